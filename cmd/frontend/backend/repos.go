@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"os"
 	"strings"
 	"time"
 
@@ -22,6 +23,7 @@ import (
 	"github.com/sourcegraph/sourcegraph/pkg/repoupdater"
 	"github.com/sourcegraph/sourcegraph/pkg/repoupdater/protocol"
 	"github.com/sourcegraph/sourcegraph/pkg/vcs/git"
+	"github.com/sourcegraph/sourcegraph/pkg/vcs/util"
 	log15 "gopkg.in/inconshreveable/log15.v2"
 )
 
@@ -40,6 +42,8 @@ var Repos = &repos{}
 
 type repos struct{}
 
+// Get retrieves the repository with the given ID. Reading from the database is retried if it fails with a
+// transient error (see retryRead).
 func (s *repos) Get(ctx context.Context, repo api.RepoID) (_ *types.Repo, err error) {
 	if Mocks.Repos.Get != nil {
 		return Mocks.Repos.Get(ctx, repo)
@@ -48,12 +52,19 @@ func (s *repos) Get(ctx context.Context, repo api.RepoID) (_ *types.Repo, err er
 	ctx, done := trace(ctx, "Repos", "Get", repo, &err)
 	defer done()
 
-	return db.Repos.Get(ctx, repo)
+	var r *types.Repo
+	err = retryRead(ctx, func() (err error) {
+		r, err = db.Repos.Get(ctx, repo)
+		return err
+	})
+	return r, err
 }
 
 // GetByName retrieves the repository with the given name. If the name refers to a repository on a known external
 // service (such as a code host) that is not yet present in the database, it will automatically look up the
 // repository externally and add it to the database before returning it.
+//
+// Like Get, it retries reading from the database if that fails with a transient error (see retryRead).
 func (s *repos) GetByName(ctx context.Context, name api.RepoName) (_ *types.Repo, err error) {
 	if Mocks.Repos.GetByName != nil {
 		return Mocks.Repos.GetByName(ctx, name)
@@ -62,8 +73,15 @@ func (s *repos) GetByName(ctx context.Context, name api.RepoName) (_ *types.Repo
 	ctx, done := trace(ctx, "Repos", "GetByName", name, &err)
 	defer done()
 
-	repo, err := db.Repos.GetByName(ctx, name)
-	if err != nil && envvar.SourcegraphDotComMode() {
+	var repo *types.Repo
+	err = retryRead(ctx, func() (err error) {
+		repo, err = db.Repos.GetByName(ctx, name)
+		return err
+	})
+	if err != nil && isTransientDBError(err) {
+		// Don't mistake a database outage for a missing repository.
+		return nil, err
+	} else if err != nil && envvar.SourcegraphDotComMode() {
 		// Automatically add repositories on Sourcegraph.com.
 		if err := s.AddGitHubDotComRepository(ctx, name); err != nil {
 			return nil, err
@@ -135,6 +153,12 @@ func (s *repos) Upsert(ctx context.Context, op api.InsertRepoOp) error {
 	return db.Repos.Upsert(ctx, op)
 }
 
+// UpsertCreated is like Upsert, but also reports whether the repository was
+// newly created.
+func (s *repos) UpsertCreated(ctx context.Context, op api.InsertRepoOp) (created bool, err error) {
+	return db.Repos.UpsertCreated(ctx, op)
+}
+
 func (s *repos) List(ctx context.Context, opt db.ReposListOptions) (repos []*types.Repo, err error) {
 	if Mocks.Repos.List != nil {
 		return Mocks.Repos.List(ctx, opt)
@@ -152,6 +176,29 @@ func (s *repos) List(ctx context.Context, opt db.ReposListOptions) (repos []*typ
 	return db.Repos.List(ctx, opt)
 }
 
+// ForEach calls fn for each repository matching opt without holding them all
+// in memory at once. See db.Repos.ForEach.
+func (s *repos) ForEach(ctx context.Context, opt db.ReposListOptions, fn func(*types.Repo) error) (err error) {
+	if Mocks.Repos.ForEach != nil {
+		return Mocks.Repos.ForEach(ctx, opt, fn)
+	}
+
+	var n int
+	ctx, done := trace(ctx, "Repos", "ForEach", opt, &err)
+	defer func() {
+		if err == nil {
+			span := opentracing.SpanFromContext(ctx)
+			span.LogFields(otlog.Int("result.len", n))
+		}
+		done()
+	}()
+
+	return db.Repos.ForEach(ctx, opt, func(repo *types.Repo) error {
+		n++
+		return fn(repo)
+	})
+}
+
 var inventoryCache = rcache.New("inv")
 
 func (s *repos) GetInventory(ctx context.Context, repo *types.Repo, commitID api.CommitID) (res *inventory.Inventory, err error) {
@@ -171,13 +218,8 @@ func (s *repos) GetInventory(ctx context.Context, repo *types.Repo, commitID api
 	}
 
 	// Try cache first
-	cacheKey := fmt.Sprintf("%s:%s", repo.Name, commitID)
-	if b, ok := inventoryCache.Get(cacheKey); ok {
-		var inv inventory.Inventory
-		if err := json.Unmarshal(b, &inv); err == nil {
-			return &inv, nil
-		}
-		log15.Warn("Repos.GetInventory failed to unmarshal cached JSON inventory", "repo", repo.Name, "commitID", commitID, "err", err)
+	if inv, ok := cachedInventory(repo, commitID); ok {
+		return inv, nil
 	}
 
 	// Not found in the cache, so compute it.
@@ -191,11 +233,118 @@ func (s *repos) GetInventory(ctx context.Context, repo *types.Repo, commitID api
 	if err != nil {
 		return nil, err
 	}
-	inventoryCache.Set(cacheKey, b)
+	inventoryCache.Set(inventoryCacheKey(repo, commitID), b)
+
+	return inv, nil
+}
+
+func inventoryCacheKey(repo *types.Repo, commitID api.CommitID) string {
+	return fmt.Sprintf("%s:%s", repo.Name, commitID)
+}
+
+// GetInventoryByPath returns the inventory of the subtree at path (such as a
+// top-level directory of a monorepo) in repo at commitID. An empty path
+// refers to the whole repository. Like GetInventory, results are cached.
+func (s *repos) GetInventoryByPath(ctx context.Context, repo *types.Repo, commitID api.CommitID, path string) (res *inventory.Inventory, err error) {
+	if Mocks.Repos.GetInventoryByPath != nil {
+		return Mocks.Repos.GetInventoryByPath(ctx, repo, commitID, path)
+	}
+	if path == "" {
+		return s.GetInventory(ctx, repo, commitID)
+	}
+
+	ctx, done := trace(ctx, "Repos", "GetInventoryByPath", map[string]interface{}{"repo": repo.Name, "commitID": commitID, "path": path}, &err)
+	defer done()
+
+	// Cap GetInventoryByPath operation to some reasonable time.
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Minute)
+	defer cancel()
+
+	if !git.IsAbsoluteRevision(string(commitID)) {
+		return nil, errors.Errorf("non-absolute CommitID for Repos.GetInventoryByPath: %v", commitID)
+	}
+
+	key := inventoryCacheKey(repo, commitID) + ":" + path
+	if b, ok := inventoryCache.Get(key); ok {
+		var inv inventory.Inventory
+		err := json.Unmarshal(b, &inv)
+		if err == nil {
+			return &inv, nil
+		}
+		log15.Warn("Repos.GetInventoryByPath failed to unmarshal cached JSON inventory", "repo", repo.Name, "commitID", commitID, "path", path, "err", err)
+	}
+
+	cachedRepo, err := CachedGitRepo(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	files, err := git.ReadDir(ctx, *cachedRepo, commitID, path, true)
+	if err != nil {
+		return nil, err
+	}
+	inv, err := inventory.Get(ctx, files)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(inv)
+	if err != nil {
+		return nil, err
+	}
+	inventoryCache.Set(key, b)
 
 	return inv, nil
 }
 
+// cachedInventory returns the inventory of repo at commitID if it is present in
+// the cache.
+func cachedInventory(repo *types.Repo, commitID api.CommitID) (*inventory.Inventory, bool) {
+	b, ok := inventoryCache.Get(inventoryCacheKey(repo, commitID))
+	if !ok {
+		return nil, false
+	}
+	var inv inventory.Inventory
+	if err := json.Unmarshal(b, &inv); err != nil {
+		log15.Warn("Repos.GetInventory failed to unmarshal cached JSON inventory", "repo", repo.Name, "commitID", commitID, "err", err)
+		return nil, false
+	}
+	return &inv, true
+}
+
+// HasCachedInventory reports whether the inventory of repo at commitID is
+// present in the cache.
+func (s *repos) HasCachedInventory(repo *types.Repo, commitID api.CommitID) bool {
+	if Mocks.Repos.HasCachedInventory != nil {
+		return Mocks.Repos.HasCachedInventory(repo, commitID)
+	}
+	_, ok := inventoryCache.Get(inventoryCacheKey(repo, commitID))
+	return ok
+}
+
+// GetLanguageBytes returns the total size of the files written in the language
+// lang in repo at commitID. It is read from the repository's inventory (see
+// GetInventory), so the first call for a commit computes and caches the full
+// inventory, and later calls (for any language) are cheap.
+func (s *repos) GetLanguageBytes(ctx context.Context, repo *types.Repo, commitID api.CommitID, lang string) (_ uint64, err error) {
+	if Mocks.Repos.GetLanguageBytes != nil {
+		return Mocks.Repos.GetLanguageBytes(ctx, repo, commitID, lang)
+	}
+
+	ctx, done := trace(ctx, "Repos", "GetLanguageBytes", map[string]interface{}{"repo": repo.Name, "commitID": commitID, "lang": lang}, &err)
+	defer done()
+
+	inv, err := s.GetInventory(ctx, repo, commitID)
+	if err != nil {
+		return 0, err
+	}
+	for _, l := range inv.Languages {
+		if l.Name == lang {
+			return l.TotalBytes, nil
+		}
+	}
+	return 0, nil
+}
+
 func (s *repos) GetInventoryUncached(ctx context.Context, repo *types.Repo, commitID api.CommitID) (res *inventory.Inventory, err error) {
 	if Mocks.Repos.GetInventoryUncached != nil {
 		return Mocks.Repos.GetInventoryUncached(ctx, repo, commitID)
@@ -215,3 +364,65 @@ func (s *repos) GetInventoryUncached(ctx context.Context, repo *types.Repo, comm
 	}
 	return inventory.Get(ctx, files)
 }
+
+// InventoryLimits bounds the work done by GetInventoryUncachedWithLimits. A
+// zero value means no limit.
+type InventoryLimits struct {
+	Timeout  time.Duration // maximum time spent listing files
+	MaxFiles int           // maximum number of files inventoried
+}
+
+// errInventoryLimitReached stops the file listing of
+// GetInventoryUncachedWithLimits once InventoryLimits.MaxFiles is reached.
+var errInventoryLimitReached = errors.New("inventory file limit reached")
+
+// GetInventoryUncachedWithLimits is like GetInventoryUncached, but it stops
+// listing files once one of the limits is hit. It then returns the inventory
+// of the files listed so far, and truncated is true.
+func (s *repos) GetInventoryUncachedWithLimits(ctx context.Context, repo *types.Repo, commitID api.CommitID, limits InventoryLimits) (res *inventory.Inventory, truncated bool, err error) {
+	if Mocks.Repos.GetInventoryUncachedWithLimits != nil {
+		return Mocks.Repos.GetInventoryUncachedWithLimits(ctx, repo, commitID, limits)
+	}
+
+	ctx, done := trace(ctx, "Repos", "GetInventoryUncachedWithLimits", map[string]interface{}{"repo": repo.Name, "commitID": commitID, "limits": limits}, &err)
+	defer done()
+
+	cachedRepo, err := CachedGitRepo(ctx, repo)
+	if err != nil {
+		return nil, false, err
+	}
+
+	listCtx := ctx
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		listCtx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		defer cancel()
+	}
+	// Only files matter for the inventory. Streaming the tree (instead of
+	// using ReadDir) is what makes it possible to stop early.
+	var files []os.FileInfo
+	err = git.ForEachTreeEntry(listCtx, *cachedRepo, commitID, "", func(e git.TreeEntry) error {
+		if e.Type != "blob" {
+			return nil
+		}
+		if limits.MaxFiles > 0 && len(files) >= limits.MaxFiles {
+			return errInventoryLimitReached
+		}
+		files = append(files, &util.FileInfo{Name_: e.Path, Size_: e.Size})
+		return nil
+	})
+	switch {
+	case err == errInventoryLimitReached:
+		truncated = true
+	case err != nil && listCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil:
+		truncated = true
+	case err != nil:
+		return nil, false, err
+	}
+
+	inv, err := inventory.Get(ctx, files)
+	if err != nil {
+		return nil, false, err
+	}
+	return inv, truncated, nil
+}
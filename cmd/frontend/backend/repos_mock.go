@@ -15,14 +15,19 @@ import (
 )
 
 type MockRepos struct {
-	Get                       func(v0 context.Context, id api.RepoID) (*types.Repo, error)
-	GetByName                 func(v0 context.Context, name api.RepoName) (*types.Repo, error)
-	AddGitHubDotComRepository func(name api.RepoName) error
-	List                      func(v0 context.Context, v1 db.ReposListOptions) ([]*types.Repo, error)
-	GetCommit                 func(v0 context.Context, repo *types.Repo, commitID api.CommitID) (*git.Commit, error)
-	ResolveRev                func(v0 context.Context, repo *types.Repo, rev string) (api.CommitID, error)
-	GetInventory              func(v0 context.Context, repo *types.Repo, commitID api.CommitID) (*inventory.Inventory, error)
-	GetInventoryUncached      func(ctx context.Context, repo *types.Repo, commitID api.CommitID) (*inventory.Inventory, error)
+	Get                            func(v0 context.Context, id api.RepoID) (*types.Repo, error)
+	GetByName                      func(v0 context.Context, name api.RepoName) (*types.Repo, error)
+	AddGitHubDotComRepository      func(name api.RepoName) error
+	List                           func(v0 context.Context, v1 db.ReposListOptions) ([]*types.Repo, error)
+	ForEach                        func(ctx context.Context, opt db.ReposListOptions, fn func(*types.Repo) error) error
+	GetCommit                      func(v0 context.Context, repo *types.Repo, commitID api.CommitID) (*git.Commit, error)
+	ResolveRev                     func(v0 context.Context, repo *types.Repo, rev string) (api.CommitID, error)
+	GetInventory                   func(v0 context.Context, repo *types.Repo, commitID api.CommitID) (*inventory.Inventory, error)
+	GetInventoryByPath             func(ctx context.Context, repo *types.Repo, commitID api.CommitID, path string) (*inventory.Inventory, error)
+	GetInventoryUncached           func(ctx context.Context, repo *types.Repo, commitID api.CommitID) (*inventory.Inventory, error)
+	GetInventoryUncachedWithLimits func(ctx context.Context, repo *types.Repo, commitID api.CommitID, limits InventoryLimits) (*inventory.Inventory, bool, error)
+	GetLanguageBytes               func(ctx context.Context, repo *types.Repo, commitID api.CommitID, lang string) (uint64, error)
+	HasCachedInventory             func(repo *types.Repo, commitID api.CommitID) bool
 }
 
 var errRepoNotFound = &errcode.Mock{
@@ -0,0 +1,73 @@
+package backend
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/sourcegraph/pkg/errcode"
+)
+
+// readRetryAttempts is the maximum number of times an idempotent read is
+// attempted by retryRead.
+const readRetryAttempts = 3
+
+// readRetryBackoff is the delay before the first retry in retryRead. It
+// doubles for every subsequent retry.
+var readRetryBackoff = 50 * time.Millisecond
+
+// retryRead calls f until it succeeds, it fails with an error that is not
+// transient (see isTransientDBError), or readRetryAttempts attempts have been
+// made. It must only be used for idempotent reads.
+//
+// It never sleeps past ctx's deadline: if the next attempt could not start
+// before then, the last error is returned immediately so that retrying does
+// not extend a request that is about to time out anyway.
+func retryRead(ctx context.Context, f func() error) error {
+	backoff := readRetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || attempt == readRetryAttempts || !isTransientDBError(err) {
+			return err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(backoff).After(deadline) {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// isTransientDBError reports whether err is likely caused by a brief loss of
+// the database connection (such as during a failover), so that retrying the
+// operation may succeed. Not-found errors are never transient.
+func isTransientDBError(err error) bool {
+	if err == nil || errcode.IsNotFound(err) {
+		return false
+	}
+	err = errors.Cause(err)
+	switch err {
+	case driver.ErrBadConn, io.EOF, io.ErrUnexpectedEOF:
+		return true
+	case context.Canceled, context.DeadlineExceeded:
+		return false
+	}
+	if pqErr, ok := err.(*pq.Error); ok {
+		// Class 08 is "connection exception"; 57P01-57P03 are raised while the
+		// server is shutting down or starting up.
+		return pqErr.Code.Class() == "08" || pqErr.Code == "57P01" || pqErr.Code == "57P02" || pqErr.Code == "57P03"
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	return strings.Contains(err.Error(), "connection refused") || strings.Contains(err.Error(), "connection reset by peer")
+}
@@ -0,0 +1,69 @@
+package backend
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sourcegraph/sourcegraph/pkg/errcode"
+)
+
+func TestRetryRead(t *testing.T) {
+	defer func(d time.Duration) { readRetryBackoff = d }(readRetryBackoff)
+	readRetryBackoff = time.Millisecond
+
+	notFound := &errcode.Mock{Message: "not found", IsNotFound: true}
+	tests := map[string]struct {
+		errs         []error
+		wantErr      error
+		wantAttempts int
+	}{
+		"success":            {errs: []error{nil}, wantAttempts: 1},
+		"transient then ok":  {errs: []error{driver.ErrBadConn, nil}, wantAttempts: 2},
+		"persistent":         {errs: []error{driver.ErrBadConn, driver.ErrBadConn, driver.ErrBadConn, nil}, wantErr: driver.ErrBadConn, wantAttempts: readRetryAttempts},
+		"not found":          {errs: []error{notFound, nil}, wantErr: notFound, wantAttempts: 1},
+		"other error":        {errs: []error{errors.New("syntax error"), nil}, wantErr: errors.New("syntax error"), wantAttempts: 1},
+		"admin shutdown":     {errs: []error{&pq.Error{Code: "57P01"}, nil}, wantAttempts: 2},
+		"connection failure": {errs: []error{&pq.Error{Code: "08006"}, nil}, wantAttempts: 2},
+		"unique violation":   {errs: []error{&pq.Error{Code: "23505"}, nil}, wantErr: &pq.Error{Code: "23505"}, wantAttempts: 1},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			attempts := 0
+			err := retryRead(context.Background(), func() error {
+				err := test.errs[attempts]
+				attempts++
+				return err
+			})
+			if (err == nil) != (test.wantErr == nil) || (err != nil && err.Error() != test.wantErr.Error()) {
+				t.Errorf("got error %v, want %v", err, test.wantErr)
+			}
+			if attempts != test.wantAttempts {
+				t.Errorf("got %d attempts, want %d", attempts, test.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryRead_deadline(t *testing.T) {
+	defer func(d time.Duration) { readRetryBackoff = d }(readRetryBackoff)
+	readRetryBackoff = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	attempts := 0
+	err := retryRead(ctx, func() error {
+		attempts++
+		return driver.ErrBadConn
+	})
+	if err != driver.ErrBadConn {
+		t.Errorf("got error %v, want %v", err, driver.ErrBadConn)
+	}
+	if attempts != 1 {
+		t.Errorf("got %d attempts, want 1 (the backoff exceeds the deadline)", attempts)
+	}
+}
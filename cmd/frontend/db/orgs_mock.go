@@ -13,6 +13,8 @@ type MockOrgs struct {
 	GetByName func(ctx context.Context, name string) (*types.Org, error)
 	Count     func(ctx context.Context, opt OrgsListOptions) (int, error)
 	List      func(ctx context.Context, opt *OrgsListOptions) ([]*types.Org, error)
+
+	GetByUserID func(ctx context.Context, userID int32) ([]*types.Org, error)
 }
 
 func (s *MockOrgs) MockGetByID_Return(t *testing.T, returns *types.Org, returnsErr error) (called *bool) {
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/sourcegraph/pkg/api"
+	"github.com/sourcegraph/sourcegraph/pkg/db/dbconn"
+)
+
+// repoKVPs stores arbitrary key-value pairs that integrations attach to
+// repositories. Values are opaque to Sourcegraph.
+type repoKVPs struct{}
+
+// Get returns the key-value pairs of the repository. If key is non-empty,
+// only the pair with that key (if any) is returned.
+func (*repoKVPs) Get(ctx context.Context, repo api.RepoID, key string) (map[string]string, error) {
+	q := "SELECT key, value FROM repo_kvps WHERE repo_id=$1"
+	args := []interface{}{repo}
+	if key != "" {
+		q += " AND key=$2"
+		args = append(args, key)
+	}
+	rows, err := dbconn.Global.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Query")
+	}
+	defer rows.Close()
+
+	kvps := map[string]string{}
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, errors.Wrap(err, "Scan")
+		}
+		kvps[k] = v
+	}
+	return kvps, rows.Err()
+}
+
+// Set sets the value of key for the repository. An empty value deletes the
+// key.
+func (*repoKVPs) Set(ctx context.Context, repo api.RepoID, key, value string) error {
+	if key == "" {
+		return errors.New("empty repo metadata key")
+	}
+	if value == "" {
+		_, err := dbconn.Global.ExecContext(ctx, "DELETE FROM repo_kvps WHERE repo_id=$1 AND key=$2", repo, key)
+		return err
+	}
+	_, err := dbconn.Global.ExecContext(ctx, `
+INSERT INTO repo_kvps(repo_id, key, value) VALUES($1, $2, $3)
+ON CONFLICT (repo_id, key) DO UPDATE SET value=excluded.value`,
+		repo, key, value,
+	)
+	return err
+}
@@ -0,0 +1,43 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/types"
+	"github.com/sourcegraph/sourcegraph/pkg/db/dbtesting"
+)
+
+func TestRepoKVPs(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+	ctx := dbtesting.TestContext(t)
+
+	repo := mustCreate(ctx, t, &types.Repo{Name: "r"})[0]
+
+	for _, kv := range [][2]string{{"scan:enabled", "true"}, {"owner", "a"}, {"owner", "b"}} {
+		if err := RepoKVPs.Set(ctx, repo.ID, kv[0], kv[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	kvps, err := RepoKVPs.Get(ctx, repo.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"scan:enabled": "true", "owner": "b"}; !reflect.DeepEqual(kvps, want) {
+		t.Errorf("got %v, want %v", kvps, want)
+	}
+
+	// An empty value deletes the key.
+	if err := RepoKVPs.Set(ctx, repo.ID, "owner", ""); err != nil {
+		t.Fatal(err)
+	}
+	kvps, err = RepoKVPs.Get(ctx, repo.ID, "owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kvps) != 0 {
+		t.Errorf("got %v, want no pairs", kvps)
+	}
+}
@@ -6,8 +6,12 @@ import (
 	"fmt"
 	regexpsyntax "regexp/syntax"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/keegancsmith/sqlf"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/authz"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/db/query"
@@ -15,6 +19,7 @@ import (
 	"github.com/sourcegraph/sourcegraph/pkg/api"
 	"github.com/sourcegraph/sourcegraph/pkg/conf"
 	"github.com/sourcegraph/sourcegraph/pkg/db/dbconn"
+	"github.com/sourcegraph/sourcegraph/pkg/db/dbutil"
 	"github.com/sourcegraph/sourcegraph/pkg/trace"
 )
 
@@ -38,7 +43,9 @@ func (e *repoNotFoundErr) NotFound() bool {
 }
 
 // repos is a DB-backed implementation of the Repos
-type repos struct{}
+type repos struct {
+	enabledNames enabledNamesCache
+}
 
 // Get returns metadata for the request repository ID. It fetches data
 // only from the database and NOT from any external sources. If the
@@ -50,7 +57,7 @@ func (s *repos) Get(ctx context.Context, id api.RepoID) (*types.Repo, error) {
 		return Mocks.Repos.Get(ctx, id)
 	}
 
-	repos, err := s.getBySQL(ctx, sqlf.Sprintf("id=%d LIMIT 1", id))
+	repos, err := s.getBySQL(ctx, sqlf.Sprintf("id=%d AND deleted_at IS NULL LIMIT 1", id))
 	if err != nil {
 		return nil, err
 	}
@@ -70,7 +77,7 @@ func (s *repos) GetByName(ctx context.Context, name api.RepoName) (*types.Repo,
 		return Mocks.Repos.GetByName(ctx, name)
 	}
 
-	repos, err := s.getBySQL(ctx, sqlf.Sprintf("name=%s LIMIT 1", name))
+	repos, err := s.getBySQL(ctx, sqlf.Sprintf("name=%s AND deleted_at IS NULL LIMIT 1", name))
 	if err != nil {
 		return nil, err
 	}
@@ -81,6 +88,76 @@ func (s *repos) GetByName(ctx context.Context, name api.RepoName) (*types.Repo,
 	return repos[0], nil
 }
 
+// Exists reports whether a (non-deleted) repository with the given name
+// exists. It is cheaper than GetByName when the repository itself is not
+// needed.
+func (s *repos) Exists(ctx context.Context, name api.RepoName) (bool, error) {
+	if Mocks.Repos.Exists != nil {
+		return Mocks.Repos.Exists(ctx, name)
+	}
+
+	var exists bool
+	err := dbconn.Global.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM repo WHERE name=$1 AND deleted_at IS NULL)", name).Scan(&exists)
+	return exists, err
+}
+
+// Touch sets the updated_at time of the repository to the current time
+// without changing anything else, so that it is included in incremental
+// syncs (see ReposListOptions.UpdatedAfter). It returns the new updated_at
+// time.
+func (s *repos) Touch(ctx context.Context, id api.RepoID) (time.Time, error) {
+	if Mocks.Repos.Touch != nil {
+		return Mocks.Repos.Touch(ctx, id)
+	}
+
+	var updatedAt time.Time
+	err := dbconn.Global.QueryRowContext(ctx, "UPDATE repo SET updated_at=now() WHERE id=$1 AND deleted_at IS NULL RETURNING updated_at", id).Scan(&updatedAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, &repoNotFoundErr{ID: id}
+	}
+	return updatedAt, err
+}
+
+// GetIDsByExternalRepos returns the IDs of the (non-deleted) repositories
+// identified by specs, in a single query. Specs that match no repository are
+// absent from the result.
+func (s *repos) GetIDsByExternalRepos(ctx context.Context, specs []api.ExternalRepoSpec) (map[api.ExternalRepoSpec]api.RepoID, error) {
+	if Mocks.Repos.GetIDsByExternalRepos != nil {
+		return Mocks.Repos.GetIDsByExternalRepos(ctx, specs)
+	}
+
+	ids := make([]string, len(specs))
+	serviceTypes := make([]string, len(specs))
+	serviceIDs := make([]string, len(specs))
+	for i, spec := range specs {
+		ids[i], serviceTypes[i], serviceIDs[i] = spec.ID, spec.ServiceType, spec.ServiceID
+	}
+	q := sqlf.Sprintf(`
+		SELECT r.id, r.external_id, r.external_service_type, r.external_service_id FROM repo r
+		JOIN unnest(%s::text[], %s::text[], %s::text[]) AS s(external_id, external_service_type, external_service_id)
+		ON r.external_id = s.external_id AND r.external_service_type = s.external_service_type AND r.external_service_id = s.external_service_id
+		WHERE r.deleted_at IS NULL`,
+		pq.Array(ids), pq.Array(serviceTypes), pq.Array(serviceIDs))
+	rows, err := dbconn.Global.QueryContext(ctx, q.Query(sqlf.PostgresBindVar), q.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make(map[api.ExternalRepoSpec]api.RepoID, len(specs))
+	for rows.Next() {
+		var (
+			id   api.RepoID
+			spec api.ExternalRepoSpec
+		)
+		if err := rows.Scan(&id, &spec.ID, &spec.ServiceType, &spec.ServiceID); err != nil {
+			return nil, err
+		}
+		res[spec] = id
+	}
+	return res, rows.Err()
+}
+
 func (s *repos) Count(ctx context.Context, opt ReposListOptions) (int, error) {
 	if Mocks.Repos.Count != nil {
 		return Mocks.Repos.Count(ctx, opt)
@@ -100,11 +177,13 @@ func (s *repos) Count(ctx context.Context, opt ReposListOptions) (int, error) {
 	return count, nil
 }
 
+// getRepoByQueryFmtstr selects repositories matching a condition. Unless the
+// condition excludes them, this includes deleted repositories.
 const getRepoByQueryFmtstr = `
 SELECT id, name, description, language, enabled, created_at,
-  updated_at, external_id, external_service_type, external_service_id
+  updated_at, deleted_at, external_id, external_service_type, external_service_id
 FROM repo
-WHERE deleted_at IS NULL AND %s`
+WHERE %s`
 
 func (s *repos) getBySQL(ctx context.Context, querySuffix *sqlf.Query) ([]*types.Repo, error) {
 	q := sqlf.Sprintf(getRepoByQueryFmtstr, querySuffix)
@@ -116,25 +195,11 @@ func (s *repos) getBySQL(ctx context.Context, querySuffix *sqlf.Query) ([]*types
 
 	var repos []*types.Repo
 	for rows.Next() {
-		var repo types.Repo
-		var spec dbExternalRepoSpec
-
-		if err := rows.Scan(
-			&repo.ID,
-			&repo.Name,
-			&repo.Description,
-			&repo.Language,
-			&repo.Enabled,
-			&repo.CreatedAt,
-			&repo.UpdatedAt,
-			&spec.id, &spec.serviceType, &spec.serviceID,
-		); err != nil {
+		repo, err := scanRepo(rows)
+		if err != nil {
 			return nil, err
 		}
-
-		repo.ExternalRepo = spec.toAPISpec()
-
-		repos = append(repos, &repo)
+		repos = append(repos, repo)
 	}
 	if err = rows.Err(); err != nil {
 		return nil, err
@@ -144,6 +209,29 @@ func (s *repos) getBySQL(ctx context.Context, querySuffix *sqlf.Query) ([]*types
 	return authzFilter(ctx, repos, authz.Read)
 }
 
+// scanRepo scans a row of a query built from getRepoByQueryFmtstr.
+func scanRepo(rows *sql.Rows) (*types.Repo, error) {
+	var repo types.Repo
+	var spec dbExternalRepoSpec
+
+	if err := rows.Scan(
+		&repo.ID,
+		&repo.Name,
+		&repo.Description,
+		&repo.Language,
+		&repo.Enabled,
+		&repo.CreatedAt,
+		&repo.UpdatedAt,
+		&repo.DeletedAt,
+		&spec.id, &spec.serviceType, &spec.serviceID,
+	); err != nil {
+		return nil, err
+	}
+
+	repo.ExternalRepo = spec.toAPISpec()
+	return &repo, nil
+}
+
 // ReposListOptions specifies the options for listing repositories.
 //
 // Query and IncludePatterns/ExcludePatterns may not be used together.
@@ -182,12 +270,33 @@ type ReposListOptions struct {
 	// OnlyArchived excludes non-archived repositories from the list.
 	OnlyArchived bool
 
+	// ExternalServiceIDs, if non-empty, only includes repositories that reside
+	// on one of these external service instances (see
+	// api.ExternalRepoSpec.ServiceID).
+	ExternalServiceIDs []string
+
 	// Index when set will only include repositories which should be indexed
 	// if true. If false it will exclude repositories which should be
 	// indexed. An example use case of this is for indexed search only
 	// indexing a subset of repositories.
 	Index *bool
 
+	// UpdatedAfter, if set, only includes repositories whose metadata was last
+	// updated after this time. Together with UpdatedAfterID and ordering by
+	// RepoListUpdatedAt and RepoListID, it can be used as a cursor for
+	// incrementally syncing repository metadata.
+	UpdatedAfter *time.Time
+
+	// UpdatedAfterID, if UpdatedAfter is set, additionally includes
+	// repositories updated exactly at UpdatedAfter whose ID is greater than
+	// UpdatedAfterID.
+	UpdatedAfterID api.RepoID
+
+	// IncludeDeleted includes deleted repositories (whose DeletedAt is set)
+	// in the list. Deleting a repository updates its updated_at, so with
+	// UpdatedAfter this tells incremental syncs which repositories to drop.
+	IncludeDeleted bool
+
 	// List of fields by which to order the return repositories.
 	OrderBy RepoListOrderBy
 
@@ -227,6 +336,8 @@ type RepoListColumn string
 const (
 	RepoListCreatedAt RepoListColumn = "created_at"
 	RepoListName      RepoListColumn = "name"
+	RepoListUpdatedAt RepoListColumn = "updated_at"
+	RepoListID        RepoListColumn = "id"
 )
 
 // List lists repositories in the Sourcegraph repository
@@ -260,11 +371,92 @@ func (s *repos) List(ctx context.Context, opt ReposListOptions) (results []*type
 	return rawRepos, nil
 }
 
+// forEachBatchSize is the number of repositories ForEach reads from the
+// database before checking their permissions and passing them on.
+const forEachBatchSize = 500
+
+// ForEach calls fn for each repository matching opt, in the same order as
+// List would return them. Unlike List, it never holds more than a small batch
+// of repositories in memory, so it is suitable for listing all repositories
+// on large instances. If fn returns an error, ForEach stops and returns it.
+//
+// The database query stays open while fn is called, so fn should not block
+// for long.
+func (s *repos) ForEach(ctx context.Context, opt ReposListOptions, fn func(*types.Repo) error) (err error) {
+	tr, ctx := trace.New(ctx, "repos.ForEach", "")
+	defer func() {
+		tr.SetError(err)
+		tr.Finish()
+	}()
+
+	if Mocks.Repos.ForEach != nil {
+		return Mocks.Repos.ForEach(ctx, opt, fn)
+	}
+
+	conds, err := s.listSQL(opt)
+	if err != nil {
+		return err
+	}
+
+	fetchSQL := sqlf.Sprintf("%s %s %s", sqlf.Join(conds, "AND"), opt.OrderBy.SQL(), opt.LimitOffset.SQL())
+	q := sqlf.Sprintf(getRepoByQueryFmtstr, fetchSQL)
+	rows, err := dbconn.Global.QueryContext(ctx, q.Query(sqlf.PostgresBindVar), q.Args()...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	batch := make([]*types.Repo, 0, forEachBatchSize)
+	flush := func() error {
+		// 🚨 SECURITY: This enforces repository permissions
+		repos, err := authzFilter(ctx, batch, authz.Read)
+		if err != nil {
+			return err
+		}
+		for _, repo := range repos {
+			if err := fn(repo); err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+	for rows.Next() {
+		repo, err := scanRepo(rows)
+		if err != nil {
+			return err
+		}
+		batch = append(batch, repo)
+		if len(batch) == forEachBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
 // ListEnabledNames returns a list of all enabled repo names. This is commonly
 // requested information by other services (repo-updater and
 // indexed-search). We special case just returning enabled names so that we
 // read much less data into memory.
+//
+// The result is cached for a short time (see enabledNamesTTL) and must not be
+// modified by the caller.
 func (s *repos) ListEnabledNames(ctx context.Context) ([]string, error) {
+	return s.enabledNames.get(ctx, enabledNamesTTL, s.listEnabledNames)
+}
+
+// InvalidateEnabledNames drops the cached result of ListEnabledNames. It is
+// called whenever this process enables, disables, adds or deletes a repo.
+func (s *repos) InvalidateEnabledNames() {
+	s.enabledNames.invalidate()
+}
+
+func (s *repos) listEnabledNames(ctx context.Context) ([]string, error) {
 	q := sqlf.Sprintf("SELECT name FROM repo WHERE enabled = true AND deleted_at IS NULL")
 	rows, err := dbconn.Global.QueryContext(ctx, q.Query(sqlf.PostgresBindVar), q.Args()...)
 	if err != nil {
@@ -287,6 +479,42 @@ func (s *repos) ListEnabledNames(ctx context.Context) ([]string, error) {
 	return names, nil
 }
 
+// LanguageStats returns the number of repositories per primary language.
+// Repositories without a known language are not counted. If enabledOnly is
+// true, only enabled repositories are counted.
+//
+// 🚨 SECURITY: This does not enforce repository permissions; it must only be
+// used to expose aggregate counts to internal callers.
+func (s *repos) LanguageStats(ctx context.Context, enabledOnly bool) (map[string]int, error) {
+	conds := []*sqlf.Query{
+		sqlf.Sprintf("deleted_at IS NULL"),
+		sqlf.Sprintf("language IS NOT NULL"),
+		sqlf.Sprintf("language <> ''"),
+	}
+	if enabledOnly {
+		conds = append(conds, sqlf.Sprintf("enabled"))
+	}
+	q := sqlf.Sprintf("SELECT language, COUNT(*) FROM repo WHERE %s GROUP BY language", sqlf.Join(conds, "AND"))
+	rows, err := dbconn.Global.QueryContext(ctx, q.Query(sqlf.PostgresBindVar), q.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := map[string]int{}
+	for rows.Next() {
+		var (
+			language string
+			count    int
+		)
+		if err := rows.Scan(&language, &count); err != nil {
+			return nil, err
+		}
+		stats[language] = count
+	}
+	return stats, rows.Err()
+}
+
 func parsePattern(p string) ([]*sqlf.Query, error) {
 	exact, like, pattern, err := parseIncludePattern(p)
 	if err != nil {
@@ -318,8 +546,8 @@ func parsePattern(p string) ([]*sqlf.Query, error) {
 }
 
 func (*repos) listSQL(opt ReposListOptions) (conds []*sqlf.Query, err error) {
-	conds = []*sqlf.Query{
-		sqlf.Sprintf("deleted_at IS NULL"),
+	if !opt.IncludeDeleted {
+		conds = append(conds, sqlf.Sprintf("deleted_at IS NULL"))
 	}
 	if opt.Query != "" && (len(opt.IncludePatterns) > 0 || opt.ExcludePattern != "") {
 		return nil, errors.New("Repos.List: Query and IncludePatterns/ExcludePattern options are mutually exclusive")
@@ -379,6 +607,13 @@ func (*repos) listSQL(opt ReposListOptions) (conds []*sqlf.Query, err error) {
 	if opt.OnlyArchived {
 		conds = append(conds, sqlf.Sprintf("archived"))
 	}
+	if len(opt.ExternalServiceIDs) > 0 {
+		conds = append(conds, sqlf.Sprintf("external_service_id = ANY(%s)", pq.Array(opt.ExternalServiceIDs)))
+	}
+
+	if opt.UpdatedAfter != nil {
+		conds = append(conds, sqlf.Sprintf("(updated_at > %s OR (updated_at = %s AND id > %d))", *opt.UpdatedAfter, *opt.UpdatedAfter, opt.UpdatedAfterID))
+	}
 
 	if opt.Index != nil {
 		// We don't currently have an index column, but when we want the
@@ -390,6 +625,9 @@ func (*repos) listSQL(opt ReposListOptions) (conds []*sqlf.Query, err error) {
 		}
 	}
 
+	if len(conds) == 0 {
+		conds = append(conds, sqlf.Sprintf("TRUE"))
+	}
 	return conds, nil
 }
 
@@ -550,7 +788,82 @@ func (s *repos) Delete(ctx context.Context, repo api.RepoID) error {
 		return Mocks.Repos.Delete(ctx, repo)
 	}
 
-	// Hard delete entries in the discussions tables that correspond to the repo.
+	if err := deleteRepoDiscussionThreads(ctx, repo); err != nil {
+		return err
+	}
+
+	q := sqlf.Sprintf("UPDATE repo SET deleted_at = NOW(), updated_at = NOW() WHERE id=%d", repo)
+	_, err := dbconn.Global.ExecContext(ctx, q.Query(sqlf.PostgresBindVar), q.Args()...)
+	s.InvalidateEnabledNames()
+	return err
+}
+
+// DeleteCountMismatchError is returned by DeleteMatching when the number of
+// matching repositories differs from the expected count.
+type DeleteCountMismatchError struct {
+	Expected, Actual int
+}
+
+func (e *DeleteCountMismatchError) Error() string {
+	return fmt.Sprintf("%d repositories matched, expected %d", e.Actual, e.Expected)
+}
+
+// DeleteMatching soft-deletes and disables all repositories matching opt in a
+// single transaction. It returns the number of deleted repositories.
+//
+// If expected is non-negative and a different number of repositories match,
+// nothing is deleted and a *DeleteCountMismatchError is returned. This
+// guards against deleting repositories that were added since the caller
+// counted them.
+func (s *repos) DeleteMatching(ctx context.Context, opt ReposListOptions, expected int) (int, error) {
+	if Mocks.Repos.DeleteMatching != nil {
+		return Mocks.Repos.DeleteMatching(ctx, opt, expected)
+	}
+
+	conds, err := s.listSQL(opt)
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []api.RepoID
+	err = dbutil.Transaction(ctx, dbconn.Global, func(tx *sql.Tx) error {
+		q := sqlf.Sprintf("UPDATE repo SET deleted_at=NOW(), updated_at=NOW(), enabled=false WHERE %s RETURNING id", sqlf.Join(conds, "AND"))
+		rows, err := tx.QueryContext(ctx, q.Query(sqlf.PostgresBindVar), q.Args()...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id api.RepoID
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if expected >= 0 && len(ids) != expected {
+			return &DeleteCountMismatchError{Expected: expected, Actual: len(ids)}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.InvalidateEnabledNames()
+
+	for _, id := range ids {
+		if err := deleteRepoDiscussionThreads(ctx, id); err != nil {
+			return len(ids), err
+		}
+	}
+	return len(ids), nil
+}
+
+// deleteRepoDiscussionThreads hard deletes entries in the discussions tables
+// that correspond to the repo.
+func deleteRepoDiscussionThreads(ctx context.Context, repo api.RepoID) error {
 	threads, err := DiscussionThreads.List(ctx, &DiscussionThreadsListOptions{
 		TargetRepoID: &repo,
 	})
@@ -563,18 +876,16 @@ func (s *repos) Delete(ctx context.Context, repo api.RepoID) error {
 			return err
 		}
 	}
-
-	q := sqlf.Sprintf("UPDATE repo SET deleted_at = NOW() WHERE id=%d", repo)
-	_, err = dbconn.Global.ExecContext(ctx, q.Query(sqlf.PostgresBindVar), q.Args()...)
-	return err
+	return nil
 }
 
 func (s *repos) SetEnabled(ctx context.Context, id api.RepoID, enabled bool) error {
-	q := sqlf.Sprintf("UPDATE repo SET enabled=%t WHERE id=%d", enabled, id)
+	q := sqlf.Sprintf("UPDATE repo SET enabled=%t, updated_at=now() WHERE id=%d", enabled, id)
 	res, err := dbconn.Global.ExecContext(ctx, q.Query(sqlf.PostgresBindVar), q.Args()...)
 	if err != nil {
 		return err
 	}
+	s.InvalidateEnabledNames()
 	rows, err := res.RowsAffected()
 	if err != nil {
 		return err
@@ -586,12 +897,12 @@ func (s *repos) SetEnabled(ctx context.Context, id api.RepoID, enabled bool) err
 }
 
 func (s *repos) UpdateLanguage(ctx context.Context, repo api.RepoID, language string) error {
-	_, err := dbconn.Global.ExecContext(ctx, "UPDATE repo SET language=$1 WHERE id=$2", language, repo)
+	_, err := dbconn.Global.ExecContext(ctx, "UPDATE repo SET language=$1, updated_at=now() WHERE id=$2 AND language IS DISTINCT FROM $1", language, repo)
 	return err
 }
 
 func (s *repos) UpdateRepositoryMetadata(ctx context.Context, name api.RepoName, description string, fork bool, archived bool) error {
-	_, err := dbconn.Global.ExecContext(ctx, "UPDATE repo SET description=$1, fork=$2, archived=$3 WHERE name=$4 	AND (description <> $1 OR fork <> $2 OR archived <> $3)", description, fork, archived, name)
+	_, err := dbconn.Global.ExecContext(ctx, "UPDATE repo SET description=$1, fork=$2, archived=$3, updated_at=now() WHERE name=$4 	AND (description <> $1 OR fork <> $2 OR archived <> $3)", description, fork, archived, name)
 	return err
 }
 
@@ -606,7 +917,13 @@ WITH upsert AS (
     external_id           = NULLIF(BTRIM($5), ''),
     external_service_type = NULLIF(BTRIM($6), ''),
     external_service_id   = NULLIF(BTRIM($7), ''),
-    archived              = $9
+    archived              = $9,
+    updated_at            = CASE
+      WHEN (repo.name, repo.description, repo.fork, repo.enabled, repo.external_id, repo.external_service_type, repo.external_service_id, repo.archived)
+        IS DISTINCT FROM ($1, $2, $3, $4, NULLIF(BTRIM($5), ''), NULLIF(BTRIM($6), ''), NULLIF(BTRIM($7), ''), $9)
+      THEN now()
+      ELSE repo.updated_at
+    END
   WHERE name = $1 OR (
     external_id IS NOT NULL
     AND external_service_type IS NOT NULL
@@ -630,7 +947,8 @@ INSERT INTO repo (
   external_id,
   external_service_type,
   external_service_id,
-  archived
+  archived,
+  updated_at
 ) (
   SELECT
     $1 AS name,
@@ -641,10 +959,46 @@ INSERT INTO repo (
     NULLIF(BTRIM($5), '') AS external_id,
     NULLIF(BTRIM($6), '') AS external_service_type,
     NULLIF(BTRIM($7), '') AS external_service_id,
-    $9 AS archived
+    $9 AS archived,
+    now() AS updated_at
   WHERE NOT EXISTS (SELECT 1 FROM upsert)
 )`
 
+// ValidateRepoName returns an error describing why name is not a valid name
+// for a new repository, or nil if it is valid. Upsert rejects new
+// repositories whose names are invalid.
+//
+// Repository names are not URLs: they have no scheme, and consist of
+// slash-separated path elements (usually starting with the code host, as in
+// "github.com/gorilla/mux").
+func ValidateRepoName(name api.RepoName) error {
+	s := string(name)
+	switch {
+	case s == "":
+		return errors.New("repository name is empty")
+	case !utf8.ValidString(s):
+		return errors.New("repository name is not valid UTF-8")
+	case strings.Contains(s, "://"):
+		return errors.New("repository name must not contain a URL scheme")
+	case strings.HasPrefix(s, "/") || strings.HasSuffix(s, "/"):
+		return errors.New("repository name must not begin or end with a slash")
+	}
+	for _, r := range s {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return fmt.Errorf("repository name must not contain whitespace or control characters (found %q)", r)
+		}
+	}
+	for _, elem := range strings.Split(s, "/") {
+		switch elem {
+		case "":
+			return errors.New("repository name must not contain empty path elements")
+		case ".", "..":
+			return fmt.Errorf("repository name must not contain %q path elements", elem)
+		}
+	}
+	return nil
+}
+
 // Upsert updates the repository if it already exists (keyed on name) and
 // inserts it if it does not.
 //
@@ -654,6 +1008,21 @@ func (s *repos) Upsert(ctx context.Context, op api.InsertRepoOp) error {
 		return Mocks.Repos.Upsert(op)
 	}
 
+	_, err := s.upsert(ctx, op)
+	return err
+}
+
+// UpsertCreated is like Upsert, but also reports whether the repository was
+// newly inserted (as opposed to already existing).
+func (s *repos) UpsertCreated(ctx context.Context, op api.InsertRepoOp) (created bool, err error) {
+	if Mocks.Repos.UpsertCreated != nil {
+		return Mocks.Repos.UpsertCreated(op)
+	}
+
+	return s.upsert(ctx, op)
+}
+
+func (s *repos) upsert(ctx context.Context, op api.InsertRepoOp) (created bool, err error) {
 	insert := false
 	language := ""
 	enabled := op.Enabled
@@ -666,7 +1035,10 @@ func (s *repos) Upsert(ctx context.Context, op api.InsertRepoOp) error {
 	r, err := s.GetByName(ctx, op.Name)
 	if err != nil {
 		if _, ok := err.(*repoNotFoundErr); !ok {
-			return err
+			return false, err
+		}
+		if err := ValidateRepoName(op.Name); err != nil {
+			return false, err
 		}
 		insert = true // missing
 	} else {
@@ -679,11 +1051,11 @@ func (s *repos) Upsert(ctx context.Context, op api.InsertRepoOp) error {
 	}
 
 	if !insert {
-		return nil
+		return false, nil
 	}
 
 	spec := (&dbExternalRepoSpec{}).fromAPISpec(op.ExternalRepo)
-	_, err = dbconn.Global.ExecContext(
+	res, err := dbconn.Global.ExecContext(
 		ctx,
 		upsertSQL,
 		op.Name,
@@ -696,8 +1068,18 @@ func (s *repos) Upsert(ctx context.Context, op api.InsertRepoOp) error {
 		language,
 		op.Archived,
 	)
+	s.InvalidateEnabledNames()
+	if err != nil {
+		return false, err
+	}
 
-	return err
+	// The statement only counts the rows affected by the INSERT, not by the
+	// UPDATE in the WITH clause.
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
 }
 
 // AllowEnableDisable returns true iff there are any repositories that are not
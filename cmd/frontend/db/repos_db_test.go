@@ -2,17 +2,22 @@ package db
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"reflect"
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/authz"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/db/query"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/types"
 	"github.com/sourcegraph/sourcegraph/pkg/actor"
 	"github.com/sourcegraph/sourcegraph/pkg/api"
+	"github.com/sourcegraph/sourcegraph/pkg/db/dbconn"
 	"github.com/sourcegraph/sourcegraph/pkg/db/dbtesting"
+	"github.com/sourcegraph/sourcegraph/pkg/errcode"
 )
 
 /*
@@ -81,6 +86,83 @@ func TestRepos_Get(t *testing.T) {
 	}
 }
 
+func TestRepos_Exists(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+
+	ctx := dbtesting.TestContext(t)
+
+	repos := mustCreate(ctx, t, &types.Repo{Name: "r"}, &types.Repo{Name: "deleted"})
+	if err := Repos.Delete(ctx, repos[1].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[api.RepoName]bool{"r": true, "deleted": false, "missing": false} {
+		exists, err := Repos.Exists(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists != want {
+			t.Errorf("%s: got exists %v, want %v", name, exists, want)
+		}
+	}
+}
+
+func TestRepos_Touch(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+
+	ctx := dbtesting.TestContext(t)
+
+	repo := mustCreate(ctx, t, &types.Repo{Name: "r"})[0]
+	updatedAt, err := Repos.Touch(ctx, repo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Repos.Get(ctx, repo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.UpdatedAt == nil || !got.UpdatedAt.Equal(updatedAt) {
+		t.Errorf("got updated_at %v, want %v", got.UpdatedAt, updatedAt)
+	}
+	if got.Name != repo.Name || got.Enabled != repo.Enabled {
+		t.Errorf("touch changed the repo: got %+v, want %+v", got, repo)
+	}
+
+	if _, err := Repos.Touch(ctx, repo.ID+1); !errcode.IsNotFound(err) {
+		t.Errorf("got err %v, want a not found error", err)
+	}
+}
+
+func TestRepos_UpsertCreated(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+
+	ctx := dbtesting.TestContext(t)
+
+	for i, test := range []struct {
+		op          api.InsertRepoOp
+		wantCreated bool
+	}{
+		{op: api.InsertRepoOp{Name: "r", Enabled: true}, wantCreated: true},
+		{op: api.InsertRepoOp{Name: "r", Enabled: true}, wantCreated: false},
+		{op: api.InsertRepoOp{Name: "r", Description: "d", Enabled: true}, wantCreated: false},
+		{op: api.InsertRepoOp{Name: "r2", Enabled: true}, wantCreated: true},
+	} {
+		created, err := Repos.UpsertCreated(ctx, test.op)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if created != test.wantCreated {
+			t.Errorf("%d: %s: got created %v, want %v", i, test.op.Name, created, test.wantCreated)
+		}
+	}
+}
+
 func TestRepos_List(t *testing.T) {
 	if testing.Short() {
 		t.Skip()
@@ -105,6 +187,191 @@ func TestRepos_List(t *testing.T) {
 	}
 }
 
+func TestRepos_ForEach(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+
+	var batches int
+	mockAuthzFilter = func(ctx context.Context, repos []*types.Repo, p authz.Perm) ([]*types.Repo, error) {
+		batches++
+		return repos, nil
+	}
+	defer func() { mockAuthzFilter = nil }()
+
+	ctx := dbtesting.TestContext(t)
+	ctx = actor.WithActor(ctx, &actor.Actor{})
+
+	var want []*types.Repo
+	for i := 0; i < forEachBatchSize+1; i++ {
+		want = append(want, mustCreate(ctx, t, &types.Repo{Name: api.RepoName(fmt.Sprintf("r%04d", i))})...)
+	}
+
+	var repos []*types.Repo
+	err := Repos.ForEach(ctx, ReposListOptions{Enabled: true, OrderBy: RepoListOrderBy{{Field: RepoListName}}}, func(repo *types.Repo) error {
+		repos = append(repos, repo)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !jsonEqual(t, repos, want) {
+		t.Errorf("got %d repos, want %d", len(repos), len(want))
+	}
+	if batches != 2 {
+		t.Errorf("got %d batches, want 2", batches)
+	}
+
+	// ForEach stops at the first error returned by fn.
+	errStop := errors.New("stop")
+	var n int
+	err = Repos.ForEach(ctx, ReposListOptions{Enabled: true}, func(repo *types.Repo) error {
+		n++
+		return errStop
+	})
+	if err != errStop || n != 1 {
+		t.Errorf("got err %v after %d calls, want %v after 1", err, n, errStop)
+	}
+}
+
+func TestRepos_List_updatedAfter(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+
+	mockAuthzFilter = func(ctx context.Context, repos []*types.Repo, p authz.Perm) ([]*types.Repo, error) {
+		return repos, nil
+	}
+	defer func() { mockAuthzFilter = nil }()
+
+	ctx := dbtesting.TestContext(t)
+	ctx = actor.WithActor(ctx, &actor.Actor{})
+
+	// Newly created repositories must have an updated_at, otherwise they are
+	// never included in incremental syncs.
+	created := mustCreate(ctx, t, &types.Repo{Name: "a"}, &types.Repo{Name: "b"}, &types.Repo{Name: "c"}, &types.Repo{Name: "d"})
+	if created[0].UpdatedAt == nil {
+		t.Fatal("newly created repository has no updated_at")
+	}
+
+	// Give all but a (which was never updated) the same earlier updated_at,
+	// so that pages must be split between equal timestamps by ID.
+	if _, err := dbconn.Global.ExecContext(ctx, "UPDATE repo SET updated_at=$1 WHERE name <> 'a'", time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		got      []api.RepoName
+		cursor   time.Time
+		cursorID api.RepoID
+	)
+	for i := 0; i < len(created)+1; i++ {
+		page, err := Repos.List(ctx, ReposListOptions{
+			Enabled:        true,
+			UpdatedAfter:   &cursor,
+			UpdatedAfterID: cursorID,
+			OrderBy:        RepoListOrderBy{{Field: RepoListUpdatedAt}, {Field: RepoListID}},
+			LimitOffset:    &LimitOffset{Limit: 1},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		got = append(got, page[0].Name)
+		cursor, cursorID = *page[0].UpdatedAt, page[0].ID
+	}
+	if want := []api.RepoName{"b", "c", "d", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Updates and deletions must be picked up by incremental syncs, and
+	// deleted repositories are listed if requested.
+	since := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := dbconn.Global.ExecContext(ctx, "UPDATE repo SET updated_at=$1", since); err != nil {
+		t.Fatal(err)
+	}
+	if err := Repos.UpdateLanguage(ctx, created[1].ID, "Go"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Repos.Delete(ctx, created[2].ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		includeDeleted bool
+		want           []api.RepoName
+	}{
+		{includeDeleted: false, want: []api.RepoName{"b"}},
+		{includeDeleted: true, want: []api.RepoName{"b", "c"}},
+	} {
+		repos, err := Repos.List(ctx, ReposListOptions{
+			Enabled:        true,
+			UpdatedAfter:   &since,
+			UpdatedAfterID: created[len(created)-1].ID,
+			IncludeDeleted: test.includeDeleted,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := sortedRepoNames(repos); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("includeDeleted=%v: got %v, want %v", test.includeDeleted, got, test.want)
+		}
+		for _, repo := range repos {
+			if deleted := repo.DeletedAt != nil; deleted != (repo.Name == "c") {
+				t.Errorf("includeDeleted=%v: got %s DeletedAt %v", test.includeDeleted, repo.Name, repo.DeletedAt)
+			}
+		}
+	}
+}
+
+func TestRepos_Upsert_updatedAt(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+
+	mockAuthzFilter = func(ctx context.Context, repos []*types.Repo, p authz.Perm) ([]*types.Repo, error) {
+		return repos, nil
+	}
+	defer func() { mockAuthzFilter = nil }()
+
+	ctx := dbtesting.TestContext(t)
+	ctx = actor.WithActor(ctx, &actor.Actor{})
+
+	op := api.InsertRepoOp{Name: "a", Description: "d", Enabled: true}
+	if err := Repos.Upsert(ctx, op); err != nil {
+		t.Fatal(err)
+	}
+	since := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := dbconn.Global.ExecContext(ctx, "UPDATE repo SET updated_at=$1", since); err != nil {
+		t.Fatal(err)
+	}
+	updatedAt := func() time.Time {
+		repo, err := Repos.GetByName(ctx, op.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *repo.UpdatedAt
+	}
+
+	// Upserting an unchanged repository must not make incremental syncs
+	// return it again.
+	if err := Repos.Upsert(ctx, op); err != nil {
+		t.Fatal(err)
+	}
+	if got := updatedAt(); !got.Equal(since) {
+		t.Errorf("got updated_at %v after unchanged upsert, want %v", got, since)
+	}
+
+	op.Description = "changed"
+	if err := Repos.Upsert(ctx, op); err != nil {
+		t.Fatal(err)
+	}
+	if got := updatedAt(); !got.After(since) {
+		t.Errorf("got updated_at %v after changed upsert, want after %v", got, since)
+	}
+}
+
 func TestRepos_List_fork(t *testing.T) {
 	if testing.Short() {
 		t.Skip()
@@ -198,6 +465,137 @@ func TestRepos_List_pagination(t *testing.T) {
 	}
 }
 
+func TestRepos_DeleteMatching(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+
+	mockAuthzFilter = func(ctx context.Context, repos []*types.Repo, p authz.Perm) ([]*types.Repo, error) {
+		return repos, nil
+	}
+	defer func() { mockAuthzFilter = nil }()
+	ctx := dbtesting.TestContext(t)
+	ctx = actor.WithActor(ctx, &actor.Actor{})
+
+	for _, op := range []api.InsertRepoOp{
+		{Name: "github.com/a/r", Enabled: true, ExternalRepo: &api.ExternalRepoSpec{ID: "1", ServiceType: "github", ServiceID: "https://github.com/"}},
+		{Name: "github.com/a/s", Enabled: false, ExternalRepo: &api.ExternalRepoSpec{ID: "2", ServiceType: "github", ServiceID: "https://github.com/"}},
+		{Name: "gitlab.com/c/r", Enabled: true, ExternalRepo: &api.ExternalRepoSpec{ID: "3", ServiceType: "gitlab", ServiceID: "https://gitlab.com/"}},
+	} {
+		if err := Repos.Upsert(ctx, op); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opt := ReposListOptions{Enabled: true, Disabled: true, ExternalServiceIDs: []string{"https://github.com/"}}
+
+	// Nothing is deleted if the number of matching repositories differs
+	// from the expected count.
+	if _, err := Repos.DeleteMatching(ctx, opt, 1); err == nil {
+		t.Fatal("got no error for mismatched count")
+	} else if _, ok := err.(*DeleteCountMismatchError); !ok {
+		t.Fatalf("got error %v, want *DeleteCountMismatchError", err)
+	}
+	if n, err := Repos.Count(ctx, ReposListOptions{Enabled: true, Disabled: true}); err != nil {
+		t.Fatal(err)
+	} else if n != 3 {
+		t.Errorf("got %d repos after mismatched delete, want 3", n)
+	}
+
+	n, err := Repos.DeleteMatching(ctx, opt, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 2; n != want {
+		t.Errorf("got %d deleted, want %d", n, want)
+	}
+
+	repos, err := Repos.List(ctx, ReposListOptions{Enabled: true, Disabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sortedRepoNames(repos), []api.RepoName{"gitlab.com/c/r"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got remaining repos %v, want %v", got, want)
+	}
+}
+
+func TestRepos_List_externalServiceIDs(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+
+	mockAuthzFilter = func(ctx context.Context, repos []*types.Repo, p authz.Perm) ([]*types.Repo, error) {
+		return repos, nil
+	}
+	defer func() { mockAuthzFilter = nil }()
+	ctx := dbtesting.TestContext(t)
+	ctx = actor.WithActor(ctx, &actor.Actor{})
+
+	for _, op := range []api.InsertRepoOp{
+		{Name: "github.com/a/r", Enabled: true, ExternalRepo: &api.ExternalRepoSpec{ID: "1", ServiceType: "github", ServiceID: "https://github.com/"}},
+		{Name: "ghe.example.com/b/r", Enabled: true, ExternalRepo: &api.ExternalRepoSpec{ID: "2", ServiceType: "github", ServiceID: "https://ghe.example.com/"}},
+		{Name: "gitlab.com/c/r", Enabled: true, ExternalRepo: &api.ExternalRepoSpec{ID: "3", ServiceType: "gitlab", ServiceID: "https://gitlab.com/"}},
+		{Name: "other/r", Enabled: true},
+	} {
+		if err := Repos.Upsert(ctx, op); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		serviceIDs []string
+		want       []api.RepoName
+	}{
+		{serviceIDs: []string{"https://github.com/"}, want: []api.RepoName{"github.com/a/r"}},
+		{serviceIDs: []string{"https://github.com/", "https://gitlab.com/"}, want: []api.RepoName{"github.com/a/r", "gitlab.com/c/r"}},
+		{serviceIDs: []string{"https://unknown.example.com/"}, want: nil},
+		{serviceIDs: nil, want: []api.RepoName{"ghe.example.com/b/r", "github.com/a/r", "gitlab.com/c/r", "other/r"}},
+	}
+	for _, test := range tests {
+		repos, err := Repos.List(ctx, ReposListOptions{Enabled: true, ExternalServiceIDs: test.serviceIDs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := sortedRepoNames(repos); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("for service IDs %v, got %v (want %v)", test.serviceIDs, got, test.want)
+		}
+	}
+}
+
+func TestRepos_GetIDsByExternalRepos(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+
+	ctx := dbtesting.TestContext(t)
+
+	a := api.ExternalRepoSpec{ID: "1", ServiceType: "github", ServiceID: "https://github.com/"}
+	b := api.ExternalRepoSpec{ID: "2", ServiceType: "gitlab", ServiceID: "https://gitlab.com/"}
+	for _, op := range []api.InsertRepoOp{
+		{Name: "github.com/a/r", Enabled: true, ExternalRepo: &a},
+		{Name: "gitlab.com/b/r", Enabled: true, ExternalRepo: &b},
+		{Name: "other/r", Enabled: true},
+	} {
+		if err := Repos.Upsert(ctx, op); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repoA, err := Repos.GetByName(ctx, "github.com/a/r")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same ID on another service must not match.
+	other := api.ExternalRepoSpec{ID: "1", ServiceType: "github", ServiceID: "https://ghe.example.com/"}
+	ids, err := Repos.GetIDsByExternalRepos(ctx, []api.ExternalRepoSpec{a, other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[api.ExternalRepoSpec]api.RepoID{a: repoA.ID}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got %v, want %v", ids, want)
+	}
+}
+
 // TestRepos_List_query tests the behavior of Repos.List when called with
 // a query.
 // Test batch 1 (correct filtering)
@@ -605,3 +1003,38 @@ func TestRepos_Create_dupe(t *testing.T) {
 	// Add another repo with the same name.
 	createRepo(ctx, t, &types.Repo{Name: "a/b"})
 }
+
+func TestRepos_LanguageStats(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+
+	ctx := dbtesting.TestContext(t)
+	ctx = actor.WithActor(ctx, &actor.Actor{})
+
+	repos := mustCreate(ctx, t, &types.Repo{Name: "a/go1"}, &types.Repo{Name: "a/go2"}, &types.Repo{Name: "a/java"}, &types.Repo{Name: "a/none"})
+	for i, lang := range []string{"Go", "Go", "Java"} {
+		if err := Repos.UpdateLanguage(ctx, repos[i].ID, lang); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Repos.SetEnabled(ctx, repos[1].ID, false); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		enabledOnly bool
+		want        map[string]int
+	}{
+		{enabledOnly: false, want: map[string]int{"Go": 2, "Java": 1}},
+		{enabledOnly: true, want: map[string]int{"Go": 1, "Java": 1}},
+	} {
+		stats, err := Repos.LanguageStats(ctx, test.enabledOnly)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(stats, test.want) {
+			t.Errorf("enabledOnly=%v: got %v, want %v", test.enabledOnly, stats, test.want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// enabledNamesTTL is how long a result of ListEnabledNames is served from
+// memory before it is read from the DB again. Changes made by this process
+// invalidate the cache immediately; the TTL bounds staleness for changes
+// made elsewhere (e.g. by repo-updater or another frontend replica).
+const enabledNamesTTL = 5 * time.Second
+
+// enabledNamesFetchTimeout bounds a fetch of the enabled repo names. The fetch
+// is shared by all concurrent callers, so it does not run on (and is not
+// canceled with) the context of any one of them.
+const enabledNamesFetchTimeout = time.Minute
+
+// enabledNamesCache is a short-lived in-memory cache of the enabled repo
+// names. The zero value is ready to use and it is safe for concurrent use.
+type enabledNamesCache struct {
+	mu       sync.Mutex
+	names    []string
+	expires  time.Time
+	gen      int                // incremented on every invalidation
+	inflight *enabledNamesFetch // the fetch in progress, if any
+}
+
+// enabledNamesFetch is a fetch of the enabled repo names that concurrent
+// callers of enabledNamesCache.get share.
+type enabledNamesFetch struct {
+	done  chan struct{} // closed when names and err are set
+	names []string
+	err   error
+}
+
+// get returns the cached names, calling fetch to refresh them if they are
+// older than ttl. Concurrent callers share a single call to fetch (and its
+// error, if any), which runs in the background with its own timeout. Each
+// caller stops waiting for it when its own ctx is done.
+func (c *enabledNamesCache) get(ctx context.Context, ttl time.Duration, fetch func(context.Context) ([]string, error)) ([]string, error) {
+	c.mu.Lock()
+	if time.Now().Before(c.expires) {
+		names := c.names
+		c.mu.Unlock()
+		return names, nil
+	}
+	f := c.inflight
+	if f == nil {
+		f = &enabledNamesFetch{done: make(chan struct{})}
+		c.inflight = f
+		go c.fetch(f, c.gen, ttl, fetch)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.names, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fetch runs the shared fetch f and caches its result unless the cache was
+// invalidated since gen.
+func (c *enabledNamesCache) fetch(f *enabledNamesFetch, gen int, ttl time.Duration, fetch func(context.Context) ([]string, error)) {
+	ctx, cancel := context.WithTimeout(context.Background(), enabledNamesFetchTimeout)
+	defer cancel()
+	f.names, f.err = fetch(ctx)
+
+	c.mu.Lock()
+	if c.inflight == f {
+		c.inflight = nil
+	}
+	// Only store the result if nothing was invalidated while we were
+	// fetching, otherwise we may cache a list from before the change.
+	if f.err == nil && gen == c.gen {
+		c.names = f.names
+		c.expires = time.Now().Add(ttl)
+	}
+	c.mu.Unlock()
+	close(f.done)
+}
+
+func (c *enabledNamesCache) invalidate() {
+	c.mu.Lock()
+	c.gen++
+	c.names = nil
+	c.expires = time.Time{}
+	c.inflight = nil // callers from now on must not get the result of an older fetch
+	c.mu.Unlock()
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEnabledNamesCache(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		mu      sync.Mutex
+		calls   int
+		names   = []string{"a"}
+		release = make(chan struct{})
+	)
+	fetch := func(context.Context) ([]string, error) {
+		<-release
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		return append([]string(nil), names...), nil
+	}
+	fetches := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls
+	}
+
+	var c enabledNamesCache
+
+	// Concurrent cold gets share a single fetch.
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := c.get(ctx, time.Hour, fetch)
+			if err == nil && !reflect.DeepEqual(got, []string{"a"}) {
+				err = fmt.Errorf("got %v, want [a]", got)
+			}
+			errs <- err
+		}()
+	}
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if n := fetches(); n != 1 {
+		t.Errorf("got %d fetches for concurrent cold gets, want 1", n)
+	}
+
+	// Warm gets are served from the cache.
+	if got, err := c.get(ctx, time.Hour, fetch); err != nil {
+		t.Fatal(err)
+	} else if want := []string{"a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if n := fetches(); n != 1 {
+		t.Errorf("got %d fetches, want result to be served from cache", n)
+	}
+
+	mu.Lock()
+	names = []string{"a", "b"}
+	mu.Unlock()
+	c.invalidate()
+	if got, err := c.get(ctx, time.Hour, fetch); err != nil {
+		t.Fatal(err)
+	} else if want := []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after invalidate: got %v, want %v", got, want)
+	}
+	if n := fetches(); n != 2 {
+		t.Errorf("after invalidate: got %d fetches, want 2", n)
+	}
+}
+
+func TestEnabledNamesCache_callerCanceled(t *testing.T) {
+	release := make(chan struct{})
+	fetch := func(ctx context.Context) ([]string, error) {
+		select {
+		case <-release:
+			return []string{"a"}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	var c enabledNamesCache
+
+	// The caller that started the fetch going away must not fail the
+	// fetch for the others.
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error)
+	go func() {
+		_, err := c.get(ctx, time.Hour, fetch)
+		canceled <- err
+	}()
+	for {
+		c.mu.Lock()
+		started := c.inflight != nil
+		c.mu.Unlock()
+		if started {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	result := make(chan error)
+	go func() {
+		got, err := c.get(context.Background(), time.Hour, fetch)
+		if err == nil && !reflect.DeepEqual(got, []string{"a"}) {
+			err = fmt.Errorf("got %v, want [a]", got)
+		}
+		result <- err
+	}()
+
+	cancel()
+	if err := <-canceled; err != context.Canceled {
+		t.Errorf("canceled caller: got error %v, want %v", err, context.Canceled)
+	}
+	close(release)
+	if err := <-result; err != nil {
+		t.Error(err)
+	}
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"testing"
+	"time"
 
 	"context"
 
@@ -10,12 +11,19 @@ import (
 )
 
 type MockRepos struct {
-	Get       func(ctx context.Context, repo api.RepoID) (*types.Repo, error)
-	GetByName func(ctx context.Context, repo api.RepoName) (*types.Repo, error)
-	List      func(v0 context.Context, v1 ReposListOptions) ([]*types.Repo, error)
-	Delete    func(ctx context.Context, repo api.RepoID) error
-	Count     func(ctx context.Context, opt ReposListOptions) (int, error)
-	Upsert    func(api.InsertRepoOp) error
+	Get            func(ctx context.Context, repo api.RepoID) (*types.Repo, error)
+	GetByName      func(ctx context.Context, repo api.RepoName) (*types.Repo, error)
+	Exists         func(ctx context.Context, repo api.RepoName) (bool, error)
+	Touch          func(ctx context.Context, repo api.RepoID) (time.Time, error)
+	List           func(v0 context.Context, v1 ReposListOptions) ([]*types.Repo, error)
+	ForEach        func(ctx context.Context, opt ReposListOptions, fn func(*types.Repo) error) error
+	Delete         func(ctx context.Context, repo api.RepoID) error
+	DeleteMatching func(ctx context.Context, opt ReposListOptions, expected int) (int, error)
+	Count          func(ctx context.Context, opt ReposListOptions) (int, error)
+	Upsert         func(api.InsertRepoOp) error
+	UpsertCreated  func(api.InsertRepoOp) (created bool, err error)
+
+	GetIDsByExternalRepos func(ctx context.Context, specs []api.ExternalRepoSpec) (map[api.ExternalRepoSpec]api.RepoID, error)
 }
 
 func (s *MockRepos) MockGet(t *testing.T, wantRepo api.RepoID) (called *bool) {
@@ -138,3 +138,32 @@ func getFilteredRepoNames(ctx context.Context, currentUser *types.User, repos ma
 
 	return accepted, nil
 }
+
+// RepoPermsProviders reports which authz provider, if any, is the source of permissions for each
+// of the given repositories, using the same rules as getFilteredRepoNames. Repositories that are
+// not claimed by any authz provider (including those with no external repo spec) are absent from
+// claimed; allowByDefault reports whether such repositories are readable by all users. It does not
+// check the permissions of any user.
+func RepoPermsProviders(ctx context.Context, repos []*types.Repo) (allowByDefault bool, claimed map[api.RepoName]authz.Provider) {
+	allowByDefault, authzProviders := authz.GetProviders()
+
+	claimed = make(map[api.RepoName]authz.Provider)
+	unverified := make(map[authz.Repo]struct{})
+	for repo := range authz.ToRepos(repos) {
+		if s := repo.ExternalRepoSpec; s.ID == "" || s.ServiceID == "" || s.ServiceType == "" {
+			continue
+		}
+		unverified[repo] = struct{}{}
+	}
+	for _, authzProvider := range authzProviders {
+		if len(unverified) == 0 {
+			break
+		}
+		var mine map[authz.Repo]struct{}
+		mine, unverified = authzProvider.Repos(ctx, unverified)
+		for repo := range mine {
+			claimed[repo.RepoName] = authzProvider
+		}
+	}
+	return allowByDefault, claimed
+}
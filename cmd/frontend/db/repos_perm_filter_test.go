@@ -731,6 +731,34 @@ func (m *MockAuthzProvider) ServiceID() string   { return m.serviceID }
 func (m *MockAuthzProvider) ServiceType() string { return m.serviceType }
 func (m *MockAuthzProvider) Validate() []string  { return nil }
 
+func TestRepoPermsProviders(t *testing.T) {
+	gitlab := &MockAuthzProvider{
+		serviceID:   "https://gitlab.mine/",
+		serviceType: "gitlab",
+		repos:       map[api.RepoName]struct{}{"gitlab.mine/u/r0": {}},
+	}
+	other := &MockAuthzProvider{
+		serviceID:   "https://other.mine/",
+		serviceType: "other",
+		repos:       map[api.RepoName]struct{}{"gitlab.mine/u/r0": {}, "other.mine/r1": {}},
+	}
+	authz.SetProviders(false, []authz.Provider{gitlab, other})
+	defer authz.SetProviders(true, nil)
+
+	noSpec := &types.Repo{Name: "other.mine/no-spec"}
+	repos := append(makeRepos("gitlab.mine/u/r0", "other.mine/r1", "unclaimed/r2"), noSpec)
+	allowByDefault, claimed := RepoPermsProviders(context.Background(), repos)
+	if allowByDefault {
+		t.Error("got allowByDefault == true, want false")
+	}
+	if want := map[api.RepoName]authz.Provider{
+		"gitlab.mine/u/r0": gitlab,
+		"other.mine/r1":    other,
+	}; !reflect.DeepEqual(claimed, want) {
+		t.Errorf("got claimed %v, want %v", claimed, want)
+	}
+}
+
 func makeRepo(name api.RepoName, id api.RepoID) *types.Repo {
 	extName := string(name)
 	if extName == "" {
@@ -65,6 +65,30 @@ func TestParseIncludePattern(t *testing.T) {
 	}
 }
 
+func TestValidateRepoName(t *testing.T) {
+	for name, wantValid := range map[api.RepoName]bool{
+		"github.com/gorilla/mux":  true,
+		"myrepo":                  true,
+		"example.com/a/b.c/d-e_f": true,
+		"":                        false,
+		"https://github.com/a/b":  false,
+		"/github.com/a/b":         false,
+		"github.com/a/b/":         false,
+		"github.com//b":           false,
+		"github.com/a/../b":       false,
+		"github.com/./b":          false,
+		"github.com/a b":          false,
+		"github.com/a\tb":         false,
+		"github.com/a\x00b":       false,
+		"github.com/\xff":         false,
+	} {
+		err := ValidateRepoName(name)
+		if valid := err == nil; valid != wantValid {
+			t.Errorf("%q: got valid %v (err %v), want %v", name, valid, err, wantValid)
+		}
+	}
+}
+
 func TestRepos_Delete(t *testing.T) {
 	if testing.Short() {
 		t.Skip()
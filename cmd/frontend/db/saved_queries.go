@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 	"github.com/sourcegraph/sourcegraph/pkg/db/dbconn"
 )
@@ -21,6 +22,10 @@ type SavedQueryInfo struct {
 // Get gets the saved query information for the given query. nil
 // is returned if there is no existing saved query info.
 func (s *savedQueries) Get(ctx context.Context, query string) (*SavedQueryInfo, error) {
+	if Mocks.SavedQueries.Get != nil {
+		return Mocks.SavedQueries.Get(ctx, query)
+	}
+
 	info := &SavedQueryInfo{
 		Query: query,
 	}
@@ -40,6 +45,42 @@ func (s *savedQueries) Get(ctx context.Context, query string) (*SavedQueryInfo,
 	return info, nil
 }
 
+// GetMany gets the saved query information for all of the given queries in a
+// single statement. The result is keyed by query; queries without stored
+// information are omitted.
+func (s *savedQueries) GetMany(ctx context.Context, queries []string) (map[string]*SavedQueryInfo, error) {
+	if Mocks.SavedQueries.GetMany != nil {
+		return Mocks.SavedQueries.GetMany(ctx, queries)
+	}
+
+	infos := make(map[string]*SavedQueryInfo, len(queries))
+	if len(queries) == 0 {
+		return infos, nil
+	}
+	rows, err := dbconn.Global.QueryContext(
+		ctx,
+		"SELECT query, last_executed, latest_result, exec_duration_ns FROM saved_queries WHERE query = ANY($1)",
+		pq.Array(queries),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "Query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			info           SavedQueryInfo
+			execDurationNs int64
+		)
+		if err := rows.Scan(&info.Query, &info.LastExecuted, &info.LatestResult, &execDurationNs); err != nil {
+			return nil, errors.Wrap(err, "Scan")
+		}
+		info.ExecDuration = time.Duration(execDurationNs)
+		infos[info.Query] = &info
+	}
+	return infos, rows.Err()
+}
+
 // Set sets the saved query information for the given info.Query.
 //
 // It is not safe to call concurrently for the same info.Query, as it uses a
@@ -77,6 +118,29 @@ func (s *savedQueries) Set(ctx context.Context, info *SavedQueryInfo) error {
 	return nil
 }
 
+// ListQueries returns the queries of all stored saved query information.
+func (s *savedQueries) ListQueries(ctx context.Context) ([]string, error) {
+	if Mocks.SavedQueries.ListQueries != nil {
+		return Mocks.SavedQueries.ListQueries(ctx)
+	}
+
+	rows, err := dbconn.Global.QueryContext(ctx, "SELECT query FROM saved_queries")
+	if err != nil {
+		return nil, errors.Wrap(err, "Query")
+	}
+	defer rows.Close()
+
+	var queries []string
+	for rows.Next() {
+		var query string
+		if err := rows.Scan(&query); err != nil {
+			return nil, errors.Wrap(err, "Scan")
+		}
+		queries = append(queries, query)
+	}
+	return queries, rows.Err()
+}
+
 func (s *savedQueries) Delete(ctx context.Context, query string) error {
 	_, err := dbconn.Global.ExecContext(
 		ctx,
@@ -85,3 +149,29 @@ func (s *savedQueries) Delete(ctx context.Context, query string) error {
 	)
 	return err
 }
+
+// DeleteMany deletes the saved query information for all of the given
+// queries in a single statement. Queries without stored information are
+// ignored. It returns the number of deleted rows.
+func (s *savedQueries) DeleteMany(ctx context.Context, queries []string) (int, error) {
+	if Mocks.SavedQueries.DeleteMany != nil {
+		return Mocks.SavedQueries.DeleteMany(ctx, queries)
+	}
+
+	if len(queries) == 0 {
+		return 0, nil
+	}
+	res, err := dbconn.Global.ExecContext(
+		ctx,
+		"DELETE FROM saved_queries WHERE query = ANY($1)",
+		pq.Array(queries),
+	)
+	if err != nil {
+		return 0, errors.Wrap(err, "DELETE")
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "RowsAffected")
+	}
+	return int(deleted), nil
+}
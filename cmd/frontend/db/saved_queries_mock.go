@@ -0,0 +1,13 @@
+package db
+
+import "context"
+
+type MockSavedQueries struct {
+	Get func(ctx context.Context, query string) (*SavedQueryInfo, error)
+
+	GetMany func(ctx context.Context, queries []string) (map[string]*SavedQueryInfo, error)
+
+	ListQueries func(ctx context.Context) ([]string, error)
+
+	DeleteMany func(ctx context.Context, queries []string) (int, error)
+}
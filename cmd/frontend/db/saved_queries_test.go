@@ -0,0 +1,51 @@
+package db
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/pkg/db/dbtesting"
+)
+
+func TestSavedQueries_DeleteMany(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+
+	ctx := dbtesting.TestContext(t)
+
+	for _, query := range []string{"a", "b", "c"} {
+		if err := SavedQueries.Set(ctx, &SavedQueryInfo{Query: query, LastExecuted: time.Now(), LatestResult: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		queries     []string
+		wantDeleted int
+		wantLeft    []string
+	}{
+		{queries: nil, wantDeleted: 0, wantLeft: []string{"a", "b", "c"}},
+		{queries: []string{"x", "y"}, wantDeleted: 0, wantLeft: []string{"a", "b", "c"}},
+		{queries: []string{"a", "x", "c"}, wantDeleted: 2, wantLeft: []string{"b"}},
+		{queries: []string{"a", "b"}, wantDeleted: 1, wantLeft: nil},
+	} {
+		deleted, err := SavedQueries.DeleteMany(ctx, test.queries)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deleted != test.wantDeleted {
+			t.Errorf("%v: got %d deleted, want %d", test.queries, deleted, test.wantDeleted)
+		}
+		left, err := SavedQueries.ListQueries(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(left)
+		if !reflect.DeepEqual(left, test.wantLeft) {
+			t.Errorf("%v: got remaining queries %v, want %v", test.queries, left, test.wantLeft)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	multierror "github.com/hashicorp/go-multierror"
 	"github.com/keegancsmith/sqlf"
+	"github.com/lib/pq"
 	"github.com/sourcegraph/jsonx"
 	"github.com/sourcegraph/sourcegraph/pkg/api"
 	"github.com/sourcegraph/sourcegraph/pkg/db/dbconn"
@@ -20,14 +21,28 @@ func (o *settings) CreateIfUpToDate(ctx context.Context, subject api.SettingsSub
 	if Mocks.Settings.CreateIfUpToDate != nil {
 		return Mocks.Settings.CreateIfUpToDate(ctx, subject, lastID, authorUserID, contents)
 	}
+	latestSetting, _, err = o.createIfUpToDate(ctx, subject, lastID, authorUserID, contents)
+	return latestSetting, err
+}
 
+// CompareAndCreate is like CreateIfUpToDate, but also reports whether the
+// settings were created. If created is false, lastID was out of date and
+// latestSetting is the subject's current (conflicting) settings.
+func (o *settings) CompareAndCreate(ctx context.Context, subject api.SettingsSubject, lastID *int32, authorUserID *int32, contents string) (latestSetting *api.Settings, created bool, err error) {
+	if Mocks.Settings.CompareAndCreate != nil {
+		return Mocks.Settings.CompareAndCreate(ctx, subject, lastID, authorUserID, contents)
+	}
+	return o.createIfUpToDate(ctx, subject, lastID, authorUserID, contents)
+}
+
+func (o *settings) createIfUpToDate(ctx context.Context, subject api.SettingsSubject, lastID *int32, authorUserID *int32, contents string) (latestSetting *api.Settings, created bool, err error) {
 	if strings.TrimSpace(contents) == "" {
-		return nil, fmt.Errorf("blank settings are invalid (you can clear the settings by entering an empty JSON object: {})")
+		return nil, false, fmt.Errorf("blank settings are invalid (you can clear the settings by entering an empty JSON object: {})")
 	}
 
 	// Validate JSON syntax before saving.
 	if _, errs := jsonx.Parse(contents, jsonx.ParseOptions{Comments: true, TrailingCommas: true}); len(errs) > 0 {
-		return nil, fmt.Errorf("invalid settings JSON: %v", errs)
+		return nil, false, fmt.Errorf("invalid settings JSON: %v", errs)
 	}
 
 	s := api.Settings{
@@ -38,7 +53,7 @@ func (o *settings) CreateIfUpToDate(ctx context.Context, subject api.SettingsSub
 
 	tx, err := dbconn.Global.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	defer func() {
@@ -54,7 +69,7 @@ func (o *settings) CreateIfUpToDate(ctx context.Context, subject api.SettingsSub
 
 	latestSetting, err = o.getLatest(ctx, tx, subject)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	creatorIsUpToDate := latestSetting != nil && lastID != nil && latestSetting.ID == *lastID
@@ -63,12 +78,12 @@ func (o *settings) CreateIfUpToDate(ctx context.Context, subject api.SettingsSub
 			"INSERT INTO settings(org_id, user_id, author_user_id, contents) VALUES($1, $2, $3, $4) RETURNING id, created_at",
 			s.Subject.Org, s.Subject.User, s.AuthorUserID, s.Contents).Scan(&s.ID, &s.CreatedAt)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
-		latestSetting = &s
+		return &s, true, nil
 	}
 
-	return latestSetting, nil
+	return latestSetting, false, nil
 }
 
 func (o *settings) GetLatest(ctx context.Context, subject api.SettingsSubject) (*api.Settings, error) {
@@ -79,6 +94,79 @@ func (o *settings) GetLatest(ctx context.Context, subject api.SettingsSubject) (
 	return o.getLatest(ctx, dbconn.Global, subject)
 }
 
+// Exist reports, for each of subjects, whether it has any settings. It is
+// cheaper than calling GetLatest for each subject because it does not read the
+// settings contents.
+func (o *settings) Exist(ctx context.Context, subjects []api.SettingsSubject) ([]bool, error) {
+	if Mocks.Settings.Exist != nil {
+		return Mocks.Settings.Exist(ctx, subjects)
+	}
+
+	var (
+		orgIDs, userIDs []int32
+		site            bool
+	)
+	for _, subject := range subjects {
+		switch {
+		case subject.Org != nil:
+			orgIDs = append(orgIDs, *subject.Org)
+		case subject.User != nil:
+			userIDs = append(userIDs, *subject.User)
+		default:
+			site = true
+		}
+	}
+
+	// Like getLatest, ignore the settings of deleted users.
+	q := sqlf.Sprintf(`
+		SELECT DISTINCT s.org_id, s.user_id FROM settings s
+		WHERE s.org_id = ANY(%s)
+		OR (s.user_id = ANY(%s) AND EXISTS (SELECT NULL FROM users WHERE id=s.user_id AND deleted_at IS NULL))
+		OR (%s AND s.org_id IS NULL AND s.user_id IS NULL)`,
+		pq.Array(orgIDs), pq.Array(userIDs), site)
+	rows, err := dbconn.Global.QueryContext(ctx, q.Query(sqlf.PostgresBindVar), q.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		orgsWithSettings  = map[int32]bool{}
+		usersWithSettings = map[int32]bool{}
+		siteHasSettings   bool
+	)
+	for rows.Next() {
+		var orgID, userID sql.NullInt64
+		if err := rows.Scan(&orgID, &userID); err != nil {
+			return nil, err
+		}
+		switch {
+		case orgID.Valid:
+			orgsWithSettings[int32(orgID.Int64)] = true
+		case userID.Valid:
+			usersWithSettings[int32(userID.Int64)] = true
+		default:
+			siteHasSettings = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	exist := make([]bool, len(subjects))
+	for i, subject := range subjects {
+		switch {
+		case subject.Org != nil:
+			exist[i] = orgsWithSettings[*subject.Org]
+		case subject.User != nil:
+			exist[i] = usersWithSettings[*subject.User]
+		default:
+			exist[i] = siteHasSettings
+		}
+	}
+	return exist, nil
+}
+
 // ListAll lists ALL settings (across all users, orgs, etc).
 //
 // If impreciseSubstring is given, only settings whose raw JSONC string contains the substring are
@@ -91,6 +179,10 @@ func (o *settings) GetLatest(ctx context.Context, subject api.SettingsSubject) (
 // 🚨 SECURITY: This method does NOT verify the user is an admin. The caller is
 // responsible for ensuring this or that the response never makes it to a user.
 func (o *settings) ListAll(ctx context.Context, impreciseSubstring string) (_ []*api.Settings, err error) {
+	if Mocks.Settings.ListAll != nil {
+		return Mocks.Settings.ListAll(ctx, impreciseSubstring)
+	}
+
 	tr, ctx := trace.New(ctx, "db.Settings.ListAll", "")
 	defer func() {
 		tr.SetError(err)
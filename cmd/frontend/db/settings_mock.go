@@ -9,4 +9,8 @@ import (
 type MockSettings struct {
 	GetLatest        func(ctx context.Context, subject api.SettingsSubject) (*api.Settings, error)
 	CreateIfUpToDate func(ctx context.Context, subject api.SettingsSubject, lastID, authorUserID *int32, contents string) (latestSetting *api.Settings, err error)
+	CompareAndCreate func(ctx context.Context, subject api.SettingsSubject, lastID, authorUserID *int32, contents string) (latestSetting *api.Settings, created bool, err error)
+	Exist            func(ctx context.Context, subjects []api.SettingsSubject) ([]bool, error)
+
+	ListAll func(ctx context.Context, impreciseSubstring string) ([]*api.Settings, error)
 }
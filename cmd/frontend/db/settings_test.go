@@ -1,6 +1,7 @@
 package db
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/sourcegraph/sourcegraph/pkg/api"
@@ -53,3 +54,42 @@ func TestSettings_ListAll(t *testing.T) {
 		}
 	})
 }
+
+func TestSettings_Exist(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+	ctx := dbtesting.TestContext(t)
+
+	user1, err := Users.Create(ctx, NewUser{Username: "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user2, err := Users.Create(ctx, NewUser{Username: "u2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Settings.CreateIfUpToDate(ctx, api.SettingsSubject{User: &user1.ID}, nil, nil, `{}`); err != nil {
+		t.Fatal(err)
+	}
+
+	subjects := []api.SettingsSubject{{Site: true}, {User: &user1.ID}, {User: &user2.ID}}
+	exist, err := Settings.Exist(ctx, subjects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []bool{false, true, false}; !reflect.DeepEqual(exist, want) {
+		t.Errorf("got %v, want %v", exist, want)
+	}
+
+	if _, err := Settings.CreateIfUpToDate(ctx, api.SettingsSubject{Site: true}, nil, nil, `{}`); err != nil {
+		t.Fatal(err)
+	}
+	exist, err = Settings.Exist(ctx, subjects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []bool{true, true, false}; !reflect.DeepEqual(exist, want) {
+		t.Errorf("got %v, want %v", exist, want)
+	}
+}
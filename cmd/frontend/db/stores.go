@@ -7,6 +7,7 @@ var (
 	DiscussionComments        = &discussionComments{}
 	DiscussionMailReplyTokens = &discussionMailReplyTokens{}
 	Repos                     = &repos{}
+	RepoKVPs                  = &repoKVPs{}
 	Phabricator               = &phabricator{}
 	SavedQueries              = &savedQueries{}
 	Orgs                      = &orgs{}
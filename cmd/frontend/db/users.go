@@ -557,6 +557,48 @@ func (u *users) GetByUsername(ctx context.Context, username string) (*types.User
 	return u.getOneBySQL(ctx, "WHERE username=$1 AND deleted_at IS NULL LIMIT 1", username)
 }
 
+// UserSummary is a user's username and primary email address.
+type UserSummary struct {
+	ID           int32
+	Username     string
+	PrimaryEmail string // empty if the user has no email addresses
+}
+
+// ListSummaries returns the summaries of the users with the given IDs, ordered
+// by ID. Users that don't exist (or were deleted) are omitted. The primary
+// email is chosen as in UserEmails.GetPrimaryEmail.
+func (u *users) ListSummaries(ctx context.Context, ids []int32) ([]*UserSummary, error) {
+	if Mocks.Users.ListSummaries != nil {
+		return Mocks.Users.ListSummaries(ctx, ids)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	rows, err := dbconn.Global.QueryContext(ctx, `
+SELECT users.id, users.username, COALESCE((
+	SELECT email FROM user_emails WHERE user_id=users.id
+	ORDER BY (verified_at IS NOT NULL) DESC, created_at ASC, email ASC LIMIT 1
+), '')
+FROM users
+WHERE users.id = ANY($1) AND users.deleted_at IS NULL
+ORDER BY users.id ASC`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []*UserSummary
+	for rows.Next() {
+		var s UserSummary
+		if err := rows.Scan(&s.ID, &s.Username, &s.PrimaryEmail); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, &s)
+	}
+	return summaries, rows.Err()
+}
+
 var ErrNoCurrentUser = errors.New("no current user")
 
 func (u *users) GetByCurrentAuthUser(ctx context.Context) (*types.User, error) {
@@ -17,6 +17,7 @@ type MockUsers struct {
 	GetByVerifiedEmail   func(ctx context.Context, email string) (*types.User, error)
 	Count                func(ctx context.Context, opt *UsersListOptions) (int, error)
 	List                 func(ctx context.Context, opt *UsersListOptions) ([]*types.User, error)
+	ListSummaries        func(ctx context.Context, ids []int32) ([]*UserSummary, error)
 }
 
 func (s *MockUsers) MockGetByID_Return(t *testing.T, returns *types.User, returnsErr error) (called *bool) {
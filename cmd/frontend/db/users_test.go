@@ -377,6 +377,41 @@ func TestUsers_GetByVerifiedEmail(t *testing.T) {
 	}
 }
 
+func TestUsers_ListSummaries(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+	ctx := dbtesting.TestContext(t)
+
+	u1, err := Users.Create(ctx, NewUser{Email: "a@a.com", Username: "u1", Password: "p", EmailIsVerified: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u2, err := Users.Create(ctx, NewUser{Username: "u2", Password: "p"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u3, err := Users.Create(ctx, NewUser{Username: "u3", Password: "p"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Users.Delete(ctx, u3.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	summaries, err := Users.ListSummaries(ctx, []int32{u2.ID, u1.ID, u3.ID, 12345})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*UserSummary{
+		{ID: u1.ID, Username: "u1", PrimaryEmail: "a@a.com"},
+		{ID: u2.ID, Username: "u2"},
+	}
+	if !reflect.DeepEqual(summaries, want) {
+		t.Errorf("got %s, want %s", asJSON(t, summaries), asJSON(t, want))
+	}
+}
+
 func TestUsers_Delete(t *testing.T) {
 	for name, hard := range map[string]bool{"": false, "_Hard": true} {
 		t.Run("TestUsers_Delete"+name, func(t *testing.T) {
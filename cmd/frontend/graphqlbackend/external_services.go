@@ -96,7 +96,7 @@ func syncExternalService(ctx context.Context, svc *types.ExternalService) error
 		CreatedAt:   svc.CreatedAt,
 		UpdatedAt:   svc.UpdatedAt,
 		DeletedAt:   svc.DeletedAt,
-	})
+	}, false)
 
 	if err != nil {
 		return err
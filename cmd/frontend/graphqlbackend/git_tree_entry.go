@@ -9,12 +9,9 @@ import (
 	"time"
 
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/backend"
-	"github.com/sourcegraph/sourcegraph/cmd/frontend/db"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/graphqlbackend/externallink"
 	"github.com/sourcegraph/sourcegraph/pkg/api"
-	"github.com/sourcegraph/sourcegraph/pkg/conf/reposource"
 	"github.com/sourcegraph/sourcegraph/pkg/vcs/git"
-	"github.com/sourcegraph/sourcegraph/schema"
 	log15 "gopkg.in/inconshreveable/log15.v2"
 )
 
@@ -97,7 +94,7 @@ func (r *gitTreeEntryResolver) Submodule() *gitSubmoduleResolver {
 }
 
 func cloneURLToRepoName(ctx context.Context, cloneURL string) (string, error) {
-	repoName, err := reposourceCloneURLToRepoName(ctx, cloneURL)
+	repoName, err := backend.CloneURLToRepoName(ctx, cloneURL)
 	if err != nil {
 		return "", err
 	}
@@ -107,81 +104,6 @@ func cloneURLToRepoName(ctx context.Context, cloneURL string) (string, error) {
 	return string(repoName), nil
 }
 
-// reposourceCloneURLToRepoName maps a Git clone URL (format documented here:
-// https://git-scm.com/docs/git-clone#_git_urls_a_id_urls_a) to the corresponding repo name if there
-// exists a code host configuration that matches the clone URL. Implicitly, it includes a code host
-// configuration for github.com, even if one is not explicitly specified. Returns the empty string and nil
-// error if a matching code host could not be found. This function does not actually check the code
-// host to see if the repository actually exists.
-func reposourceCloneURLToRepoName(ctx context.Context, cloneURL string) (repoName api.RepoName, err error) {
-	if repoName := reposource.CustomCloneURLToRepoName(cloneURL); repoName != "" {
-		return repoName, nil
-	}
-
-	var repoSources []reposource.RepoSource
-
-	// The following code makes serial database calls.
-	// Ideally these could be done in parallel, but the table is small
-	// and I don't think real world perf is going to be bad.
-	// It is also unclear to me if deterministic order is important here (it seems like it might be),
-	// so if this is parallalized in the future, consider whether order is important.
-
-	githubs, err := db.ExternalServices.ListGitHubConnections(ctx)
-	if err != nil {
-		return "", err
-	}
-	for _, c := range githubs {
-		repoSources = append(repoSources, reposource.GitHub{GitHubConnection: c})
-	}
-
-	gitlabs, err := db.ExternalServices.ListGitLabConnections(ctx)
-	if err != nil {
-		return "", err
-	}
-	for _, c := range gitlabs {
-		repoSources = append(repoSources, reposource.GitLab{GitLabConnection: c})
-	}
-
-	bitbuckets, err := db.ExternalServices.ListBitbucketServerConnections(ctx)
-	if err != nil {
-		return "", err
-	}
-	for _, c := range bitbuckets {
-		repoSources = append(repoSources, reposource.BitbucketServer{BitbucketServerConnection: c})
-	}
-
-	awscodecommits, err := db.ExternalServices.ListAWSCodeCommitConnections(ctx)
-	if err != nil {
-		return "", err
-	}
-	for _, c := range awscodecommits {
-		repoSources = append(repoSources, reposource.AWS{AWSCodeCommitConnection: c})
-	}
-
-	gitolites, err := db.ExternalServices.ListGitoliteConnections(ctx)
-	if err != nil {
-		return "", err
-	}
-	for _, c := range gitolites {
-		repoSources = append(repoSources, reposource.Gitolite{GitoliteConnection: c})
-	}
-
-	// Fallback for github.com
-	repoSources = append(repoSources, reposource.GitHub{
-		GitHubConnection: &schema.GitHubConnection{Url: "https://github.com"},
-	})
-	for _, ch := range repoSources {
-		repoName, err := ch.CloneURLToRepoName(cloneURL)
-		if err != nil {
-			return "", err
-		}
-		if repoName != "" {
-			return repoName, nil
-		}
-	}
-
-	return "", nil
-}
 func createFileInfo(path string, isDir bool) os.FileInfo {
 	return fileInfo{path: path, isDir: isDir}
 }
@@ -287,7 +287,7 @@ func (r *schemaResolver) SetRepositoryEnabled(ctx context.Context, args *struct
 		if err != nil {
 			return nil, err
 		}
-		if _, err := repoupdater.DefaultClient.EnqueueRepoUpdate(ctx, gitserverRepo); err != nil {
+		if _, err := repoupdater.DefaultClient.EnqueueRepoUpdate(ctx, gitserverRepo); err != nil && !repoupdater.IsAutoUpdatesDisabled(err) {
 			return nil, err
 		}
 	}
@@ -274,7 +274,7 @@ func (r *schemaResolver) UpdateAllMirrorRepositories(ctx context.Context) (*Empt
 		if err != nil {
 			return nil, err
 		}
-		if _, err := repoupdater.DefaultClient.EnqueueRepoUpdate(ctx, gitserverRepo); err != nil {
+		if _, err := repoupdater.DefaultClient.EnqueueRepoUpdate(ctx, gitserverRepo); err != nil && !repoupdater.IsAutoUpdatesDisabled(err) {
 			return nil, err
 		}
 	}
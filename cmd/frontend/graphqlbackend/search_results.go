@@ -643,6 +643,12 @@ var (
 	maxTimeout = time.Minute
 )
 
+// SearchLimitDefaults returns the limits that apply to a search query that
+// sets neither count: nor timeout:, and the maximum timeout of any query.
+func SearchLimitDefaults() (maxResults int, timeout, maxQueryTimeout time.Duration) {
+	return defaultMaxSearchResults, defaultTimeout, maxTimeout
+}
+
 func (r *searchResolver) searchTimeoutFieldSet() bool {
 	timeout, _ := r.query.StringValue(query.FieldTimeout)
 	return timeout != "" || r.countIsSet()
@@ -193,7 +193,7 @@ func newCommon(w http.ResponseWriter, r *http.Request, title string, serveError
 			}
 
 			_, err = repoupdater.DefaultClient.EnqueueRepoUpdate(ctx, gitserverRepo)
-			if err != nil {
+			if err != nil && !repoupdater.IsAutoUpdatesDisabled(err) {
 				log15.Error("EnqueueRepoUpdate", "error", err)
 			}
 		}()
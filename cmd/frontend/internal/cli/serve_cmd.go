@@ -8,10 +8,12 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/keegancsmith/tmpfriend"
@@ -21,6 +23,7 @@ import (
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/internal/bg"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/internal/cli/loghandlers"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/internal/goroutine"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/internal/httpapi"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/internal/pkg/discussions/mailreply"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/internal/pkg/siteid"
 	"github.com/sourcegraph/sourcegraph/pkg/conf"
@@ -223,6 +226,25 @@ func Main() error {
 		srv.wg.Add(1)
 
 		log15.Debug("Stopping HTTP server due to imminent restart")
+		drainStreams()
+		srv.Close()
+	}()
+
+	go func() {
+		// Give in-flight streaming responses (such as archive downloads) a
+		// chance to finish before shutting down, but shut down immediately if
+		// we receive a second signal.
+		c := make(chan os.Signal, 2)
+		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+		<-c
+		go func() {
+			<-c
+			log15.Warn("Exiting without waiting for in-flight streams due to second shutdown signal")
+			os.Exit(1)
+		}()
+
+		log15.Info("Stopping HTTP server due to shutdown signal")
+		drainStreams()
 		srv.Close()
 	}()
 
@@ -237,6 +259,14 @@ func Main() error {
 	return nil
 }
 
+// drainStreams waits (up to a grace period) for in-flight streaming responses
+// of the internal API to finish, rejecting new ones meanwhile.
+func drainStreams() {
+	if !httpapi.DrainStreams() {
+		log15.Warn("Streaming requests did not finish within the grace period; they will be interrupted.")
+	}
+}
+
 type httpServers struct {
 	mu      sync.Mutex
 	wg      sync.WaitGroup
@@ -1,8 +1,14 @@
 package httpapi
 
 import (
+	"context"
+	"testing"
+
 	"github.com/gorilla/mux"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/db"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/internal/httpapi/router"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/types"
+	"github.com/sourcegraph/sourcegraph/pkg/api"
 	"github.com/sourcegraph/sourcegraph/pkg/httptestutil"
 	"github.com/sourcegraph/sourcegraph/pkg/txemail"
 )
@@ -15,3 +21,19 @@ func newTest() *httptestutil.Client {
 	mux := NewHandler(router.New(mux.NewRouter()))
 	return httptestutil.NewTest(mux)
 }
+
+func newInternalTest() *httptestutil.Client {
+	mux := NewInternalHandler(router.NewInternal(mux.NewRouter()))
+	return httptestutil.NewTest(mux)
+}
+
+// mockEnabledRepo mocks db.Repos.GetByName to return an enabled repository
+// for any name, so that the git endpoints allow access to it. It returns a
+// function that resets the db.Repos mocks.
+func mockEnabledRepo(t *testing.T) (reset func()) {
+	t.Helper()
+	db.Mocks.Repos.GetByName = func(ctx context.Context, name api.RepoName) (*types.Repo, error) {
+		return &types.Repo{ID: 1, Name: name, Enabled: true}, nil
+	}
+	return func() { db.Mocks.Repos = db.MockRepos{} }
+}
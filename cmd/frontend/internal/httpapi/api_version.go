@@ -0,0 +1,54 @@
+package httpapi
+
+import (
+	"mime"
+	"net/http"
+
+	"github.com/sourcegraph/sourcegraph/pkg/api"
+)
+
+// withAPIVersion is a mux middleware that sets the X-API-Version header to
+// api.InternalAPIVersion on JSON responses, so that clients can detect
+// responses whose shape they don't understand.
+func withAPIVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&apiVersionWriter{ResponseWriter: w}, r)
+	})
+}
+
+// apiVersionWriter sets the X-API-Version header when the header is written
+// if, at that point, the response's content type is JSON. Handlers may
+// change the content type at any point before that.
+type apiVersionWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *apiVersionWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type")); mediaType == "application/json" {
+			w.Header().Set("X-API-Version", api.InternalAPIVersion)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *apiVersionWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher, which streaming handlers rely on.
+func (w *apiVersionWriter) Flush() {
+	f, ok := w.ResponseWriter.(http.Flusher)
+	if !ok {
+		return
+	}
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	f.Flush()
+}
@@ -0,0 +1,119 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sourcegraph/sourcegraph/pkg/env"
+)
+
+var (
+	maxConcurrentArchives, _ = strconv.Atoi(env.Get("SRC_GIT_ARCHIVE_MAX_CONCURRENCY", "32", "maximum number of concurrent git archive streams from gitserver (0 for no limit)"))
+	archiveQueueTimeout, _   = time.ParseDuration(env.Get("SRC_GIT_ARCHIVE_QUEUE_TIMEOUT", "5s", "how long a git archive request waits for a free stream before it is rejected"))
+
+	gitArchiveLimiter = newArchiveLimiter(maxConcurrentArchives, archiveQueueTimeout)
+)
+
+var (
+	archiveStreamsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "src",
+		Subsystem: "internal_api",
+		Name:      "git_archive_streams",
+		Help:      "Current number of git archive streams from gitserver.",
+	})
+	archiveQueueWait = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "src",
+		Subsystem: "internal_api",
+		Name:      "git_archive_queue_wait_seconds",
+		Help:      "Time spent waiting for a free git archive stream.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(archiveStreamsGauge)
+	prometheus.MustRegister(archiveQueueWait)
+}
+
+// archiveLimiter bounds the number of concurrent archive streams from
+// gitserver, to protect gitserver from being overloaded by the frontend.
+type archiveLimiter struct {
+	sem     chan struct{} // nil means no limit
+	timeout time.Duration
+}
+
+func newArchiveLimiter(max int, timeout time.Duration) *archiveLimiter {
+	l := &archiveLimiter{timeout: timeout}
+	if max > 0 {
+		l.sem = make(chan struct{}, max)
+	}
+	return l
+}
+
+// acquire waits until a stream is available, for at most l.timeout. The
+// returned func must be called to release the stream. If no stream becomes
+// available in time, an *archiveLimitError is returned.
+func (l *archiveLimiter) acquire(ctx context.Context) (release func(), err error) {
+	if l.sem != nil {
+		start := time.Now()
+		timer := time.NewTimer(l.timeout)
+		defer timer.Stop()
+		select {
+		case l.sem <- struct{}{}:
+		case <-timer.C:
+			return nil, &archiveLimitError{Limit: cap(l.sem), RetryAfter: l.timeout, Reset: time.Now().Add(l.timeout)}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		archiveQueueWait.Observe(time.Since(start).Seconds())
+	}
+	archiveStreamsGauge.Inc()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			archiveStreamsGauge.Dec()
+			if l.sem != nil {
+				<-l.sem
+			}
+		})
+	}, nil
+}
+
+// releaseOnClose calls release when the wrapped ReadCloser is closed.
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (r *releaseOnClose) Close() error {
+	defer r.release()
+	return r.ReadCloser.Close()
+}
+
+// archiveLimitError is returned when a git archive request could not get a
+// stream to gitserver in time.
+type archiveLimitError struct {
+	Limit      int // maximum number of concurrent streams
+	RetryAfter time.Duration
+	Reset      time.Time // when the client should retry
+}
+
+func (e *archiveLimitError) Error() string {
+	return fmt.Sprintf("too many concurrent git archive requests, retry after %s", e.RetryAfter)
+}
+
+func (e *archiveLimitError) HTTPStatusCode() int { return http.StatusTooManyRequests }
+
+func (e *archiveLimitError) ErrorCode() string { return "too_many_archive_requests" }
+
+// RateLimit implements rateLimitedError. All streams were in use when the
+// request was rejected.
+func (e *archiveLimitError) RateLimit() rateLimitState {
+	return rateLimitState{Limit: e.Limit, Remaining: 0, Reset: e.Reset}
+}
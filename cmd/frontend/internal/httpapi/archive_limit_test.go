@@ -0,0 +1,44 @@
+package httpapi
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestArchiveLimiter(t *testing.T) {
+	l := newArchiveLimiter(1, 10*time.Millisecond)
+
+	release, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The only stream is in use, so the next request is rejected.
+	if _, err := l.acquire(context.Background()); err == nil {
+		t.Fatal("got nil error, want *archiveLimitError")
+	} else if _, ok := err.(*archiveLimitError); !ok {
+		t.Fatalf("got error %v, want *archiveLimitError", err)
+	}
+
+	// Releasing twice must not free more streams than were acquired.
+	release()
+	release()
+	release2, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release2()
+	if _, err := l.acquire(context.Background()); err == nil {
+		t.Error("got nil error, want *archiveLimitError")
+	}
+}
+
+func TestArchiveLimiter_noLimit(t *testing.T) {
+	l := newArchiveLimiter(0, 0)
+	for i := 0; i < 100; i++ {
+		if _, err := l.acquire(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package httpapi
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+const (
+	// archiveShareMaxPrefix is how much of an archive with a single reader is
+	// kept in memory, so that identical requests arriving shortly after the
+	// first one can still share it.
+	archiveShareMaxPrefix = 1 << 20
+
+	// archiveShareMaxSpool is the maximum number of bytes of an archive that
+	// are spooled to disk for its readers. Readers that fall further behind
+	// read the rest of the archive from a separate git archive invocation.
+	archiveShareMaxSpool = 1 << 30
+)
+
+// archiveShares coalesces concurrent requests for the same git archive, so
+// that a burst of identical requests (e.g. from CI) runs git archive only
+// once.
+var archiveShares = &archiveGroup{
+	m:         map[string]*sharedArchive{},
+	maxPrefix: archiveShareMaxPrefix,
+	maxSpool:  archiveShareMaxSpool,
+}
+
+// archiveGroup tracks the archives that are currently being produced, keyed
+// by an identifier of their contents.
+//
+// An archive with a single reader is streamed to it directly. Only once a
+// second reader joins is the archive spooled to a temporary file, from which
+// the readers that are behind read.
+type archiveGroup struct {
+	maxPrefix, maxSpool int64
+
+	mu sync.Mutex
+	m  map[string]*sharedArchive
+}
+
+// open returns a reader for the archive identified by key. If the archive is
+// already being produced for another request (and its output so far is still
+// available), the returned reader shares that output (from the beginning).
+// Otherwise fetch is called to produce it.
+//
+// The context passed to fetch is independent of ctx, so that one client going
+// away does not affect the other clients sharing the archive. It is canceled
+// once all readers are closed. Readers that can't be served from the shared
+// output call fetch again with ctx to read the rest of the archive, so fetch
+// must produce the same output each time.
+func (g *archiveGroup) open(ctx context.Context, key string, fetch func(context.Context) (io.ReadCloser, error)) (io.ReadCloser, error) {
+	g.mu.Lock()
+	if s, ok := g.m[key]; ok && s.join() {
+		g.mu.Unlock()
+
+		select {
+		case <-s.ready:
+		case <-ctx.Done():
+			g.release(s)
+			return nil, ctx.Err()
+		}
+		if s.fetchErr != nil {
+			g.release(s)
+			return nil, s.fetchErr
+		}
+		return &sharedArchiveReader{ctx: ctx, g: g, s: s}, nil
+	}
+
+	fetchCtx, cancel := context.WithCancel(context.Background())
+	s := &sharedArchive{key: key, fetch: fetch, refs: 1, ready: make(chan struct{}), cancel: cancel}
+	s.cond = sync.NewCond(&s.mu)
+	g.m[key] = s
+	g.mu.Unlock()
+
+	s.rc, s.fetchErr = fetch(fetchCtx)
+	close(s.ready)
+	if s.fetchErr != nil {
+		g.release(s)
+		return nil, s.fetchErr
+	}
+	return &sharedArchiveReader{ctx: ctx, g: g, s: s}, nil
+}
+
+// release drops a reference to s. When the last reference is dropped, the
+// production of s is canceled (if it is still running) and its resources are
+// freed.
+func (g *archiveGroup) release(s *sharedArchive) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refs--
+	if s.refs > 0 {
+		return
+	}
+	if g.m[s.key] == s {
+		delete(g.m, s.key)
+	}
+	s.cancel()
+	if !s.pulling {
+		s.closeResources()
+	}
+}
+
+// sharedArchive is an archive that is read by one or more clients. Its output
+// is read from rc by whichever reader needs it first.
+type sharedArchive struct {
+	key    string
+	fetch  func(context.Context) (io.ReadCloser, error)
+	cancel context.CancelFunc
+
+	// ready is closed once rc or fetchErr is set.
+	ready    chan struct{}
+	rc       io.ReadCloser
+	fetchErr error
+
+	mu      sync.Mutex
+	cond    *sync.Cond           // signaled when pos, pulling, done or a reader's closed changes
+	pos     int64                // number of bytes read from rc
+	prefix  []byte               // bytes read from rc while unspooled, until they exceed maxPrefix
+	spool   *os.File             // bytes read from rc since there was more than one reader
+	spooled int64                // number of bytes written to spool
+	capped  bool                 // whether spool reached maxSpool, so that only owner reads on from rc
+	owner   *sharedArchiveReader // the reader that reads from rc once capped
+	pulling bool                 // whether a reader is reading from rc
+	done    bool                 // whether rc is exhausted (or failed)
+	err     error                // the error that rc failed with, if any
+	refs    int                  // number of requests using the archive
+}
+
+// join adds a reader to s if its output so far is still available to the new
+// reader, starting to spool it if necessary. The caller must hold g.mu.
+func (s *sharedArchive) join() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done || s.capped || s.refs == 0 {
+		return false
+	}
+	if s.spool == nil {
+		if int64(len(s.prefix)) != s.pos {
+			return false // the first reader is beyond the prefix
+		}
+		f, err := ioutil.TempFile("", "archive-share-")
+		if err != nil {
+			return false
+		}
+		// The file stays accessible through s.spool until it is closed.
+		os.Remove(f.Name())
+		if _, err := f.Write(s.prefix); err != nil {
+			f.Close()
+			return false
+		}
+		s.spool, s.spooled, s.prefix = f, s.pos, nil
+	}
+	s.refs++
+	return true
+}
+
+// closeResources closes rc and the spool. The caller must hold s.mu.
+func (s *sharedArchive) closeResources() {
+	if s.rc != nil {
+		s.rc.Close()
+		s.rc = nil
+	}
+	if s.spool != nil {
+		s.spool.Close()
+		s.spool = nil
+	}
+	s.prefix = nil
+}
+
+// sharedArchiveReader reads a sharedArchive from the beginning. If its output
+// is no longer available (because the spool reached its maximum size), the
+// rest of the archive is read from a separate fetch.
+type sharedArchiveReader struct {
+	ctx       context.Context // for the separate fetch
+	g         *archiveGroup
+	s         *sharedArchive
+	off       int64
+	closed    bool          // guarded by s.mu
+	own       io.ReadCloser // the separate fetch, if any
+	closeOnce sync.Once
+}
+
+func (r *sharedArchiveReader) Read(p []byte) (int, error) {
+	if r.own != nil {
+		return r.own.Read(p)
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	s := r.s
+	s.mu.Lock()
+	for {
+		switch {
+		case r.closed:
+			s.mu.Unlock()
+			return 0, io.ErrClosedPipe
+
+		case r.off < s.spooled:
+			if int64(len(p)) > s.spooled-r.off {
+				p = p[:s.spooled-r.off]
+			}
+			f := s.spool
+			s.mu.Unlock()
+			n, err := f.ReadAt(p, r.off)
+			r.off += int64(n)
+			if err == io.EOF {
+				err = nil
+			}
+			return n, err
+
+		case r.off < s.pos, s.capped && s.owner != r && !s.done:
+			// The output is not spooled, so it is only available from
+			// a separate fetch.
+			s.mu.Unlock()
+			if err := r.fetchOwn(); err != nil {
+				return 0, err
+			}
+			return r.own.Read(p)
+
+		case s.done:
+			err := s.err
+			s.mu.Unlock()
+			if err == nil {
+				err = io.EOF
+			}
+			return 0, err
+
+		case s.pulling:
+			s.cond.Wait()
+
+		default:
+			return r.pull(p)
+		}
+	}
+}
+
+// pull reads the next bytes of the archive from rc into p. The caller must
+// hold s.mu, which pull unlocks.
+func (r *sharedArchiveReader) pull(p []byte) (int, error) {
+	s := r.s
+	s.pulling = true
+	rc := s.rc
+	s.mu.Unlock()
+	n, err := rc.Read(p)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pulling = false
+	s.cond.Broadcast()
+
+	if n > 0 {
+		switch {
+		case s.spool != nil && !s.capped:
+			if s.spooled+int64(n) > r.g.maxSpool {
+				s.capped, s.owner = true, r
+			} else if _, werr := s.spool.WriteAt(p[:n], s.spooled); werr != nil {
+				s.capped, s.owner = true, r
+			} else {
+				s.spooled += int64(n)
+			}
+		case s.spool == nil && int64(len(s.prefix)) == s.pos:
+			if s.pos+int64(n) <= r.g.maxPrefix {
+				s.prefix = append(s.prefix, p[:n]...)
+			} else {
+				s.prefix = nil
+			}
+		}
+		s.pos += int64(n)
+		r.off += int64(n)
+	}
+	if err != nil {
+		s.done = true
+		if err != io.EOF {
+			s.err = err
+		}
+	}
+	if s.refs == 0 {
+		s.closeResources()
+	}
+
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// fetchOwn replaces r's use of the shared archive with a separate fetch,
+// positioned at r's offset.
+func (r *sharedArchiveReader) fetchOwn() error {
+	rc, err := r.s.fetch(r.ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(ioutil.Discard, rc, r.off); err != nil {
+		rc.Close()
+		return err
+	}
+
+	r.s.mu.Lock()
+	closed := r.closed
+	if !closed {
+		r.own = rc
+	}
+	r.s.mu.Unlock()
+	if closed {
+		rc.Close()
+		return io.ErrClosedPipe
+	}
+	r.closeOnce.Do(func() { r.g.release(r.s) })
+	return nil
+}
+
+func (r *sharedArchiveReader) Close() error {
+	r.s.mu.Lock()
+	r.closed = true
+	r.s.cond.Broadcast()
+	own := r.own
+	r.s.mu.Unlock()
+
+	r.closeOnce.Do(func() { r.g.release(r.s) })
+	if own != nil {
+		return own.Close()
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestArchiveGroup returns an archiveGroup whose fetch function counts its
+// calls and produces data.
+func newTestArchiveGroup(maxPrefix, maxSpool int64, data string) (g *archiveGroup, fetch func(context.Context) (io.ReadCloser, error), fetches *int32) {
+	g = &archiveGroup{m: map[string]*sharedArchive{}, maxPrefix: maxPrefix, maxSpool: maxSpool}
+	fetches = new(int32)
+	fetch = func(ctx context.Context) (io.ReadCloser, error) {
+		atomic.AddInt32(fetches, 1)
+		return ioutil.NopCloser(strings.NewReader(data)), nil
+	}
+	return g, fetch, fetches
+}
+
+func readN(t *testing.T, r io.Reader, n int) string {
+	t.Helper()
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+	return string(buf)
+}
+
+func readAll(t *testing.T, r io.Reader) string {
+	t.Helper()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestArchiveGroup(t *testing.T) {
+	g, fetch, fetches := newTestArchiveGroup(8, 1<<20, "hello world")
+
+	a, err := g.open(context.Background(), "k", fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readN(t, a, 5); got != "hello" {
+		t.Errorf("got %q, want %q", got, "hello")
+	}
+	// The first reader is still within the prefix, so later requests share
+	// the archive.
+	b, err := g.open(context.Background(), "k", fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := g.open(context.Background(), "k", fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A client going away must not affect the others.
+	c.Close()
+
+	if got := readAll(t, b); got != "hello world" {
+		t.Errorf("got %q, want %q", got, "hello world")
+	}
+	if got := readAll(t, a); got != " world" {
+		t.Errorf("got %q, want %q", got, " world")
+	}
+	a.Close()
+	b.Close()
+	if *fetches != 1 {
+		t.Errorf("got %d fetches, want 1", *fetches)
+	}
+	if len(g.m) != 0 {
+		t.Errorf("got %d in-flight archives, want 0", len(g.m))
+	}
+}
+
+func TestArchiveGroup_singleReaderNotSpooled(t *testing.T) {
+	g, fetch, _ := newTestArchiveGroup(8, 1<<20, "hello world")
+
+	rc, err := g.open(context.Background(), "k", fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if got := readAll(t, rc); got != "hello world" {
+		t.Errorf("got %q, want %q", got, "hello world")
+	}
+	if s := rc.(*sharedArchiveReader).s; s.spool != nil {
+		t.Error("archive with a single reader was spooled")
+	}
+}
+
+func TestArchiveGroup_beyondPrefix(t *testing.T) {
+	g, fetch, fetches := newTestArchiveGroup(8, 1<<20, "hello world")
+
+	a, err := g.open(context.Background(), "k", fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	readN(t, a, 9)
+
+	// The beginning of the archive is gone, so it is fetched again.
+	b, err := g.open(context.Background(), "k", fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if got := readAll(t, b); got != "hello world" {
+		t.Errorf("got %q, want %q", got, "hello world")
+	}
+	if got := readAll(t, a); got != "ld" {
+		t.Errorf("got %q, want %q", got, "ld")
+	}
+	if *fetches != 2 {
+		t.Errorf("got %d fetches, want 2", *fetches)
+	}
+}
+
+func TestArchiveGroup_spoolLimit(t *testing.T) {
+	g, fetch, fetches := newTestArchiveGroup(8, 4, "hello world")
+
+	a, err := g.open(context.Background(), "k", fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := g.open(context.Background(), "k", fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if got := readN(t, a, 3); got != "hel" {
+		t.Errorf("got %q, want %q", got, "hel")
+	}
+	// Reading beyond the spool limit leaves b behind, so b reads the rest
+	// from a separate fetch.
+	if got := readN(t, a, 3); got != "lo " {
+		t.Errorf("got %q, want %q", got, "lo ")
+	}
+	if got := readAll(t, b); got != "hello world" {
+		t.Errorf("got %q, want %q", got, "hello world")
+	}
+	if got := readAll(t, a); got != "world" {
+		t.Errorf("got %q, want %q", got, "world")
+	}
+	if *fetches != 2 {
+		t.Errorf("got %d fetches, want 2", *fetches)
+	}
+}
+
+func TestArchiveGroup_cancelWhenUnused(t *testing.T) {
+	g := &archiveGroup{m: map[string]*sharedArchive{}}
+
+	canceled := make(chan struct{})
+	pr, _ := io.Pipe()
+	rc, err := g.open(context.Background(), "k", func(ctx context.Context) (io.ReadCloser, error) {
+		go func() {
+			<-ctx.Done()
+			pr.CloseWithError(ctx.Err())
+			close(canceled)
+		}()
+		return pr, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+	<-canceled
+}
+
+func TestArchiveGroup_fetchError(t *testing.T) {
+	g := &archiveGroup{m: map[string]*sharedArchive{}}
+
+	want := errors.New("fetch failed")
+	if _, err := g.open(context.Background(), "k", func(ctx context.Context) (io.ReadCloser, error) {
+		return nil, want
+	}); err != want {
+		t.Errorf("got error %v, want %v", err, want)
+	}
+	if len(g.m) != 0 {
+		t.Errorf("got %d in-flight archives, want 0", len(g.m))
+	}
+}
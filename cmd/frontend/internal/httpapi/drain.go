@@ -0,0 +1,99 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	apirouter "github.com/sourcegraph/sourcegraph/cmd/frontend/internal/httpapi/router"
+	"github.com/sourcegraph/sourcegraph/pkg/env"
+)
+
+var streamDrainGracePeriod, _ = time.ParseDuration(env.Get("SRC_STREAM_DRAIN_GRACE_PERIOD", "30s", "maximum time given to in-flight streaming internal API requests (such as archive downloads) to finish on shutdown"))
+
+// drainingRetryAfter is the Retry-After sent with requests for streaming routes
+// that are rejected because the server is shutting down. By then, another
+// replica (or this one, restarted) should be serving.
+const drainingRetryAfter = 10 * time.Second
+
+// streamTracker tracks the in-flight requests of streaming routes so that they
+// can be allowed to finish on shutdown.
+type streamTracker struct {
+	mu       sync.Mutex
+	draining bool
+	inFlight sync.WaitGroup
+}
+
+// streams tracks the requests of the streaming routes (see
+// apirouter.IsStreaming).
+var streams = &streamTracker{}
+
+// start registers a new stream. It returns false if the tracker is draining,
+// in which case the stream must not be started.
+func (t *streamTracker) start() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return false
+	}
+	t.inFlight.Add(1)
+	return true
+}
+
+func (t *streamTracker) done() { t.inFlight.Done() }
+
+// drain stops new streams from starting and waits up to timeout for the
+// in-flight streams to finish. It reports whether they all finished.
+func (t *streamTracker) drain(timeout time.Duration) bool {
+	t.mu.Lock()
+	t.draining = true
+	t.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		t.inFlight.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// DrainStreams makes the internal API reject new requests for streaming
+// routes (such as archive downloads) with 503 Service Unavailable, and waits
+// for the in-flight ones to finish, up to a grace period. It reports whether
+// they all finished. It is called before shutting down the server, so that
+// long-running downloads are not cut off.
+func DrainStreams() bool {
+	return streams.drain(streamDrainGracePeriod)
+}
+
+// withStreamDrain is a mux middleware that tracks the requests of streaming
+// routes in streams.
+func withStreamDrain(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := mux.CurrentRoute(r)
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !apirouter.IsStreaming(route.GetName()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		t := streams
+		if !t.start() {
+			w.Header().Set("Retry-After", strconv.Itoa(int(drainingRetryAfter/time.Second)))
+			http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		defer t.done()
+		next.ServeHTTP(w, r)
+	})
+}
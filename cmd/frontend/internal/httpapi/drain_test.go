@@ -0,0 +1,86 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	apirouter "github.com/sourcegraph/sourcegraph/cmd/frontend/internal/httpapi/router"
+)
+
+func TestWithStreamDrain(t *testing.T) {
+	defer func(orig *streamTracker) { streams = orig }(streams)
+	streams = &streamTracker{}
+
+	started, release := make(chan struct{}), make(chan struct{})
+	m := mux.NewRouter()
+	m.Path("/tar").Name(apirouter.GitTar).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("archive"))
+	})
+	m.Path("/json").Name("json").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	})
+	m.Use(withStreamDrain)
+
+	inFlight := httptest.NewRecorder()
+	served := make(chan struct{})
+	go func() {
+		m.ServeHTTP(inFlight, httptest.NewRequest("GET", "/tar", nil))
+		close(served)
+	}()
+	<-started
+
+	drained := make(chan bool)
+	go func() { drained <- streams.drain(5 * time.Second) }()
+
+	// Wait for the tracker to start draining.
+	for {
+		streams.mu.Lock()
+		draining := streams.draining
+		streams.mu.Unlock()
+		if draining {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/tar", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("new stream while draining: got status %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("new stream while draining: got no Retry-After header")
+	}
+
+	// Non-streaming routes are unaffected.
+	rec = httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/json", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("JSON request while draining: got status %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	close(release)
+	<-served
+	if !<-drained {
+		t.Error("drain did not wait for the in-flight stream to finish")
+	}
+	if inFlight.Code != http.StatusOK || inFlight.Body.String() != "archive" {
+		t.Errorf("in-flight stream: got status %d and body %q, want full archive", inFlight.Code, inFlight.Body.String())
+	}
+}
+
+func TestStreamTracker_drainTimeout(t *testing.T) {
+	tr := &streamTracker{}
+	if !tr.start() {
+		t.Fatal("start failed before draining")
+	}
+	if tr.drain(10 * time.Millisecond) {
+		t.Error("drain reported success with a stream still in flight")
+	}
+	tr.done()
+}
@@ -0,0 +1,113 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/pkg/api"
+	"github.com/sourcegraph/sourcegraph/pkg/vcs/git"
+)
+
+// codedError is implemented by errors that carry a stable, machine-readable
+// code. handleError responds to such errors with a JSON body (see
+// errorResponse) so that clients can distinguish failure modes without
+// parsing error messages.
+type codedError interface {
+	error
+	ErrorCode() string
+}
+
+// errorResponse is the JSON body written for a codedError.
+type errorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// repoDisabledError is returned by the git endpoints when the repository
+// exists but is not enabled.
+type repoDisabledError struct {
+	Repo api.RepoName
+}
+
+func (e *repoDisabledError) Error() string {
+	return fmt.Sprintf("repository is disabled: %s", e.Repo)
+}
+
+func (e *repoDisabledError) HTTPStatusCode() int { return http.StatusForbidden }
+
+func (e *repoDisabledError) ErrorCode() string { return "repo_disabled" }
+
+// repoNotAllowedError is returned by the git endpoints for repositories that
+// are not in the git.accessAllowlist site configuration.
+type repoNotAllowedError struct {
+	Repo api.RepoName
+}
+
+func (e *repoNotAllowedError) Error() string {
+	return fmt.Sprintf("git access to repository is not allowed: %s", e.Repo)
+}
+
+func (e *repoNotAllowedError) HTTPStatusCode() int { return http.StatusForbidden }
+
+func (e *repoNotAllowedError) ErrorCode() string { return "repo_not_allowed" }
+
+// notSupportedError is returned by endpoints for features that this site
+// does not model.
+type notSupportedError struct {
+	Feature string
+}
+
+func (e *notSupportedError) Error() string {
+	return fmt.Sprintf("not supported: %s", e.Feature)
+}
+
+func (e *notSupportedError) HTTPStatusCode() int { return http.StatusNotImplemented }
+
+func (e *notSupportedError) ErrorCode() string { return "not_supported" }
+
+// revisionNotFoundError is returned by the git endpoints when a revision or
+// object does not exist. Unlike a plain *git.RevisionNotFoundError, its
+// message is sent to the client.
+type revisionNotFoundError struct {
+	*git.RevisionNotFoundError
+}
+
+func (e *revisionNotFoundError) ErrorCode() string { return "revision_not_found" }
+
+// noCommitBeforeError is returned by serveGitTar when no commit on the
+// default branch precedes the requested asOf time.
+type noCommitBeforeError struct {
+	Repo   api.RepoName
+	Before time.Time
+}
+
+func (e *noCommitBeforeError) Error() string {
+	return fmt.Sprintf("no commit on the default branch of %s before %s", e.Repo, e.Before.Format(time.RFC3339))
+}
+
+func (e *noCommitBeforeError) HTTPStatusCode() int { return http.StatusNotFound }
+
+func (e *noCommitBeforeError) ErrorCode() string { return "no_commit_before" }
+
+// cloneInProgressRetryAfter is the Retry-After sent with a repoCloningError.
+const cloneInProgressRetryAfter = 5 * time.Second
+
+// repoCloningError is sent instead of a *vcs.RepoNotExistError whose clone is
+// in progress, so that clients can tell a transient clone (and poll) from a
+// repository that does not exist.
+type repoCloningError struct {
+	Repo     api.RepoName
+	Progress string // progress message of the clone, if any
+}
+
+func (e *repoCloningError) Error() string {
+	if e.Progress != "" {
+		return fmt.Sprintf("repository is cloning: %s (%s)", e.Repo, e.Progress)
+	}
+	return fmt.Sprintf("repository is cloning: %s", e.Repo)
+}
+
+func (e *repoCloningError) HTTPStatusCode() int { return http.StatusAccepted }
+
+func (e *repoCloningError) ErrorCode() string { return "repo_cloning" }
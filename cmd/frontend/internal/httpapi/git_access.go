@@ -0,0 +1,33 @@
+package httpapi
+
+import (
+	log15 "gopkg.in/inconshreveable/log15.v2"
+
+	"github.com/sourcegraph/sourcegraph/pkg/api"
+	"github.com/sourcegraph/sourcegraph/pkg/conf"
+	"github.com/sourcegraph/sourcegraph/pkg/pathmatch"
+)
+
+// gitAccessAllowed reports whether the git endpoints may serve the
+// repository according to the git.accessAllowlist site configuration. An
+// empty allowlist allows all repositories.
+//
+// Invalid patterns match nothing, so that a typo never grants access to more
+// repositories than intended.
+func gitAccessAllowed(name api.RepoName) bool {
+	allowlist := conf.Get().GitAccessAllowlist
+	if len(allowlist) == 0 {
+		return true
+	}
+	for _, pattern := range allowlist {
+		m, err := pathmatch.CompilePattern(pattern, pathmatch.CompileOptions{})
+		if err != nil {
+			log15.Warn("Ignoring invalid pattern in git.accessAllowlist.", "pattern", pattern, "error", err)
+			continue
+		}
+		if m.MatchPath(string(name)) {
+			return true
+		}
+	}
+	return false
+}
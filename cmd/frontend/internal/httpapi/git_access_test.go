@@ -0,0 +1,32 @@
+package httpapi
+
+import (
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/pkg/api"
+	"github.com/sourcegraph/sourcegraph/pkg/conf"
+	"github.com/sourcegraph/sourcegraph/schema"
+)
+
+func TestGitAccessAllowed(t *testing.T) {
+	defer conf.Mock(nil)
+
+	tests := []struct {
+		allowlist []string
+		repo      api.RepoName
+		want      bool
+	}{
+		{allowlist: nil, repo: "github.com/a/b", want: true},
+		{allowlist: []string{"github.com/a/*"}, repo: "github.com/a/b", want: true},
+		{allowlist: []string{"github.com/a/*"}, repo: "github.com/A/B", want: true},
+		{allowlist: []string{"github.com/a/*"}, repo: "github.com/c/b", want: false},
+		{allowlist: []string{"github.com/c/b", "github.com/a/*"}, repo: "github.com/c/b", want: true},
+		{allowlist: []string{"github.com/[a"}, repo: "github.com/a", want: false},
+	}
+	for _, test := range tests {
+		conf.Mock(&conf.Unified{SiteConfiguration: schema.SiteConfiguration{GitAccessAllowlist: test.allowlist}})
+		if got := gitAccessAllowed(test.repo); got != test.want {
+			t.Errorf("allowlist %q, repo %q: got %v, want %v", test.allowlist, test.repo, got, test.want)
+		}
+	}
+}
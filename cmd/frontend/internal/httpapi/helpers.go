@@ -2,8 +2,10 @@ package httpapi
 
 import (
 	"encoding/json"
+	"mime"
 	"net/http"
 	"reflect"
+	"strings"
 )
 
 // writeJSON writes a JSON Content-Type header and a JSON-encoded object to the
@@ -20,3 +22,17 @@ func writeJSON(w http.ResponseWriter, v interface{}) error {
 	w.Header().Set("content-type", "application/json; charset=utf-8")
 	return json.NewEncoder(w).Encode(v)
 }
+
+// acceptsMediaType reports whether the request's Accept header explicitly
+// lists mediaType (ignoring parameters and wildcards).
+func acceptsMediaType(r *http.Request, mediaType string) bool {
+	for _, accept := range r.Header["Accept"] {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			t, _, err := mime.ParseMediaType(mediaRange)
+			if err == nil && t == mediaType {
+				return true
+			}
+		}
+	}
+	return false
+}
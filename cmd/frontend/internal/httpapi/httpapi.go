@@ -1,6 +1,11 @@
 package httpapi
 
 import (
+	"compress/flate"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"reflect"
@@ -10,6 +15,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/gorilla/schema"
 	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/envvar"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/internal/app/pkg/updatecheck"
 	apirouter "github.com/sourcegraph/sourcegraph/cmd/frontend/internal/httpapi/router"
@@ -17,6 +23,7 @@ import (
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/registry"
 	"github.com/sourcegraph/sourcegraph/pkg/env"
 	"github.com/sourcegraph/sourcegraph/pkg/trace"
+	"github.com/sourcegraph/sourcegraph/pkg/vcs"
 	log15 "gopkg.in/inconshreveable/log15.v2"
 )
 
@@ -74,28 +81,94 @@ func NewInternalHandler(m *mux.Router) http.Handler {
 	m.Get(apirouter.ReposUpdateMetadata).Handler(trace.TraceRoute(handler(serveReposUpdateMetadata)))
 	m.Get(apirouter.ReposList).Handler(trace.TraceRoute(handler(serveReposList)))
 	m.Get(apirouter.ReposListEnabled).Handler(trace.TraceRoute(handler(serveReposListEnabled)))
+	m.Get(apirouter.ReposListByExtService).Handler(trace.TraceRoute(handler(serveReposListByExternalService)))
+	m.Get(apirouter.ReposListForOrg).Handler(trace.TraceRoute(handler(serveReposListForOrg)))
+	m.Get(apirouter.ReposGetByExtRepoBatch).Handler(trace.TraceRoute(handler(serveReposGetByExternalReposBatch)))
+	m.Get(apirouter.ReposNeedingClone).Handler(trace.TraceRoute(handler(serveReposNeedingClone)))
+	m.Get(apirouter.ReposCloneStatus).Handler(trace.TraceRoute(handler(serveReposCloneStatusSummary)))
+	m.Get(apirouter.ReposRecentlyUpdated).Handler(trace.TraceRoute(handler(serveReposRecentlyUpdated)))
 	m.Get(apirouter.ReposGetByName).Handler(trace.TraceRoute(handler(serveReposGetByName)))
+	m.Get(apirouter.ReposExists).Handler(trace.TraceRoute(handler(serveReposExists)))
+	m.Get(apirouter.ReposStatus).Handler(trace.TraceRoute(handler(serveReposStatus)))
+	m.Get(apirouter.ReposCancelClone).Handler(trace.TraceRoute(handler(serveReposCancelClone)))
+	m.Get(apirouter.ReposDefaultBranches).Handler(trace.TraceRoute(handler(serveReposDefaultBranchesBatch)))
+	m.Get(apirouter.ReposPermsStatus).Handler(trace.TraceRoute(handler(serveReposPermsStatus)))
+	m.Get(apirouter.ReposPermsStatusBatch).Handler(trace.TraceRoute(handler(serveReposPermsStatusBatch)))
+	m.Get(apirouter.ReposValidateName).Handler(trace.TraceRoute(handler(serveReposValidateName)))
+	m.Get(apirouter.ReposTouch).Handler(trace.TraceRoute(handler(serveReposTouch)))
+	m.Get(apirouter.ReposDeleteByFilter).Handler(trace.TraceRoute(handler(serveReposDeleteByFilter)))
+	m.Get(apirouter.ReposGetMetadata).Handler(trace.TraceRoute(handler(serveReposGetMetadata)))
+	m.Get(apirouter.ReposSetMetadata).Handler(trace.TraceRoute(handler(serveReposSetMetadata)))
+	m.Get(apirouter.ReposGitserverShard).Handler(trace.TraceRoute(handler(serveReposGitserverShard)))
+	m.Get(apirouter.ReposGitserverShards).Handler(trace.TraceRoute(handler(serveReposGitserverShards)))
+	m.Get(apirouter.ReposInventory).Handler(trace.TraceRoute(handler(serveReposInventory)))
+	m.Get(apirouter.ReposInventoryByPath).Handler(trace.TraceRoute(handler(serveReposInventoryByPath)))
+	m.Get(apirouter.ReposInventoryUncached).Handler(trace.TraceRoute(handler(serveReposInventoryUncached)))
+	m.Get(apirouter.ReposInventoryWarm).Handler(trace.TraceRoute(handler(serveReposInventoryWarm)))
+	m.Get(apirouter.ReposHasLanguage).Handler(trace.TraceRoute(handler(serveReposHasLanguage)))
+	m.Get(apirouter.ReposLanguageStats).Handler(trace.TraceRoute(handler(serveReposLanguageStats)))
 	m.Get(apirouter.SettingsGetForSubject).Handler(trace.TraceRoute(handler(serveSettingsGetForSubject)))
+	m.Get(apirouter.SettingsUpdate).Handler(trace.TraceRoute(handler(serveSettingsUpdate)))
+	m.Get(apirouter.SettingsExistBatch).Handler(trace.TraceRoute(handler(serveSettingsExistBatch)))
 	m.Get(apirouter.SavedQueriesListAll).Handler(trace.TraceRoute(handler(serveSavedQueriesListAll)))
 	m.Get(apirouter.SavedQueriesGetInfo).Handler(trace.TraceRoute(handler(serveSavedQueriesGetInfo)))
 	m.Get(apirouter.SavedQueriesSetInfo).Handler(trace.TraceRoute(handler(serveSavedQueriesSetInfo)))
 	m.Get(apirouter.SavedQueriesDeleteInfo).Handler(trace.TraceRoute(handler(serveSavedQueriesDeleteInfo)))
+	m.Get(apirouter.SavedQueriesDeleteInfoBatch).Handler(trace.TraceRoute(handler(serveSavedQueriesDeleteInfoBatch)))
+	m.Get(apirouter.SavedQueriesReconcile).Handler(trace.TraceRoute(handler(serveSavedQueriesReconcile)))
+	m.Get(apirouter.SavedQueriesHealth).Handler(trace.TraceRoute(handler(serveSavedQueriesHealth)))
 	m.Get(apirouter.OrgsListUsers).Handler(trace.TraceRoute(handler(serveOrgsListUsers)))
 	m.Get(apirouter.OrgsGetByName).Handler(trace.TraceRoute(handler(serveOrgsGetByName)))
+	m.Get(apirouter.OrgsIsAdmin).Handler(trace.TraceRoute(handler(serveOrgsIsAdmin)))
 	m.Get(apirouter.UsersGetByUsername).Handler(trace.TraceRoute(handler(serveUsersGetByUsername)))
+	m.Get(apirouter.UsersSummary).Handler(trace.TraceRoute(handler(serveUsersSummary)))
 	m.Get(apirouter.UserEmailsGetEmail).Handler(trace.TraceRoute(handler(serveUserEmailsGetEmail)))
 	m.Get(apirouter.ExternalURL).Handler(trace.TraceRoute(handler(serveExternalURL)))
 	m.Get(apirouter.GitServerAddrs).Handler(trace.TraceRoute(handler(serveGitServerAddrs)))
 	m.Get(apirouter.CanSendEmail).Handler(trace.TraceRoute(handler(serveCanSendEmail)))
+	m.Get(apirouter.EmailVerificationRequired).Handler(trace.TraceRoute(handler(serveEmailVerificationRequired)))
+	m.Get(apirouter.EmailConfig).Handler(trace.TraceRoute(handler(serveEmailConfig)))
 	m.Get(apirouter.SendEmail).Handler(trace.TraceRoute(handler(serveSendEmail)))
+	m.Get(apirouter.SendEmailBatch).Handler(trace.TraceRoute(handler(serveSendEmailBatch)))
+	m.Get(apirouter.Extension).Handler(trace.TraceRoute(handler(serveExtension)))
+	m.Get(apirouter.ExtensionsWarm).Handler(trace.TraceRoute(handler(serveExtensionsWarm)))
+	m.Get(apirouter.ExtensionsList).Handler(trace.TraceRoute(handler(serveExtensionsList)))
+	m.Get(apirouter.GitVersion).Handler(trace.TraceRoute(handler(serveGitVersion)))
+	m.Get(apirouter.GitserverDiskInfo).Handler(trace.TraceRoute(handler(serveGitserverDiskInfo)))
 	m.Get(apirouter.GitResolveRevision).Handler(trace.TraceRoute(handler(serveGitResolveRevision)))
+	m.Get(apirouter.GitResolveRevisions).Handler(trace.TraceRoute(handler(serveGitResolveRevisions)))
+	m.Get(apirouter.GitCommits).Handler(trace.TraceRoute(handler(serveGitCommits)))
+	m.Get(apirouter.GitIsAncestor).Handler(trace.TraceRoute(handler(serveGitIsAncestor)))
+	m.Get(apirouter.GitMergeBaseDiffStat).Handler(trace.TraceRoute(handler(serveGitMergeBaseDiffStat)))
+	m.Get(apirouter.GitTagsContaining).Handler(trace.TraceRoute(handler(serveGitTagsContaining)))
+	m.Get(apirouter.GitBranchesContaining).Handler(trace.TraceRoute(handler(serveGitBranchesContaining)))
+	m.Get(apirouter.GitHasSubmodules).Handler(trace.TraceRoute(handler(serveGitHasSubmodules)))
+	m.Get(apirouter.GitSubmodules).Handler(trace.TraceRoute(handler(serveGitSubmodules)))
+	m.Get(apirouter.GitRefs).Handler(trace.TraceRoute(handler(serveGitRefs)))
+	m.Get(apirouter.GitObjectType).Handler(trace.TraceRoute(handler(serveGitObjectType)))
+	m.Get(apirouter.GitBlob).Handler(trace.TraceRoute(handler(serveGitBlob)))
+	m.Get(apirouter.GitPathExists).Handler(trace.TraceRoute(handler(serveGitPathExists)))
+	m.Get(apirouter.GitFileType).Handler(trace.TraceRoute(handler(serveGitFileType)))
+	m.Get(apirouter.GitFileSymbols).Handler(trace.TraceRoute(handler(serveGitFileSymbols)))
+	m.Get(apirouter.GitTreeRecursive).Handler(trace.TraceRoute(handler(serveGitTreeRecursive)))
+	m.Get(apirouter.GitLargestFiles).Handler(trace.TraceRoute(handler(serveGitLargestFiles)))
+	m.Get(apirouter.GitLogStream).Handler(trace.TraceRoute(handler(serveGitLogStream)))
+	m.Get(apirouter.GitCommitsBetween).Handler(trace.TraceRoute(handler(serveGitCommitsBetween)))
+	m.Get(apirouter.GitDiff).Handler(trace.TraceRoute(handler(serveGitDiff)))
+	m.Get(apirouter.GitDiffTrees).Handler(trace.TraceRoute(handler(serveGitDiffTrees)))
 	m.Get(apirouter.GitTar).Handler(trace.TraceRoute(handler(serveGitTar)))
+	m.Get(apirouter.GitArchiveChecksum).Handler(trace.TraceRoute(handler(serveGitArchiveChecksum)))
 	m.Get(apirouter.Telemetry).Handler(trace.TraceRoute(telemetryHandler))
 	m.Get(apirouter.GraphQL).Handler(trace.TraceRoute(handler(serveGraphQL)))
 	m.Get(apirouter.Configuration).Handler(trace.TraceRoute(handler(serveConfiguration)))
 	m.Get(apirouter.SearchConfiguration).Handler(trace.TraceRoute(handler(serveSearchConfiguration)))
+	m.Get(apirouter.SearchLimits).Handler(trace.TraceRoute(handler(serveSearchLimitsForSubject)))
 	m.Path("/ping").Methods("GET").Name("ping").HandlerFunc(handlePing)
 
+	m.Use(withAPIVersion)
+	m.Use(withStreamDrain)
+	m.Use(withRouteTimeout)
+
 	m.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("API no route: %s %s from %s", r.Method, r.URL, r.Referer())
 		http.Error(w, "no route", http.StatusNotFound)
@@ -108,13 +181,84 @@ func NewInternalHandler(m *mux.Router) http.Handler {
 func handler(h func(http.ResponseWriter, *http.Request) error) http.Handler {
 	return handlerutil.HandlerWithErrorReturn{
 		Handler: func(w http.ResponseWriter, r *http.Request) error {
+			defer recoverPanic(w, r)
 			w.Header().Set("Content-Type", "application/json")
+			if err := decompressRequestBody(r); err != nil {
+				return err
+			}
 			return h(w, r)
 		},
 		Error: handleError,
 	}
 }
 
+// maxDecompressedRequestBodySize is the maximum size of a gzip-compressed
+// request body after decompression. It protects against decompression bombs.
+var maxDecompressedRequestBodySize int64 = 100 * 1024 * 1024
+
+// decompressRequestBody transparently decompresses the request body if the
+// client sent it with "Content-Encoding: gzip". Reading more than
+// maxDecompressedRequestBodySize bytes from the decompressed body fails.
+func decompressRequestBody(r *http.Request) error {
+	if r.Header.Get("Content-Encoding") != "gzip" {
+		return nil
+	}
+	zr, err := gzip.NewReader(r.Body)
+	if err != nil {
+		return &requestBodyError{Status: http.StatusBadRequest, Err: errors.Wrap(err, "gzip request body")}
+	}
+	r.Body = &decompressedBody{
+		r:      io.LimitReader(zr, maxDecompressedRequestBodySize+1),
+		Closer: r.Body,
+		max:    maxDecompressedRequestBodySize,
+	}
+	r.Header.Del("Content-Encoding")
+	r.ContentLength = -1
+	return nil
+}
+
+// requestBodyError is returned when reading a gzip-compressed request body
+// fails because the body is invalid (400 Bad Request) or too large (413
+// Request Entity Too Large). Handlers usually wrap it (e.g. with "Decode"), so
+// handleError looks for it in the cause of the error.
+type requestBodyError struct {
+	Status int
+	Err    error
+}
+
+func (e *requestBodyError) Error() string { return e.Err.Error() }
+
+func (e *requestBodyError) HTTPStatusCode() int { return e.Status }
+
+// decompressedBody is the decompressed body of a gzip-compressed request. Its
+// errors for an invalid or oversized body are *requestBodyError.
+type decompressedBody struct {
+	r         io.Reader // the decompressed body, limited to max+1 bytes
+	io.Closer           // the original request body
+	n, max    int64
+}
+
+func (b *decompressedBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.n += int64(n)
+	if b.n > b.max {
+		return n - int(b.n-b.max), &requestBodyError{Status: http.StatusRequestEntityTooLarge, Err: fmt.Errorf("decompressed request body exceeds %d bytes", b.max)}
+	}
+	if isGzipFormatError(err) {
+		err = &requestBodyError{Status: http.StatusBadRequest, Err: errors.Wrap(err, "gzip request body")}
+	}
+	return n, err
+}
+
+// isGzipFormatError reports whether err is an error of a gzip.Reader for
+// invalid (or truncated) compressed data.
+func isGzipFormatError(err error) bool {
+	if _, ok := err.(flate.CorruptInputError); ok {
+		return true
+	}
+	return err == gzip.ErrChecksum || err == gzip.ErrHeader || err == io.ErrUnexpectedEOF
+}
+
 var schemaDecoder = schema.NewDecoder()
 
 func init() {
@@ -144,6 +288,33 @@ func handleError(w http.ResponseWriter, r *http.Request, status int, err error)
 	// Never cache error responses.
 	w.Header().Set("cache-control", "no-cache, max-age=0")
 
+	if e, ok := err.(rateLimitedError); ok {
+		setRateLimitHeaders(w, e.RateLimit(), time.Now())
+	}
+
+	if e, ok := errors.Cause(err).(*requestBodyError); ok {
+		status = e.HTTPStatusCode()
+	}
+
+	// Handlers often wrap the errors of the git commands they run, so look at
+	// the cause.
+	if e, ok := errors.Cause(err).(*vcs.RepoNotExistError); ok && e.CloneInProgress {
+		w.Header().Set("Retry-After", strconv.Itoa(int(cloneInProgressRetryAfter.Seconds())))
+		err = &repoCloningError{Repo: e.Repo, Progress: e.CloneProgress}
+		status = http.StatusAccepted
+	}
+
+	// Errors with a code are part of the API contract, so we always send
+	// them to the client as JSON.
+	if ce, ok := err.(codedError); ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(errorResponse{Error: ce.Error(), Code: ce.ErrorCode()}); err != nil {
+			log15.Error("error encoding API error response", "err", err)
+		}
+		return
+	}
+
 	errBody := err.Error()
 
 	var displayErrBody string
@@ -0,0 +1,49 @@
+package httpapi
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// idsAsStrings reports whether the client asked for IDs to be encoded as JSON
+// strings instead of numbers, either with the "idsAsStrings" query parameter
+// or with an "ids=string" parameter in the Accept header (e.g.
+// "application/json; ids=string"). JavaScript clients lose precision for
+// numbers above 2^53, so this lets them keep working if IDs are widened.
+func idsAsStrings(r *http.Request) bool {
+	if v, _ := strconv.ParseBool(r.URL.Query().Get("idsAsStrings")); v {
+		return true
+	}
+	for _, accept := range r.Header["Accept"] {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			_, params, err := mime.ParseMediaType(mediaRange)
+			if err == nil && params["ids"] == "string" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsonID returns the value to JSON-encode for id, according to
+// idsAsStrings.
+func jsonID(r *http.Request, id int32) interface{} {
+	if idsAsStrings(r) {
+		return strconv.FormatInt(int64(id), 10)
+	}
+	return id
+}
+
+// jsonIDs is like jsonID, for a list of IDs.
+func jsonIDs(r *http.Request, ids []int32) interface{} {
+	if !idsAsStrings(r) {
+		return ids
+	}
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = strconv.FormatInt(int64(id), 10)
+	}
+	return strs
+}
@@ -0,0 +1,49 @@
+package httpapi
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestIDsAsStrings(t *testing.T) {
+	tests := []struct {
+		url    string
+		accept string
+		want   bool
+	}{
+		{url: "/", want: false},
+		{url: "/?idsAsStrings=true", want: true},
+		{url: "/?idsAsStrings=false", want: false},
+		{url: "/", accept: "application/json", want: false},
+		{url: "/", accept: "application/json; ids=string", want: true},
+		{url: "/", accept: "text/plain, application/json;ids=string", want: true},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", test.url, nil)
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+		if got := idsAsStrings(r); got != test.want {
+			t.Errorf("%s (Accept: %q): got %v, want %v", test.url, test.accept, got, test.want)
+		}
+	}
+}
+
+func TestJSONIDs(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", nil)
+	if got, want := jsonID(r, 12345), interface{}(int32(12345)); got != want {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+	if got, want := jsonIDs(r, []int32{1, 2}), interface{}([]int32{1, 2}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+
+	r = httptest.NewRequest("POST", "/?idsAsStrings=true", nil)
+	if got, want := jsonID(r, 12345), interface{}("12345"); got != want {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+	if got, want := jsonIDs(r, []int32{1, 2}), interface{}([]string{"1", "2"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+}
@@ -1,9 +1,27 @@
 package httpapi
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	log15 "gopkg.in/inconshreveable/log15.v2"
 
@@ -12,12 +30,24 @@ import (
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/backend"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/db"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/globals"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/graphqlbackend"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/internal/inventory"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/internal/pkg/usagestats"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/registry"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/types"
 	"github.com/sourcegraph/sourcegraph/pkg/api"
 	"github.com/sourcegraph/sourcegraph/pkg/conf"
+	"github.com/sourcegraph/sourcegraph/pkg/env"
+	"github.com/sourcegraph/sourcegraph/pkg/errcode"
 	"github.com/sourcegraph/sourcegraph/pkg/gitserver"
+	"github.com/sourcegraph/sourcegraph/pkg/gitserver/protocol"
 	"github.com/sourcegraph/sourcegraph/pkg/jsonc"
+	"github.com/sourcegraph/sourcegraph/pkg/pathmatch"
+	"github.com/sourcegraph/sourcegraph/pkg/rcache"
+	registryclient "github.com/sourcegraph/sourcegraph/pkg/registry"
+	symbolsprotocol "github.com/sourcegraph/sourcegraph/pkg/symbols/protocol"
 	"github.com/sourcegraph/sourcegraph/pkg/txemail"
+	"github.com/sourcegraph/sourcegraph/pkg/vcs"
 	"github.com/sourcegraph/sourcegraph/pkg/vcs/git"
 )
 
@@ -27,7 +57,38 @@ func serveReposGetByName(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return err
 	}
-	data, err := json.Marshal(repo)
+
+	resp := struct {
+		*types.Repo
+		*repoLastFetched
+		*repoHead
+	}{Repo: repo}
+
+	// LastFetched is only included if requested, since it costs a gitserver
+	// round trip that most callers don't need. It is null if the repository
+	// was never fetched or if gitserver could not be reached. We don't fail
+	// the request in the latter case because the repository itself is still
+	// useful.
+	if withLastFetched, _ := strconv.ParseBool(r.URL.Query().Get("withLastFetched")); withLastFetched {
+		resp.repoLastFetched = &repoLastFetched{}
+		if info, err := gitserverRepoInfo(r.Context(), repo.Name); err != nil {
+			log15.Warn("Failed to get repository info from gitserver", "repo", repo.Name, "error", err)
+		} else if ri := info.Results[repo.Name]; ri != nil {
+			resp.LastFetched = ri.LastFetched
+		}
+	}
+
+	// The default branch is only included if requested, to save callers that
+	// resolve it anyway a round trip. Like LastFetched, its fields are null
+	// if it cannot be determined.
+	if withHead, _ := strconv.ParseBool(r.URL.Query().Get("withHead")); withHead {
+		resp.repoHead = &repoHead{}
+		if err := resp.repoHead.resolve(r.Context(), repo.Name); err != nil {
+			log15.Warn("Failed to resolve default branch of repository", "repo", repo.Name, "error", err)
+		}
+	}
+
+	data, err := json.Marshal(resp)
 	if err != nil {
 		return err
 	}
@@ -36,433 +97,3593 @@ func serveReposGetByName(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
-func serveReposCreateIfNotExists(w http.ResponseWriter, r *http.Request) error {
-	var repo api.RepoCreateOrUpdateRequest
-	err := json.NewDecoder(r.Body).Decode(&repo)
-	if err != nil {
-		return err
+func serveReposExists(w http.ResponseWriter, r *http.Request) error {
+	var req api.ReposExistsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
 	}
-	err = backend.Repos.Upsert(r.Context(), api.InsertRepoOp{
-		Name:         repo.RepoName,
-		Description:  repo.Description,
-		Fork:         repo.Fork,
-		Archived:     repo.Archived,
-		Enabled:      repo.Enabled,
-		ExternalRepo: repo.ExternalRepo,
-	})
+	// Only consult the database so that we never trigger a repo-updater
+	// lookup (and possibly a clone) for a repository we don't know about.
+	exists, err := db.Repos.Exists(r.Context(), req.Repo)
 	if err != nil {
-		return err
+		return errors.Wrap(err, "Repos.Exists")
 	}
-	sgRepo, err := backend.Repos.GetByName(r.Context(), repo.RepoName)
-	if err != nil {
-		return err
+	if err := json.NewEncoder(w).Encode(api.ReposExistsResponse{Exists: exists}); err != nil {
+		return errors.Wrap(err, "Encode")
 	}
-	data, err := json.Marshal(sgRepo)
-	if err != nil {
-		return err
+	return nil
+}
+
+// serveReposStatus responds with whether a repository exists, is enabled and
+// is cloned (or being cloned), and with its default branch. It lets callers
+// find out why git operations on a repository would fail with a single
+// request. Only the database and gitserver are consulted, never the code host.
+func serveReposStatus(w http.ResponseWriter, r *http.Request) error {
+	var req api.ReposStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+
+	var resp api.ReposStatusResponse
+	repo, err := db.Repos.GetByName(r.Context(), req.Repo)
+	if err != nil && !errcode.IsNotFound(err) {
+		return errors.Wrap(err, "Repos.GetByName")
+	}
+	if repo != nil {
+		resp.Exists = true
+		resp.Enabled = repo.Enabled
+
+		info, err := gitserverRepoInfo(r.Context(), repo.Name)
+		if err != nil {
+			return errors.Wrap(err, "RepoInfo")
+		}
+		if ri := info.Results[repo.Name]; ri != nil {
+			resp.Cloned = ri.Cloned
+			resp.Cloning = ri.CloneInProgress
+		}
+		if resp.Cloned {
+			var head repoHead
+			if err := head.resolve(r.Context(), repo.Name); err != nil {
+				return err
+			}
+			resp.DefaultBranch = head.DefaultBranch
+			resp.HeadCommit = head.HeadCommit
+		}
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return errors.Wrap(err, "Encode")
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Write(data)
 	return nil
 }
 
-func serveReposUpdateMetadata(w http.ResponseWriter, r *http.Request) error {
-	var repo api.ReposUpdateMetadataRequest
-	err := json.NewDecoder(r.Body).Decode(&repo)
-	if err != nil {
-		return err
+const (
+	// maxDefaultBranchesBatch is the maximum number of repositories accepted
+	// by serveReposDefaultBranchesBatch in a single request.
+	maxDefaultBranchesBatch = 500
+
+	// maxConcurrentDefaultBranches is the maximum number of default branches
+	// resolved concurrently by serveReposDefaultBranchesBatch.
+	maxConcurrentDefaultBranches = 16
+)
+
+// serveReposDefaultBranchesBatch resolves the default branch and its commit
+// for each of the given repositories, in the order given. Like
+// serveReposStatus, it only consults the database and gitserver, so it never
+// triggers a repo-updater lookup. A repository that cannot be resolved does
+// not fail the request; its entry reports why instead.
+func serveReposDefaultBranchesBatch(w http.ResponseWriter, r *http.Request) error {
+	var req api.ReposDefaultBranchesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
 	}
-	if err := db.Repos.UpdateRepositoryMetadata(r.Context(), repo.RepoName, repo.Description, repo.Fork, repo.Archived); err != nil {
-		return errors.Wrap(err, "Repos.UpdateRepositoryMetadata failed")
+	if len(req.Repos) > maxDefaultBranchesBatch {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: fmt.Errorf("at most %d repositories may be requested at once", maxDefaultBranchesBatch)}
+	}
+
+	results := make([]api.RepoDefaultBranch, len(req.Repos))
+	if len(req.Repos) > 0 {
+		info, err := gitserverRepoInfo(r.Context(), req.Repos...)
+		if err != nil {
+			return errors.Wrap(err, "RepoInfo")
+		}
+
+		var (
+			wg  sync.WaitGroup
+			sem = make(chan struct{}, maxConcurrentDefaultBranches)
+		)
+		for i, name := range req.Repos {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(res *api.RepoDefaultBranch, name api.RepoName) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				*res = resolveDefaultBranch(r.Context(), name, info.Results[name])
+			}(&results[i], name)
+		}
+		wg.Wait()
+	}
+
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		return errors.Wrap(err, "Encode")
 	}
 	return nil
 }
 
-func servePhabricatorRepoCreate(w http.ResponseWriter, r *http.Request) error {
-	var repo api.PhabricatorRepoCreateRequest
-	err := json.NewDecoder(r.Body).Decode(&repo)
-	if err != nil {
-		return err
+// resolveDefaultBranch returns the default branch entry of the repository for
+// serveReposDefaultBranchesBatch, given its clone status on gitserver.
+func resolveDefaultBranch(ctx context.Context, name api.RepoName, ri *protocol.RepoInfo) api.RepoDefaultBranch {
+	res := api.RepoDefaultBranch{Repo: name}
+	if err := ensureGitAccess(ctx, name); err != nil {
+		res.Status, res.Error = api.DefaultBranchStatusError, err.Error()
+		return res
 	}
-	phabRepo, err := db.Phabricator.CreateOrUpdate(r.Context(), repo.Callsign, repo.RepoName, repo.URL)
-	if err != nil {
-		return err
+	switch {
+	case ri == nil:
+		res.Status, res.Error = api.DefaultBranchStatusError, "no clone status from gitserver"
+		return res
+	case ri.CloneInProgress:
+		res.Status = api.DefaultBranchStatusCloning
+		return res
+	case !ri.Cloned:
+		res.Status = api.DefaultBranchStatusNotCloned
+		return res
 	}
-	data, err := json.Marshal(phabRepo)
+
+	var head repoHead
+	if err := head.resolve(ctx, name); err != nil {
+		res.Status, res.Error = api.DefaultBranchStatusError, err.Error()
+		return res
+	}
+	if head.HeadCommit == nil {
+		res.Status = api.DefaultBranchStatusEmpty
+		return res
+	}
+	res.Status, res.CommitID = api.DefaultBranchStatusOK, *head.HeadCommit
+	if head.DefaultBranch != nil {
+		res.DefaultBranch = *head.DefaultBranch
+	}
+	return res
+}
+
+// maxPermsStatusBatch is the maximum number of repositories accepted by
+// serveReposPermsStatusBatch in a single request.
+const maxPermsStatusBatch = 500
+
+// serveReposPermsStatus responds with where the permissions of a repository
+// come from: the authz provider that enforces them or, if there is none,
+// whether the repository is readable by all users or only by site admins. It
+// does not check (or refresh) the permissions of any user.
+func serveReposPermsStatus(w http.ResponseWriter, r *http.Request) error {
+	var req api.ReposPermsStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	repo, err := db.Repos.GetByName(r.Context(), req.Repo)
 	if err != nil {
 		return err
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Write(data)
+	if err := json.NewEncoder(w).Encode(repoPermsStatuses(r.Context(), []*types.Repo{repo})[0]); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
 	return nil
 }
 
-// serveExternalServiceConfigs serves a JSON response that is an array of all
-// external service configs that match the requested kind.
-func serveExternalServiceConfigs(w http.ResponseWriter, r *http.Request) error {
-	var req api.ExternalServiceConfigsRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
-	if err != nil {
-		return err
+// serveReposPermsStatusBatch is like serveReposPermsStatus for each of the
+// given repositories, in the order given. A repository that does not exist
+// does not fail the request; its entry reports it instead.
+func serveReposPermsStatusBatch(w http.ResponseWriter, r *http.Request) error {
+	var req api.ReposPermsStatusBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
 	}
-	services, err := db.ExternalServices.List(r.Context(), db.ExternalServicesListOptions{
-		Kinds: []string{req.Kind},
-	})
-	if err != nil {
-		return err
+	if len(req.Repos) > maxPermsStatusBatch {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: fmt.Errorf("at most %d repositories may be requested at once", maxPermsStatusBatch)}
 	}
 
-	// Instead of returning an intermediate response type, we directly return
-	// the array of configs (which are themselves JSON objects).
-	// This makes it possible for the caller to directly unmarshal the response into
-	// a slice of connection configurations for this external service kind.
-	configs := make([]map[string]interface{}, 0, len(services))
-	for _, service := range services {
-		var config map[string]interface{}
-		// Raw configs may have comments in them so we have to use a json parser
-		// that supports comments in json.
-		if err := jsonc.Unmarshal(service.Config, &config); err != nil {
-			log15.Error(
-				"ignoring external service config that has invalid json",
-				"id", service.ID,
-				"displayName", service.DisplayName,
-				"config", service.Config,
-				"err", err,
-			)
+	results := make([]api.RepoPermsStatus, len(req.Repos))
+	var repos []*types.Repo
+	for i, name := range req.Repos {
+		repo, err := db.Repos.GetByName(r.Context(), name)
+		if errcode.IsNotFound(err) {
+			results[i] = api.RepoPermsStatus{Repo: name, Error: "repository not found"}
 			continue
+		} else if err != nil {
+			return errors.Wrap(err, "Repos.GetByName")
 		}
-		configs = append(configs, config)
+		repos = append(repos, repo)
 	}
-	return json.NewEncoder(w).Encode(configs)
-}
-
-// serveExternalServicesList serves a JSON response that is an array of all external services
-// of the given kind
-func serveExternalServicesList(w http.ResponseWriter, r *http.Request) error {
-	var req api.ExternalServicesListRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
-	if err != nil {
-		return err
+	statuses := repoPermsStatuses(r.Context(), repos)
+	for i := range results {
+		if results[i].Error == "" {
+			results[i], statuses = statuses[0], statuses[1:]
+		}
 	}
 
-	if len(req.Kinds) == 0 {
-		req.Kinds = append(req.Kinds, req.Kind)
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		return errors.Wrap(err, "Encode")
 	}
+	return nil
+}
 
-	services, err := db.ExternalServices.List(r.Context(), db.ExternalServicesListOptions{
-		Kinds: req.Kinds,
-	})
-	if err != nil {
-		return err
+// repoPermsStatuses returns the permissions status of each of repos, in the
+// same order.
+func repoPermsStatuses(ctx context.Context, repos []*types.Repo) []api.RepoPermsStatus {
+	allowByDefault, claimed := db.RepoPermsProviders(ctx, repos)
+	statuses := make([]api.RepoPermsStatus, len(repos))
+	for i, repo := range repos {
+		st := api.RepoPermsStatus{Repo: repo.Name}
+		switch p, ok := claimed[repo.Name]; {
+		case ok:
+			st.Tracked, st.ServiceType, st.ServiceID = true, p.ServiceType(), p.ServiceID()
+			st.Reason = "permissions are fetched from the code host by the authz provider and cached per user"
+		case repo.ExternalRepo == nil || repo.ExternalRepo.ID == "" || repo.ExternalRepo.ServiceType == "" || repo.ExternalRepo.ServiceID == "":
+			st.Reason = "repository has no external repository spec, so only site admins can read it"
+		case allowByDefault:
+			st.Unrestricted = true
+			st.Reason = "repository is not claimed by any authz provider, so all users can read it"
+		default:
+			st.Reason = "repository is not claimed by any authz provider and access is denied by default, so only site admins can read it"
+		}
+		statuses[i] = st
 	}
-	return json.NewEncoder(w).Encode(services)
+	return statuses
 }
 
-func serveConfiguration(w http.ResponseWriter, r *http.Request) error {
-	raw, err := globals.ConfigurationServerFrontendOnly.Source.Read(r.Context())
+// gitserverCancelClone is gitserver.DefaultClient.CancelClone. It is a
+// variable so that tests can mock it.
+var gitserverCancelClone = func(ctx context.Context, repo api.RepoName) (*protocol.CancelCloneResponse, error) {
+	return gitserver.DefaultClient.CancelClone(ctx, repo)
+}
+
+// serveReposCancelClone cancels the queued or in-progress clone of a
+// repository on gitserver and responds with the resulting clone state. If the
+// repository is not being cloned, nothing is canceled and Canceled is false.
+func serveReposCancelClone(w http.ResponseWriter, r *http.Request) error {
+	var req api.ReposCancelCloneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	repo, err := db.Repos.GetByName(r.Context(), req.Repo)
 	if err != nil {
 		return err
 	}
-	err = json.NewEncoder(w).Encode(raw)
+	res, err := gitserverCancelClone(r.Context(), repo.Name)
 	if err != nil {
+		return errors.Wrap(err, "CancelClone")
+	}
+	resp := api.ReposCancelCloneResponse{
+		Canceled: res.Canceled,
+		Cloning:  res.CloneInProgress,
+		Cloned:   res.Cloned,
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		return errors.Wrap(err, "Encode")
 	}
 	return nil
 }
 
-// serveSearchConfiguration is _only_ used by the zoekt index server. Zoekt does
-// not depend on frontend and therefore does not have access to `conf.Watch`.
-// Additionally, it only cares about certain search specific settings so this
-// search specific endpoint is used rather than serving the entire site settings
-// from /.internal/configuration.
-func serveSearchConfiguration(w http.ResponseWriter, r *http.Request) error {
-	largeFiles := conf.Get().SearchLargeFiles
-	opts := struct {
-		LargeFiles []string
-	}{
-		LargeFiles: largeFiles,
+// serveReposValidateName checks whether a name would be accepted for a new
+// repository. It applies the same validation as repository creation, but never
+// touches the database.
+func serveReposValidateName(w http.ResponseWriter, r *http.Request) error {
+	var req api.ReposValidateNameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
 	}
-	err := json.NewEncoder(w).Encode(opts)
-	if err != nil {
-		return errors.Wrap(err, "encode")
+	resp := api.ReposValidateNameResponse{Valid: true}
+	if err := db.ValidateRepoName(req.Repo); err != nil {
+		resp = api.ReposValidateNameResponse{Reason: err.Error()}
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return errors.Wrap(err, "Encode")
 	}
 	return nil
 }
 
-func serveReposList(w http.ResponseWriter, r *http.Request) error {
-	var opt db.ReposListOptions
-	err := json.NewDecoder(r.Body).Decode(&opt)
-	if err != nil {
-		return err
+// serveReposTouch bumps the updated_at time of a repository, so that
+// integrations that changed repository-related data outside of Sourcegraph can
+// make it reappear in incremental syncs.
+func serveReposTouch(w http.ResponseWriter, r *http.Request) error {
+	var req api.ReposTouchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
 	}
-	res, err := backend.Repos.List(r.Context(), opt)
+	updatedAt, err := db.Repos.Touch(r.Context(), req.RepoID)
 	if err != nil {
 		return err
 	}
+	if err := json.NewEncoder(w).Encode(api.ReposTouchResponse{UpdatedAt: updatedAt}); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
 
-	// BACKCOMPAT: Add a "URI" field because zoekt-sourcegraph-indexserver expects one to exist
-	// (with the repository name). This is a legacy of the rename from "repo URI" to "repo name".
-	type repoWithBackcompatURIField struct {
-		URI string
-		*types.Repo
+// serveReposDeleteByFilter soft-deletes and disables all repositories matching
+// a filter, such as all repositories of a code host that is being
+// decommissioned.
+//
+// A dry run only counts the matching repositories and returns a confirmation
+// token, which must be passed back to actually delete them. The token is
+// derived from the filter and the count, so it is rejected if the set of
+// matching repositories grew or shrank since the dry run.
+func serveReposDeleteByFilter(w http.ResponseWriter, r *http.Request) error {
+	var req api.ReposDeleteByFilterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
 	}
-	res2 := make([]*repoWithBackcompatURIField, len(res))
-	for i, repo := range res {
-		res2[i] = &repoWithBackcompatURIField{
-			URI:  string(repo.Name),
-			Repo: repo,
-		}
+	if req.ExternalServiceID == "" && req.NameGlob == "" {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.New("externalServiceID or nameGlob must be specified")}
 	}
 
-	data, err := json.Marshal(res2)
-	if err != nil {
-		return err
+	opt := db.ReposListOptions{Enabled: true, Disabled: true}
+	if req.ExternalServiceID != "" {
+		opt.ExternalServiceIDs = []string{req.ExternalServiceID}
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Write(data)
-	return nil
-}
-
-func serveReposListEnabled(w http.ResponseWriter, r *http.Request) error {
-	names, err := db.Repos.ListEnabledNames(r.Context())
-	if err != nil {
-		return err
+	if req.NameGlob != "" {
+		opt.IncludePatterns = []string{globToRegexp(req.NameGlob)}
 	}
-	return json.NewEncoder(w).Encode(names)
-}
 
-func serveSavedQueriesListAll(w http.ResponseWriter, r *http.Request) error {
-	// List settings for all users, orgs, etc.
-	settings, err := db.Settings.ListAll(r.Context(), "")
+	count, err := db.Repos.Count(r.Context(), opt)
 	if err != nil {
-		return errors.Wrap(err, "db.Settings.ListAll")
+		return errors.Wrap(err, "Repos.Count")
 	}
+	token := deleteByFilterToken(req, count)
 
-	queries := make([]api.SavedQuerySpecAndConfig, 0, len(settings))
-	for _, settings := range settings {
-		var config api.PartialConfigSavedQueries
-		if err := jsonc.Unmarshal(settings.Contents, &config); err != nil {
-			return err
+	resp := api.ReposDeleteByFilterResponse{Count: count}
+	if req.DryRun {
+		resp.ConfirmationToken = token
+	} else {
+		if req.ConfirmationToken != token {
+			return &errcode.HTTPErr{Status: http.StatusConflict, Err: errors.New("invalid confirmation token (perform a dry run with the same filter to obtain one)")}
 		}
-		for _, query := range config.SavedQueries {
-			spec := api.SavedQueryIDSpec{Subject: settings.Subject, Key: query.Key}
-			queries = append(queries, api.SavedQuerySpecAndConfig{
-				Spec:   spec,
-				Config: query,
-			})
+		// Repositories may have been added or removed between the Count
+		// above and the deletion, so the deletion is rolled back unless it
+		// affects exactly the confirmed number of repositories.
+		resp.Count, err = db.Repos.DeleteMatching(r.Context(), opt, count)
+		if err != nil {
+			if _, ok := err.(*db.DeleteCountMismatchError); ok {
+				return &errcode.HTTPErr{Status: http.StatusConflict, Err: err}
+			}
+			return errors.Wrap(err, "Repos.DeleteMatching")
 		}
 	}
-
-	if err := json.NewEncoder(w).Encode(queries); err != nil {
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		return errors.Wrap(err, "Encode")
 	}
 	return nil
 }
 
-func serveSavedQueriesGetInfo(w http.ResponseWriter, r *http.Request) error {
-	var query string
-	err := json.NewDecoder(r.Body).Decode(&query)
-	if err != nil {
+// deleteByFilterToken returns the confirmation token for deleting the count
+// repositories matching the filter of req.
+func deleteByFilterToken(req api.ReposDeleteByFilterRequest, count int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%d", req.ExternalServiceID, req.NameGlob, count)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// globToRegexp converts a glob pattern, in which "*" matches any sequence of
+// characters (including "/") and "?" matches any single character, to an
+// anchored regular expression.
+func globToRegexp(glob string) string {
+	pattern := regexp.QuoteMeta(glob)
+	pattern = strings.Replace(pattern, `\*`, ".*", -1)
+	pattern = strings.Replace(pattern, `\?`, ".", -1)
+	return "^" + pattern + "$"
+}
+
+// serveReposGetMetadata responds with the key-value metadata that
+// integrations attached to a repository (see serveReposSetMetadata).
+func serveReposGetMetadata(w http.ResponseWriter, r *http.Request) error {
+	var req api.ReposGetMetadataRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		return errors.Wrap(err, "Decode")
 	}
-	info, err := db.SavedQueries.Get(r.Context(), query)
+	if _, err := db.Repos.Get(r.Context(), req.RepoID); err != nil {
+		return err
+	}
+	kvps, err := db.RepoKVPs.Get(r.Context(), req.RepoID, req.Key)
 	if err != nil {
-		return errors.Wrap(err, "SavedQueries.Get")
+		return errors.Wrap(err, "RepoKVPs.Get")
 	}
-	if err := json.NewEncoder(w).Encode(info); err != nil {
+	if err := json.NewEncoder(w).Encode(kvps); err != nil {
 		return errors.Wrap(err, "Encode")
 	}
 	return nil
 }
 
-func serveSavedQueriesSetInfo(w http.ResponseWriter, r *http.Request) error {
-	var info *api.SavedQueryInfo
-	err := json.NewDecoder(r.Body).Decode(&info)
-	if err != nil {
+func serveReposSetMetadata(w http.ResponseWriter, r *http.Request) error {
+	var req api.ReposSetMetadataRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		return errors.Wrap(err, "Decode")
 	}
-	err = db.SavedQueries.Set(r.Context(), &db.SavedQueryInfo{
-		Query:        info.Query,
-		LastExecuted: info.LastExecuted,
-		LatestResult: info.LatestResult,
-		ExecDuration: info.ExecDuration,
-	})
-	if err != nil {
-		return errors.Wrap(err, "SavedQueries.Set")
+	if req.Key == "" {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.New("key must not be empty")}
+	}
+	if _, err := db.Repos.Get(r.Context(), req.RepoID); err != nil {
+		return err
+	}
+	if err := db.RepoKVPs.Set(r.Context(), req.RepoID, req.Key, req.Value); err != nil {
+		return errors.Wrap(err, "RepoKVPs.Set")
 	}
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
 	return nil
 }
 
-func serveSavedQueriesDeleteInfo(w http.ResponseWriter, r *http.Request) error {
-	var query string
-	err := json.NewDecoder(r.Body).Decode(&query)
-	if err != nil {
+// serveReposGitserverShard reports which gitserver a repository is stored on.
+// The shard is computed from the name alone, so the repository need not
+// exist.
+func serveReposGitserverShard(w http.ResponseWriter, r *http.Request) error {
+	var req api.ReposGitserverShardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		return errors.Wrap(err, "Decode")
 	}
-	err = db.SavedQueries.Delete(r.Context(), query)
-	if err != nil {
-		return errors.Wrap(err, "SavedQueries.Delete")
+	resp := api.ReposGitserverShardResponse{ShardAddr: gitserver.DefaultClient.AddrForRepo(r.Context(), req.Repo)}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return errors.Wrap(err, "Encode")
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
 	return nil
 }
 
-func serveSettingsGetForSubject(w http.ResponseWriter, r *http.Request) error {
-	var subject api.SettingsSubject
-	if err := json.NewDecoder(r.Body).Decode(&subject); err != nil {
+// serveReposGitserverShards is the batch version of serveReposGitserverShard.
+// It responds with a map from repository name to gitserver address.
+func serveReposGitserverShards(w http.ResponseWriter, r *http.Request) error {
+	var repos []api.RepoName
+	if err := json.NewDecoder(r.Body).Decode(&repos); err != nil {
 		return errors.Wrap(err, "Decode")
 	}
-	settings, err := db.Settings.GetLatest(r.Context(), subject)
-	if err != nil {
-		return errors.Wrap(err, "Settings.GetLatest")
+	shards := make(map[api.RepoName]string, len(repos))
+	for _, repo := range repos {
+		shards[repo] = gitserver.DefaultClient.AddrForRepo(r.Context(), repo)
 	}
-	if err := json.NewEncoder(w).Encode(settings); err != nil {
+	if err := json.NewEncoder(w).Encode(shards); err != nil {
 		return errors.Wrap(err, "Encode")
 	}
 	return nil
 }
 
-func serveOrgsListUsers(w http.ResponseWriter, r *http.Request) error {
-	var orgID int32
-	err := json.NewDecoder(r.Body).Decode(&orgID)
+// inventoryCSVHeader is the header row of inventories served as CSV. Tools
+// parse it, so it must not change.
+var inventoryCSVHeader = []string{"language", "type", "bytes"}
+
+// serveReposInventory responds with the inventory (the languages used) of a
+// repository at a commit. It is served as CSV (see inventoryCSVHeader) if the
+// client accepts text/csv, and as JSON otherwise.
+func serveReposInventory(w http.ResponseWriter, r *http.Request) error {
+	var req api.ReposInventoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	repo, err := db.Repos.GetByName(r.Context(), req.Repo)
 	if err != nil {
+		return err
+	}
+	inv, err := backend.Repos.GetInventory(r.Context(), repo, req.CommitID)
+	if err != nil {
+		return err
+	}
+
+	if !acceptsMediaType(r, "text/csv") {
+		if err := json.NewEncoder(w).Encode(inv); err != nil {
+			return errors.Wrap(err, "Encode")
+		}
+		return nil
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	cw := csv.NewWriter(w)
+	cw.Write(inventoryCSVHeader)
+	for _, lang := range inv.Languages {
+		cw.Write([]string{lang.Name, lang.Type, strconv.FormatUint(lang.TotalBytes, 10)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// serveReposInventoryByPath responds with the inventory of a subtree (such as
+// a team's top-level directory in a monorepo) of a repository at a commit.
+func serveReposInventoryByPath(w http.ResponseWriter, r *http.Request) error {
+	var req api.ReposInventoryByPathRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		return errors.Wrap(err, "Decode")
 	}
-	orgMembers, err := db.OrgMembers.GetByOrgID(r.Context(), orgID)
+	path, err := cleanRepoPath(req.Path)
 	if err != nil {
-		return errors.Wrap(err, "OrgMembers.GetByOrgID")
+		return err
 	}
-	users := make([]int32, 0, len(orgMembers))
-	for _, member := range orgMembers {
-		users = append(users, member.UserID)
+	repo, err := db.Repos.GetByName(r.Context(), req.Repo)
+	if err != nil {
+		return err
+	}
+	inv, err := backend.Repos.GetInventoryByPath(r.Context(), repo, req.CommitID, path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &errcode.HTTPErr{Status: http.StatusNotFound, Err: err}
+		}
+		return err
 	}
-	if err := json.NewEncoder(w).Encode(users); err != nil {
+	if err := json.NewEncoder(w).Encode(inv); err != nil {
 		return errors.Wrap(err, "Encode")
 	}
 	return nil
 }
 
-func serveOrgsGetByName(w http.ResponseWriter, r *http.Request) error {
-	var orgName string
-	err := json.NewDecoder(r.Body).Decode(&orgName)
-	if err != nil {
+var (
+	inventoryUncachedTimeout, _  = time.ParseDuration(env.Get("SRC_INVENTORY_UNCACHED_TIMEOUT", "1m", "default time limit for listing the files of an uncached repository inventory"))
+	inventoryUncachedMaxFiles, _ = strconv.Atoi(env.Get("SRC_INVENTORY_UNCACHED_MAX_FILES", "500000", "default maximum number of files in an uncached repository inventory"))
+)
+
+// reposInventoryUncachedResponse is an inventory, plus whether it only covers
+// part of the repository because a limit was hit.
+type reposInventoryUncachedResponse struct {
+	*inventory.Inventory
+	Truncated bool `json:"truncated"`
+}
+
+// serveReposInventoryUncached computes the inventory of a repository at a
+// commit without using the cache. Unlike serveReposInventory, it is bounded
+// by a time limit and a file count limit, so that a huge repository cannot tie
+// up the frontend; when either is hit, the partial inventory is returned.
+func serveReposInventoryUncached(w http.ResponseWriter, r *http.Request) error {
+	var req api.ReposInventoryUncachedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		return errors.Wrap(err, "Decode")
 	}
-	org, err := db.Orgs.GetByName(r.Context(), orgName)
+	if req.TimeoutSeconds < 0 || req.MaxFiles < 0 {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.New("timeoutSeconds and maxFiles must not be negative")}
+	}
+	limits := backend.InventoryLimits{
+		Timeout:  inventoryUncachedTimeout,
+		MaxFiles: inventoryUncachedMaxFiles,
+	}
+	if req.TimeoutSeconds > 0 {
+		limits.Timeout = time.Duration(req.TimeoutSeconds) * time.Second
+	}
+	if req.MaxFiles > 0 {
+		limits.MaxFiles = req.MaxFiles
+	}
+
+	repo, err := db.Repos.GetByName(r.Context(), req.Repo)
 	if err != nil {
-		return errors.Wrap(err, "Orgs.GetByName")
+		return err
+	}
+	inv, truncated, err := backend.Repos.GetInventoryUncachedWithLimits(r.Context(), repo, req.CommitID, limits)
+	if err != nil {
+		return err
 	}
-	if err := json.NewEncoder(w).Encode(org.ID); err != nil {
+	if err := json.NewEncoder(w).Encode(reposInventoryUncachedResponse{Inventory: inv, Truncated: truncated}); err != nil {
 		return errors.Wrap(err, "Encode")
 	}
 	return nil
 }
 
-func serveUsersGetByUsername(w http.ResponseWriter, r *http.Request) error {
-	var username string
-	err := json.NewDecoder(r.Body).Decode(&username)
-	if err != nil {
+// maxConcurrentInventoryWarm is the maximum number of inventories computed
+// concurrently by a single serveReposInventoryWarm request.
+const maxConcurrentInventoryWarm = 4
+
+// serveReposInventoryWarm computes and caches the inventory of each of the
+// given repositories at the given commit, so that later inventory lookups
+// (e.g. for dashboards) are served from the cache. Only the outcome for each
+// repository is returned, not the inventories.
+func serveReposInventoryWarm(w http.ResponseWriter, r *http.Request) error {
+	var reqs []api.ReposInventoryWarmRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
 		return errors.Wrap(err, "Decode")
 	}
-	user, err := db.Users.GetByUsername(r.Context(), username)
-	if err != nil {
-		return errors.Wrap(err, "Users.GetByUsername")
+
+	var (
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, maxConcurrentInventoryWarm)
+		results = make([]api.ReposInventoryWarmResult, len(reqs))
+	)
+	for i, req := range reqs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, req api.ReposInventoryWarmRequest) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i].Repo = req.Repo
+			results[i].CommitID = req.CommitID
+			repo, err := db.Repos.GetByName(r.Context(), req.Repo)
+			if err == nil {
+				if backend.Repos.HasCachedInventory(repo, req.CommitID) {
+					results[i].Cached = true
+					return
+				}
+				_, err = backend.Repos.GetInventory(r.Context(), repo, req.CommitID)
+			}
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}(i, req)
 	}
-	if err := json.NewEncoder(w).Encode(user.ID); err != nil {
+	wg.Wait()
+
+	if err := json.NewEncoder(w).Encode(results); err != nil {
 		return errors.Wrap(err, "Encode")
 	}
 	return nil
 }
 
-func serveUserEmailsGetEmail(w http.ResponseWriter, r *http.Request) error {
-	var userID int32
-	err := json.NewDecoder(r.Body).Decode(&userID)
-	if err != nil {
+func serveReposHasLanguage(w http.ResponseWriter, r *http.Request) error {
+	var req api.ReposHasLanguageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		return errors.Wrap(err, "Decode")
 	}
-	email, _, err := db.UserEmails.GetPrimaryEmail(r.Context(), userID)
+	repo, err := db.Repos.GetByName(r.Context(), req.Repo)
 	if err != nil {
-		return errors.Wrap(err, "UserEmails.GetEmail")
+		return err
 	}
-	if err := json.NewEncoder(w).Encode(email); err != nil {
+	n, err := backend.Repos.GetLanguageBytes(r.Context(), repo, req.CommitID, req.Language)
+	if err != nil {
+		return err
+	}
+	resp := api.ReposHasLanguageResponse{Present: n > 0, Bytes: int64(n)}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		return errors.Wrap(err, "Encode")
 	}
 	return nil
 }
 
-func serveExternalURL(w http.ResponseWriter, r *http.Request) error {
-	if err := json.NewEncoder(w).Encode(globals.ExternalURL.String()); err != nil {
+func serveReposLanguageStats(w http.ResponseWriter, r *http.Request) error {
+	var req api.ReposLanguageStatsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	stats, err := db.Repos.LanguageStats(r.Context(), req.EnabledOnly)
+	if err != nil {
+		return errors.Wrap(err, "Repos.LanguageStats")
+	}
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
 		return errors.Wrap(err, "Encode")
 	}
 	return nil
 }
 
-func serveGitServerAddrs(w http.ResponseWriter, r *http.Request) error {
-	if err := json.NewEncoder(w).Encode(conf.SrcGitServers); err != nil {
-		return errors.Wrap(err, "Encode")
+// repoLastFetched is when a repository was last fetched from its code host.
+type repoLastFetched struct {
+	LastFetched *time.Time
+}
+
+// repoHead is the default branch of a repository and the commit it points
+// to.
+type repoHead struct {
+	DefaultBranch *string
+	HeadCommit    *api.CommitID
+}
+
+// resolve sets the fields of h, leaving them nil if the repository is not
+// cloned (yet) or is empty.
+func (h *repoHead) resolve(ctx context.Context, name api.RepoName) error {
+	// Do not to trigger a repo-updater lookup since the caller only wants
+	// what gitserver already has.
+	repo := gitserver.Repo{Name: name}
+	commitID, err := git.ResolveRevision(ctx, repo, nil, "HEAD", &git.ResolveRevisionOptions{NoEnsureRevision: true})
+	if err != nil {
+		if vcs.IsRepoNotExist(err) || git.IsRevisionNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	refBytes, _, exitCode, err := git.ExecSafe(ctx, repo, []string{"symbolic-ref", "--short", "HEAD"})
+	if err != nil {
+		return err
+	}
+	h.HeadCommit = &commitID
+	if exitCode == 0 { // HEAD may be detached
+		branch := string(bytes.TrimSpace(refBytes))
+		h.DefaultBranch = &branch
 	}
 	return nil
 }
 
-func serveCanSendEmail(w http.ResponseWriter, r *http.Request) error {
-	if err := json.NewEncoder(w).Encode(conf.CanSendEmail()); err != nil {
-		return errors.Wrap(err, "Encode")
+func serveReposCreateIfNotExists(w http.ResponseWriter, r *http.Request) error {
+	var repo api.RepoCreateOrUpdateRequest
+	err := json.NewDecoder(r.Body).Decode(&repo)
+	if err != nil {
+		return err
 	}
+	created, err := backend.Repos.UpsertCreated(r.Context(), api.InsertRepoOp{
+		Name:         repo.RepoName,
+		Description:  repo.Description,
+		Fork:         repo.Fork,
+		Archived:     repo.Archived,
+		Enabled:      repo.Enabled,
+		ExternalRepo: repo.ExternalRepo,
+	})
+	if err != nil {
+		return err
+	}
+	sgRepo, err := backend.Repos.GetByName(r.Context(), repo.RepoName)
+	if err != nil {
+		return err
+	}
+	if created {
+		notifyRepoCreated(sgRepo)
+	}
+	data, err := json.Marshal(sgRepo)
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
 	return nil
 }
 
-func serveSendEmail(w http.ResponseWriter, r *http.Request) error {
-	var msg txemail.Message
-	err := json.NewDecoder(r.Body).Decode(&msg)
+func serveReposUpdateMetadata(w http.ResponseWriter, r *http.Request) error {
+	var repo api.ReposUpdateMetadataRequest
+	err := json.NewDecoder(r.Body).Decode(&repo)
 	if err != nil {
 		return err
 	}
-	return txemail.Send(r.Context(), msg)
+	if err := db.Repos.UpdateRepositoryMetadata(r.Context(), repo.RepoName, repo.Description, repo.Fork, repo.Archived); err != nil {
+		return errors.Wrap(err, "Repos.UpdateRepositoryMetadata failed")
+	}
+	return nil
 }
 
-func serveGitResolveRevision(w http.ResponseWriter, r *http.Request) error {
-	// used by zoekt-sourcegraph-mirror
-	vars := mux.Vars(r)
-	name := api.RepoName(vars["RepoName"])
-	spec := vars["Spec"]
-
-	// Do not to trigger a repo-updater lookup since this is a batch job.
-	commitID, err := git.ResolveRevision(r.Context(), gitserver.Repo{Name: name}, nil, spec, nil)
+func servePhabricatorRepoCreate(w http.ResponseWriter, r *http.Request) error {
+	var repo api.PhabricatorRepoCreateRequest
+	err := json.NewDecoder(r.Body).Decode(&repo)
+	if err != nil {
+		return err
+	}
+	phabRepo, err := db.Phabricator.CreateOrUpdate(r.Context(), repo.Callsign, repo.RepoName, repo.URL)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(phabRepo)
 	if err != nil {
 		return err
 	}
-
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(commitID))
+	w.Write(data)
 	return nil
 }
 
-func serveGitTar(w http.ResponseWriter, r *http.Request) error {
-	// used by zoekt-sourcegraph-mirror
-	vars := mux.Vars(r)
-	name := api.RepoName(vars["RepoName"])
-	spec := vars["Commit"]
+// serveExternalServiceConfigs serves a JSON response that is an array of all
+// external service configs that match the requested kind.
+func serveExternalServiceConfigs(w http.ResponseWriter, r *http.Request) error {
+	var req api.ExternalServiceConfigsRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return err
+	}
+	services, err := db.ExternalServices.List(r.Context(), db.ExternalServicesListOptions{
+		Kinds: []string{req.Kind},
+	})
+	if err != nil {
+		return err
+	}
 
-	// Ensure commit exists. Do not want to trigger a repo-updater lookup since this is a batch job.
-	repo := gitserver.Repo{Name: name}
-	commit, err := git.ResolveRevision(r.Context(), repo, nil, spec, nil)
+	// Instead of returning an intermediate response type, we directly return
+	// the array of configs (which are themselves JSON objects).
+	// This makes it possible for the caller to directly unmarshal the response into
+	// a slice of connection configurations for this external service kind.
+	configs := make([]map[string]interface{}, 0, len(services))
+	for _, service := range services {
+		var config map[string]interface{}
+		// Raw configs may have comments in them so we have to use a json parser
+		// that supports comments in json.
+		if err := jsonc.Unmarshal(service.Config, &config); err != nil {
+			log15.Error(
+				"ignoring external service config that has invalid json",
+				"id", service.ID,
+				"displayName", service.DisplayName,
+				"config", service.Config,
+				"err", err,
+			)
+			continue
+		}
+		configs = append(configs, config)
+	}
+	return json.NewEncoder(w).Encode(configs)
+}
+
+// serveExternalServicesList serves a JSON response that is an array of all external services
+// of the given kind
+func serveExternalServicesList(w http.ResponseWriter, r *http.Request) error {
+	var req api.ExternalServicesListRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
 		return err
 	}
 
-	src, err := git.Archive(r.Context(), repo, git.ArchiveOptions{Treeish: string(commit), Format: "tar"})
+	if len(req.Kinds) == 0 {
+		req.Kinds = append(req.Kinds, req.Kind)
+	}
+
+	services, err := db.ExternalServices.List(r.Context(), db.ExternalServicesListOptions{
+		Kinds: req.Kinds,
+	})
 	if err != nil {
 		return err
 	}
-	defer src.Close()
+	return json.NewEncoder(w).Encode(services)
+}
 
-	w.Header().Set("Content-Type", "application/x-tar")
-	w.WriteHeader(http.StatusOK)
-	_, err = io.Copy(w, src)
-	return err
+func serveConfiguration(w http.ResponseWriter, r *http.Request) error {
+	raw, err := globals.ConfigurationServerFrontendOnly.Source.Read(r.Context())
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(w).Encode(raw)
+	if err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// serveSearchConfiguration is _only_ used by the zoekt index server. Zoekt does
+// not depend on frontend and therefore does not have access to `conf.Watch`.
+// Additionally, it only cares about certain search specific settings so this
+// search specific endpoint is used rather than serving the entire site settings
+// from /.internal/configuration.
+func serveSearchConfiguration(w http.ResponseWriter, r *http.Request) error {
+	largeFiles := conf.Get().SearchLargeFiles
+	opts := struct {
+		LargeFiles []string
+	}{
+		LargeFiles: largeFiles,
+	}
+	err := json.NewEncoder(w).Encode(opts)
+	if err != nil {
+		return errors.Wrap(err, "encode")
+	}
+	return nil
+}
+
+// reposListChunkSize is the number of repositories serveReposList looks up
+// on gitserver at once when NotFetchedWithinHours is set.
+const reposListChunkSize = 1000
+
+// serveReposList responds with a JSON array of the repositories matching the
+// given options. The array is written as the repositories are read from the
+// database, so that memory use does not grow with the number of repositories
+// on large instances.
+func serveReposList(w http.ResponseWriter, r *http.Request) error {
+	var opt struct {
+		db.ReposListOptions
+
+		// NotFetchedWithinHours, if positive, restricts the list to
+		// repositories that gitserver has not fetched within that many hours
+		// (including repositories that were never fetched). The LastFetched
+		// field of the results is only populated when this is set.
+		NotFetchedWithinHours int
+	}
+	err := json.NewDecoder(r.Body).Decode(&opt)
+	if err != nil {
+		return err
+	}
+	// Incremental syncs need to learn about deleted repositories, which are
+	// listed with DeletedAt set.
+	if opt.UpdatedAfter != nil {
+		opt.IncludeDeleted = true
+	}
+
+	// BACKCOMPAT: Add a "URI" field because zoekt-sourcegraph-indexserver expects one to exist
+	// (with the repository name). This is a legacy of the rename from "repo URI" to "repo name".
+	type repoWithBackcompatURIField struct {
+		URI string
+		*types.Repo
+		LastFetched *time.Time `json:",omitempty"`
+	}
+
+	// The opening bracket is only written along with the first repository,
+	// so that an error before then still results in an error response.
+	// Errors after that can only truncate the response.
+	var (
+		enc     = json.NewEncoder(w)
+		written int
+	)
+	writeRepo := func(repo *types.Repo, lastFetched *time.Time) error {
+		sep := ","
+		if written == 0 {
+			sep = "["
+		}
+		written++
+		if _, err := io.WriteString(w, sep); err != nil {
+			return err
+		}
+		return enc.Encode(&repoWithBackcompatURIField{
+			URI:         string(repo.Name),
+			Repo:        repo,
+			LastFetched: lastFetched,
+		})
+	}
+
+	var (
+		chunk  []*types.Repo
+		cutoff = time.Now().Add(-time.Duration(opt.NotFetchedWithinHours) * time.Hour)
+	)
+	flushChunk := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		names := make([]api.RepoName, len(chunk))
+		for i, repo := range chunk {
+			names[i] = repo.Name
+		}
+		info, err := gitserver.DefaultClient.RepoInfo(r.Context(), names...)
+		if err != nil {
+			return errors.Wrap(err, "gitserver.RepoInfo")
+		}
+		stale, lastFetched := filterNotFetchedSince(chunk, info.Results, cutoff)
+		for _, repo := range stale {
+			if err := writeRepo(repo, lastFetched[repo.Name]); err != nil {
+				return err
+			}
+		}
+		chunk = chunk[:0]
+		return nil
+	}
+
+	err = backend.Repos.ForEach(r.Context(), opt.ReposListOptions, func(repo *types.Repo) error {
+		if opt.NotFetchedWithinHours <= 0 {
+			return writeRepo(repo, nil)
+		}
+		chunk = append(chunk, repo)
+		if len(chunk) == reposListChunkSize {
+			return flushChunk()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flushChunk()
+	}
+	if err != nil {
+		return err
+	}
+
+	end := "]"
+	if written == 0 {
+		end = "[]"
+	}
+	_, err = io.WriteString(w, end)
+	return err
+}
+
+// filterNotFetchedSince returns the repositories whose last fetch (according
+// to infos) happened before cutoff, or that were never fetched, along with
+// their last fetch times.
+func filterNotFetchedSince(repos []*types.Repo, infos map[api.RepoName]*protocol.RepoInfo, cutoff time.Time) ([]*types.Repo, map[api.RepoName]*time.Time) {
+	var stale []*types.Repo
+	lastFetched := make(map[api.RepoName]*time.Time)
+	for _, repo := range repos {
+		var t *time.Time
+		if info := infos[repo.Name]; info != nil {
+			t = info.LastFetched
+		}
+		if t != nil && !t.Before(cutoff) {
+			continue
+		}
+		stale = append(stale, repo)
+		lastFetched[repo.Name] = t
+	}
+	return stale, lastFetched
+}
+
+func serveReposListEnabled(w http.ResponseWriter, r *http.Request) error {
+	names, err := db.Repos.ListEnabledNames(r.Context())
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(names)
+}
+
+const (
+	// defaultRecentlyUpdatedRepos and maxRecentlyUpdatedRepos are the default
+	// and maximum number of repositories returned by serveReposRecentlyUpdated.
+	defaultRecentlyUpdatedRepos = 10
+	maxRecentlyUpdatedRepos     = 1000
+)
+
+// serveReposRecentlyUpdated lists the enabled repositories whose metadata was
+// most recently updated, most recent first.
+func serveReposRecentlyUpdated(w http.ResponseWriter, r *http.Request) error {
+	var req api.ReposRecentlyUpdatedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultRecentlyUpdatedRepos
+	} else if limit > maxRecentlyUpdatedRepos {
+		limit = maxRecentlyUpdatedRepos
+	}
+
+	repos, err := db.Repos.List(r.Context(), db.ReposListOptions{
+		Enabled: true,
+		// Exclude repositories that were never updated (whose updated_at is
+		// NULL, which would otherwise sort first).
+		UpdatedAfter: &time.Time{},
+		OrderBy: db.RepoListOrderBy{
+			{Field: db.RepoListUpdatedAt, Descending: true},
+			{Field: db.RepoListID, Descending: true},
+		},
+		LimitOffset: &db.LimitOffset{Limit: limit},
+	})
+	if err != nil {
+		return errors.Wrap(err, "Repos.List")
+	}
+
+	results := make([]api.RecentlyUpdatedRepo, 0, len(repos))
+	for _, repo := range repos {
+		if repo.UpdatedAt == nil {
+			continue
+		}
+		results = append(results, api.RecentlyUpdatedRepo{Name: repo.Name, UpdatedAt: *repo.UpdatedAt})
+	}
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// maxConcurrentCloneChecks is the maximum number of repositories whose clone
+// status is checked concurrently by a single serveReposNeedingClone request.
+const maxConcurrentCloneChecks = 16
+
+// serveReposNeedingClone checks whether each enabled repository in the page
+// given by Limit and Offset is cloned on gitserver, and returns those that are
+// not. Repositories whose status could not be checked are reported in Errors.
+// TotalCount is the number of enabled repositories, so that callers know when
+// they have paged through all of them.
+func serveReposNeedingClone(w http.ResponseWriter, r *http.Request) error {
+	var req api.ReposNeedingCloneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+
+	opt := db.ReposListOptions{Enabled: true}
+	totalCount, err := db.Repos.Count(r.Context(), opt)
+	if err != nil {
+		return errors.Wrap(err, "Repos.Count")
+	}
+	if req.Limit > 0 {
+		opt.LimitOffset = &db.LimitOffset{Limit: req.Limit, Offset: req.Offset}
+	}
+	repos, err := db.Repos.List(r.Context(), opt)
+	if err != nil {
+		return errors.Wrap(err, "Repos.List")
+	}
+
+	var (
+		wg     sync.WaitGroup
+		sem    = make(chan struct{}, maxConcurrentCloneChecks)
+		cloned = make([]bool, len(repos))
+		errs   = make([]error, len(repos))
+	)
+	for i, repo := range repos {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, name api.RepoName) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			cloned[i], errs[i] = gitserver.DefaultClient.IsRepoCloned(r.Context(), name)
+		}(i, repo.Name)
+	}
+	wg.Wait()
+
+	resp := api.ReposNeedingCloneResponse{
+		Repos:      []api.RepoName{},
+		Errors:     []api.ReposNeedingCloneError{},
+		TotalCount: totalCount,
+	}
+	for i, repo := range repos {
+		switch {
+		case errs[i] != nil:
+			resp.Errors = append(resp.Errors, api.ReposNeedingCloneError{Repo: repo.Name, Error: errs[i].Error()})
+		case !cloned[i]:
+			resp.Repos = append(resp.Repos, repo.Name)
+		}
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// cloneStatusSummaryCache caches the response of serveReposCloneStatusSummary,
+// which is expensive to compute on instances with many repositories.
+var cloneStatusSummaryCache = rcache.NewWithTTL("clone-status-summary", 60)
+
+// cloneStatusBatchSize is the number of repositories whose clone status is
+// requested from gitserver in a single call.
+const cloneStatusBatchSize = 500
+
+// gitserverRepoInfo is gitserver.DefaultClient.RepoInfo. It is a variable so
+// that tests can mock it.
+var gitserverRepoInfo = func(ctx context.Context, repos ...api.RepoName) (*protocol.RepoInfoResponse, error) {
+	// RepoInfo panics if there are no gitserver addresses to shard over.
+	if len(gitserver.DefaultClient.Addrs(ctx)) == 0 {
+		return nil, errors.New("no gitserver addresses")
+	}
+	return gitserver.DefaultClient.RepoInfo(ctx, repos...)
+}
+
+// serveReposCloneStatusSummary responds with the number of enabled
+// repositories that are not cloned, being cloned, cloned, or whose status
+// could not be determined. The summary is cached for a minute, so repeated
+// requests (e.g. from a dashboard) don't check every repository each time.
+func serveReposCloneStatusSummary(w http.ResponseWriter, r *http.Request) error {
+	const key = "summary"
+	var resp api.ReposCloneStatusSummary
+	if data, ok := cloneStatusSummaryCache.Get(key); !ok || json.Unmarshal(data, &resp) != nil {
+		repos, err := db.Repos.List(r.Context(), db.ReposListOptions{Enabled: true})
+		if err != nil {
+			return errors.Wrap(err, "Repos.List")
+		}
+		names := make([]api.RepoName, len(repos))
+		for i, repo := range repos {
+			names[i] = repo.Name
+		}
+		resp = summarizeCloneStatus(r.Context(), names)
+		if data, err := json.Marshal(resp); err == nil {
+			cloneStatusSummaryCache.Set(key, data)
+		}
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// summarizeCloneStatus counts the repositories in each clone state. The
+// status is requested from gitserver in batches, a bounded number of which are
+// in flight at once. All repositories in a batch that fails are counted as
+// errored.
+func summarizeCloneStatus(ctx context.Context, names []api.RepoName) api.ReposCloneStatusSummary {
+	var (
+		mu      sync.Mutex
+		summary api.ReposCloneStatusSummary
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, maxConcurrentCloneChecks)
+	)
+	for start := 0; start < len(names); start += cloneStatusBatchSize {
+		end := start + cloneStatusBatchSize
+		if end > len(names) {
+			end = len(names)
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(batch []api.RepoName) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			info, err := gitserverRepoInfo(ctx, batch...)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log15.Warn("Failed to get repository info from gitserver", "repos", len(batch), "error", err)
+				summary.Errored += len(batch)
+				return
+			}
+			for _, name := range batch {
+				switch ri := info.Results[name]; {
+				case ri == nil:
+					summary.Errored++
+				case ri.CloneInProgress:
+					summary.Cloning++
+				case ri.Cloned:
+					summary.Cloned++
+				default:
+					summary.NotCloned++
+				}
+			}
+		}(names[start:end])
+	}
+	wg.Wait()
+	return summary
+}
+
+// serveReposListByExternalService lists the (enabled and disabled)
+// repositories that reside on any of the given external service instances,
+// e.g. a single GitHub Enterprise instance. TotalCount is the number of
+// matching repositories regardless of pagination.
+func serveReposListByExternalService(w http.ResponseWriter, r *http.Request) error {
+	var req api.ReposListByExternalServiceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	if len(req.ServiceIDs) == 0 {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.New("at least one external service ID is required")}
+	}
+
+	opt := db.ReposListOptions{
+		Enabled:            true,
+		Disabled:           true,
+		ExternalServiceIDs: req.ServiceIDs,
+	}
+	totalCount, err := db.Repos.Count(r.Context(), opt)
+	if err != nil {
+		return errors.Wrap(err, "Repos.Count")
+	}
+	if req.Limit > 0 {
+		opt.LimitOffset = &db.LimitOffset{Limit: req.Limit, Offset: req.Offset}
+	}
+	repos, err := db.Repos.List(r.Context(), opt)
+	if err != nil {
+		return errors.Wrap(err, "Repos.List")
+	}
+
+	resp := struct {
+		Repos      []*types.Repo `json:"repos"`
+		TotalCount int           `json:"totalCount"`
+	}{Repos: repos, TotalCount: totalCount}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// serveReposListForOrg lists the repositories associated with an
+// organization. Repositories are not associated with organizations in the
+// database (orgs only have members, invitations and settings), so after
+// validating the org it always responds with a notSupportedError.
+func serveReposListForOrg(w http.ResponseWriter, r *http.Request) error {
+	var req api.ReposListForOrgRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	if req.OrgID <= 0 {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.New("orgID is required")}
+	}
+	if _, err := db.Orgs.GetByID(r.Context(), req.OrgID); err != nil {
+		if _, ok := err.(*db.OrgNotFoundError); ok {
+			return &errcode.HTTPErr{Status: http.StatusNotFound, Err: err}
+		}
+		return errors.Wrap(err, "Orgs.GetByID")
+	}
+	return &notSupportedError{Feature: "repository to organization associations"}
+}
+
+// listAllSavedQueries returns the saved queries in the settings of all users,
+// orgs, etc.
+func listAllSavedQueries(ctx context.Context) ([]api.SavedQuerySpecAndConfig, error) {
+	settings, err := db.Settings.ListAll(ctx, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "db.Settings.ListAll")
+	}
+
+	queries := make([]api.SavedQuerySpecAndConfig, 0, len(settings))
+	for _, settings := range settings {
+		var config api.PartialConfigSavedQueries
+		if err := jsonc.Unmarshal(settings.Contents, &config); err != nil {
+			return nil, err
+		}
+		for _, query := range config.SavedQueries {
+			spec := api.SavedQueryIDSpec{Subject: settings.Subject, Key: query.Key}
+			queries = append(queries, api.SavedQuerySpecAndConfig{
+				Spec:   spec,
+				Config: query,
+			})
+		}
+	}
+	return queries, nil
+}
+
+func serveSavedQueriesListAll(w http.ResponseWriter, r *http.Request) error {
+	queries, err := listAllSavedQueries(r.Context())
+	if err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(w).Encode(queries); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+func serveSavedQueriesGetInfo(w http.ResponseWriter, r *http.Request) error {
+	var query string
+	err := json.NewDecoder(r.Body).Decode(&query)
+	if err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	info, err := db.SavedQueries.Get(r.Context(), query)
+	if err != nil {
+		return errors.Wrap(err, "SavedQueries.Get")
+	}
+	if info == nil {
+		return &errcode.HTTPErr{Status: http.StatusNotFound, Err: fmt.Errorf("saved query %q has no info", query)}
+	}
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+func serveSavedQueriesSetInfo(w http.ResponseWriter, r *http.Request) error {
+	var info *api.SavedQueryInfo
+	err := json.NewDecoder(r.Body).Decode(&info)
+	if err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	err = db.SavedQueries.Set(r.Context(), &db.SavedQueryInfo{
+		Query:        info.Query,
+		LastExecuted: info.LastExecuted,
+		LatestResult: info.LatestResult,
+		ExecDuration: info.ExecDuration,
+	})
+	if err != nil {
+		return errors.Wrap(err, "SavedQueries.Set")
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+	return nil
+}
+
+func serveSavedQueriesDeleteInfo(w http.ResponseWriter, r *http.Request) error {
+	var query string
+	err := json.NewDecoder(r.Body).Decode(&query)
+	if err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	err = db.SavedQueries.Delete(r.Context(), query)
+	if err != nil {
+		return errors.Wrap(err, "SavedQueries.Delete")
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+	return nil
+}
+
+func serveSavedQueriesDeleteInfoBatch(w http.ResponseWriter, r *http.Request) error {
+	var queries []string
+	if err := json.NewDecoder(r.Body).Decode(&queries); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	deleted, err := db.SavedQueries.DeleteMany(r.Context(), queries)
+	if err != nil {
+		return errors.Wrap(err, "SavedQueries.DeleteMany")
+	}
+	if err := json.NewEncoder(w).Encode(deleted); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+func serveSavedQueriesReconcile(w http.ResponseWriter, r *http.Request) error {
+	var req api.SavedQueriesReconcileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+
+	queries, err := listAllSavedQueries(r.Context())
+	if err != nil {
+		return err
+	}
+	live := make(map[string]struct{}, len(queries))
+	for _, q := range queries {
+		live[q.Config.Query] = struct{}{}
+	}
+
+	stored, err := db.SavedQueries.ListQueries(r.Context())
+	if err != nil {
+		return errors.Wrap(err, "SavedQueries.ListQueries")
+	}
+
+	result := api.SavedQueriesReconcileResult{Removed: []string{}}
+	for _, query := range stored {
+		if _, ok := live[query]; !ok {
+			result.Removed = append(result.Removed, query)
+		}
+	}
+	if !req.DryRun {
+		if _, err := db.SavedQueries.DeleteMany(r.Context(), result.Removed); err != nil {
+			return errors.Wrap(err, "SavedQueries.DeleteMany")
+		}
+	}
+	result.Count = len(result.Removed)
+
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+const (
+	// defaultSavedQuerySlowThreshold is the execution duration above which
+	// serveSavedQueriesHealth reports a saved query as slow, unless the
+	// request specifies another threshold.
+	defaultSavedQuerySlowThreshold = time.Minute
+
+	// defaultSavedQueryStaleAfter is how long after its last execution
+	// serveSavedQueriesHealth reports a saved query as stale, unless the
+	// request specifies another duration. The query runner runs a query every
+	// 30 times its execution duration, so a healthy query runs much more often.
+	defaultSavedQueryStaleAfter = 6 * time.Hour
+)
+
+// serveSavedQueriesHealth reports, for each saved query in the settings of
+// all users, orgs, etc., when the query runner last executed it and how long
+// it took, flagging queries that are slow or have not run recently. Queries
+// that were never executed are stale. The queries are paginated in the order
+// returned by listAllSavedQueries.
+func serveSavedQueriesHealth(w http.ResponseWriter, r *http.Request) error {
+	var req api.SavedQueriesHealthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	if req.Limit < 0 || req.Offset < 0 || req.SlowThresholdSeconds < 0 || req.StaleAfterSeconds < 0 {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.New("limit, offset and thresholds must not be negative")}
+	}
+	slowThreshold, staleAfter := defaultSavedQuerySlowThreshold, defaultSavedQueryStaleAfter
+	if req.SlowThresholdSeconds > 0 {
+		slowThreshold = time.Duration(req.SlowThresholdSeconds) * time.Second
+	}
+	if req.StaleAfterSeconds > 0 {
+		staleAfter = time.Duration(req.StaleAfterSeconds) * time.Second
+	}
+
+	queries, err := listAllSavedQueries(r.Context())
+	if err != nil {
+		return err
+	}
+	resp := api.SavedQueriesHealthResponse{TotalCount: len(queries)}
+	if req.Offset < len(queries) {
+		queries = queries[req.Offset:]
+	} else {
+		queries = nil
+	}
+	if req.Limit > 0 && req.Limit < len(queries) {
+		queries = queries[:req.Limit]
+	}
+
+	texts := make([]string, len(queries))
+	for i, q := range queries {
+		texts[i] = q.Config.Query
+	}
+	infos, err := db.SavedQueries.GetMany(r.Context(), texts)
+	if err != nil {
+		return errors.Wrap(err, "SavedQueries.GetMany")
+	}
+
+	now := time.Now()
+	resp.Queries = make([]api.SavedQueryHealth, len(queries))
+	for i, q := range queries {
+		h := api.SavedQueryHealth{Spec: q.Spec, Query: q.Config.Query, Stale: true}
+		if info := infos[q.Config.Query]; info != nil {
+			lastExecuted, latestResult := info.LastExecuted, info.LatestResult
+			h.LastExecuted = &lastExecuted
+			h.LatestResult = &latestResult
+			h.ExecDuration = info.ExecDuration
+			h.Slow = info.ExecDuration > slowThreshold
+			h.Stale = now.Sub(info.LastExecuted) > staleAfter
+		}
+		resp.Queries[i] = h
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// serveSettingsGetForSubject returns the latest settings of a subject. If the
+// "path" query parameter is given (such as ?path=search.defaultLimit), only
+// the value at that path in the settings contents is returned, or 404 Not
+// Found if there is none. See lookupSettingsPath for the path syntax.
+func serveSettingsGetForSubject(w http.ResponseWriter, r *http.Request) error {
+	var subject api.SettingsSubject
+	if err := json.NewDecoder(r.Body).Decode(&subject); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	settings, err := db.Settings.GetLatest(r.Context(), subject)
+	if err != nil {
+		return errors.Wrap(err, "Settings.GetLatest")
+	}
+
+	var v interface{} = settings
+	if path := r.URL.Query().Get("path"); path != "" {
+		var contents interface{}
+		if settings != nil {
+			if err := jsonc.Unmarshal(settings.Contents, &contents); err != nil {
+				return errors.Wrap(err, "parsing settings")
+			}
+		}
+		value, ok := lookupSettingsPath(contents, path)
+		if !ok {
+			return &errcode.HTTPErr{Status: http.StatusNotFound, Err: fmt.Errorf("settings have no value at path %q", path)}
+		}
+		v = value
+	}
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// serveSearchLimitsForSubject returns the search limits that apply to a
+// settings subject: the defaults, overridden by the search settings in the
+// subject's settings cascade. The number of results and the timeouts cannot be
+// configured in settings, so they are always the defaults that search applies
+// to queries without count: or timeout:.
+func serveSearchLimitsForSubject(w http.ResponseWriter, r *http.Request) error {
+	var subject api.SettingsSubject
+	if err := json.NewDecoder(r.Body).Decode(&subject); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	cascade, err := settingsCascade(r.Context(), subject)
+	if err != nil {
+		return err
+	}
+
+	maxResults, timeout, maxTimeout := graphqlbackend.SearchLimitDefaults()
+	limits := api.SearchLimits{
+		MaxResults:        maxResults,
+		TimeoutSeconds:    int(timeout / time.Second),
+		MaxTimeoutSeconds: int(maxTimeout / time.Second),
+		ContextLines:      1, // the documented default of search.contextLines
+	}
+	for _, s := range cascade {
+		settings, err := db.Settings.GetLatest(r.Context(), s)
+		if err != nil {
+			return errors.Wrap(err, "Settings.GetLatest")
+		}
+		if settings == nil {
+			continue
+		}
+		var search struct {
+			ContextLines *int `json:"search.contextLines"`
+		}
+		if err := jsonc.Unmarshal(settings.Contents, &search); err != nil {
+			// Like the settings cascade, ignore settings that can't be parsed.
+			log15.Warn("Ignoring invalid settings for search limits.", "subject", s, "error", err)
+			continue
+		}
+		if search.ContextLines != nil && *search.ContextLines >= 0 {
+			limits.ContextLines = *search.ContextLines
+		}
+	}
+
+	if err := json.NewEncoder(w).Encode(limits); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// settingsCascade returns the subjects whose settings apply to subject, from
+// lowest to highest precedence, in the same order as the GraphQL settings
+// cascade: global settings, then the user's organizations (by ID), then the
+// subject itself. The computed default settings are not included.
+func settingsCascade(ctx context.Context, subject api.SettingsSubject) ([]api.SettingsSubject, error) {
+	site := api.SettingsSubject{Site: true}
+	switch {
+	case subject.Default:
+		return nil, nil
+	case subject.Site:
+		return []api.SettingsSubject{site}, nil
+	case subject.Org != nil:
+		return []api.SettingsSubject{site, subject}, nil
+	case subject.User != nil:
+		orgs, err := db.Orgs.GetByUserID(ctx, *subject.User)
+		if err != nil {
+			return nil, errors.Wrap(err, "Orgs.GetByUserID")
+		}
+		sort.Slice(orgs, func(i, j int) bool { return orgs[i].ID < orgs[j].ID })
+		cascade := []api.SettingsSubject{site}
+		for _, org := range orgs {
+			cascade = append(cascade, api.SettingsSubject{Org: &org.ID})
+		}
+		return append(cascade, subject), nil
+	default:
+		return nil, &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.New("unknown settings subject")}
+	}
+}
+
+// serveSettingsUpdate creates new settings for a subject, but only if the
+// subject's latest settings are still the ones the caller last read. If they
+// are not, it responds with 409 Conflict and the current version so that the
+// caller can re-read and retry.
+//
+// Unlike the GraphQL settings mutations, this does not notify the
+// query-runner of saved query changes.
+func serveSettingsUpdate(w http.ResponseWriter, r *http.Request) error {
+	var req api.SettingsUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	latest, created, err := db.Settings.CompareAndCreate(r.Context(), req.Subject, req.LastKnownVersion, req.AuthorUserID, req.Contents)
+	if err != nil {
+		return errors.Wrap(err, "Settings.CompareAndCreate")
+	}
+	if !created {
+		w.WriteHeader(http.StatusConflict)
+	}
+	if err := json.NewEncoder(w).Encode(api.SettingsUpdateResponse{Version: latest.ID}); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// serveReposGetByExternalReposBatch resolves the given external repository
+// specs to repository IDs. The response maps each matched spec's string
+// representation (see api.ExternalRepoSpec.String) to its repository ID;
+// specs that match no repository are omitted.
+func serveReposGetByExternalReposBatch(w http.ResponseWriter, r *http.Request) error {
+	var specs []api.ExternalRepoSpec
+	if err := json.NewDecoder(r.Body).Decode(&specs); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	ids, err := db.Repos.GetIDsByExternalRepos(r.Context(), specs)
+	if err != nil {
+		return errors.Wrap(err, "Repos.GetIDsByExternalRepos")
+	}
+	resp := make(map[string]api.RepoID, len(ids))
+	for spec, id := range ids {
+		resp[spec.String()] = id
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// serveSettingsExistBatch reports which of the given subjects have any
+// settings. The response maps each subject's string representation (such as
+// "site" or "org 1") to whether it has settings.
+func serveSettingsExistBatch(w http.ResponseWriter, r *http.Request) error {
+	var subjects []api.SettingsSubject
+	if err := json.NewDecoder(r.Body).Decode(&subjects); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	exist, err := db.Settings.Exist(r.Context(), subjects)
+	if err != nil {
+		return errors.Wrap(err, "Settings.Exist")
+	}
+	resp := make(map[string]bool, len(subjects))
+	for i, subject := range subjects {
+		resp[subject.String()] = exist[i]
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+func serveOrgsListUsers(w http.ResponseWriter, r *http.Request) error {
+	var orgID int32
+	err := json.NewDecoder(r.Body).Decode(&orgID)
+	if err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	orgMembers, err := db.OrgMembers.GetByOrgID(r.Context(), orgID)
+	if err != nil {
+		return errors.Wrap(err, "OrgMembers.GetByOrgID")
+	}
+	users := make([]int32, 0, len(orgMembers))
+	for _, member := range orgMembers {
+		users = append(users, member.UserID)
+	}
+	if err := json.NewEncoder(w).Encode(jsonIDs(r, users)); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+func serveOrgsGetByName(w http.ResponseWriter, r *http.Request) error {
+	var orgName string
+	err := json.NewDecoder(r.Body).Decode(&orgName)
+	if err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	org, err := db.Orgs.GetByName(r.Context(), orgName)
+	if err != nil {
+		return errors.Wrap(err, "Orgs.GetByName")
+	}
+	if err := json.NewEncoder(w).Encode(jsonID(r, org.ID)); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// serveOrgsIsAdmin reports whether a user is a member and an admin of an org,
+// without listing all of the org's members. Orgs have no member roles, so
+// every member can administer the org (see backend.CheckOrgAccess).
+func serveOrgsIsAdmin(w http.ResponseWriter, r *http.Request) error {
+	var req api.OrgsIsAdminRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	var resp api.OrgsIsAdminResponse
+	_, err := db.OrgMembers.GetByOrgIDAndUserID(r.Context(), req.OrgID, req.UserID)
+	if err != nil && !errcode.IsNotFound(err) {
+		return errors.Wrap(err, "OrgMembers.GetByOrgIDAndUserID")
+	}
+	if err == nil {
+		resp.IsMember = true
+		resp.IsAdmin = true
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+func serveUsersGetByUsername(w http.ResponseWriter, r *http.Request) error {
+	var username string
+	err := json.NewDecoder(r.Body).Decode(&username)
+	if err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	user, err := db.Users.GetByUsername(r.Context(), username)
+	if err != nil {
+		return errors.Wrap(err, "Users.GetByUsername")
+	}
+	if err := json.NewEncoder(w).Encode(jsonID(r, user.ID)); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// serveUsersSummary responds with the username, primary email and last active
+// time of each of the given users. Users that don't exist are omitted.
+func serveUsersSummary(w http.ResponseWriter, r *http.Request) error {
+	var userIDs []int32
+	if err := json.NewDecoder(r.Body).Decode(&userIDs); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	summaries, err := db.Users.ListSummaries(r.Context(), userIDs)
+	if err != nil {
+		return errors.Wrap(err, "Users.ListSummaries")
+	}
+	ids := make([]int32, len(summaries))
+	for i, s := range summaries {
+		ids[i] = s.ID
+	}
+	lastActive, err := usagestats.GetLastActiveTimes(ids)
+	if err != nil {
+		return errors.Wrap(err, "GetLastActiveTimes")
+	}
+
+	resp := make([]api.UserSummary, len(summaries))
+	for i, s := range summaries {
+		resp[i] = api.UserSummary{UserID: s.ID, Username: s.Username, PrimaryEmail: s.PrimaryEmail}
+		if t, ok := lastActive[s.ID]; ok {
+			resp[i].LastActiveAt = &t
+		}
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+func serveUserEmailsGetEmail(w http.ResponseWriter, r *http.Request) error {
+	var userID int32
+	err := json.NewDecoder(r.Body).Decode(&userID)
+	if err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	email, _, err := db.UserEmails.GetPrimaryEmail(r.Context(), userID)
+	if err != nil {
+		return errors.Wrap(err, "UserEmails.GetEmail")
+	}
+	if err := json.NewEncoder(w).Encode(email); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+func serveExternalURL(w http.ResponseWriter, r *http.Request) error {
+	if err := json.NewEncoder(w).Encode(globals.ExternalURL.String()); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+func serveGitServerAddrs(w http.ResponseWriter, r *http.Request) error {
+	if err := json.NewEncoder(w).Encode(conf.SrcGitServers); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+func serveCanSendEmail(w http.ResponseWriter, r *http.Request) error {
+	if err := json.NewEncoder(w).Encode(conf.CanSendEmail()); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+func serveEmailVerificationRequired(w http.ResponseWriter, r *http.Request) error {
+	resp := api.EmailVerificationRequiredResponse{Required: conf.EmailVerificationRequired()}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+func serveEmailConfig(w http.ResponseWriter, r *http.Request) error {
+	resp := api.EmailConfig{
+		CanSend:              conf.CanSendEmail(),
+		VerificationRequired: conf.EmailVerificationRequired(),
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+func serveSendEmail(w http.ResponseWriter, r *http.Request) error {
+	var msg txemail.Message
+	err := json.NewDecoder(r.Body).Decode(&msg)
+	if err != nil {
+		return err
+	}
+	return txemail.Send(r.Context(), msg)
+}
+
+func serveSendEmailBatch(w http.ResponseWriter, r *http.Request) error {
+	var req api.SendEmailBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+
+	// Send to each recipient separately so that one bad address does not
+	// prevent delivery to (or leak the addresses of) the others.
+	results := make([]api.SendEmailBatchResult, len(req.Recipients))
+	for i, recipient := range req.Recipients {
+		msg := txemail.Message(req.Message)
+		msg.To = []string{recipient}
+		results[i].Recipient = recipient
+		if err := txemail.Send(r.Context(), msg); err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].Sent = true
+	}
+
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// ensureGitAccess returns a *repoNotAllowedError if the repository is not in
+// the git access allowlist (see gitAccessAllowed), and a *repoDisabledError if
+// it is not enabled. It only consults the database, so it never triggers a
+// repo-updater lookup.
+func ensureGitAccess(ctx context.Context, name api.RepoName) error {
+	if !gitAccessAllowed(name) {
+		return &repoNotAllowedError{Repo: name}
+	}
+	repo, err := db.Repos.GetByName(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !repo.Enabled {
+		return &repoDisabledError{Repo: name}
+	}
+	return nil
+}
+
+// maxConcurrentExtensionsWarm is the maximum number of extension manifests
+// fetched concurrently by serveExtensionsWarm.
+const maxConcurrentExtensionsWarm = 8
+
+// getExtensionByExtensionID is registry.GetExtensionByExtensionID. It is a
+// variable so that tests can mock it.
+var getExtensionByExtensionID = registry.GetExtensionByExtensionID
+
+// serveExtension returns the manifest of an extension in the local or remote
+// registry. Remote manifests are normally served from the registry HTTP cache;
+// if the "refresh" query parameter is true, the manifest is fetched from the
+// remote registry again and the cache entry is updated, so that extension
+// developers don't have to wait for it to expire.
+func serveExtension(w http.ResponseWriter, r *http.Request) error {
+	var extensionID string
+	if err := json.NewDecoder(r.Body).Decode(&extensionID); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+
+	ctx := r.Context()
+	if refresh, _ := strconv.ParseBool(r.URL.Query().Get("refresh")); refresh {
+		ctx = registryclient.WithNoCache(ctx)
+	}
+	local, remote, err := getExtensionByExtensionID(ctx, extensionID)
+	if err != nil {
+		return err
+	}
+
+	resp := api.ExtensionResponse{ExtensionID: extensionID}
+	switch {
+	case local != nil:
+		resp.IsLocal = true
+		manifest, err := local.Manifest(ctx)
+		if err != nil {
+			return err
+		}
+		if manifest != nil {
+			raw := manifest.Raw()
+			resp.Manifest = &raw
+		}
+	case remote != nil:
+		resp.Manifest = remote.Manifest
+	default:
+		return &errcode.HTTPErr{Status: http.StatusNotFound, Err: fmt.Errorf("extension not found: %q", extensionID)}
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// serveExtensionsWarm fetches the manifests of the given extensions, so that
+// later lookups are served from the registry HTTP cache instead of hitting
+// the remote registry on first load. Only the outcome for each extension is
+// returned, not the manifests.
+func serveExtensionsWarm(w http.ResponseWriter, r *http.Request) error {
+	var req api.ExtensionsWarmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+
+	var (
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, maxConcurrentExtensionsWarm)
+		results = make([]api.ExtensionsWarmResult, len(req.ExtensionIDs))
+	)
+	for i, extensionID := range req.ExtensionIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, extensionID string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i].ExtensionID = extensionID
+			local, remote, err := getExtensionByExtensionID(r.Context(), extensionID)
+			if err == nil && local == nil && remote == nil {
+				err = fmt.Errorf("extension not found: %q", extensionID)
+			}
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}(i, extensionID)
+	}
+	wg.Wait()
+
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// listRegistryExtensions lists the extensions in the local and remote
+// registries. It is a variable so that tests can mock it.
+var listRegistryExtensions = func(ctx context.Context) ([]graphqlbackend.RegistryExtension, error) {
+	conn, err := registry.ExtensionRegistry.Extensions(ctx, &graphqlbackend.RegistryExtensionConnectionArgs{Local: true, Remote: true})
+	if err != nil {
+		return nil, err
+	}
+	xs, err := conn.Nodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Nodes returns partial (local) results when the remote registry is
+	// inaccessible, so only report the error.
+	if msg := conn.Error(ctx); msg != nil {
+		log15.Warn("Listing registry extensions returned partial results.", "error", *msg)
+	}
+	return xs, nil
+}
+
+// serveExtensionsList lists the extensions in the local and remote
+// registries, reporting for each whether it has a valid manifest and the
+// version declared in it.
+func serveExtensionsList(w http.ResponseWriter, r *http.Request) error {
+	xs, err := listRegistryExtensions(r.Context())
+	if err != nil {
+		return err
+	}
+
+	items := make([]api.ExtensionsListItem, len(xs))
+	for i, x := range xs {
+		items[i] = api.ExtensionsListItem{
+			ExtensionID: x.ExtensionID(),
+			IsLocal:     x.IsLocal(),
+		}
+		manifest, err := x.Manifest(r.Context())
+		if err != nil || manifest == nil {
+			continue
+		}
+		var m struct {
+			Version string `json:"version"`
+		}
+		if err := jsonc.Unmarshal(manifest.Raw(), &m); err != nil {
+			continue
+		}
+		items[i].HasManifest = true
+		items[i].Version = m.Version
+	}
+
+	if err := json.NewEncoder(w).Encode(items); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// serveGitVersion reports the versions of git and gitserver running on each
+// gitserver shard. The top-level versions are only set if all shards that
+// could be reached agree on them.
+func serveGitVersion(w http.ResponseWriter, r *http.Request) error {
+	addrs := gitserver.DefaultClient.Addrs(r.Context())
+	resp := api.GitVersionResponse{Shards: make([]api.GitserverVersion, len(addrs))}
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		wg.Add(1)
+		go func(shard *api.GitserverVersion, addr string) {
+			defer wg.Done()
+			shard.Addr = addr
+			v, err := gitserver.DefaultClient.Version(r.Context(), addr)
+			if err != nil {
+				shard.Error = err.Error()
+				return
+			}
+			shard.GitVersion = v.GitVersion
+			shard.GitserverVersion = v.GitserverVersion
+		}(&resp.Shards[i], addr)
+	}
+	wg.Wait()
+
+	gitVersions := map[string]bool{}
+	gitserverVersions := map[string]bool{}
+	for _, shard := range resp.Shards {
+		if shard.Error == "" {
+			gitVersions[shard.GitVersion] = true
+			gitserverVersions[shard.GitserverVersion] = true
+		}
+	}
+	if len(gitVersions) == 1 {
+		for v := range gitVersions {
+			resp.GitVersion = v
+		}
+	}
+	if len(gitserverVersions) == 1 {
+		for v := range gitserverVersions {
+			resp.GitserverVersion = v
+		}
+	}
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// serveGitserverDiskInfo reports the free and total disk space of each
+// gitserver shard, and the totals across all shards that could be reached.
+func serveGitserverDiskInfo(w http.ResponseWriter, r *http.Request) error {
+	addrs := gitserver.DefaultClient.Addrs(r.Context())
+	resp := api.GitserverDiskInfoResponse{Shards: make([]api.GitserverDiskInfo, len(addrs))}
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		wg.Add(1)
+		go func(shard *api.GitserverDiskInfo, addr string) {
+			defer wg.Done()
+			shard.Addr = addr
+			info, err := gitserver.DefaultClient.DiskInfo(r.Context(), addr)
+			if err != nil {
+				shard.Error = err.Error()
+				return
+			}
+			shard.FreeBytes = info.FreeBytes
+			shard.TotalBytes = info.TotalBytes
+			shard.PercentUsed = percentUsed(info.FreeBytes, info.TotalBytes)
+		}(&resp.Shards[i], addr)
+	}
+	wg.Wait()
+
+	for _, shard := range resp.Shards {
+		resp.FreeBytes += shard.FreeBytes
+		resp.TotalBytes += shard.TotalBytes
+	}
+	resp.PercentUsed = percentUsed(resp.FreeBytes, resp.TotalBytes)
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// percentUsed returns the percentage of total that is not free, or 0 if total
+// is 0.
+func percentUsed(free, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(total-free) / float64(total) * 100
+}
+
+// resolveRevisionOrNotFound resolves spec to a commit of repo, without
+// triggering a repo-updater lookup. If spec does not resolve, the returned
+// error makes handleError respond with 404 Not Found and the reason.
+func resolveRevisionOrNotFound(ctx context.Context, repo gitserver.Repo, spec string) (api.CommitID, error) {
+	commitID, err := git.ResolveRevision(ctx, repo, nil, spec, nil)
+	return commitID, revisionNotFound(err)
+}
+
+// revisionNotFound returns err as a *revisionNotFoundError if it is a
+// *git.RevisionNotFoundError, and err otherwise.
+func revisionNotFound(err error) error {
+	if e, ok := err.(*git.RevisionNotFoundError); ok {
+		return &revisionNotFoundError{e}
+	}
+	return err
+}
+
+func serveGitResolveRevision(w http.ResponseWriter, r *http.Request) error {
+	// used by zoekt-sourcegraph-mirror
+	vars := mux.Vars(r)
+	name := api.RepoName(vars["RepoName"])
+	spec := vars["Spec"]
+
+	if err := ensureGitAccess(r.Context(), name); err != nil {
+		return err
+	}
+
+	// Do not to trigger a repo-updater lookup since this is a batch job.
+	commitID, err := git.ResolveRevision(r.Context(), gitserver.Repo{Name: name}, nil, spec, nil)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(commitID))
+	return nil
+}
+
+// maxConcurrentResolveRevision is the maximum number of revisions resolved
+// concurrently by a single serveGitResolveRevisions request.
+const maxConcurrentResolveRevision = 16
+
+func serveGitResolveRevisions(w http.ResponseWriter, r *http.Request) error {
+	// used by the cross-repo search planner
+	var req api.GitResolveRevisionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+
+	// Either resolve Spec in each of Repos, or each of Specs in Repo.
+	var results []api.GitResolveRevisionsResult
+	if len(req.Specs) > 0 {
+		if req.Repo == "" || len(req.Repos) > 0 || req.Spec != "" {
+			return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.New("specs must be used with repo (and without spec and repos)")}
+		}
+		if err := ensureGitAccess(r.Context(), req.Repo); err != nil {
+			return err
+		}
+		results = make([]api.GitResolveRevisionsResult, len(req.Specs))
+		for i, spec := range req.Specs {
+			results[i] = api.GitResolveRevisionsResult{Repo: req.Repo, Spec: spec}
+		}
+	} else {
+		results = make([]api.GitResolveRevisionsResult, len(req.Repos))
+		for i, name := range req.Repos {
+			results[i] = api.GitResolveRevisionsResult{Repo: name}
+		}
+	}
+
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, maxConcurrentResolveRevision)
+	)
+	for i := range results {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(result *api.GitResolveRevisionsResult) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			var err error
+			spec := result.Spec
+			if spec == "" {
+				spec = req.Spec
+				err = ensureGitAccess(r.Context(), result.Repo)
+			}
+			if err == nil {
+				// Do not to trigger a repo-updater lookup since this is a batch job.
+				result.CommitID, err = git.ResolveRevision(r.Context(), gitserver.Repo{Name: result.Repo}, nil, spec, nil)
+			}
+			if err != nil {
+				result.Error = err.Error()
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+func serveGitCommits(w http.ResponseWriter, r *http.Request) error {
+	// used by the activity feed
+	var req api.GitCommitsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+
+	if err := ensureGitAccess(r.Context(), req.Repo); err != nil {
+		return err
+	}
+
+	// Only pass well-formed commit IDs to git, so that a single bad ID does
+	// not fail the whole batch.
+	ids := make([]api.CommitID, 0, len(req.Commits))
+	for _, id := range req.Commits {
+		if git.IsAbsoluteRevision(string(id)) {
+			ids = append(ids, id)
+		}
+	}
+	commits, err := git.GetCommits(r.Context(), gitserver.Repo{Name: req.Repo}, ids)
+	if err != nil {
+		return err
+	}
+
+	results := make([]api.GitCommitsResult, len(req.Commits))
+	for i, id := range req.Commits {
+		results[i].CommitID = id
+		commit, ok := commits[id]
+		if !ok {
+			results[i].Error = (&git.RevisionNotFoundError{Repo: req.Repo, Spec: string(id)}).Error()
+			continue
+		}
+		subject := commit.Message
+		if i := strings.Index(subject, "\n"); i != -1 {
+			subject = subject[:i]
+		}
+		results[i].Author = commit.Author.Name
+		results[i].Date = commit.Author.Date
+		results[i].Subject = subject
+		results[i].Parents = commit.Parents
+	}
+
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+func serveGitIsAncestor(w http.ResponseWriter, r *http.Request) error {
+	var req api.GitIsAncestorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	if req.Commit == "" || req.Ref == "" {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.New("commit and ref must be specified")}
+	}
+
+	if err := ensureGitAccess(r.Context(), req.Repo); err != nil {
+		return err
+	}
+
+	// Do not to trigger a repo-updater lookup since this is a batch job.
+	repo := gitserver.Repo{Name: req.Repo}
+	var ids [2]api.CommitID
+	for i, spec := range []string{req.Commit, req.Ref} {
+		id, err := resolveRevisionOrNotFound(r.Context(), repo, spec)
+		if err != nil {
+			return err
+		}
+		ids[i] = id
+	}
+
+	isAncestor, err := git.IsAncestor(r.Context(), repo, ids[0], ids[1])
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(w).Encode(api.GitIsAncestorResponse{IsAncestor: isAncestor}); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// serveGitMergeBaseDiffStat responds with the diffstat of the changes on a
+// branch since its merge base with a base branch, e.g. to estimate the size of
+// a pull request. It responds with 404 if the branches have no common
+// ancestor.
+func serveGitMergeBaseDiffStat(w http.ResponseWriter, r *http.Request) error {
+	var req api.GitMergeBaseDiffStatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	if req.Branch == "" || req.BaseBranch == "" {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.New("branch and baseBranch must be specified")}
+	}
+
+	if err := ensureGitAccess(r.Context(), req.Repo); err != nil {
+		return err
+	}
+
+	repo := gitserver.Repo{Name: req.Repo}
+	var ids [2]api.CommitID
+	for i, spec := range []string{req.Branch, req.BaseBranch} {
+		id, err := resolveRevisionOrNotFound(r.Context(), repo, spec)
+		if err != nil {
+			return err
+		}
+		ids[i] = id
+	}
+
+	mergeBase, err := git.MergeBase(r.Context(), repo, ids[0], ids[1])
+	if err != nil {
+		if err == git.ErrNoMergeBase {
+			http.Error(w, fmt.Sprintf("%s and %s have no common ancestor", req.Branch, req.BaseBranch), http.StatusNotFound)
+			return nil
+		}
+		return err
+	}
+	stat, err := git.GetDiffStat(r.Context(), repo, mergeBase, ids[0])
+	if err != nil {
+		return err
+	}
+	resp := api.GitMergeBaseDiffStatResponse{
+		MergeBase:    mergeBase,
+		FilesChanged: stat.FilesChanged,
+		Additions:    stat.Additions,
+		Deletions:    stat.Deletions,
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// serveGitTagsContaining lists the tags whose history includes a commit, so
+// that callers can tell which releases contain it.
+func serveGitTagsContaining(w http.ResponseWriter, r *http.Request) error {
+	var req api.GitTagsContainingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	if req.Commit == "" {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.New("commit must be specified")}
+	}
+
+	if err := ensureGitAccess(r.Context(), req.Repo); err != nil {
+		return err
+	}
+
+	repo := gitserver.Repo{Name: req.Repo}
+	commitID, err := resolveRevisionOrNotFound(r.Context(), repo, req.Commit)
+	if err != nil {
+		return err
+	}
+
+	tags, err := git.ListTagsContaining(r.Context(), repo, commitID)
+	if err != nil {
+		return err
+	}
+	resp := api.GitTagsContainingResponse{Tags: tags}
+	if resp.Tags == nil {
+		resp.Tags = []string{}
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// serveGitBranchesContaining lists the branches whose history includes a
+// commit. A commit that is on no branch yields an empty list.
+func serveGitBranchesContaining(w http.ResponseWriter, r *http.Request) error {
+	var req api.GitBranchesContainingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	if req.Commit == "" {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.New("commit must be specified")}
+	}
+
+	if err := ensureGitAccess(r.Context(), req.Repo); err != nil {
+		return err
+	}
+
+	repo := gitserver.Repo{Name: req.Repo}
+	commitID, err := resolveRevisionOrNotFound(r.Context(), repo, req.Commit)
+	if err != nil {
+		return err
+	}
+
+	branches, err := git.ListBranchesContaining(r.Context(), repo, commitID)
+	if err != nil {
+		return err
+	}
+	resp := api.GitBranchesContainingResponse{Branches: branches}
+	if resp.Branches == nil {
+		resp.Branches = []string{}
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// serveGitHasSubmodules reports whether a repository declares any submodules
+// (in its .gitmodules file) at a commit, so that callers can decide whether
+// they need to fetch recursively.
+func serveGitHasSubmodules(w http.ResponseWriter, r *http.Request) error {
+	var req api.GitHasSubmodulesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	if req.Commit == "" {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.New("commit must be specified")}
+	}
+
+	if err := ensureGitAccess(r.Context(), req.Repo); err != nil {
+		return err
+	}
+
+	repo := gitserver.Repo{Name: req.Repo}
+	commitID, err := resolveRevisionOrNotFound(r.Context(), repo, req.Commit)
+	if err != nil {
+		return err
+	}
+
+	paths, err := git.ListSubmodulePaths(r.Context(), repo, commitID)
+	if err != nil {
+		return err
+	}
+	resp := api.GitHasSubmodulesResponse{HasSubmodules: len(paths) > 0, Paths: paths}
+	if resp.Paths == nil {
+		resp.Paths = []string{}
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// listSubmodules is git.ListSubmodules. It is a variable so that tests can
+// mock it.
+var listSubmodules = git.ListSubmodules
+
+// serveGitSubmodules lists the submodules declared in a repository's
+// .gitmodules file, mapping each submodule's URL to the name of a repository
+// known to Sourcegraph where possible.
+func serveGitSubmodules(w http.ResponseWriter, r *http.Request) error {
+	var req api.GitSubmodulesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	if req.Commit == "" {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.New("commit must be specified")}
+	}
+
+	if err := ensureGitAccess(r.Context(), req.Repo); err != nil {
+		return err
+	}
+
+	repo := gitserver.Repo{Name: req.Repo}
+	commitID, err := resolveRevisionOrNotFound(r.Context(), repo, req.Commit)
+	if err != nil {
+		return err
+	}
+
+	submodules, err := listSubmodules(r.Context(), repo, commitID)
+	if err != nil {
+		return err
+	}
+	resp := make([]api.GitSubmodule, 0, len(submodules))
+	for _, s := range submodules {
+		resolved, err := resolveSubmoduleRepo(r.Context(), req.Repo, s.URL)
+		if err != nil {
+			return err
+		}
+		resp = append(resp, api.GitSubmodule{Path: s.Path, URL: s.URL, ResolvedRepo: resolved})
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// resolveSubmoduleRepo returns the name of the repository that the submodule
+// URL of the superproject repository refers to, or the empty string if it
+// does not refer to a repository known to Sourcegraph. Relative URLs are
+// resolved against the superproject's name, as git resolves them against the
+// superproject's remote URL.
+func resolveSubmoduleRepo(ctx context.Context, superproject api.RepoName, cloneURL string) (api.RepoName, error) {
+	var name api.RepoName
+	if strings.HasPrefix(cloneURL, "./") || strings.HasPrefix(cloneURL, "../") {
+		name = api.RepoName(strings.TrimSuffix(path.Join(string(superproject), cloneURL), ".git"))
+	} else {
+		var err error
+		name, err = backend.CloneURLToRepoName(ctx, cloneURL)
+		if err != nil {
+			// A malformed URL in .gitmodules should not prevent the other
+			// submodules from being resolved.
+			log15.Warn("Failed to resolve submodule repository name from clone URL.", "repo", superproject, "cloneURL", cloneURL, "error", err)
+			return "", nil
+		}
+	}
+	if name == "" {
+		return "", nil
+	}
+	exists, err := db.Repos.Exists(ctx, name)
+	if err != nil {
+		return "", errors.Wrap(err, "Repos.Exists")
+	}
+	if !exists {
+		return "", nil
+	}
+	return name, nil
+}
+
+// serveGitRefs lists the refs of a repository as JSON, for clients that
+// cannot parse git's wire protocol. Refs are sorted by name, so Limit and
+// Offset can be used to page through repositories with many refs.
+func serveGitRefs(w http.ResponseWriter, r *http.Request) error {
+	var req api.GitRefsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	types := make([]git.RefType, len(req.Types))
+	for i, t := range req.Types {
+		types[i] = git.RefType(t)
+		switch types[i] {
+		case git.RefTypeBranch, git.RefTypeTag, git.RefTypeOther:
+		default:
+			return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: fmt.Errorf("invalid ref type %q", t)}
+		}
+	}
+
+	if err := ensureGitAccess(r.Context(), req.Repo); err != nil {
+		return err
+	}
+
+	refs, err := git.ListRefs(r.Context(), gitserver.Repo{Name: req.Repo}, types...)
+	if err != nil {
+		return err
+	}
+	resp := api.GitRefsResponse{Refs: []api.GitRef{}, TotalCount: len(refs)}
+	if req.Offset < len(refs) {
+		refs = refs[req.Offset:]
+		if req.Limit > 0 && req.Limit < len(refs) {
+			refs = refs[:req.Limit]
+		}
+		for _, ref := range refs {
+			resp.Refs = append(resp.Refs, api.GitRef{Name: ref.Name, CommitID: ref.CommitID, Type: string(ref.Type)})
+		}
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// shaPattern matches full and abbreviated git object SHAs.
+var shaPattern = regexp.MustCompile(`^[0-9a-f]{4,40}$`)
+
+// serveGitObjectType reports whether a SHA names a commit, tree, blob or tag,
+// so that clients can decide how to fetch it.
+func serveGitObjectType(w http.ResponseWriter, r *http.Request) error {
+	var req api.GitObjectTypeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	if !shaPattern.MatchString(req.SHA) {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: fmt.Errorf("invalid SHA %q", req.SHA)}
+	}
+
+	if err := ensureGitAccess(r.Context(), req.Repo); err != nil {
+		return err
+	}
+
+	objectType, err := git.GetObjectType(r.Context(), gitserver.Repo{Name: req.Repo}, req.SHA)
+	if err != nil {
+		return revisionNotFound(err)
+	}
+	if err := json.NewEncoder(w).Encode(api.GitObjectTypeResponse{Type: string(objectType)}); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// readBlob is git.ReadBlob. It is a variable so that tests can mock it.
+var readBlob = git.ReadBlob
+
+// serveGitBlob streams the raw contents of a blob given its SHA, for clients
+// (such as content caches) that already know the SHA from a tree listing and
+// don't need to resolve a path.
+func serveGitBlob(w http.ResponseWriter, r *http.Request) error {
+	var req api.GitBlobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	if !shaPattern.MatchString(req.SHA) {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: fmt.Errorf("invalid SHA %q", req.SHA)}
+	}
+
+	if err := ensureGitAccess(r.Context(), req.Repo); err != nil {
+		return err
+	}
+
+	rc, err := readBlob(r.Context(), gitserver.Repo{Name: req.Repo}, req.SHA)
+	if err != nil {
+		if errcode.IsBadRequest(err) {
+			return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: err}
+		}
+		return revisionNotFound(err)
+	}
+	rc = closeOnDone(r.Context(), rc)
+	defer rc.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, err = io.Copy(w, rc)
+	return err
+}
+
+// serveGitPathExists reports whether a path exists at a commit (and whether it
+// is a directory) without fetching its contents. A nonexistent path is not an
+// error: it is reported as exists: false.
+func serveGitPathExists(w http.ResponseWriter, r *http.Request) error {
+	var req api.GitPathExistsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	if req.Commit == "" {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.New("commit must be specified")}
+	}
+	path, err := cleanRepoPath(req.Path)
+	if err != nil {
+		return err
+	}
+
+	if err := ensureGitAccess(r.Context(), req.Repo); err != nil {
+		return err
+	}
+
+	repo := gitserver.Repo{Name: req.Repo}
+	commitID, err := resolveRevisionOrNotFound(r.Context(), repo, req.Commit)
+	if err != nil {
+		return err
+	}
+
+	var resp api.GitPathExistsResponse
+	fi, err := git.Stat(r.Context(), repo, commitID, path)
+	if err == nil {
+		resp = api.GitPathExistsResponse{Exists: true, IsDir: fi.IsDir()}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// detectFileType is git.DetectFileType. It is a variable so that tests can
+// mock it.
+var detectFileType = git.DetectFileType
+
+// serveGitFileType reports whether a file is binary, along with its MIME type
+// and size, so that viewers can decide whether to render it before fetching
+// its contents.
+func serveGitFileType(w http.ResponseWriter, r *http.Request) error {
+	var req api.GitFileTypeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	path, err := cleanRepoPath(req.Path)
+	if err != nil {
+		return err
+	}
+	if req.Commit == "" || path == "" {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.New("commit and path must be specified")}
+	}
+
+	if err := ensureGitAccess(r.Context(), req.Repo); err != nil {
+		return err
+	}
+
+	repo := gitserver.Repo{Name: req.Repo}
+	commitID, err := resolveRevisionOrNotFound(r.Context(), repo, req.Commit)
+	if err != nil {
+		return err
+	}
+
+	ft, err := detectFileType(r.Context(), repo, commitID, path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, fmt.Sprintf("path %q not found", path), http.StatusNotFound)
+			return nil
+		}
+		if errcode.IsBadRequest(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return nil
+		}
+		return err
+	}
+	resp := api.GitFileTypeResponse{IsBinary: ft.IsBinary, MIMEType: ft.MIMEType, Size: ft.Size}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// maxFileSymbols is the maximum number of symbols that serveGitFileSymbols
+// requests from the symbols service for a single file.
+const maxFileSymbols = 10000
+
+// listTags is backend.Symbols.ListTags. It is a variable so that tests can
+// mock it.
+var listTags = backend.Symbols.ListTags
+
+func serveGitFileSymbols(w http.ResponseWriter, r *http.Request) error {
+	// used by code navigation
+	var req api.GitFileSymbolsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	path, err := cleanRepoPath(req.Path)
+	if err != nil {
+		return err
+	}
+	if req.Commit == "" || path == "" {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.New("commit and path must be specified")}
+	}
+
+	if err := ensureGitAccess(r.Context(), req.Repo); err != nil {
+		return err
+	}
+	// Do not trigger a repo-updater lookup, consistent with the other git
+	// endpoints.
+	commitID, err := resolveRevisionOrNotFound(r.Context(), gitserver.Repo{Name: req.Repo}, req.Commit)
+	if err != nil {
+		return err
+	}
+
+	// The symbols service returns no symbols for files in languages it
+	// can't parse, so those get an empty list.
+	symbols, err := listTags(r.Context(), symbolsprotocol.SearchArgs{
+		Repo:            req.Repo,
+		CommitID:        commitID,
+		IncludePatterns: []string{"^" + regexp.QuoteMeta(path) + "$"},
+		IsCaseSensitive: true,
+		First:           maxFileSymbols,
+	})
+	if err != nil {
+		return errors.Wrap(err, "Symbols.ListTags")
+	}
+	result := []api.GitFileSymbol{}
+	for _, s := range symbols {
+		if s.Parent != "" {
+			continue
+		}
+		result = append(result, api.GitFileSymbol{Name: s.Name, Kind: s.Kind, Line: s.Line})
+	}
+
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// serveGitTreeRecursive responds with every entry under a path at a commit,
+// as newline-delimited JSON (one api.GitTreeEntry per line). The entries are
+// streamed as git produces them, so huge trees don't need to fit in memory.
+func serveGitTreeRecursive(w http.ResponseWriter, r *http.Request) error {
+	// used by static analysis
+	var req api.GitTreeRecursiveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	if req.Commit == "" {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.New("commit must be specified")}
+	}
+	path, err := cleanRepoPath(req.Path)
+	if err != nil {
+		return err
+	}
+
+	if err := ensureGitAccess(r.Context(), req.Repo); err != nil {
+		return err
+	}
+	// Do not trigger a repo-updater lookup, consistent with the other git
+	// endpoints.
+	repo := gitserver.Repo{Name: req.Repo}
+	commitID, err := resolveRevisionOrNotFound(r.Context(), repo, req.Commit)
+	if err != nil {
+		return err
+	}
+
+	// Headers are written with the first entry, so that errors before it
+	// (and a nonexistent path) still get a proper status code.
+	enc := json.NewEncoder(w)
+	n := 0
+	err = git.ForEachTreeEntry(r.Context(), repo, commitID, path, func(e git.TreeEntry) error {
+		if n == 0 {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+		}
+		n++
+		return enc.Encode(api.GitTreeEntry{Path: e.Path, Mode: e.Mode, Type: e.Type, Size: e.Size, SHA: e.SHA})
+	})
+	if err != nil {
+		return err
+	}
+	if n == 0 && path != "" {
+		http.Error(w, fmt.Sprintf("no tree %q in %s@%s", path, req.Repo, req.Commit), http.StatusNotFound)
+		return nil
+	}
+	if n == 0 {
+		// The empty tree.
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	return nil
+}
+
+const (
+	defaultLargestFiles = 10   // number of files returned by serveGitLargestFiles if TopN is 0
+	maxLargestFiles     = 1000 // maximum TopN accepted by serveGitLargestFiles
+)
+
+// serveGitLargestFiles returns the largest files of a repository at a
+// commit, largest first, so that accidentally committed binaries can be found
+// without downloading an archive. Listing the whole tree of a huge repository
+// can be slow, so the route has its own timeout (see internalRouteTimeouts).
+func serveGitLargestFiles(w http.ResponseWriter, r *http.Request) error {
+	var req api.GitLargestFilesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	if req.Commit == "" {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.New("commit must be specified")}
+	}
+	if req.TopN < 0 || req.TopN > maxLargestFiles {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: fmt.Errorf("topN must be between 0 and %d", maxLargestFiles)}
+	}
+	if req.TopN == 0 {
+		req.TopN = defaultLargestFiles
+	}
+
+	if err := ensureGitAccess(r.Context(), req.Repo); err != nil {
+		return err
+	}
+	repo := gitserver.Repo{Name: req.Repo}
+	commitID, err := resolveRevisionOrNotFound(r.Context(), repo, req.Commit)
+	if err != nil {
+		return err
+	}
+
+	entries, err := largestFiles(r.Context(), repo, commitID, req.TopN)
+	if err != nil {
+		return err
+	}
+	files := make([]api.GitLargestFile, len(entries))
+	for i, e := range entries {
+		files[i] = api.GitLargestFile{Path: e.Path, Size: e.Size, SHA: e.SHA}
+	}
+	if err := json.NewEncoder(w).Encode(files); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// largestFiles is git.LargestFiles. It is a variable so that tests can mock
+// it.
+var largestFiles = git.LargestFiles
+
+// gitLogStreamFlushInterval is the number of commits after which
+// serveGitLogStream flushes its response.
+const gitLogStreamFlushInterval = 100
+
+// serveGitLogStream streams every commit reachable from a ref as NDJSON, for
+// bulk consumers (such as analytics backfills) for which paginating through
+// the history would be too chatty. If the client goes away, the git log
+// process is canceled.
+func serveGitLogStream(w http.ResponseWriter, r *http.Request) error {
+	var req api.GitLogStreamRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	if req.Ref == "" {
+		req.Ref = "HEAD"
+	}
+
+	if err := ensureGitAccess(r.Context(), req.Repo); err != nil {
+		return err
+	}
+	// Do not trigger a repo-updater lookup, consistent with the other git
+	// endpoints.
+	repo := gitserver.Repo{Name: req.Repo}
+	commitID, err := resolveRevisionOrNotFound(r.Context(), repo, req.Ref)
+	if err != nil {
+		return err
+	}
+
+	// Headers are written with the first commit, so that errors before it
+	// still get a proper status code.
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	n := 0
+	return git.ForEachCommit(r.Context(), repo, commitID, func(c *git.Commit) error {
+		if n == 0 {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+		}
+		n++
+		subject := c.Message
+		if i := strings.IndexByte(subject, '\n'); i != -1 {
+			subject = subject[:i]
+		}
+		entry := api.GitLogEntry{
+			CommitID:    c.ID,
+			Parents:     c.Parents,
+			AuthorName:  c.Author.Name,
+			AuthorEmail: c.Author.Email,
+			AuthorDate:  c.Author.Date,
+			Subject:     subject,
+		}
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+		if flusher != nil && n%gitLogStreamFlushInterval == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+}
+
+const (
+	defaultCommitsBetweenLimit = 100  // page size of serveGitCommitsBetween if Limit is 0
+	maxCommitsBetweenLimit     = 1000 // maximum Limit accepted by serveGitCommitsBetween
+)
+
+// forEachCommitInRange is git.ForEachCommitInRange. It is a variable so that
+// tests can mock it.
+var forEachCommitInRange = git.ForEachCommitInRange
+
+// errCommitsPageFull stops the iteration of serveGitCommitsBetween once a
+// page is full.
+var errCommitsPageFull = errors.New("page full")
+
+// serveGitCommitsBetween returns a page of the commits in base..head (see
+// git.ForEachCommitInRange), newest first. The next page starts after the
+// commit given as the cursor, so pages are stable as long as base and head
+// resolve to the same commits; clients should pass the resolved commit IDs
+// from the first response when requesting later pages.
+func serveGitCommitsBetween(w http.ResponseWriter, r *http.Request) error {
+	var req api.GitCommitsBetweenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	if req.Base == "" || req.Head == "" {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.New("base and head must be specified")}
+	}
+	if req.Limit < 0 || req.Limit > maxCommitsBetweenLimit {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: fmt.Errorf("limit must be between 0 and %d", maxCommitsBetweenLimit)}
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultCommitsBetweenLimit
+	}
+
+	if err := ensureGitAccess(r.Context(), req.Repo); err != nil {
+		return err
+	}
+	// Do not trigger a repo-updater lookup, consistent with the other git
+	// endpoints.
+	repo := gitserver.Repo{Name: req.Repo}
+	var resp api.GitCommitsBetweenResponse
+	for _, rev := range []struct {
+		spec string
+		dst  *api.CommitID
+	}{{req.Base, &resp.Base}, {req.Head, &resp.Head}} {
+		commitID, err := resolveRevisionOrNotFound(r.Context(), repo, rev.spec)
+		if err != nil {
+			return err
+		}
+		*rev.dst = commitID
+	}
+
+	resp.Commits = []api.GitLogEntry{}
+	seenCursor := req.Cursor == ""
+	err := forEachCommitInRange(r.Context(), repo, resp.Base, resp.Head, func(c *git.Commit) error {
+		if !seenCursor {
+			seenCursor = c.ID == req.Cursor
+			return nil
+		}
+		if len(resp.Commits) == req.Limit {
+			resp.NextCursor = resp.Commits[len(resp.Commits)-1].CommitID
+			return errCommitsPageFull
+		}
+		subject := c.Message
+		if i := strings.IndexByte(subject, '\n'); i != -1 {
+			subject = subject[:i]
+		}
+		resp.Commits = append(resp.Commits, api.GitLogEntry{
+			CommitID:    c.ID,
+			Parents:     c.Parents,
+			AuthorName:  c.Author.Name,
+			AuthorEmail: c.Author.Email,
+			AuthorDate:  c.Author.Date,
+			Subject:     subject,
+		})
+		return nil
+	})
+	if err != nil && err != errCommitsPageFull {
+		return err
+	}
+	if !seenCursor {
+		http.Error(w, fmt.Sprintf("cursor %s is not in %s..%s", req.Cursor, resp.Base, resp.Head), http.StatusBadRequest)
+		return nil
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// rawDiff is git.RawDiff. It is a variable so that tests can mock it.
+var rawDiff = git.RawDiff
+
+// serveGitDiff streams the unified diff between two revisions, so that
+// clients can get patches without cloning the repository. If the client goes
+// away, the git diff process is canceled.
+func serveGitDiff(w http.ResponseWriter, r *http.Request) error {
+	var req api.GitDiffRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	if req.Head == "" {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.New("head must be specified")}
+	}
+
+	if err := ensureGitAccess(r.Context(), req.Repo); err != nil {
+		return err
+	}
+
+	repo := gitserver.Repo{Name: req.Repo}
+	var ids [2]api.CommitID
+	for i, spec := range []string{req.Base, req.Head} {
+		if spec == "" {
+			continue
+		}
+		id, err := resolveRevisionOrNotFound(r.Context(), repo, spec)
+		if err != nil {
+			return err
+		}
+		ids[i] = id
+	}
+
+	rc, err := rawDiff(r.Context(), repo, ids[0], ids[1], req.Path)
+	if err != nil {
+		return err
+	}
+	rc = closeOnDone(r.Context(), rc)
+	defer rc.Close()
+
+	w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+	_, err = io.Copy(w, rc)
+	return err
+}
+
+// resolveTree and rawTreeDiff are git.ResolveTree and git.RawTreeDiff. They
+// are variables so that tests can mock them.
+var (
+	resolveTree = git.ResolveTree
+	rawTreeDiff = git.RawTreeDiff
+)
+
+// serveGitDiffTrees streams the unified diff between two tree-ishes (such as
+// commits of unrelated branches, or tree IDs). Unlike serveGitDiff, the trees
+// need not be in a parent relationship. A tree-ish that cannot be resolved to
+// a tree is a bad request.
+func serveGitDiffTrees(w http.ResponseWriter, r *http.Request) error {
+	var req api.GitDiffTreesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	if req.TreeA == "" || req.TreeB == "" {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.New("treeA and treeB must be specified")}
+	}
+
+	if err := ensureGitAccess(r.Context(), req.Repo); err != nil {
+		return err
+	}
+
+	repo := gitserver.Repo{Name: req.Repo}
+	var trees [2]string
+	for i, treeish := range []string{req.TreeA, req.TreeB} {
+		tree, err := resolveTree(r.Context(), repo, treeish)
+		if err != nil {
+			if git.IsRevisionNotFound(err) {
+				// Write the message directly, so that the client learns
+				// which tree-ish failed (handleError hides it).
+				name := []string{"treeA", "treeB"}[i]
+				http.Error(w, fmt.Sprintf("%s %q does not resolve to a tree", name, treeish), http.StatusBadRequest)
+				return nil
+			}
+			return err
+		}
+		trees[i] = tree
+	}
+
+	rc, err := rawTreeDiff(r.Context(), repo, trees[0], trees[1], req.Path)
+	if err != nil {
+		return err
+	}
+	rc = closeOnDone(r.Context(), rc)
+	defer rc.Close()
+
+	w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+	_, err = io.Copy(w, rc)
+	return err
+}
+
+func serveGitTar(w http.ResponseWriter, r *http.Request) error {
+	// used by zoekt-sourcegraph-mirror
+	vars := mux.Vars(r)
+	name := api.RepoName(vars["RepoName"])
+	spec := vars["Commit"]
+
+	if err := ensureGitAccess(r.Context(), name); err != nil {
+		return err
+	}
+
+	// If asOf is specified, archive the last commit on the default branch
+	// that was committed before that time. The commit in the URL is ignored.
+	var asOf time.Time
+	if s := r.URL.Query().Get("asOf"); s != "" {
+		var err error
+		asOf, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.Wrap(err, "invalid asOf")}
+		}
+		spec = "HEAD"
+	}
+
+	// Ensure commit exists. Do not want to trigger a repo-updater lookup since this is a batch job.
+	repo := gitserver.Repo{Name: name}
+	commit, err := resolveRevisionOrNotFound(r.Context(), repo, spec)
+	if err != nil {
+		return err
+	}
+
+	if !asOf.IsZero() {
+		commits, err := git.Commits(r.Context(), repo, git.CommitsOptions{
+			Range:  string(commit),
+			N:      1,
+			Before: asOf.Format(time.RFC3339),
+		})
+		if err != nil {
+			return err
+		}
+		if len(commits) == 0 {
+			return &noCommitBeforeError{Repo: name, Before: asOf}
+		}
+		commit = commits[0].ID
+	}
+
+	// If changedSince is specified, only the files added or modified since
+	// that commit are archived, so that mirrors can fetch just the delta
+	// since their last sync. The deleted files are reported in the
+	// X-Deleted-Paths trailer.
+	var (
+		include map[string]bool // if non-nil, only these entries are archived
+		deleted []string
+	)
+	if changedSince := r.URL.Query().Get("changedSince"); changedSince != "" {
+		since, err := git.ResolveRevision(r.Context(), repo, nil, changedSince, nil)
+		if err != nil {
+			if _, ok := err.(*git.RevisionNotFoundError); ok {
+				return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.Wrap(err, "invalid changedSince")}
+			}
+			return err
+		}
+		ok, err := git.IsAncestor(r.Context(), repo, since, commit)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: fmt.Errorf("changedSince %s is not an ancestor of %s", changedSince, commit)}
+		}
+		var changed []string
+		changed, deleted, err = git.ChangedPaths(r.Context(), repo, since, commit)
+		if err != nil {
+			return err
+		}
+		include = tarEntriesForPaths(changed)
+	}
+
+	// Entries matching any of the exclude globs (e.g. "vendor/**") are
+	// dropped from the archive. Excludes are applied to the entries git
+	// produced, so if a path is both included and excluded, the exclude
+	// wins.
+	var exclude []pathmatch.PathMatcher
+	for _, pattern := range r.URL.Query()["exclude"] {
+		m, err := pathmatch.CompilePattern(pattern, pathmatch.CompileOptions{CaseSensitive: true})
+		if err != nil {
+			return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.Wrapf(err, "invalid exclude pattern %q", pattern)}
+		}
+		exclude = append(exclude, m)
+	}
+
+	// If path is given (possibly more than once), only those files and
+	// directories are archived. They are passed to git as literal pathspecs,
+	// so that wildcards and pathspec magic have no effect. A path that does
+	// not exist would only make git archive fail after the response has
+	// started, so it is rejected up front.
+	var paths []string
+	for _, p := range r.URL.Query()["path"] {
+		cleaned, err := cleanRepoPath(p)
+		if err != nil {
+			return err
+		}
+		if cleaned == "" {
+			// The repository root was requested, so archive the whole tree.
+			paths = nil
+			break
+		}
+		if _, err := git.Stat(r.Context(), repo, commit, cleaned); err != nil {
+			if os.IsNotExist(err) {
+				http.Error(w, fmt.Sprintf("path %q does not exist at commit %s", p, commit), http.StatusBadRequest)
+				return nil
+			}
+			return err
+		}
+		paths = append(paths, ":(literal)"+cleaned)
+	}
+	sort.Strings(paths)
+
+	// Some git config affects the archived file contents (e.g. line ending
+	// conversion). An allowlisted set of such settings can be overridden
+	// with config=key=value, to produce the same archive on every platform.
+	config := r.URL.Query()["config"]
+	for _, kv := range config {
+		if err := git.CheckArchiveConfig(kv); err != nil {
+			return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: err}
+		}
+	}
+
+	// The archive is a tarball unless format=zip is given. Filtering is only
+	// supported for tarballs, because a zip archive can't be filtered without
+	// buffering all of it.
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "tar"
+	}
+	if format != "tar" && format != "zip" {
+		http.Error(w, fmt.Sprintf("unsupported format %q (must be tar or zip)", format), http.StatusBadRequest)
+		return nil
+	}
+	if format == "zip" && (include != nil || len(exclude) > 0) {
+		http.Error(w, "changedSince and exclude are not supported for zip archives", http.StatusBadRequest)
+		return nil
+	}
+
+	// The archive is only gzip-compressed if the client asks for it with
+	// encoding=gzip or compressionLevel, not merely because its
+	// Accept-Encoding allows it (HTTP clients often send that by default).
+	// The compressionLevel parameter (1-9) trades server CPU for size.
+	var useGzip bool
+	switch encoding := r.URL.Query().Get("encoding"); encoding {
+	case "", "identity":
+	case "gzip":
+		useGzip = true
+	default:
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: fmt.Errorf("unsupported encoding %q (must be gzip or identity)", encoding)}
+	}
+	gzipLevel := gzip.DefaultCompression
+	if s := r.URL.Query().Get("compressionLevel"); s != "" {
+		gzipLevel, err = strconv.Atoi(s)
+		if err != nil || gzipLevel < gzip.BestSpeed || gzipLevel > gzip.BestCompression {
+			return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: fmt.Errorf("invalid compressionLevel %q (must be between %d and %d)", s, gzip.BestSpeed, gzip.BestCompression)}
+		}
+		useGzip = true
+	}
+
+	// Excludes and compression are applied per request, so that the
+	// archive can be shared.
+	src, err := openGitArchive(r.Context(), repo, commit, format, paths, config)
+	if err != nil {
+		return err
+	}
+	// Archives can be huge. If the client goes away, stop the upstream git
+	// archive right away instead of when the next write to w fails.
+	src = closeOnDone(r.Context(), src)
+	defer src.Close()
+
+	copyArchive := func(dst io.Writer) error {
+		if include != nil {
+			return copyTarFiltered(dst, src, func(name string) bool {
+				return include[name] && !matchAnyPath(exclude, name)
+			})
+		}
+		if len(exclude) > 0 {
+			return copyTarExcluding(dst, src, exclude)
+		}
+		_, err := io.Copy(dst, src)
+		return err
+	}
+	// The deleted paths are only sent once the archive was written
+	// successfully.
+	setTrailers := func() {
+		if include != nil {
+			w.Header().Set("X-Deleted-Paths", encodeDeletedPaths(deleted))
+		}
+	}
+
+	// Report the commit that was archived, so that clients passing a mutable
+	// spec (such as a branch name) know exactly what they got without a
+	// separate (and possibly inconsistent) resolve request.
+	w.Header().Set("X-Resolved-Commit", string(commit))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": archiveFilename(name, commit, format)}))
+	if include != nil {
+		w.Header().Set("Trailer", "X-Deleted-Paths")
+	}
+	// Zip archives are already compressed, so they are never gzipped.
+	if format == "zip" {
+		w.Header().Set("Content-Type", "application/zip")
+	} else {
+		w.Header().Set("Content-Type", "application/x-tar")
+	}
+	if format == "zip" || !useGzip {
+		w.WriteHeader(http.StatusOK)
+		if err := copyArchive(w); err != nil {
+			return err
+		}
+		setTrailers()
+		return nil
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	w.WriteHeader(http.StatusOK)
+	zw, err := gzip.NewWriterLevel(w, gzipLevel)
+	if err != nil {
+		return err
+	}
+	if err := copyArchive(zw); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	setTrailers()
+	return nil
+}
+
+// archiveFilename returns the file name under which serveGitTar offers the
+// archive of repo at commit for download, e.g.
+// "github.com-gorilla-mux-0123456789ab.tar".
+func archiveFilename(repo api.RepoName, commit api.CommitID, format string) string {
+	short := string(commit)
+	if len(short) > 12 {
+		short = short[:12]
+	}
+	return strings.Replace(string(repo), "/", "-", -1) + "-" + short + "." + format
+}
+
+// tarEntriesForPaths returns the names of the entries of a git archive that
+// are needed to hold the files at paths: the files themselves and all of
+// their parent directories.
+func tarEntriesForPaths(paths []string) map[string]bool {
+	entries := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		entries[p] = true
+		for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+			entries[dir+"/"] = true
+		}
+	}
+	return entries
+}
+
+// encodeDeletedPaths encodes paths as the value of the X-Deleted-Paths
+// trailer: a comma-separated list of query-escaped paths.
+func encodeDeletedPaths(paths []string) string {
+	escaped := make([]string, len(paths))
+	for i, p := range paths {
+		escaped[i] = url.QueryEscape(p)
+	}
+	return strings.Join(escaped, ",")
+}
+
+// gitArchive is git.Archive. It is a variable so that tests can mock it.
+var gitArchive = git.Archive
+
+// openGitArchive returns the archive of repo at commit in the given format
+// ("tar" or "zip"), limited to the given pathspecs (if any) and with the given
+// git config overrides (see git.ArchiveOptions). Concurrent requests for the
+// same archive share a single git archive invocation.
+func openGitArchive(ctx context.Context, repo gitserver.Repo, commit api.CommitID, format string, paths, config []string) (io.ReadCloser, error) {
+	key := fmt.Sprintf("%s@%s:%s", repo.Name, commit, format)
+	if len(paths) > 0 {
+		key += fmt.Sprintf(":paths=%q", paths)
+	}
+	if len(config) > 0 {
+		key += fmt.Sprintf(":%q", config)
+	}
+	return archiveShares.open(ctx, key, func(fetchCtx context.Context) (io.ReadCloser, error) {
+		release, err := gitArchiveLimiter.acquire(fetchCtx)
+		if err != nil {
+			return nil, err
+		}
+		rc, err := gitArchive(fetchCtx, repo, git.ArchiveOptions{Treeish: string(commit), Format: format, Paths: paths, Config: config})
+		if err != nil {
+			release()
+			return nil, err
+		}
+		return &releaseOnClose{ReadCloser: rc, release: release}, nil
+	})
+}
+
+// archiveChecksumCache caches the responses of serveGitArchiveChecksum, keyed
+// by repository, commit ID and format. The archive of a commit does not
+// change, so the entries don't expire.
+var archiveChecksumCache = rcache.New("archive-checksum")
+
+// serveGitArchiveChecksum responds with the SHA-256 checksum and size of the
+// (uncompressed) archive of a commit, so that archives can be compared across
+// instances without transferring them. Hashing the archive of a huge
+// repository can be slow, so the route has its own timeout (see
+// internalRouteTimeouts).
+func serveGitArchiveChecksum(w http.ResponseWriter, r *http.Request) error {
+	// used by reproducibility audits
+	var req api.GitArchiveChecksumRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errors.Wrap(err, "Decode")
+	}
+	if req.Format == "" {
+		req.Format = "tar"
+	}
+	if req.Format != "tar" && req.Format != "zip" {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: fmt.Errorf("invalid format %q (must be tar or zip)", req.Format)}
+	}
+	if req.Commit == "" {
+		return &errcode.HTTPErr{Status: http.StatusBadRequest, Err: errors.New("commit must be specified")}
+	}
+
+	if err := ensureGitAccess(r.Context(), req.Repo); err != nil {
+		return err
+	}
+	// Do not trigger a repo-updater lookup, consistent with the other git
+	// endpoints.
+	repo := gitserver.Repo{Name: req.Repo}
+	commit, err := resolveRevisionOrNotFound(r.Context(), repo, req.Commit)
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("%s@%s:%s", req.Repo, commit, req.Format)
+	var resp api.GitArchiveChecksumResponse
+	if data, ok := archiveChecksumCache.Get(key); !ok || json.Unmarshal(data, &resp) != nil {
+		resp, err = computeArchiveChecksum(r.Context(), repo, commit, req.Format)
+		if err != nil {
+			return err
+		}
+		if data, err := json.Marshal(resp); err == nil {
+			archiveChecksumCache.Set(key, data)
+		}
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return errors.Wrap(err, "Encode")
+	}
+	return nil
+}
+
+// computeArchiveChecksum streams the archive of repo at commit through a
+// SHA-256 hasher.
+func computeArchiveChecksum(ctx context.Context, repo gitserver.Repo, commit api.CommitID, format string) (api.GitArchiveChecksumResponse, error) {
+	src, err := openGitArchive(ctx, repo, commit, format, nil, nil)
+	if err != nil {
+		return api.GitArchiveChecksumResponse{}, err
+	}
+	src = closeOnDone(ctx, src)
+	defer src.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, src)
+	if err != nil {
+		return api.GitArchiveChecksumResponse{}, err
+	}
+	return api.GitArchiveChecksumResponse{
+		CommitID: commit,
+		SHA256:   hex.EncodeToString(h.Sum(nil)),
+		Size:     size,
+	}, nil
+}
+
+// closeOnDone returns an io.ReadCloser that reads from rc and closes it as soon
+// as ctx is done, which unblocks any pending Read and cancels the command
+// producing rc's contents. After ctx is done, Read returns ctx.Err().
+func closeOnDone(ctx context.Context, rc io.ReadCloser) io.ReadCloser {
+	c := &ctxReadCloser{ctx: ctx, rc: rc, stop: make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.closeRC()
+		case <-c.stop:
+		}
+	}()
+	return c
+}
+
+type ctxReadCloser struct {
+	ctx  context.Context
+	rc   io.ReadCloser
+	stop chan struct{}
+
+	stopOnce sync.Once
+	once     sync.Once
+	closeErr error
+}
+
+func (c *ctxReadCloser) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := c.rc.Read(p)
+	if ctxErr := c.ctx.Err(); err != nil && ctxErr != nil {
+		err = ctxErr
+	}
+	return n, err
+}
+
+func (c *ctxReadCloser) closeRC() error {
+	c.once.Do(func() { c.closeErr = c.rc.Close() })
+	return c.closeErr
+}
+
+func (c *ctxReadCloser) Close() error {
+	c.stopOnce.Do(func() { close(c.stop) })
+	return c.closeRC()
+}
+
+// copyTarExcluding copies the tar archive read from src to dst, omitting all
+// entries whose name matches any of the exclude matchers. If every entry is
+// excluded, dst is still a valid (empty) tar archive.
+func copyTarExcluding(dst io.Writer, src io.Reader, exclude []pathmatch.PathMatcher) error {
+	return copyTarFiltered(dst, src, func(name string) bool {
+		return !matchAnyPath(exclude, name)
+	})
+}
+
+// copyTarFiltered copies the tar archive read from src to dst, omitting all
+// entries for whose name keep returns false. Global headers (which git uses
+// to record the commit ID) are always kept.
+func copyTarFiltered(dst io.Writer, src io.Reader, keep func(name string) bool) error {
+	tr := tar.NewReader(src)
+	tw := tar.NewWriter(dst)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeXGlobalHeader && !keep(hdr.Name) {
+			continue
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// matchAnyPath reports whether name matches any of the matchers.
+func matchAnyPath(matchers []pathmatch.PathMatcher, name string) bool {
+	for _, m := range matchers {
+		if m.MatchPath(name) {
+			return true
+		}
+	}
+	return false
 }
 
 func handlePing(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,2801 @@
+package httpapi
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/authz"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/backend"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/db"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/graphqlbackend"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/internal/httpapi/router"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/internal/inventory"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/internal/pkg/usagestats"
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/types"
+	"github.com/sourcegraph/sourcegraph/pkg/api"
+	"github.com/sourcegraph/sourcegraph/pkg/conf"
+	"github.com/sourcegraph/sourcegraph/pkg/errcode"
+	"github.com/sourcegraph/sourcegraph/pkg/gitserver"
+	"github.com/sourcegraph/sourcegraph/pkg/gitserver/protocol"
+	"github.com/sourcegraph/sourcegraph/pkg/pathmatch"
+	"github.com/sourcegraph/sourcegraph/pkg/registry"
+	symbolsprotocol "github.com/sourcegraph/sourcegraph/pkg/symbols/protocol"
+	"github.com/sourcegraph/sourcegraph/pkg/txemail"
+	"github.com/sourcegraph/sourcegraph/pkg/txemail/txtypes"
+	"github.com/sourcegraph/sourcegraph/pkg/vcs"
+	"github.com/sourcegraph/sourcegraph/pkg/vcs/git"
+	"github.com/sourcegraph/sourcegraph/pkg/vcs/util"
+	"github.com/sourcegraph/sourcegraph/schema"
+)
+
+func TestGitEndpoints_RepoDisabled(t *testing.T) {
+	c := newInternalTest()
+
+	db.Mocks.Repos.GetByName = func(ctx context.Context, name api.RepoName) (*types.Repo, error) {
+		return &types.Repo{ID: 1, Name: name, Enabled: false}, nil
+	}
+	defer func() { db.Mocks.Repos = db.MockRepos{} }()
+
+	for _, url := range []string{
+		"/git/github.com/gorilla/mux/resolve-revision/master",
+		"/git/github.com/gorilla/mux/tar/master",
+	} {
+		t.Run(url, func(t *testing.T) {
+			resp, err := c.Get(url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != http.StatusForbidden {
+				t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusForbidden)
+			}
+			var body errorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if want := "repo_disabled"; body.Code != want {
+				t.Errorf("got code %q, want %q", body.Code, want)
+			}
+		})
+	}
+}
+
+func TestGitEndpoints_CloneInProgress(t *testing.T) {
+	c := newInternalTest()
+
+	defer mockEnabledRepo(t)()
+	git.Mocks.ResolveRevision = func(spec string, opt *git.ResolveRevisionOptions) (api.CommitID, error) {
+		return "", &vcs.RepoNotExistError{Repo: "github.com/gorilla/mux", CloneInProgress: true}
+	}
+	defer git.ResetMocks()
+
+	for _, url := range []string{
+		"/git/github.com/gorilla/mux/resolve-revision/master",
+		"/git/github.com/gorilla/mux/tar/master",
+	} {
+		t.Run(url, func(t *testing.T) {
+			resp, err := c.Get(url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != http.StatusAccepted {
+				t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusAccepted)
+			}
+			if resp.Header.Get("Retry-After") == "" {
+				t.Error("got no Retry-After header")
+			}
+			var body errorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if want := "repo_cloning"; body.Code != want {
+				t.Errorf("got code %q, want %q", body.Code, want)
+			}
+		})
+	}
+}
+
+func TestHandleError_wrappedCloneInProgress(t *testing.T) {
+	err := errors.Wrap(&vcs.RepoNotExistError{Repo: "github.com/gorilla/mux", CloneInProgress: true}, "git log")
+	rec := httptest.NewRecorder()
+	handleError(rec, httptest.NewRequest("POST", "/git/log-stream", nil), errcode.HTTP(err), err)
+
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusAccepted)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("got no Retry-After header")
+	}
+	var body errorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if want := "repo_cloning"; body.Code != want {
+		t.Errorf("got code %q, want %q", body.Code, want)
+	}
+}
+
+func TestServeReposListForOrg(t *testing.T) {
+	c := newInternalTest()
+
+	db.Mocks.Orgs.GetByID = func(ctx context.Context, id int32) (*types.Org, error) {
+		if id != 1 {
+			return nil, &db.OrgNotFoundError{Message: fmt.Sprintf("id %d", id)}
+		}
+		return &types.Org{ID: id, Name: "acme"}, nil
+	}
+	defer func() { db.Mocks.Orgs = db.MockOrgs{} }()
+
+	tests := []struct {
+		req        api.ReposListForOrgRequest
+		wantStatus int
+		wantCode   string
+	}{
+		{req: api.ReposListForOrgRequest{}, wantStatus: http.StatusBadRequest},
+		{req: api.ReposListForOrgRequest{OrgID: 2}, wantStatus: http.StatusNotFound},
+		{req: api.ReposListForOrgRequest{OrgID: 1, Limit: 10}, wantStatus: http.StatusNotImplemented, wantCode: "not_supported"},
+	}
+	for _, test := range tests {
+		body, _ := json.Marshal(test.req)
+		req, _ := http.NewRequest("POST", "/repos/list-for-org", bytes.NewReader(body))
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != test.wantStatus {
+			t.Errorf("%+v: got status %d, want %d", test.req, resp.StatusCode, test.wantStatus)
+		}
+		if test.wantCode == "" {
+			continue
+		}
+		var errResp errorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+			t.Fatal(err)
+		}
+		if errResp.Code != test.wantCode {
+			t.Errorf("%+v: got code %q, want %q", test.req, errResp.Code, test.wantCode)
+		}
+	}
+}
+
+func TestServeGitVersion(t *testing.T) {
+	c := newInternalTest()
+
+	gs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" {
+			t.Errorf("got gitserver request for %s, want /version", r.URL.Path)
+		}
+		json.NewEncoder(w).Encode(protocol.VersionResponse{GitVersion: "git version 2.20.1", GitserverVersion: "3.0.0"})
+	}))
+	defer gs.Close()
+	// The second shard is unreachable.
+	addrs := []string{strings.TrimPrefix(gs.URL, "http://"), "127.0.0.1:0"}
+	defer func(orig func(context.Context) []string) { gitserver.DefaultClient.Addrs = orig }(gitserver.DefaultClient.Addrs)
+	gitserver.DefaultClient.Addrs = func(context.Context) []string { return addrs }
+
+	var resp api.GitVersionResponse
+	if err := c.GetJSON("/git/version", &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.GitVersion != "git version 2.20.1" || resp.GitserverVersion != "3.0.0" {
+		t.Errorf("got versions %q and %q, want the reachable shard's", resp.GitVersion, resp.GitserverVersion)
+	}
+	if len(resp.Shards) != 2 {
+		t.Fatalf("got %d shards, want 2", len(resp.Shards))
+	}
+	if got := resp.Shards[0]; got.Addr != addrs[0] || got.GitVersion != "git version 2.20.1" || got.Error != "" {
+		t.Errorf("got shard %+v, want versions", got)
+	}
+	if got := resp.Shards[1]; got.Addr != addrs[1] || got.GitVersion != "" || got.Error == "" {
+		t.Errorf("got shard %+v, want error", got)
+	}
+}
+
+func TestServeGitserverDiskInfo(t *testing.T) {
+	c := newInternalTest()
+
+	gs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/disk-info" {
+			t.Errorf("got gitserver request for %s, want /disk-info", r.URL.Path)
+		}
+		json.NewEncoder(w).Encode(protocol.DiskInfoResponse{FreeBytes: 25, TotalBytes: 100})
+	}))
+	defer gs.Close()
+	// The third shard is unreachable.
+	gsAddr := strings.TrimPrefix(gs.URL, "http://")
+	addrs := []string{gsAddr, gsAddr, "127.0.0.1:0"}
+	defer func(orig func(context.Context) []string) { gitserver.DefaultClient.Addrs = orig }(gitserver.DefaultClient.Addrs)
+	gitserver.DefaultClient.Addrs = func(context.Context) []string { return addrs }
+
+	var resp api.GitserverDiskInfoResponse
+	if err := c.GetJSON("/gitserver/disk-info", &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.FreeBytes != 50 || resp.TotalBytes != 200 || resp.PercentUsed != 75 {
+		t.Errorf("got totals %+v, want 50 free of 200 (75%% used)", resp)
+	}
+	if len(resp.Shards) != 3 {
+		t.Fatalf("got %d shards, want 3", len(resp.Shards))
+	}
+	want := api.GitserverDiskInfo{Addr: gsAddr, FreeBytes: 25, TotalBytes: 100, PercentUsed: 75}
+	if got := resp.Shards[0]; got != want {
+		t.Errorf("got shard %+v, want %+v", got, want)
+	}
+	if got := resp.Shards[2]; got.Addr != addrs[2] || got.TotalBytes != 0 || got.Error == "" {
+		t.Errorf("got shard %+v, want error", got)
+	}
+}
+
+func TestServeGitResolveRevisions(t *testing.T) {
+	c := newInternalTest()
+
+	db.Mocks.Repos.GetByName = func(ctx context.Context, name api.RepoName) (*types.Repo, error) {
+		return &types.Repo{ID: 1, Name: name, Enabled: name != "github.com/disabled/repo"}, nil
+	}
+	defer func() { db.Mocks.Repos = db.MockRepos{} }()
+	git.Mocks.ResolveRevision = func(spec string, opt *git.ResolveRevisionOptions) (api.CommitID, error) {
+		if spec != "main" {
+			t.Errorf("got spec %q, want %q", spec, "main")
+		}
+		return "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", nil
+	}
+	defer git.ResetMocks()
+
+	var results []api.GitResolveRevisionsResult
+	req := api.GitResolveRevisionsRequest{
+		Spec:  "main",
+		Repos: []api.RepoName{"github.com/gorilla/mux", "github.com/disabled/repo"},
+	}
+	if err := c.DoJSON("POST", "/git/resolve-revisions", req, &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	if got := results[0]; got.Repo != "github.com/gorilla/mux" || got.CommitID != "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" || got.Error != "" {
+		t.Errorf("got %+v, want resolved commit", got)
+	}
+	if got := results[1]; got.Repo != "github.com/disabled/repo" || got.CommitID != "" || got.Error == "" {
+		t.Errorf("got %+v, want error", got)
+	}
+}
+
+func TestServeGitResolveRevisions_specs(t *testing.T) {
+	c := newInternalTest()
+
+	defer mockEnabledRepo(t)()
+	git.Mocks.ResolveRevision = func(spec string, opt *git.ResolveRevisionOptions) (api.CommitID, error) {
+		if spec == "missing" {
+			return "", &git.RevisionNotFoundError{Repo: "github.com/gorilla/mux", Spec: spec}
+		}
+		return api.CommitID(strings.Repeat(spec[:1], 40)), nil
+	}
+	defer git.ResetMocks()
+
+	var results []api.GitResolveRevisionsResult
+	req := api.GitResolveRevisionsRequest{
+		Repo:  "github.com/gorilla/mux",
+		Specs: []string{"base", "head", "missing"},
+	}
+	if err := c.DoJSON("POST", "/git/resolve-revisions", req, &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	for i, want := range []api.CommitID{"bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", "hhhhhhhhhhhhhhhhhhhhhhhhhhhhhhhhhhhhhhhh"} {
+		if got := results[i]; got.Spec != req.Specs[i] || got.CommitID != want || got.Error != "" {
+			t.Errorf("got %+v, want spec %q resolved to %s", got, req.Specs[i], want)
+		}
+	}
+	if got := results[2]; got.Spec != "missing" || got.CommitID != "" || got.Error == "" {
+		t.Errorf("got %+v, want error", got)
+	}
+}
+
+func TestServeSavedQueriesGetInfo_NotFound(t *testing.T) {
+	c := newInternalTest()
+
+	db.Mocks.SavedQueries.Get = func(ctx context.Context, query string) (*db.SavedQueryInfo, error) {
+		return nil, nil
+	}
+	defer func() { db.Mocks.SavedQueries = db.MockSavedQueries{} }()
+
+	body, _ := json.Marshal("repo:foo bar")
+	req, _ := http.NewRequest("POST", "/saved-queries/get-info", bytes.NewReader(body))
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+
+	db.Mocks.SavedQueries.Get = func(ctx context.Context, query string) (*db.SavedQueryInfo, error) {
+		return nil, errors.New("connection refused")
+	}
+	req, _ = http.NewRequest("POST", "/saved-queries/get-info", bytes.NewReader(body))
+	resp, err = c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusInternalServerError)
+	}
+}
+
+func TestServeSavedQueriesDeleteInfoBatch(t *testing.T) {
+	c := newInternalTest()
+
+	var gotQueries []string
+	db.Mocks.SavedQueries.DeleteMany = func(ctx context.Context, queries []string) (int, error) {
+		gotQueries = queries
+		return 1, nil
+	}
+	defer func() { db.Mocks.SavedQueries = db.MockSavedQueries{} }()
+
+	var deleted int
+	if err := c.DoJSON("POST", "/saved-queries/delete-info-batch", []string{"a", "missing"}, &deleted); err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 {
+		t.Errorf("got %d deleted, want 1", deleted)
+	}
+	if want := []string{"a", "missing"}; !reflect.DeepEqual(gotQueries, want) {
+		t.Errorf("got queries %v, want %v", gotQueries, want)
+	}
+}
+
+func TestServeSavedQueriesReconcile(t *testing.T) {
+	c := newInternalTest()
+
+	db.Mocks.Settings.ListAll = func(ctx context.Context, impreciseSubstring string) ([]*api.Settings, error) {
+		return []*api.Settings{
+			{Subject: api.SettingsSubject{Site: true}, Contents: `{"search.savedQueries": [{"key": "a", "query": "live"}]}`},
+		}, nil
+	}
+	defer func() { db.Mocks.Settings = db.MockSettings{} }()
+	db.Mocks.SavedQueries.ListQueries = func(ctx context.Context) ([]string, error) {
+		return []string{"live", "orphan1", "orphan2"}, nil
+	}
+	var deleted []string
+	db.Mocks.SavedQueries.DeleteMany = func(ctx context.Context, queries []string) (int, error) {
+		deleted = append(deleted, queries...)
+		return len(queries), nil
+	}
+	defer func() { db.Mocks.SavedQueries = db.MockSavedQueries{} }()
+
+	for _, dryRun := range []bool{true, false} {
+		deleted = nil
+		var resp api.SavedQueriesReconcileResult
+		if err := c.DoJSON("POST", "/saved-queries/reconcile", api.SavedQueriesReconcileRequest{DryRun: dryRun}, &resp); err != nil {
+			t.Fatal(err)
+		}
+		orphans := []string{"orphan1", "orphan2"}
+		if want := (api.SavedQueriesReconcileResult{Removed: orphans, Count: 2}); !reflect.DeepEqual(resp, want) {
+			t.Errorf("dryRun=%v: got %+v, want %+v", dryRun, resp, want)
+		}
+		var wantDeleted []string
+		if !dryRun {
+			wantDeleted = orphans
+		}
+		if !reflect.DeepEqual(deleted, wantDeleted) {
+			t.Errorf("dryRun=%v: got deleted %v, want %v", dryRun, deleted, wantDeleted)
+		}
+	}
+}
+
+func TestServeSavedQueriesHealth(t *testing.T) {
+	c := newInternalTest()
+
+	userID := int32(1)
+	db.Mocks.Settings.ListAll = func(ctx context.Context, impreciseSubstring string) ([]*api.Settings, error) {
+		return []*api.Settings{
+			{Subject: api.SettingsSubject{Site: true}, Contents: `{"search.savedQueries": [{"key": "healthy", "query": "a"}, {"key": "slow", "query": "b"}]}`},
+			{Subject: api.SettingsSubject{User: &userID}, Contents: `{"search.savedQueries": [{"key": "old", "query": "c"}, {"key": "new", "query": "d"}]}`},
+		}, nil
+	}
+	defer func() { db.Mocks.Settings = db.MockSettings{} }()
+	now := time.Now().UTC().Truncate(time.Second)
+	var gotQueries []string
+	db.Mocks.SavedQueries.GetMany = func(ctx context.Context, queries []string) (map[string]*db.SavedQueryInfo, error) {
+		gotQueries = queries
+		return map[string]*db.SavedQueryInfo{
+			"a": {Query: "a", LastExecuted: now, LatestResult: now, ExecDuration: time.Second},
+			"b": {Query: "b", LastExecuted: now, LatestResult: now, ExecDuration: 2 * time.Minute},
+			"c": {Query: "c", LastExecuted: now.Add(-24 * time.Hour), LatestResult: now, ExecDuration: time.Second},
+		}, nil
+	}
+	defer func() { db.Mocks.SavedQueries = db.MockSavedQueries{} }()
+
+	type health struct {
+		key         string
+		slow, stale bool
+		executed    bool
+	}
+	for _, test := range []struct {
+		req  api.SavedQueriesHealthRequest
+		want []health
+	}{
+		{
+			req: api.SavedQueriesHealthRequest{},
+			want: []health{
+				{key: "healthy", executed: true},
+				{key: "slow", slow: true, executed: true},
+				{key: "old", stale: true, executed: true},
+				{key: "new", stale: true},
+			},
+		},
+		{
+			req:  api.SavedQueriesHealthRequest{Limit: 2, Offset: 1, SlowThresholdSeconds: 300},
+			want: []health{{key: "slow", executed: true}, {key: "old", stale: true, executed: true}},
+		},
+		{
+			req:  api.SavedQueriesHealthRequest{Offset: 10},
+			want: []health{},
+		},
+	} {
+		var resp api.SavedQueriesHealthResponse
+		if err := c.DoJSON("POST", "/saved-queries/health", test.req, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.TotalCount != 4 {
+			t.Errorf("%+v: got total count %d, want 4", test.req, resp.TotalCount)
+		}
+		got := make([]health, len(resp.Queries))
+		for i, q := range resp.Queries {
+			got[i] = health{key: q.Spec.Key, slow: q.Slow, stale: q.Stale, executed: q.LastExecuted != nil}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%+v: got %+v, want %+v", test.req, got, test.want)
+		}
+		if len(gotQueries) != len(test.want) {
+			t.Errorf("%+v: got info requested for %q, want only the current page", test.req, gotQueries)
+		}
+	}
+}
+
+func TestServeEmailConfig(t *testing.T) {
+	c := newInternalTest()
+	defer conf.Mock(nil)
+
+	tests := []struct {
+		smtp *schema.SMTPServerConfig
+		want api.EmailConfig
+	}{
+		{smtp: nil, want: api.EmailConfig{}},
+		{
+			smtp: &schema.SMTPServerConfig{Host: "smtp.example.com", Port: 587},
+			want: api.EmailConfig{CanSend: true, VerificationRequired: true},
+		},
+	}
+	for _, test := range tests {
+		conf.Mock(&conf.Unified{SiteConfiguration: schema.SiteConfiguration{EmailSmtp: test.smtp}})
+
+		var config api.EmailConfig
+		if err := c.DoJSON("POST", "/email-config", nil, &config); err != nil {
+			t.Fatal(err)
+		}
+		if config != test.want {
+			t.Errorf("smtp %+v: got %+v, want %+v", test.smtp, config, test.want)
+		}
+
+		var required api.EmailVerificationRequiredResponse
+		if err := c.DoJSON("POST", "/email-verification-required", nil, &required); err != nil {
+			t.Fatal(err)
+		}
+		if required.Required != test.want.VerificationRequired {
+			t.Errorf("smtp %+v: got required %v, want %v", test.smtp, required.Required, test.want.VerificationRequired)
+		}
+	}
+}
+
+func TestServeSendEmailBatch(t *testing.T) {
+	c := newInternalTest()
+
+	var sentTo []string
+	txemail.MockSend = func(ctx context.Context, message txemail.Message) error {
+		if len(message.To) != 1 {
+			t.Errorf("got recipients %v, want exactly one", message.To)
+		}
+		if message.To[0] == "bad@example.com" {
+			return errors.New("rejected")
+		}
+		sentTo = append(sentTo, message.To[0])
+		return nil
+	}
+	defer func() { txemail.MockSend = nil }()
+
+	var results []api.SendEmailBatchResult
+	req := api.SendEmailBatchRequest{
+		Message:    txtypes.Message{To: []string{"ignored@example.com"}},
+		Recipients: []string{"a@example.com", "bad@example.com", "b@example.com"},
+	}
+	if err := c.DoJSON("POST", "/send-email-batch", req, &results); err != nil {
+		t.Fatal(err)
+	}
+	want := []api.SendEmailBatchResult{
+		{Recipient: "a@example.com", Sent: true},
+		{Recipient: "bad@example.com", Error: "rejected"},
+		{Recipient: "b@example.com", Sent: true},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("got %+v, want %+v", results, want)
+	}
+	if want := []string{"a@example.com", "b@example.com"}; !reflect.DeepEqual(sentTo, want) {
+		t.Errorf("sent to %v, want %v", sentTo, want)
+	}
+}
+
+func TestServeExtension(t *testing.T) {
+	c := newInternalTest()
+
+	var cacheControl []string
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cacheControl = append(cacheControl, r.Header.Get("Cache-Control"))
+		w.Header().Set(registry.MediaTypeHeaderName, registry.MediaType)
+		manifest := `{"version": "1.0.0"}`
+		json.NewEncoder(w).Encode(registry.Extension{ExtensionID: "alice/a", Manifest: &manifest})
+	}))
+	defer remote.Close()
+	remoteURL, _ := url.Parse(remote.URL)
+
+	orig := getExtensionByExtensionID
+	defer func() { getExtensionByExtensionID = orig }()
+	getExtensionByExtensionID = func(ctx context.Context, extensionID string) (graphqlbackend.RegistryExtension, *registry.Extension, error) {
+		if extensionID != "alice/a" {
+			return nil, nil, nil
+		}
+		x, err := registry.GetByExtensionID(ctx, remoteURL, extensionID)
+		return nil, x, err
+	}
+
+	for _, path := range []string{"/extension", "/extension?refresh=true"} {
+		var resp api.ExtensionResponse
+		if err := c.DoJSON("POST", path, "alice/a", &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Manifest == nil || *resp.Manifest != `{"version": "1.0.0"}` {
+			t.Errorf("%s: got manifest %v", path, resp.Manifest)
+		}
+	}
+	if want := []string{"", "no-cache"}; !reflect.DeepEqual(cacheControl, want) {
+		t.Errorf("got Cache-Control headers %q, want %q", cacheControl, want)
+	}
+
+	body, _ := json.Marshal("bob/missing")
+	req, _ := http.NewRequest("POST", "/extension", bytes.NewReader(body))
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("missing extension: got status %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestServeExtensionsWarm(t *testing.T) {
+	c := newInternalTest()
+
+	var (
+		mu      sync.Mutex
+		fetched []string
+	)
+	orig := getExtensionByExtensionID
+	defer func() { getExtensionByExtensionID = orig }()
+	getExtensionByExtensionID = func(ctx context.Context, extensionID string) (graphqlbackend.RegistryExtension, *registry.Extension, error) {
+		if extensionID == "bad/extension" {
+			return nil, nil, errors.New("boom")
+		}
+		mu.Lock()
+		fetched = append(fetched, extensionID)
+		mu.Unlock()
+		return nil, &registry.Extension{ExtensionID: extensionID}, nil
+	}
+
+	var results []api.ExtensionsWarmResult
+	if err := c.DoJSON("POST", "/extensions/warm", api.ExtensionsWarmRequest{ExtensionIDs: []string{"alice/a", "bad/extension"}}, &results); err != nil {
+		t.Fatal(err)
+	}
+	want := []api.ExtensionsWarmResult{
+		{ExtensionID: "alice/a"},
+		{ExtensionID: "bad/extension", Error: "boom"},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("got %+v, want %+v", results, want)
+	}
+	if want := []string{"alice/a"}; !reflect.DeepEqual(fetched, want) {
+		t.Errorf("fetched %v, want %v", fetched, want)
+	}
+}
+
+type fakeRegistryExtension struct {
+	graphqlbackend.RegistryExtension
+	extensionID string
+	local       bool
+	manifest    *string
+}
+
+func (x *fakeRegistryExtension) ExtensionID() string { return x.extensionID }
+func (x *fakeRegistryExtension) IsLocal() bool       { return x.local }
+func (x *fakeRegistryExtension) Manifest(context.Context) (graphqlbackend.ExtensionManifest, error) {
+	if x.manifest == nil {
+		return nil, nil
+	}
+	return fakeExtensionManifest(*x.manifest), nil
+}
+
+type fakeExtensionManifest string
+
+func (m fakeExtensionManifest) Raw() string                   { return string(m) }
+func (m fakeExtensionManifest) Description() (*string, error) { return nil, nil }
+func (m fakeExtensionManifest) BundleURL() (*string, error)   { return nil, nil }
+
+func TestServeExtensionsList(t *testing.T) {
+	c := newInternalTest()
+
+	strptr := func(s string) *string { return &s }
+	orig := listRegistryExtensions
+	defer func() { listRegistryExtensions = orig }()
+	listRegistryExtensions = func(ctx context.Context) ([]graphqlbackend.RegistryExtension, error) {
+		return []graphqlbackend.RegistryExtension{
+			&fakeRegistryExtension{extensionID: "example.com/alice/a", local: true, manifest: strptr(`{"version": "1.2.0"}`)},
+			&fakeRegistryExtension{extensionID: "bob/b", manifest: strptr(`{}`)},
+			&fakeRegistryExtension{extensionID: "bob/no-manifest"},
+			&fakeRegistryExtension{extensionID: "bob/invalid", manifest: strptr(`{`)},
+		}, nil
+	}
+
+	var items []api.ExtensionsListItem
+	if err := c.DoJSON("POST", "/extensions/list", nil, &items); err != nil {
+		t.Fatal(err)
+	}
+	want := []api.ExtensionsListItem{
+		{ExtensionID: "example.com/alice/a", IsLocal: true, HasManifest: true, Version: "1.2.0"},
+		{ExtensionID: "bob/b", HasManifest: true},
+		{ExtensionID: "bob/no-manifest"},
+		{ExtensionID: "bob/invalid"},
+	}
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("got %+v, want %+v", items, want)
+	}
+}
+
+func TestServeSettingsGetForSubject_path(t *testing.T) {
+	c := newInternalTest()
+
+	db.Mocks.Settings.GetLatest = func(ctx context.Context, subject api.SettingsSubject) (*api.Settings, error) {
+		return &api.Settings{ID: 1, Contents: `{
+			// Comments are allowed in settings.
+			"search.defaultLimit": 50,
+		}`}, nil
+	}
+	defer func() { db.Mocks.Settings = db.MockSettings{} }()
+
+	var value int
+	if err := c.DoJSON("POST", "/settings/get-for-subject?path=search.defaultLimit", api.SettingsSubject{Site: true}, &value); err != nil {
+		t.Fatal(err)
+	}
+	if want := 50; value != want {
+		t.Errorf("got %d, want %d", value, want)
+	}
+
+	body, _ := json.Marshal(api.SettingsSubject{Site: true})
+	req, _ := http.NewRequest("POST", "/settings/get-for-subject?path=search.missing", bytes.NewReader(body))
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestServeSettingsUpdate(t *testing.T) {
+	c := newInternalTest()
+
+	current := &api.Settings{ID: 2, Contents: "{}"}
+	db.Mocks.Settings.CompareAndCreate = func(ctx context.Context, subject api.SettingsSubject, lastID, authorUserID *int32, contents string) (*api.Settings, bool, error) {
+		if lastID == nil || *lastID != current.ID {
+			return current, false, nil
+		}
+		current = &api.Settings{ID: current.ID + 1, Contents: contents}
+		return current, true, nil
+	}
+	defer func() { db.Mocks.Settings = db.MockSettings{} }()
+
+	lastKnown := int32(2)
+	var resp api.SettingsUpdateResponse
+	req := api.SettingsUpdateRequest{LastKnownVersion: &lastKnown, Contents: `{"a":1}`}
+	if err := c.DoJSON("POST", "/settings/update", req, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if want := int32(3); resp.Version != want {
+		t.Errorf("got version %d, want %d", resp.Version, want)
+	}
+
+	// Updating again from the same (now stale) version conflicts.
+	body, _ := json.Marshal(req)
+	httpReq, _ := http.NewRequest("POST", "/settings/update", bytes.NewReader(body))
+	httpResp, err := c.Do(httpReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if httpResp.StatusCode != http.StatusConflict {
+		t.Fatalf("got status %d, want %d", httpResp.StatusCode, http.StatusConflict)
+	}
+	resp = api.SettingsUpdateResponse{}
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if want := int32(3); resp.Version != want {
+		t.Errorf("got current version %d, want %d", resp.Version, want)
+	}
+}
+
+func TestServeSettingsExistBatch(t *testing.T) {
+	c := newInternalTest()
+
+	db.Mocks.Settings.Exist = func(ctx context.Context, subjects []api.SettingsSubject) ([]bool, error) {
+		exist := make([]bool, len(subjects))
+		for i, subject := range subjects {
+			exist[i] = subject.Site || (subject.Org != nil && *subject.Org == 1)
+		}
+		return exist, nil
+	}
+	defer func() { db.Mocks.Settings = db.MockSettings{} }()
+
+	org1, org2, user1 := int32(1), int32(2), int32(1)
+	subjects := []api.SettingsSubject{{Site: true}, {Org: &org1}, {Org: &org2}, {User: &user1}}
+	var got map[string]bool
+	if err := c.DoJSON("POST", "/settings/exist-batch", subjects, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{"site": true, "org 1": true, "org 2": false, "user 1": false}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestServeReposGetByExternalReposBatch(t *testing.T) {
+	c := newInternalTest()
+
+	known := api.ExternalRepoSpec{ID: "1", ServiceType: "github", ServiceID: "https://github.com/"}
+	unknown := api.ExternalRepoSpec{ID: "2", ServiceType: "github", ServiceID: "https://github.com/"}
+	db.Mocks.Repos.GetIDsByExternalRepos = func(ctx context.Context, specs []api.ExternalRepoSpec) (map[api.ExternalRepoSpec]api.RepoID, error) {
+		if want := []api.ExternalRepoSpec{known, unknown}; !reflect.DeepEqual(specs, want) {
+			t.Errorf("got specs %v, want %v", specs, want)
+		}
+		return map[api.ExternalRepoSpec]api.RepoID{known: 7}, nil
+	}
+	defer func() { db.Mocks.Repos = db.MockRepos{} }()
+
+	var got map[string]api.RepoID
+	if err := c.DoJSON("POST", "/repos/get-by-external-repos-batch", []api.ExternalRepoSpec{known, unknown}, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]api.RepoID{"ExternalRepoSpec{https://github.com/ github 1}": 7}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestServeSearchLimitsForSubject(t *testing.T) {
+	c := newInternalTest()
+
+	db.Mocks.Orgs.GetByUserID = func(ctx context.Context, userID int32) ([]*types.Org, error) {
+		return []*types.Org{{ID: 3}, {ID: 2}}, nil
+	}
+	defer func() { db.Mocks.Orgs = db.MockOrgs{} }()
+	// Later orgs (by ID) and the user take precedence.
+	contents := map[string]string{
+		"site":   `{"search.contextLines": 2}`,
+		"org 2":  `{"search.contextLines": 5}`,
+		"org 3":  `{"search.contextLines": 4, /* comment */}`,
+		"user 1": `{"search.contextLines": -1}`,
+	}
+	db.Mocks.Settings.GetLatest = func(ctx context.Context, subject api.SettingsSubject) (*api.Settings, error) {
+		if c, ok := contents[subject.String()]; ok {
+			return &api.Settings{Subject: subject, Contents: c}, nil
+		}
+		return nil, nil
+	}
+	defer func() { db.Mocks.Settings = db.MockSettings{} }()
+
+	org2, user1, user2 := int32(2), int32(1), int32(2)
+	for _, test := range []struct {
+		subject          api.SettingsSubject
+		wantContextLines int
+	}{
+		{subject: api.SettingsSubject{Default: true}, wantContextLines: 1},
+		{subject: api.SettingsSubject{Site: true}, wantContextLines: 2},
+		{subject: api.SettingsSubject{Org: &org2}, wantContextLines: 5},
+		{subject: api.SettingsSubject{User: &user1}, wantContextLines: 4}, // the user's -1 is invalid
+		{subject: api.SettingsSubject{User: &user2}, wantContextLines: 4},
+	} {
+		var limits api.SearchLimits
+		if err := c.DoJSON("POST", "/search/limits", test.subject, &limits); err != nil {
+			t.Fatal(err)
+		}
+		want := api.SearchLimits{MaxResults: 30, TimeoutSeconds: 10, MaxTimeoutSeconds: 60, ContextLines: test.wantContextLines}
+		if limits != want {
+			t.Errorf("%s: got %+v, want %+v", test.subject, limits, want)
+		}
+	}
+}
+
+func TestServeReposInventory(t *testing.T) {
+	c := newInternalTest()
+
+	db.Mocks.Repos.GetByName = func(ctx context.Context, name api.RepoName) (*types.Repo, error) {
+		return &types.Repo{Name: name}, nil
+	}
+	defer func() { db.Mocks.Repos = db.MockRepos{} }()
+	backend.Mocks.Repos.GetInventory = func(ctx context.Context, repo *types.Repo, commitID api.CommitID) (*inventory.Inventory, error) {
+		return &inventory.Inventory{Languages: []*inventory.Lang{
+			{Name: "Go", Type: "programming", TotalBytes: 1234},
+			{Name: "Markdown", Type: "prose", TotalBytes: 56},
+		}}, nil
+	}
+	defer func() { backend.Mocks.Repos = backend.MockRepos{} }()
+
+	req := api.ReposInventoryRequest{Repo: "github.com/gorilla/mux", CommitID: "c"}
+	var inv inventory.Inventory
+	if err := c.DoJSON("POST", "/repos/inventory", req, &inv); err != nil {
+		t.Fatal(err)
+	}
+	if len(inv.Languages) != 2 || inv.Languages[0].Name != "Go" {
+		t.Errorf("got JSON inventory %+v, want 2 languages", inv)
+	}
+
+	body, _ := json.Marshal(req)
+	httpReq, _ := http.NewRequest("POST", "/repos/inventory", bytes.NewReader(body))
+	httpReq.Header.Set("Accept", "text/csv")
+	resp, err := c.Do(httpReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Header.Get("Content-Type"); !strings.HasPrefix(got, "text/csv") {
+		t.Errorf("got Content-Type %q, want text/csv", got)
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	if want := "language,type,bytes\nGo,programming,1234\nMarkdown,prose,56\n"; string(data) != want {
+		t.Errorf("got CSV %q, want %q", data, want)
+	}
+}
+
+func TestServeReposInventoryByPath(t *testing.T) {
+	c := newInternalTest()
+
+	db.Mocks.Repos.GetByName = func(ctx context.Context, name api.RepoName) (*types.Repo, error) {
+		return &types.Repo{Name: name}, nil
+	}
+	defer func() { db.Mocks.Repos = db.MockRepos{} }()
+	backend.Mocks.Repos.GetInventoryByPath = func(ctx context.Context, repo *types.Repo, commitID api.CommitID, path string) (*inventory.Inventory, error) {
+		if path != "team/a" {
+			return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+		}
+		return &inventory.Inventory{Languages: []*inventory.Lang{{Name: "Go", Type: "programming", TotalBytes: 12}}}, nil
+	}
+	defer func() { backend.Mocks.Repos = backend.MockRepos{} }()
+
+	var inv inventory.Inventory
+	if err := c.DoJSON("POST", "/repos/inventory-by-path", api.ReposInventoryByPathRequest{Repo: "github.com/gorilla/mux", CommitID: "c", Path: "/team/a/"}, &inv); err != nil {
+		t.Fatal(err)
+	}
+	if len(inv.Languages) != 1 || inv.Languages[0].TotalBytes != 12 {
+		t.Errorf("got inventory %+v, want 12 bytes of Go", inv)
+	}
+
+	body, _ := json.Marshal(api.ReposInventoryByPathRequest{Repo: "github.com/gorilla/mux", CommitID: "c", Path: "missing"})
+	req, _ := http.NewRequest("POST", "/repos/inventory-by-path", bytes.NewReader(body))
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestServeReposInventoryUncached(t *testing.T) {
+	c := newInternalTest()
+
+	db.Mocks.Repos.GetByName = func(ctx context.Context, name api.RepoName) (*types.Repo, error) {
+		return &types.Repo{Name: name}, nil
+	}
+	defer func() { db.Mocks.Repos = db.MockRepos{} }()
+	var gotLimits backend.InventoryLimits
+	backend.Mocks.Repos.GetInventoryUncachedWithLimits = func(ctx context.Context, repo *types.Repo, commitID api.CommitID, limits backend.InventoryLimits) (*inventory.Inventory, bool, error) {
+		gotLimits = limits
+		return &inventory.Inventory{Languages: []*inventory.Lang{{Name: "Go", Type: "programming", TotalBytes: 12}}}, true, nil
+	}
+	defer func() { backend.Mocks.Repos = backend.MockRepos{} }()
+
+	var resp struct {
+		inventory.Inventory
+		Truncated bool `json:"truncated"`
+	}
+	if err := c.DoJSON("POST", "/repos/inventory-uncached", api.ReposInventoryUncachedRequest{Repo: "github.com/gorilla/mux", CommitID: "c", TimeoutSeconds: 5, MaxFiles: 10}, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if want := (backend.InventoryLimits{Timeout: 5 * time.Second, MaxFiles: 10}); gotLimits != want {
+		t.Errorf("got limits %+v, want %+v", gotLimits, want)
+	}
+	if !resp.Truncated || len(resp.Languages) != 1 || resp.Languages[0].TotalBytes != 12 {
+		t.Errorf("got %+v, want truncated inventory with 12 bytes of Go", resp)
+	}
+
+	if err := c.DoJSON("POST", "/repos/inventory-uncached", api.ReposInventoryUncachedRequest{Repo: "github.com/gorilla/mux", CommitID: "c"}, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if want := (backend.InventoryLimits{Timeout: inventoryUncachedTimeout, MaxFiles: inventoryUncachedMaxFiles}); gotLimits != want {
+		t.Errorf("got limits %+v, want defaults %+v", gotLimits, want)
+	}
+}
+
+func TestServeReposInventoryWarm(t *testing.T) {
+	c := newInternalTest()
+
+	db.Mocks.Repos.GetByName = func(ctx context.Context, name api.RepoName) (*types.Repo, error) {
+		return &types.Repo{Name: name}, nil
+	}
+	defer func() { db.Mocks.Repos = db.MockRepos{} }()
+	backend.Mocks.Repos.HasCachedInventory = func(repo *types.Repo, commitID api.CommitID) bool {
+		return repo.Name == "github.com/cached/repo"
+	}
+	var (
+		mu       sync.Mutex
+		computed []api.RepoName
+	)
+	backend.Mocks.Repos.GetInventory = func(ctx context.Context, repo *types.Repo, commitID api.CommitID) (*inventory.Inventory, error) {
+		if repo.Name == "github.com/bad/repo" {
+			return nil, errors.New("boom")
+		}
+		mu.Lock()
+		computed = append(computed, repo.Name)
+		mu.Unlock()
+		return &inventory.Inventory{}, nil
+	}
+	defer func() { backend.Mocks.Repos = backend.MockRepos{} }()
+
+	req := []api.ReposInventoryWarmRequest{
+		{Repo: "github.com/new/repo", CommitID: "c1"},
+		{Repo: "github.com/cached/repo", CommitID: "c2"},
+		{Repo: "github.com/bad/repo", CommitID: "c3"},
+	}
+	var results []api.ReposInventoryWarmResult
+	if err := c.DoJSON("POST", "/repos/inventory-warm", req, &results); err != nil {
+		t.Fatal(err)
+	}
+	want := []api.ReposInventoryWarmResult{
+		{Repo: "github.com/new/repo", CommitID: "c1"},
+		{Repo: "github.com/cached/repo", CommitID: "c2", Cached: true},
+		{Repo: "github.com/bad/repo", CommitID: "c3", Error: "boom"},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("got %+v, want %+v", results, want)
+	}
+	if want := []api.RepoName{"github.com/new/repo"}; !reflect.DeepEqual(computed, want) {
+		t.Errorf("computed inventories of %v, want %v", computed, want)
+	}
+}
+
+func TestServeReposExists(t *testing.T) {
+	c := newInternalTest()
+
+	db.Mocks.Repos.Exists = func(ctx context.Context, name api.RepoName) (bool, error) {
+		return name == "github.com/gorilla/mux", nil
+	}
+	defer func() { db.Mocks.Repos = db.MockRepos{} }()
+
+	for name, want := range map[api.RepoName]bool{"github.com/gorilla/mux": true, "github.com/missing/repo": false} {
+		var resp api.ReposExistsResponse
+		if err := c.DoJSON("POST", "/repos/exists", api.ReposExistsRequest{Repo: name}, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Exists != want {
+			t.Errorf("%s: got exists %v, want %v", name, resp.Exists, want)
+		}
+	}
+}
+
+func TestServeReposStatus(t *testing.T) {
+	c := newInternalTest()
+
+	db.Mocks.Repos.GetByName = func(ctx context.Context, name api.RepoName) (*types.Repo, error) {
+		switch name {
+		case "github.com/gorilla/mux":
+			return &types.Repo{ID: 1, Name: name, Enabled: true}, nil
+		case "github.com/gorilla/schema":
+			return &types.Repo{ID: 2, Name: name}, nil
+		}
+		return nil, &errcode.Mock{Message: "repo not found", IsNotFound: true}
+	}
+	defer func() { db.Mocks.Repos = db.MockRepos{} }()
+	orig := gitserverRepoInfo
+	defer func() { gitserverRepoInfo = orig }()
+	gitserverRepoInfo = func(ctx context.Context, repos ...api.RepoName) (*protocol.RepoInfoResponse, error) {
+		return &protocol.RepoInfoResponse{Results: map[api.RepoName]*protocol.RepoInfo{
+			"github.com/gorilla/mux":    {Cloned: true},
+			"github.com/gorilla/schema": {CloneInProgress: true},
+		}}, nil
+	}
+	git.Mocks.ResolveRevision = func(spec string, opt *git.ResolveRevisionOptions) (api.CommitID, error) {
+		return "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", nil
+	}
+	git.Mocks.ExecSafe = func(params []string) (stdout, stderr []byte, exitCode int, err error) {
+		return []byte("master\n"), nil, 0, nil
+	}
+	defer git.ResetMocks()
+
+	branch, commit := "master", api.CommitID("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	for name, want := range map[api.RepoName]api.ReposStatusResponse{
+		"github.com/gorilla/mux":    {Exists: true, Enabled: true, Cloned: true, DefaultBranch: &branch, HeadCommit: &commit},
+		"github.com/gorilla/schema": {Exists: true, Cloning: true},
+		"github.com/missing/repo":   {},
+	} {
+		var resp api.ReposStatusResponse
+		if err := c.DoJSON("POST", "/repos/status", api.ReposStatusRequest{Repo: name}, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(resp, want) {
+			t.Errorf("%s: got %+v, want %+v", name, resp, want)
+		}
+	}
+}
+
+func TestServeReposDefaultBranchesBatch(t *testing.T) {
+	c := newInternalTest()
+
+	db.Mocks.Repos.GetByName = func(ctx context.Context, name api.RepoName) (*types.Repo, error) {
+		if name == "github.com/missing/repo" {
+			return nil, &errcode.Mock{Message: "repo not found", IsNotFound: true}
+		}
+		return &types.Repo{ID: 1, Name: name, Enabled: true}, nil
+	}
+	defer func() { db.Mocks.Repos = db.MockRepos{} }()
+	orig := gitserverRepoInfo
+	defer func() { gitserverRepoInfo = orig }()
+	gitserverRepoInfo = func(ctx context.Context, repos ...api.RepoName) (*protocol.RepoInfoResponse, error) {
+		return &protocol.RepoInfoResponse{Results: map[api.RepoName]*protocol.RepoInfo{
+			"github.com/gorilla/mux":     {Cloned: true},
+			"github.com/gorilla/schema":  {CloneInProgress: true},
+			"github.com/gorilla/context": {},
+		}}, nil
+	}
+	git.Mocks.ResolveRevision = func(spec string, opt *git.ResolveRevisionOptions) (api.CommitID, error) {
+		return "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", nil
+	}
+	git.Mocks.ExecSafe = func(params []string) (stdout, stderr []byte, exitCode int, err error) {
+		return []byte("master\n"), nil, 0, nil
+	}
+	defer git.ResetMocks()
+
+	req := api.ReposDefaultBranchesRequest{Repos: []api.RepoName{"github.com/gorilla/mux", "github.com/gorilla/schema", "github.com/gorilla/context", "github.com/missing/repo"}}
+	var resp []api.RepoDefaultBranch
+	if err := c.DoJSON("POST", "/repos/default-branches", req, &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := []api.RepoDefaultBranch{
+		{Repo: "github.com/gorilla/mux", Status: api.DefaultBranchStatusOK, DefaultBranch: "master", CommitID: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"},
+		{Repo: "github.com/gorilla/schema", Status: api.DefaultBranchStatusCloning},
+		{Repo: "github.com/gorilla/context", Status: api.DefaultBranchStatusNotCloned},
+		{Repo: "github.com/missing/repo", Status: api.DefaultBranchStatusError, Error: "repo not found"},
+	}
+	if !reflect.DeepEqual(resp, want) {
+		t.Errorf("got %+v, want %+v", resp, want)
+	}
+
+	// A cloned repository without commits.
+	git.Mocks.ResolveRevision = func(spec string, opt *git.ResolveRevisionOptions) (api.CommitID, error) {
+		return "", &git.RevisionNotFoundError{Repo: "github.com/gorilla/mux", Spec: spec}
+	}
+	resp = nil
+	if err := c.DoJSON("POST", "/repos/default-branches", api.ReposDefaultBranchesRequest{Repos: []api.RepoName{"github.com/gorilla/mux"}}, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if want := []api.RepoDefaultBranch{{Repo: "github.com/gorilla/mux", Status: api.DefaultBranchStatusEmpty}}; !reflect.DeepEqual(resp, want) {
+		t.Errorf("empty repository: got %+v, want %+v", resp, want)
+	}
+}
+
+// permsStatusProvider is an authz.Provider that claims the repositories in
+// repos. Only the methods used to find a repository's provider are
+// implemented.
+type permsStatusProvider struct {
+	authz.Provider
+	repos map[api.RepoName]struct{}
+}
+
+func (p permsStatusProvider) Repos(ctx context.Context, repos map[authz.Repo]struct{}) (mine, others map[authz.Repo]struct{}) {
+	mine, others = make(map[authz.Repo]struct{}), make(map[authz.Repo]struct{})
+	for repo := range repos {
+		if _, ok := p.repos[repo.RepoName]; ok {
+			mine[repo] = struct{}{}
+		} else {
+			others[repo] = struct{}{}
+		}
+	}
+	return mine, others
+}
+
+func (permsStatusProvider) ServiceType() string { return "gitlab" }
+func (permsStatusProvider) ServiceID() string   { return "https://gitlab.example.com/" }
+
+func TestServeReposPermsStatus(t *testing.T) {
+	c := newInternalTest()
+
+	db.Mocks.Repos.GetByName = func(ctx context.Context, name api.RepoName) (*types.Repo, error) {
+		switch name {
+		case "github.com/missing/repo":
+			return nil, &errcode.Mock{Message: "repo not found", IsNotFound: true}
+		case "local/repo":
+			return &types.Repo{ID: 2, Name: name}, nil
+		}
+		return &types.Repo{ID: 1, Name: name, ExternalRepo: &api.ExternalRepoSpec{ID: string(name), ServiceType: "gitlab", ServiceID: "https://gitlab.example.com/"}}, nil
+	}
+	defer func() { db.Mocks.Repos = db.MockRepos{} }()
+	authz.SetProviders(false, []authz.Provider{permsStatusProvider{repos: map[api.RepoName]struct{}{"gitlab.example.com/a/b": {}}}})
+	defer authz.SetProviders(true, nil)
+
+	var resp api.RepoPermsStatus
+	if err := c.DoJSON("POST", "/repos/perms-status", api.ReposPermsStatusRequest{Repo: "gitlab.example.com/a/b"}, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Tracked || resp.ServiceType != "gitlab" || resp.ServiceID != "https://gitlab.example.com/" || resp.Unrestricted {
+		t.Errorf("tracked repository: got %+v", resp)
+	}
+
+	req, _ := http.NewRequest("POST", "/repos/perms-status", strings.NewReader(`{"repo":"github.com/missing/repo"}`))
+	if resp, err := c.Do(req); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("missing repository: got status %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+
+	var batch []api.RepoPermsStatus
+	batchReq := api.ReposPermsStatusBatchRequest{Repos: []api.RepoName{"github.com/missing/repo", "gitlab.example.com/a/b", "github.com/gorilla/mux", "local/repo"}}
+	if err := c.DoJSON("POST", "/repos/perms-status-batch", batchReq, &batch); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, st := range batch {
+		got = append(got, fmt.Sprintf("%s tracked=%v unrestricted=%v error=%q", st.Repo, st.Tracked, st.Unrestricted, st.Error))
+	}
+	want := []string{
+		`github.com/missing/repo tracked=false unrestricted=false error="repository not found"`,
+		`gitlab.example.com/a/b tracked=true unrestricted=false error=""`,
+		`github.com/gorilla/mux tracked=false unrestricted=false error=""`,
+		`local/repo tracked=false unrestricted=false error=""`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Unclaimed repositories with an external repo spec are readable by all
+	// users if authz allows access by default.
+	authz.SetProviders(true, nil)
+	if err := c.DoJSON("POST", "/repos/perms-status", api.ReposPermsStatusRequest{Repo: "github.com/gorilla/mux"}, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Tracked || !resp.Unrestricted {
+		t.Errorf("unclaimed repository: got %+v", resp)
+	}
+}
+
+func TestServeReposCancelClone(t *testing.T) {
+	c := newInternalTest()
+
+	db.Mocks.Repos.GetByName = func(ctx context.Context, name api.RepoName) (*types.Repo, error) {
+		if name == "github.com/missing/repo" {
+			return nil, &errcode.Mock{Message: "repo not found", IsNotFound: true}
+		}
+		return &types.Repo{ID: 1, Name: name, Enabled: true}, nil
+	}
+	defer func() { db.Mocks.Repos = db.MockRepos{} }()
+	orig := gitserverCancelClone
+	defer func() { gitserverCancelClone = orig }()
+	gitserverCancelClone = func(ctx context.Context, repo api.RepoName) (*protocol.CancelCloneResponse, error) {
+		if repo == "github.com/gorilla/mux" {
+			return &protocol.CancelCloneResponse{Canceled: true}, nil
+		}
+		return &protocol.CancelCloneResponse{Cloned: true}, nil
+	}
+
+	for name, want := range map[api.RepoName]api.ReposCancelCloneResponse{
+		"github.com/gorilla/mux":    {Canceled: true},
+		"github.com/gorilla/schema": {Cloned: true},
+	} {
+		var resp api.ReposCancelCloneResponse
+		if err := c.DoJSON("POST", "/repos/cancel-clone", api.ReposCancelCloneRequest{Repo: name}, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp != want {
+			t.Errorf("%s: got %+v, want %+v", name, resp, want)
+		}
+	}
+
+	body, _ := json.Marshal(api.ReposCancelCloneRequest{Repo: "github.com/missing/repo"})
+	req, _ := http.NewRequest("POST", "/repos/cancel-clone", bytes.NewReader(body))
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("got status %d for missing repo, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestServeReposValidateName(t *testing.T) {
+	c := newInternalTest()
+
+	var resp api.ReposValidateNameResponse
+	if err := c.DoJSON("POST", "/repos/validate-name", api.ReposValidateNameRequest{Repo: "github.com/gorilla/mux"}, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if want := (api.ReposValidateNameResponse{Valid: true}); resp != want {
+		t.Errorf("got %+v, want %+v", resp, want)
+	}
+
+	resp = api.ReposValidateNameResponse{}
+	if err := c.DoJSON("POST", "/repos/validate-name", api.ReposValidateNameRequest{Repo: "https://github.com/gorilla/mux"}, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Valid || resp.Reason == "" {
+		t.Errorf("got %+v, want invalid with a reason", resp)
+	}
+}
+
+func TestServeReposCreateIfNotExists_webhook(t *testing.T) {
+	c := newInternalTest()
+
+	notified := make(chan api.RepoName, 2)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var repo types.Repo
+		if err := json.NewDecoder(r.Body).Decode(&repo); err != nil {
+			t.Error(err)
+		}
+		notified <- repo.Name
+	}))
+	defer webhook.Close()
+	conf.Mock(&conf.Unified{SiteConfiguration: schema.SiteConfiguration{ReposCreatedWebhookURL: webhook.URL}})
+	defer conf.Mock(nil)
+
+	db.Mocks.Repos.UpsertCreated = func(op api.InsertRepoOp) (bool, error) {
+		return op.Name == "github.com/new/repo", nil
+	}
+	defer mockEnabledRepo(t)()
+
+	for _, name := range []api.RepoName{"github.com/existing/repo", "github.com/new/repo"} {
+		var repo types.Repo
+		if err := c.DoJSON("POST", "/repos/create-if-not-exists", api.RepoCreateOrUpdateRequest{RepoName: name}, &repo); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case name := <-notified:
+		if name != "github.com/new/repo" {
+			t.Errorf("got notification for %q, want only %q", name, "github.com/new/repo")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for webhook notification")
+	}
+	select {
+	case name := <-notified:
+		t.Errorf("got unexpected notification for %q", name)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestServeReposTouch(t *testing.T) {
+	c := newInternalTest()
+
+	now := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+	db.Mocks.Repos.Touch = func(ctx context.Context, repo api.RepoID) (time.Time, error) {
+		if repo != 1 {
+			return time.Time{}, &errcode.Mock{Message: "repo not found", IsNotFound: true}
+		}
+		return now, nil
+	}
+	defer func() { db.Mocks.Repos = db.MockRepos{} }()
+
+	var resp api.ReposTouchResponse
+	if err := c.DoJSON("POST", "/repos/touch", api.ReposTouchRequest{RepoID: 1}, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.UpdatedAt.Equal(now) {
+		t.Errorf("got updatedAt %v, want %v", resp.UpdatedAt, now)
+	}
+
+	body, _ := json.Marshal(api.ReposTouchRequest{RepoID: 2})
+	req, _ := http.NewRequest("POST", "/repos/touch", bytes.NewReader(body))
+	httpResp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if httpResp.StatusCode != http.StatusNotFound {
+		t.Errorf("got status %d, want %d", httpResp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestServeReposDeleteByFilter(t *testing.T) {
+	c := newInternalTest()
+
+	var deleted []db.ReposListOptions
+	matching := 3 // number of repositories matching when deleting
+	db.Mocks.Repos.Count = func(ctx context.Context, opt db.ReposListOptions) (int, error) {
+		if want := []string{`^github\.example\.com/.*$`}; !reflect.DeepEqual(opt.IncludePatterns, want) {
+			t.Errorf("got include patterns %q, want %q", opt.IncludePatterns, want)
+		}
+		return 3, nil
+	}
+	db.Mocks.Repos.DeleteMatching = func(ctx context.Context, opt db.ReposListOptions, expected int) (int, error) {
+		if expected != 3 {
+			t.Errorf("got expected count %d, want 3", expected)
+		}
+		if matching != expected {
+			return 0, &db.DeleteCountMismatchError{Expected: expected, Actual: matching}
+		}
+		deleted = append(deleted, opt)
+		return matching, nil
+	}
+	defer func() { db.Mocks.Repos = db.MockRepos{} }()
+
+	// A dry run deletes nothing and returns a confirmation token.
+	var dryRun api.ReposDeleteByFilterResponse
+	if err := c.DoJSON("POST", "/repos/delete-by-filter", api.ReposDeleteByFilterRequest{NameGlob: "github.example.com/*", DryRun: true}, &dryRun); err != nil {
+		t.Fatal(err)
+	}
+	if dryRun.Count != 3 || dryRun.ConfirmationToken == "" {
+		t.Errorf("got dry run response %+v, want count 3 and a confirmation token", dryRun)
+	}
+	if len(deleted) != 0 {
+		t.Fatalf("dry run deleted repositories")
+	}
+
+	// Deleting without the right token is rejected.
+	body, _ := json.Marshal(api.ReposDeleteByFilterRequest{NameGlob: "github.example.com/*", ConfirmationToken: "bad"})
+	req, _ := http.NewRequest("POST", "/repos/delete-by-filter", bytes.NewReader(body))
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusConflict)
+	}
+	if len(deleted) != 0 {
+		t.Fatalf("deleted repositories without confirmation")
+	}
+
+	var result api.ReposDeleteByFilterResponse
+	if err := c.DoJSON("POST", "/repos/delete-by-filter", api.ReposDeleteByFilterRequest{NameGlob: "github.example.com/*", ConfirmationToken: dryRun.ConfirmationToken}, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Count != 3 || len(deleted) != 1 {
+		t.Errorf("got count %d with %d deletions, want 3 with 1 deletion", result.Count, len(deleted))
+	}
+
+	// A repository matching the filter was added after the count, so the
+	// deletion is rolled back.
+	matching = 4
+	body, _ = json.Marshal(api.ReposDeleteByFilterRequest{NameGlob: "github.example.com/*", ConfirmationToken: dryRun.ConfirmationToken})
+	req, _ = http.NewRequest("POST", "/repos/delete-by-filter", bytes.NewReader(body))
+	resp, err = c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusConflict)
+	}
+	if len(deleted) != 1 {
+		t.Errorf("got %d deletions, want the mismatched deletion to be rolled back", len(deleted))
+	}
+}
+
+func TestServeReposDeleteByFilter_noFilter(t *testing.T) {
+	c := newInternalTest()
+
+	body, _ := json.Marshal(api.ReposDeleteByFilterRequest{DryRun: true})
+	req, _ := http.NewRequest("POST", "/repos/delete-by-filter", bytes.NewReader(body))
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestServeReposGitserverShards(t *testing.T) {
+	c := newInternalTest()
+
+	defer func(orig func(context.Context) []string) { gitserver.DefaultClient.Addrs = orig }(gitserver.DefaultClient.Addrs)
+	gitserver.DefaultClient.Addrs = func(context.Context) []string {
+		return []string{"gitserver-0:3178", "gitserver-1:3178"}
+	}
+
+	repos := []api.RepoName{"github.com/gorilla/mux", "github.com/gorilla/schema", "github.com/pkg/errors"}
+	var shards map[api.RepoName]string
+	if err := c.DoJSON("POST", "/repos/gitserver-shards", repos, &shards); err != nil {
+		t.Fatal(err)
+	}
+	for _, repo := range repos {
+		var resp api.ReposGitserverShardResponse
+		if err := c.DoJSON("POST", "/repos/gitserver-shard", api.ReposGitserverShardRequest{Repo: repo}, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if want := gitserver.DefaultClient.AddrForRepo(context.Background(), repo); resp.ShardAddr != want || shards[repo] != want {
+			t.Errorf("%s: got shard %q (batch %q), want %q", repo, resp.ShardAddr, shards[repo], want)
+		}
+	}
+}
+
+func TestServeReposGetByName_withLastFetched(t *testing.T) {
+	c := newInternalTest()
+
+	defer mockEnabledRepo(t)()
+
+	lastFetched := time.Unix(1000, 0).UTC()
+	var calls int
+	orig := gitserverRepoInfo
+	defer func() { gitserverRepoInfo = orig }()
+	gitserverRepoInfo = func(ctx context.Context, repos ...api.RepoName) (*protocol.RepoInfoResponse, error) {
+		calls++
+		results := map[api.RepoName]*protocol.RepoInfo{}
+		for _, repo := range repos {
+			if repo == "github.com/gorilla/mux" {
+				results[repo] = &protocol.RepoInfo{Cloned: true, LastFetched: &lastFetched}
+			}
+		}
+		return &protocol.RepoInfoResponse{Results: results}, nil
+	}
+
+	get := func(url string) map[string]interface{} {
+		var resp map[string]interface{}
+		if err := c.DoJSON("POST", url, nil, &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := get("/repos/github.com/gorilla/mux")
+	if _, ok := resp["LastFetched"]; ok {
+		t.Errorf("got LastFetched without withLastFetched: %v", resp)
+	}
+	if calls != 0 {
+		t.Errorf("got %d gitserver calls without withLastFetched, want 0", calls)
+	}
+
+	resp = get("/repos/github.com/gorilla/mux?withLastFetched=true")
+	if want := lastFetched.Format(time.RFC3339); resp["LastFetched"] != want {
+		t.Errorf("got LastFetched %v, want %v", resp["LastFetched"], want)
+	}
+
+	// Repositories that were never fetched have a null LastFetched.
+	resp = get("/repos/github.com/gorilla/never?withLastFetched=true")
+	if v, ok := resp["LastFetched"]; !ok || v != nil {
+		t.Errorf("got LastFetched %v (present: %v), want null", v, ok)
+	}
+
+	// gitserver errors don't fail the request.
+	gitserverRepoInfo = func(ctx context.Context, repos ...api.RepoName) (*protocol.RepoInfoResponse, error) {
+		return nil, errors.New("no gitserver addresses")
+	}
+	resp = get("/repos/github.com/gorilla/mux?withLastFetched=true")
+	if v, ok := resp["LastFetched"]; !ok || v != nil {
+		t.Errorf("got LastFetched %v (present: %v), want null", v, ok)
+	}
+}
+
+func TestServeReposGetByName_withHead(t *testing.T) {
+	c := newInternalTest()
+
+	defer mockEnabledRepo(t)()
+	git.Mocks.ResolveRevision = func(spec string, opt *git.ResolveRevisionOptions) (api.CommitID, error) {
+		return "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", nil
+	}
+	git.Mocks.ExecSafe = func(params []string) (stdout, stderr []byte, exitCode int, err error) {
+		return []byte("main\n"), nil, 0, nil
+	}
+	defer git.ResetMocks()
+
+	get := func(url string) map[string]interface{} {
+		var resp map[string]interface{}
+		if err := c.DoJSON("POST", url, nil, &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := get("/repos/github.com/gorilla/mux")
+	if _, ok := resp["HeadCommit"]; ok {
+		t.Errorf("got HeadCommit without withHead: %v", resp)
+	}
+	if _, ok := resp["DefaultBranch"]; ok {
+		t.Errorf("got DefaultBranch without withHead: %v", resp)
+	}
+
+	resp = get("/repos/github.com/gorilla/mux?withHead=true")
+	if resp["HeadCommit"] != "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" || resp["DefaultBranch"] != "main" {
+		t.Errorf("got HeadCommit %v and DefaultBranch %v, want resolved head", resp["HeadCommit"], resp["DefaultBranch"])
+	}
+
+	// Uncloned repositories have a null head.
+	git.Mocks.ResolveRevision = func(spec string, opt *git.ResolveRevisionOptions) (api.CommitID, error) {
+		return "", &vcs.RepoNotExistError{Repo: "github.com/gorilla/mux", CloneInProgress: true}
+	}
+	resp = get("/repos/github.com/gorilla/mux?withHead=true")
+	if v, ok := resp["HeadCommit"]; !ok || v != nil {
+		t.Errorf("got HeadCommit %v (present: %v), want null", v, ok)
+	}
+	if v, ok := resp["DefaultBranch"]; !ok || v != nil {
+		t.Errorf("got DefaultBranch %v (present: %v), want null", v, ok)
+	}
+}
+
+func TestServeReposRecentlyUpdated(t *testing.T) {
+	c := newInternalTest()
+
+	t1, t2 := time.Unix(1000, 0).UTC(), time.Unix(2000, 0).UTC()
+	db.Mocks.Repos.List = func(ctx context.Context, opt db.ReposListOptions) ([]*types.Repo, error) {
+		if opt.LimitOffset == nil || opt.LimitOffset.Limit != maxRecentlyUpdatedRepos {
+			t.Errorf("got LimitOffset %+v, want limit %d", opt.LimitOffset, maxRecentlyUpdatedRepos)
+		}
+		if len(opt.OrderBy) == 0 || opt.OrderBy[0] != (db.RepoListSort{Field: db.RepoListUpdatedAt, Descending: true}) {
+			t.Errorf("got OrderBy %+v, want updated_at descending first", opt.OrderBy)
+		}
+		return []*types.Repo{{Name: "b", UpdatedAt: &t2}, {Name: "a", UpdatedAt: &t1}}, nil
+	}
+	defer func() { db.Mocks.Repos = db.MockRepos{} }()
+
+	var repos []api.RecentlyUpdatedRepo
+	if err := c.DoJSON("POST", "/repos/recently-updated", api.ReposRecentlyUpdatedRequest{Limit: 1e6}, &repos); err != nil {
+		t.Fatal(err)
+	}
+	want := []api.RecentlyUpdatedRepo{{Name: "b", UpdatedAt: t2}, {Name: "a", UpdatedAt: t1}}
+	if !reflect.DeepEqual(repos, want) {
+		t.Errorf("got %+v, want %+v", repos, want)
+	}
+}
+
+func TestSummarizeCloneStatus(t *testing.T) {
+	orig := gitserverRepoInfo
+	defer func() { gitserverRepoInfo = orig }()
+
+	gitserverRepoInfo = func(ctx context.Context, repos ...api.RepoName) (*protocol.RepoInfoResponse, error) {
+		return &protocol.RepoInfoResponse{Results: map[api.RepoName]*protocol.RepoInfo{
+			"cloned":     {Cloned: true},
+			"cloning":    {CloneInProgress: true},
+			"not-cloned": {},
+		}}, nil
+	}
+	got := summarizeCloneStatus(context.Background(), []api.RepoName{"cloned", "cloning", "not-cloned", "missing"})
+	if want := (api.ReposCloneStatusSummary{NotCloned: 1, Cloning: 1, Cloned: 1, Errored: 1}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	gitserverRepoInfo = func(ctx context.Context, repos ...api.RepoName) (*protocol.RepoInfoResponse, error) {
+		return nil, errors.New("gitserver unavailable")
+	}
+	got = summarizeCloneStatus(context.Background(), []api.RepoName{"a", "b"})
+	if want := (api.ReposCloneStatusSummary{Errored: 2}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestServeReposNeedingClone(t *testing.T) {
+	c := newInternalTest()
+
+	gitserverHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req protocol.IsRepoClonedRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		switch req.Repo {
+		case "github.com/a/cloned":
+			w.WriteHeader(http.StatusOK)
+		case "github.com/a/broken":
+			panic(http.ErrAbortHandler) // fail the request
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	gs := httptest.NewServer(gitserverHandler)
+	defer gs.Close()
+	defer func(orig func(context.Context) []string) { gitserver.DefaultClient.Addrs = orig }(gitserver.DefaultClient.Addrs)
+	gitserver.DefaultClient.Addrs = func(context.Context) []string {
+		return []string{strings.TrimPrefix(gs.URL, "http://")}
+	}
+
+	db.Mocks.Repos.Count = func(ctx context.Context, opt db.ReposListOptions) (int, error) {
+		return 10, nil
+	}
+	db.Mocks.Repos.List = func(ctx context.Context, opt db.ReposListOptions) ([]*types.Repo, error) {
+		if !opt.Enabled || opt.Disabled {
+			t.Errorf("got options %+v, want only enabled repos", opt)
+		}
+		if opt.LimitOffset == nil || *opt.LimitOffset != (db.LimitOffset{Limit: 3, Offset: 6}) {
+			t.Errorf("got LimitOffset %+v, want limit 3 offset 6", opt.LimitOffset)
+		}
+		return []*types.Repo{{Name: "github.com/a/cloned"}, {Name: "github.com/a/broken"}, {Name: "github.com/a/missing"}}, nil
+	}
+	defer func() { db.Mocks.Repos = db.MockRepos{} }()
+
+	var resp api.ReposNeedingCloneResponse
+	if err := c.DoJSON("POST", "/repos/needing-clone", api.ReposNeedingCloneRequest{Limit: 3, Offset: 6}, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if want := []api.RepoName{"github.com/a/missing"}; !reflect.DeepEqual(resp.Repos, want) {
+		t.Errorf("got repos %v, want %v", resp.Repos, want)
+	}
+	if len(resp.Errors) != 1 || resp.Errors[0].Repo != "github.com/a/broken" || resp.Errors[0].Error == "" {
+		t.Errorf("got errors %+v, want one for github.com/a/broken", resp.Errors)
+	}
+	if resp.TotalCount != 10 {
+		t.Errorf("got total count %d, want 10", resp.TotalCount)
+	}
+}
+
+func TestServeGitCommits(t *testing.T) {
+	c := newInternalTest()
+
+	defer mockEnabledRepo(t)()
+	const known = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	git.Mocks.GetCommit = func(id api.CommitID) (*git.Commit, error) {
+		if id != known {
+			return nil, &git.RevisionNotFoundError{Spec: string(id)}
+		}
+		return &git.Commit{
+			ID:      id,
+			Author:  git.Signature{Name: "alice"},
+			Message: "subject\n\nbody",
+			Parents: []api.CommitID{"bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"},
+		}, nil
+	}
+	defer git.ResetMocks()
+
+	var results []api.GitCommitsResult
+	req := api.GitCommitsRequest{
+		Repo:    "github.com/gorilla/mux",
+		Commits: []api.CommitID{known, "cccccccccccccccccccccccccccccccccccccccc", "HEAD"},
+	}
+	if err := c.DoJSON("POST", "/git/commits", req, &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	if got := results[0]; got.CommitID != known || got.Author != "alice" || got.Subject != "subject" || len(got.Parents) != 1 || got.Error != "" {
+		t.Errorf("got %+v, want commit metadata", got)
+	}
+	for _, got := range results[1:] {
+		if got.Error == "" {
+			t.Errorf("got %+v, want error", got)
+		}
+	}
+}
+
+func TestHandler_GzipRequestBody(t *testing.T) {
+	c := newInternalTest()
+
+	defer mockEnabledRepo(t)()
+	git.Mocks.ResolveRevision = func(spec string, opt *git.ResolveRevisionOptions) (api.CommitID, error) {
+		return "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", nil
+	}
+	defer git.ResetMocks()
+
+	compress := func(body interface{}) []byte {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if err := json.NewEncoder(zw).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	postRaw := func(data []byte) *http.Response {
+		req, _ := http.NewRequest("POST", "/git/resolve-revisions", bytes.NewReader(data))
+		req.Header.Set("Content-Encoding", "gzip")
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	post := func(body interface{}) *http.Response { return postRaw(compress(body)) }
+
+	req := api.GitResolveRevisionsRequest{Spec: "main", Repos: []api.RepoName{"github.com/gorilla/mux"}}
+	resp := post(req)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	var results []api.GitResolveRevisionsResult
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].CommitID == "" {
+		t.Errorf("got %+v, want 1 resolved result", results)
+	}
+
+	// A truncated body is rejected as invalid, even though the handler wraps
+	// the error.
+	data := compress(req)
+	if resp := postRaw(data[:len(data)/2]); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %d for truncated body, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+
+	// A body that decompresses to more than the limit is rejected.
+	defer func(orig int64) { maxDecompressedRequestBodySize = orig }(maxDecompressedRequestBodySize)
+	maxDecompressedRequestBodySize = 16
+	if resp := post(req); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("got status %d for oversized body, want %d", resp.StatusCode, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestServeGit_revisionNotFound(t *testing.T) {
+	c := newInternalTest()
+
+	defer mockEnabledRepo(t)()
+	git.Mocks.ResolveRevision = func(spec string, opt *git.ResolveRevisionOptions) (api.CommitID, error) {
+		if spec == "main" || spec == "master" {
+			return "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", nil
+		}
+		return "", &git.RevisionNotFoundError{Repo: "github.com/gorilla/mux", Spec: spec}
+	}
+	defer git.ResetMocks()
+
+	tests := []struct {
+		path       string
+		req        interface{}
+		wantStatus int
+	}{
+		{"/git/is-ancestor", api.GitIsAncestorRequest{Repo: "github.com/gorilla/mux", Commit: "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Ref: "main"}, http.StatusNotFound},
+		{"/git/tags-containing", api.GitTagsContainingRequest{Repo: "github.com/gorilla/mux", Commit: "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"}, http.StatusNotFound},
+		{"/git/branches-containing", api.GitBranchesContainingRequest{Repo: "github.com/gorilla/mux", Commit: "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"}, http.StatusNotFound},
+		{"/git/branches-containing", api.GitBranchesContainingRequest{Repo: "github.com/gorilla/mux"}, http.StatusBadRequest},
+		{"/git/merge-base-diffstat", api.GitMergeBaseDiffStatRequest{Repo: "github.com/gorilla/mux", Branch: "missing", BaseBranch: "master"}, http.StatusNotFound},
+		{"/git/merge-base-diffstat", api.GitMergeBaseDiffStatRequest{Repo: "github.com/gorilla/mux", Branch: "missing"}, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		body, _ := json.Marshal(test.req)
+		req, _ := http.NewRequest("POST", test.path, bytes.NewReader(body))
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != test.wantStatus {
+			t.Errorf("%s %+v: got status %d, want %d", test.path, test.req, resp.StatusCode, test.wantStatus)
+		}
+		if test.wantStatus != http.StatusNotFound {
+			continue
+		}
+		var errResp errorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+			t.Fatalf("%s %+v: %s", test.path, test.req, err)
+		}
+		if errResp.Code != "revision_not_found" {
+			t.Errorf("%s %+v: got error code %q, want revision_not_found", test.path, test.req, errResp.Code)
+		}
+	}
+}
+
+type notAFileError struct{}
+
+func (notAFileError) Error() string    { return "not a file" }
+func (notAFileError) BadRequest() bool { return true }
+
+func TestServeGitFileSymbols(t *testing.T) {
+	c := newInternalTest()
+
+	defer mockEnabledRepo(t)()
+	git.Mocks.ResolveRevision = func(spec string, opt *git.ResolveRevisionOptions) (api.CommitID, error) {
+		return "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", nil
+	}
+	defer git.ResetMocks()
+	var gotArgs []symbolsprotocol.SearchArgs
+	orig := listTags
+	defer func() { listTags = orig }()
+	listTags = func(ctx context.Context, args symbolsprotocol.SearchArgs) ([]symbolsprotocol.Symbol, error) {
+		gotArgs = append(gotArgs, args)
+		if args.IncludePatterns[0] != "^mux\\.go$" {
+			// Unsupported languages have no symbols.
+			return nil, nil
+		}
+		return []symbolsprotocol.Symbol{
+			{Name: "Router", Kind: "type", Line: 10, Path: "mux.go"},
+			{Name: "ServeHTTP", Kind: "method", Line: 20, Path: "mux.go", Parent: "Router", ParentKind: "type"},
+			{Name: "NewRouter", Kind: "func", Line: 30, Path: "mux.go"},
+		}, nil
+	}
+
+	var symbols []api.GitFileSymbol
+	if err := c.DoJSON("POST", "/git/file-symbols", api.GitFileSymbolsRequest{Repo: "github.com/gorilla/mux", Commit: "master", Path: "mux.go"}, &symbols); err != nil {
+		t.Fatal(err)
+	}
+	want := []api.GitFileSymbol{
+		{Name: "Router", Kind: "type", Line: 10},
+		{Name: "NewRouter", Kind: "func", Line: 30},
+	}
+	if !reflect.DeepEqual(symbols, want) {
+		t.Errorf("got %+v, want %+v", symbols, want)
+	}
+	if len(gotArgs) != 1 || gotArgs[0].CommitID != "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" || !gotArgs[0].IsCaseSensitive {
+		t.Errorf("got search args %+v, want a case-sensitive search at the resolved commit", gotArgs)
+	}
+
+	// An empty list (not null) is returned for files without symbols.
+	var raw json.RawMessage
+	if err := c.DoJSON("POST", "/git/file-symbols", api.GitFileSymbolsRequest{Repo: "github.com/gorilla/mux", Commit: "master", Path: "logo.png"}, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if string(bytes.TrimSpace(raw)) != "[]" {
+		t.Errorf("got %s, want []", raw)
+	}
+}
+
+func TestServeGitFileType(t *testing.T) {
+	c := newInternalTest()
+
+	defer mockEnabledRepo(t)()
+	git.Mocks.ResolveRevision = func(spec string, opt *git.ResolveRevisionOptions) (api.CommitID, error) {
+		return "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", nil
+	}
+	defer git.ResetMocks()
+	orig := detectFileType
+	defer func() { detectFileType = orig }()
+	detectFileType = func(ctx context.Context, repo gitserver.Repo, commit api.CommitID, name string) (*git.FileType, error) {
+		switch name {
+		case "logo.png":
+			return &git.FileType{IsBinary: true, MIMEType: "image/png", Size: 1234}, nil
+		case "dir":
+			return nil, notAFileError{}
+		}
+		return nil, &os.PathError{Op: "ls-tree", Path: name, Err: os.ErrNotExist}
+	}
+
+	var resp api.GitFileTypeResponse
+	if err := c.DoJSON("POST", "/git/file-type", api.GitFileTypeRequest{Repo: "github.com/gorilla/mux", Commit: "master", Path: "logo.png"}, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if want := (api.GitFileTypeResponse{IsBinary: true, MIMEType: "image/png", Size: 1234}); resp != want {
+		t.Errorf("got %+v, want %+v", resp, want)
+	}
+
+	for path, wantStatus := range map[string]int{
+		"missing": http.StatusNotFound,
+		"dir":     http.StatusBadRequest,
+		"":        http.StatusBadRequest,
+	} {
+		body, _ := json.Marshal(api.GitFileTypeRequest{Repo: "github.com/gorilla/mux", Commit: "master", Path: path})
+		req, _ := http.NewRequest("POST", "/git/file-type", bytes.NewReader(body))
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != wantStatus {
+			t.Errorf("%q: got status %d, want %d", path, resp.StatusCode, wantStatus)
+		}
+	}
+}
+
+func TestServeGitCommitsBetween(t *testing.T) {
+	c := newInternalTest()
+
+	defer mockEnabledRepo(t)()
+	git.Mocks.ResolveRevision = func(spec string, opt *git.ResolveRevisionOptions) (api.CommitID, error) {
+		switch spec {
+		case "v1.0", "b":
+			return "b", nil
+		case "master", "h":
+			return "h", nil
+		}
+		return "", &git.RevisionNotFoundError{Repo: "github.com/gorilla/mux", Spec: spec}
+	}
+	defer git.ResetMocks()
+	orig := forEachCommitInRange
+	defer func() { forEachCommitInRange = orig }()
+	forEachCommitInRange = func(ctx context.Context, repo gitserver.Repo, base, head api.CommitID, fn func(*git.Commit) error) error {
+		if base != "b" || head != "h" {
+			t.Errorf("got range %s..%s, want b..h", base, head)
+		}
+		for _, id := range []api.CommitID{"c5", "c4", "c3", "c2", "c1"} {
+			if err := fn(&git.Commit{ID: id, Message: "subject " + string(id) + "\n\nbody"}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var pages [][]api.CommitID
+	req := api.GitCommitsBetweenRequest{Repo: "github.com/gorilla/mux", Base: "v1.0", Head: "master", Limit: 2}
+	for {
+		var resp api.GitCommitsBetweenResponse
+		if err := c.DoJSON("POST", "/git/commits-between", req, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Base != "b" || resp.Head != "h" {
+			t.Errorf("got resolved range %s..%s, want b..h", resp.Base, resp.Head)
+		}
+		var page []api.CommitID
+		for _, commit := range resp.Commits {
+			if want := "subject " + string(commit.CommitID); commit.Subject != want {
+				t.Errorf("got subject %q, want %q", commit.Subject, want)
+			}
+			page = append(page, commit.CommitID)
+		}
+		pages = append(pages, page)
+		if resp.NextCursor == "" {
+			break
+		}
+		req = api.GitCommitsBetweenRequest{Repo: req.Repo, Base: string(resp.Base), Head: string(resp.Head), Limit: req.Limit, Cursor: resp.NextCursor}
+	}
+	if want := [][]api.CommitID{{"c5", "c4"}, {"c3", "c2"}, {"c1"}}; !reflect.DeepEqual(pages, want) {
+		t.Errorf("got pages %v, want %v", pages, want)
+	}
+
+	for _, test := range []struct {
+		req        api.GitCommitsBetweenRequest
+		wantStatus int
+	}{
+		{req: api.GitCommitsBetweenRequest{Repo: "github.com/gorilla/mux", Base: "b", Head: "h", Cursor: "unknown"}, wantStatus: http.StatusBadRequest},
+		{req: api.GitCommitsBetweenRequest{Repo: "github.com/gorilla/mux", Base: "missing", Head: "h"}, wantStatus: http.StatusNotFound},
+		{req: api.GitCommitsBetweenRequest{Repo: "github.com/gorilla/mux", Base: "b"}, wantStatus: http.StatusBadRequest},
+		{req: api.GitCommitsBetweenRequest{Repo: "github.com/gorilla/mux", Base: "b", Head: "h", Limit: maxCommitsBetweenLimit + 1}, wantStatus: http.StatusBadRequest},
+	} {
+		body, _ := json.Marshal(test.req)
+		req, _ := http.NewRequest("POST", "/git/commits-between", bytes.NewReader(body))
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != test.wantStatus {
+			t.Errorf("%+v: got status %d, want %d", test.req, resp.StatusCode, test.wantStatus)
+		}
+	}
+}
+
+func TestServeGitLargestFiles(t *testing.T) {
+	c := newInternalTest()
+
+	defer mockEnabledRepo(t)()
+	git.Mocks.ResolveRevision = func(spec string, opt *git.ResolveRevisionOptions) (api.CommitID, error) {
+		if spec == "master" {
+			return "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", nil
+		}
+		return "", &git.RevisionNotFoundError{Repo: "github.com/gorilla/mux", Spec: spec}
+	}
+	defer git.ResetMocks()
+	orig := largestFiles
+	defer func() { largestFiles = orig }()
+	var gotN int
+	largestFiles = func(ctx context.Context, repo gitserver.Repo, commit api.CommitID, n int) ([]git.TreeEntry, error) {
+		gotN = n
+		return []git.TreeEntry{{Path: "big.bin", Mode: "100644", Type: "blob", Size: 100, SHA: "b"}, {Path: "a", Mode: "100644", Type: "blob", Size: 1, SHA: "c"}}, nil
+	}
+
+	var files []api.GitLargestFile
+	if err := c.DoJSON("POST", "/git/largest-files", api.GitLargestFilesRequest{Repo: "github.com/gorilla/mux", Commit: "master"}, &files); err != nil {
+		t.Fatal(err)
+	}
+	want := []api.GitLargestFile{{Path: "big.bin", Size: 100, SHA: "b"}, {Path: "a", Size: 1, SHA: "c"}}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("got %+v, want %+v", files, want)
+	}
+	if gotN != defaultLargestFiles {
+		t.Errorf("got n %d, want default %d", gotN, defaultLargestFiles)
+	}
+
+	for _, test := range []struct {
+		req        api.GitLargestFilesRequest
+		wantStatus int
+	}{
+		{req: api.GitLargestFilesRequest{Repo: "github.com/gorilla/mux", Commit: "missing"}, wantStatus: http.StatusNotFound},
+		{req: api.GitLargestFilesRequest{Repo: "github.com/gorilla/mux", Commit: "master", TopN: maxLargestFiles + 1}, wantStatus: http.StatusBadRequest},
+		{req: api.GitLargestFilesRequest{Repo: "github.com/gorilla/mux"}, wantStatus: http.StatusBadRequest},
+	} {
+		body, _ := json.Marshal(test.req)
+		req, _ := http.NewRequest("POST", "/git/largest-files", bytes.NewReader(body))
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != test.wantStatus {
+			t.Errorf("%+v: got status %d, want %d", test.req, resp.StatusCode, test.wantStatus)
+		}
+	}
+}
+
+func TestServeGitDiffTrees(t *testing.T) {
+	c := newInternalTest()
+
+	defer mockEnabledRepo(t)()
+	origResolveTree, origRawTreeDiff := resolveTree, rawTreeDiff
+	defer func() { resolveTree, rawTreeDiff = origResolveTree, origRawTreeDiff }()
+	resolveTree = func(ctx context.Context, repo gitserver.Repo, treeish string) (string, error) {
+		switch treeish {
+		case "a":
+			return "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", nil
+		case "b":
+			return "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", nil
+		}
+		return "", &git.RevisionNotFoundError{Repo: repo.Name, Spec: treeish}
+	}
+	rawTreeDiff = func(ctx context.Context, repo gitserver.Repo, treeA, treeB, path string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(fmt.Sprintf("diff %s..%s -- %s\n", treeA, treeB, path))), nil
+	}
+
+	tests := []struct {
+		req        api.GitDiffTreesRequest
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			req:        api.GitDiffTreesRequest{Repo: "github.com/gorilla/mux", TreeA: "a", TreeB: "b", Path: "d"},
+			wantStatus: http.StatusOK,
+			wantBody:   "diff aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa..bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb -- d\n",
+		},
+		{req: api.GitDiffTreesRequest{Repo: "github.com/gorilla/mux", TreeA: "a", TreeB: "missing"}, wantStatus: http.StatusBadRequest, wantBody: "treeB \"missing\" does not resolve to a tree\n"},
+		{req: api.GitDiffTreesRequest{Repo: "github.com/gorilla/mux", TreeA: "a"}, wantStatus: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		body, _ := json.Marshal(test.req)
+		req, _ := http.NewRequest("POST", "/git/diff-trees", bytes.NewReader(body))
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != test.wantStatus {
+			t.Errorf("%+v: got status %d, want %d", test.req, resp.StatusCode, test.wantStatus)
+			continue
+		}
+		if test.wantBody == "" {
+			continue
+		}
+		got, _ := ioutil.ReadAll(resp.Body)
+		if string(got) != test.wantBody {
+			t.Errorf("%+v: got body %q, want %q", test.req, got, test.wantBody)
+		}
+	}
+}
+
+func TestServeGitDiff(t *testing.T) {
+	c := newInternalTest()
+
+	defer mockEnabledRepo(t)()
+	git.Mocks.ResolveRevision = func(spec string, opt *git.ResolveRevisionOptions) (api.CommitID, error) {
+		switch spec {
+		case "base":
+			return "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", nil
+		case "head":
+			return "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", nil
+		}
+		return "", &git.RevisionNotFoundError{Repo: "github.com/gorilla/mux", Spec: spec}
+	}
+	defer git.ResetMocks()
+	orig := rawDiff
+	defer func() { rawDiff = orig }()
+	rawDiff = func(ctx context.Context, repo gitserver.Repo, base, head api.CommitID, path string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(fmt.Sprintf("diff %s..%s -- %s\n", base, head, path))), nil
+	}
+
+	tests := []struct {
+		req        api.GitDiffRequest
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			req:        api.GitDiffRequest{Repo: "github.com/gorilla/mux", Base: "base", Head: "head", Path: "a/b"},
+			wantStatus: http.StatusOK,
+			wantBody:   "diff aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa..bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb -- a/b\n",
+		},
+		{
+			req:        api.GitDiffRequest{Repo: "github.com/gorilla/mux", Head: "head"},
+			wantStatus: http.StatusOK,
+			wantBody:   "diff ..bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb -- \n",
+		},
+		{req: api.GitDiffRequest{Repo: "github.com/gorilla/mux", Base: "missing", Head: "head"}, wantStatus: http.StatusNotFound},
+		{req: api.GitDiffRequest{Repo: "github.com/gorilla/mux", Base: "base"}, wantStatus: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		body, _ := json.Marshal(test.req)
+		req, _ := http.NewRequest("POST", "/git/diff", bytes.NewReader(body))
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != test.wantStatus {
+			t.Errorf("%+v: got status %d, want %d", test.req, resp.StatusCode, test.wantStatus)
+			continue
+		}
+		if test.wantStatus != http.StatusOK {
+			continue
+		}
+		got, _ := ioutil.ReadAll(resp.Body)
+		if string(got) != test.wantBody {
+			t.Errorf("%+v: got body %q, want %q", test.req, got, test.wantBody)
+		}
+	}
+}
+
+type notABlobError struct{}
+
+func (notABlobError) Error() string    { return "not a blob" }
+func (notABlobError) BadRequest() bool { return true }
+
+func TestServeGitBlob(t *testing.T) {
+	c := newInternalTest()
+
+	defer mockEnabledRepo(t)()
+	orig := readBlob
+	defer func() { readBlob = orig }()
+	readBlob = func(ctx context.Context, repo gitserver.Repo, sha string) (io.ReadCloser, error) {
+		switch sha {
+		case "587be6b4c3f93f93c489c0111bba5596147a26cb":
+			return ioutil.NopCloser(strings.NewReader("x\n")), nil
+		case "a1dffc7a64c0b2d395484bf452e9aeb1da3a18f2":
+			return nil, notABlobError{}
+		}
+		return nil, &git.RevisionNotFoundError{Repo: repo.Name, Spec: sha}
+	}
+
+	for sha, want := range map[string]int{
+		"587be6b4c3f93f93c489c0111bba5596147a26cb": http.StatusOK,
+		"a1dffc7a64c0b2d395484bf452e9aeb1da3a18f2": http.StatusBadRequest,
+		"0000000000000000000000000000000000000000": http.StatusNotFound,
+		"HEAD": http.StatusBadRequest,
+	} {
+		body, _ := json.Marshal(api.GitBlobRequest{Repo: "github.com/gorilla/mux", SHA: sha})
+		req, _ := http.NewRequest("POST", "/git/blob", bytes.NewReader(body))
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != want {
+			t.Errorf("%s: got status %d, want %d", sha, resp.StatusCode, want)
+			continue
+		}
+		if want != http.StatusOK {
+			continue
+		}
+		if data, _ := ioutil.ReadAll(resp.Body); string(data) != "x\n" {
+			t.Errorf("%s: got body %q, want %q", sha, data, "x\n")
+		}
+	}
+}
+
+func TestServeGitPathExists(t *testing.T) {
+	c := newInternalTest()
+
+	defer mockEnabledRepo(t)()
+	git.Mocks.ResolveRevision = func(spec string, opt *git.ResolveRevisionOptions) (api.CommitID, error) {
+		return "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", nil
+	}
+	git.Mocks.Stat = func(commit api.CommitID, name string) (os.FileInfo, error) {
+		switch name {
+		case "dir":
+			return &util.FileInfo{Name_: name, Mode_: os.ModeDir}, nil
+		case "dir/file.go":
+			return &util.FileInfo{Name_: "file.go"}, nil
+		}
+		return nil, &os.PathError{Op: "ls-tree", Path: name, Err: os.ErrNotExist}
+	}
+	defer git.ResetMocks()
+
+	for path, want := range map[string]api.GitPathExistsResponse{
+		"dir":         {Exists: true, IsDir: true},
+		"dir/file.go": {Exists: true},
+		"missing":     {},
+	} {
+		var resp api.GitPathExistsResponse
+		if err := c.DoJSON("POST", "/git/path-exists", api.GitPathExistsRequest{Repo: "github.com/gorilla/mux", Commit: "master", Path: path}, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp != want {
+			t.Errorf("%s: got %+v, want %+v", path, resp, want)
+		}
+	}
+}
+
+func TestServeGitSubmodules(t *testing.T) {
+	c := newInternalTest()
+
+	defer mockEnabledRepo(t)()
+	db.Mocks.Repos.Exists = func(ctx context.Context, name api.RepoName) (bool, error) {
+		return name == "github.com/gorilla/context" || name == "github.com/gorilla/schema", nil
+	}
+	db.Mocks.ExternalServices.List = func(opt db.ExternalServicesListOptions) ([]*types.ExternalService, error) {
+		return nil, nil
+	}
+	defer func() { db.Mocks.ExternalServices = db.MockExternalServices{} }()
+	git.Mocks.ResolveRevision = func(spec string, opt *git.ResolveRevisionOptions) (api.CommitID, error) {
+		return "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", nil
+	}
+	defer git.ResetMocks()
+	listSubmodules = func(ctx context.Context, repo gitserver.Repo, commit api.CommitID) ([]git.Submodule, error) {
+		return []git.Submodule{
+			{Path: "context", URL: "https://github.com/gorilla/context.git"},
+			{Path: "private", URL: "git@example.com:private/repo.git"},
+			{Path: "schema", URL: "../schema.git"},
+		}, nil
+	}
+	defer func() { listSubmodules = git.ListSubmodules }()
+
+	var resp []api.GitSubmodule
+	if err := c.DoJSON("POST", "/git/submodules", api.GitSubmodulesRequest{Repo: "github.com/gorilla/mux", Commit: "master"}, &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := []api.GitSubmodule{
+		{Path: "context", URL: "https://github.com/gorilla/context.git", ResolvedRepo: "github.com/gorilla/context"},
+		{Path: "private", URL: "git@example.com:private/repo.git"},
+		{Path: "schema", URL: "../schema.git", ResolvedRepo: "github.com/gorilla/schema"},
+	}
+	if !reflect.DeepEqual(resp, want) {
+		t.Errorf("got %+v, want %+v", resp, want)
+	}
+}
+
+func TestServeOrgsIsAdmin(t *testing.T) {
+	c := newInternalTest()
+
+	db.Mocks.OrgMembers.GetByOrgIDAndUserID = func(ctx context.Context, orgID, userID int32) (*types.OrgMembership, error) {
+		if orgID == 1 && userID == 2 {
+			return &types.OrgMembership{OrgID: orgID, UserID: userID}, nil
+		}
+		return nil, &db.ErrOrgMemberNotFound{}
+	}
+	defer func() { db.Mocks.OrgMembers = db.MockOrgMembers{} }()
+
+	for req, want := range map[api.OrgsIsAdminRequest]api.OrgsIsAdminResponse{
+		{OrgID: 1, UserID: 2}: {IsMember: true, IsAdmin: true},
+		{OrgID: 1, UserID: 3}: {},
+	} {
+		var resp api.OrgsIsAdminResponse
+		if err := c.DoJSON("POST", "/orgs/is-admin", req, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp != want {
+			t.Errorf("%+v: got %+v, want %+v", req, resp, want)
+		}
+	}
+}
+
+func TestServeUsersSummary(t *testing.T) {
+	c := newInternalTest()
+
+	db.Mocks.Users.ListSummaries = func(ctx context.Context, ids []int32) ([]*db.UserSummary, error) {
+		if want := []int32{1, 2, 3}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("got ids %v, want %v", ids, want)
+		}
+		return []*db.UserSummary{
+			{ID: 1, Username: "alice", PrimaryEmail: "alice@example.com"},
+			{ID: 3, Username: "carol"},
+		}, nil
+	}
+	defer func() { db.Mocks.Users = db.MockUsers{} }()
+	lastActive := time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)
+	usagestats.MockGetLastActiveTimes = func(userIDs []int32) (map[int32]time.Time, error) {
+		return map[int32]time.Time{1: lastActive}, nil
+	}
+	defer func() { usagestats.MockGetLastActiveTimes = nil }()
+
+	var resp []api.UserSummary
+	if err := c.DoJSON("POST", "/users/summary", []int32{1, 2, 3}, &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := []api.UserSummary{
+		{UserID: 1, Username: "alice", PrimaryEmail: "alice@example.com", LastActiveAt: &lastActive},
+		{UserID: 3, Username: "carol"},
+	}
+	if !reflect.DeepEqual(resp, want) {
+		t.Errorf("got %+v, want %+v", resp, want)
+	}
+}
+
+func TestGitEndpoints_PathTraversal(t *testing.T) {
+	c := newInternalTest()
+
+	defer mockEnabledRepo(t)()
+
+	for url, req := range map[string]interface{}{
+		"/git/tree-recursive": api.GitTreeRecursiveRequest{Repo: "github.com/gorilla/mux", Commit: "master", Path: "../../etc"},
+		"/git/file-symbols":   api.GitFileSymbolsRequest{Repo: "github.com/gorilla/mux", Commit: "master", Path: "a/../../../etc/passwd"},
+		"/git/path-exists":    api.GitPathExistsRequest{Repo: "github.com/gorilla/mux", Commit: "master", Path: "../.."},
+	} {
+		body, _ := json.Marshal(req)
+		httpReq, _ := http.NewRequest("POST", url, bytes.NewReader(body))
+		resp, err := c.Do(httpReq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want %d", url, resp.StatusCode, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestServeGitArchiveChecksum_invalidFormat(t *testing.T) {
+	c := newInternalTest()
+
+	body, _ := json.Marshal(api.GitArchiveChecksumRequest{Repo: "github.com/gorilla/mux", Commit: "master", Format: "rar"})
+	req, _ := http.NewRequest("POST", "/git/archive-checksum", bytes.NewReader(body))
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestServeReposList(t *testing.T) {
+	c := newInternalTest()
+
+	var names []api.RepoName
+	backend.Mocks.Repos.ForEach = func(ctx context.Context, opt db.ReposListOptions, fn func(*types.Repo) error) error {
+		if !opt.Enabled {
+			t.Errorf("got options %+v, want enabled repos", opt)
+		}
+		for _, name := range names {
+			if err := fn(&types.Repo{ID: 1, Name: name}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	defer func() { backend.Mocks.Repos = backend.MockRepos{} }()
+
+	for _, names = range [][]api.RepoName{nil, {"github.com/gorilla/mux"}, {"github.com/gorilla/mux", "github.com/gorilla/schema"}} {
+		var resp []struct {
+			URI  string
+			Name api.RepoName
+		}
+		if err := c.DoJSON("POST", "/repos/list", db.ReposListOptions{Enabled: true}, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil || len(resp) != len(names) {
+			t.Fatalf("got %+v, want %d repos", resp, len(names))
+		}
+		for i, repo := range resp {
+			if repo.Name != names[i] || repo.URI != string(names[i]) {
+				t.Errorf("got %+v, want name and URI %q", repo, names[i])
+			}
+		}
+	}
+}
+
+// countingResponseWriter is an http.ResponseWriter that discards the body,
+// only keeping its size and last byte.
+type countingResponseWriter struct {
+	header http.Header
+	n      int
+	last   byte
+}
+
+func (w *countingResponseWriter) Header() http.Header { return w.header }
+func (w *countingResponseWriter) WriteHeader(int)     {}
+func (w *countingResponseWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		w.n += len(p)
+		w.last = p[len(p)-1]
+	}
+	return len(p), nil
+}
+
+func TestServeReposList_streaming(t *testing.T) {
+	// The request goes through the router and its middleware (rather than
+	// httptestutil.Client, which buffers the response), so that a middleware
+	// that buffers the response (such as a route timeout) fails the test.
+	h := NewInternalHandler(router.NewInternal(mux.NewRouter()))
+	const numRepos = 100000
+	w := &countingResponseWriter{header: http.Header{}}
+
+	// Each repository must be written before the next one is produced, so
+	// that the handler never holds more than one repository at a time.
+	backend.Mocks.Repos.ForEach = func(ctx context.Context, opt db.ReposListOptions, fn func(*types.Repo) error) error {
+		for i := 0; i < numRepos; i++ {
+			before := w.n
+			if err := fn(&types.Repo{ID: api.RepoID(i), Name: api.RepoName(fmt.Sprintf("github.com/org/repo%d", i))}); err != nil {
+				return err
+			}
+			if w.n <= before {
+				return fmt.Errorf("repo %d was not written before the next one was requested", i)
+			}
+		}
+		return nil
+	}
+	defer func() { backend.Mocks.Repos = backend.MockRepos{} }()
+
+	req, _ := http.NewRequest("POST", "/repos/list", strings.NewReader(`{}`))
+	h.ServeHTTP(w, req)
+	if w.last != ']' {
+		t.Errorf("got response ending in %q, want ']'", w.last)
+	}
+}
+
+func TestFilterNotFetchedSince(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	repos := []*types.Repo{{Name: "fresh"}, {Name: "stale"}, {Name: "never"}, {Name: "unknown"}}
+	infos := map[api.RepoName]*protocol.RepoInfo{
+		"fresh": {LastFetched: &now},
+		"stale": {LastFetched: &old},
+		"never": {},
+	}
+
+	got, lastFetched := filterNotFetchedSince(repos, infos, now.Add(-24*time.Hour))
+	var names []api.RepoName
+	for _, repo := range got {
+		names = append(names, repo.Name)
+	}
+	if want := []api.RepoName{"stale", "never", "unknown"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got repos %v, want %v", names, want)
+	}
+	if lastFetched["stale"] == nil || !lastFetched["stale"].Equal(old) {
+		t.Errorf("got stale LastFetched %v, want %v", lastFetched["stale"], old)
+	}
+	if lastFetched["never"] != nil {
+		t.Errorf("got never LastFetched %v, want nil", lastFetched["never"])
+	}
+}
+
+func TestCopyTarExcluding(t *testing.T) {
+	var src bytes.Buffer
+	tw := tar.NewWriter(&src)
+	for _, name := range []string{"README", "vendor/", "vendor/a/b.go", "main.go"} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(name))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	names := func(exclude ...string) []string {
+		var matchers []pathmatch.PathMatcher
+		for _, pattern := range exclude {
+			m, err := pathmatch.CompilePattern(pattern, pathmatch.CompileOptions{CaseSensitive: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			matchers = append(matchers, m)
+		}
+		var dst bytes.Buffer
+		if err := copyTarExcluding(&dst, bytes.NewReader(src.Bytes()), matchers); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		tr := tar.NewReader(&dst)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, hdr.Name)
+		}
+		return names
+	}
+
+	if got, want := names("vendor/**"), []string{"README", "main.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := names("**"); len(got) != 0 {
+		t.Errorf("got %v, want empty archive", got)
+	}
+}
+
+func TestServeGitTar_invalidConfig(t *testing.T) {
+	c := newInternalTest()
+
+	defer mockEnabledRepo(t)()
+	git.Mocks.ResolveRevision = func(spec string, opt *git.ResolveRevisionOptions) (api.CommitID, error) {
+		return "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", nil
+	}
+	defer git.ResetMocks()
+
+	req, _ := http.NewRequest("GET", "/git/github.com/gorilla/mux/tar/master?config=core.fsmonitor=true", nil)
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestServeGitTar_invalidFormat(t *testing.T) {
+	c := newInternalTest()
+
+	defer mockEnabledRepo(t)()
+	git.Mocks.ResolveRevision = func(spec string, opt *git.ResolveRevisionOptions) (api.CommitID, error) {
+		return "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", nil
+	}
+	defer git.ResetMocks()
+
+	for _, query := range []string{"format=tgz", "format=zip&exclude=vendor/**"} {
+		req, _ := http.NewRequest("GET", "/git/github.com/gorilla/mux/tar/master?"+query, nil)
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want %d", query, resp.StatusCode, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestServeGitTar_invalidPath(t *testing.T) {
+	c := newInternalTest()
+
+	defer mockEnabledRepo(t)()
+	git.Mocks.ResolveRevision = func(spec string, opt *git.ResolveRevisionOptions) (api.CommitID, error) {
+		return "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", nil
+	}
+	git.Mocks.Stat = func(commit api.CommitID, path string) (os.FileInfo, error) {
+		if path == "src/backend" {
+			return &util.FileInfo{Name_: path, Mode_: os.ModeDir}, nil
+		}
+		return nil, &os.PathError{Op: "ls-tree", Path: path, Err: os.ErrNotExist}
+	}
+	defer git.ResetMocks()
+
+	for _, query := range []string{"path=../etc", "path=src/backend&path=src/missing"} {
+		req, _ := http.NewRequest("GET", "/git/github.com/gorilla/mux/tar/master?"+query, nil)
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want %d", query, resp.StatusCode, http.StatusBadRequest)
+		}
+	}
+}
+
+// mockGitArchive mocks gitArchive to return an empty tarball, recording the
+// treeish of each call in treeishes.
+func mockGitArchive(t *testing.T, treeishes *[]string) (restore func()) {
+	var empty bytes.Buffer
+	if err := tar.NewWriter(&empty).Close(); err != nil {
+		t.Fatal(err)
+	}
+	orig := gitArchive
+	gitArchive = func(ctx context.Context, repo gitserver.Repo, opt git.ArchiveOptions) (io.ReadCloser, error) {
+		*treeishes = append(*treeishes, opt.Treeish)
+		return ioutil.NopCloser(bytes.NewReader(empty.Bytes())), nil
+	}
+	return func() { gitArchive = orig }
+}
+
+func TestServeGitTar_resolvedCommit(t *testing.T) {
+	c := newInternalTest()
+
+	defer mockEnabledRepo(t)()
+	git.Mocks.ResolveRevision = func(spec string, opt *git.ResolveRevisionOptions) (api.CommitID, error) {
+		if spec != "master" {
+			t.Errorf("got spec %q, want master", spec)
+		}
+		return "cccccccccccccccccccccccccccccccccccccccc", nil
+	}
+	defer git.ResetMocks()
+	var treeishes []string
+	defer mockGitArchive(t, &treeishes)()
+
+	resp, err := c.Get("/git/github.com/gorilla/mux/tar/master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if got, want := resp.Header.Get("X-Resolved-Commit"), "cccccccccccccccccccccccccccccccccccccccc"; got != want {
+		t.Errorf("got X-Resolved-Commit %q, want %q", got, want)
+	}
+	if want := []string{"cccccccccccccccccccccccccccccccccccccccc"}; !reflect.DeepEqual(treeishes, want) {
+		t.Errorf("got archived treeishes %v, want %v", treeishes, want)
+	}
+}
+
+func TestServeGitTar_encoding(t *testing.T) {
+	c := newInternalTest()
+
+	defer mockEnabledRepo(t)()
+	git.Mocks.ResolveRevision = func(spec string, opt *git.ResolveRevisionOptions) (api.CommitID, error) {
+		return "cccccccccccccccccccccccccccccccccccccccc", nil
+	}
+	defer git.ResetMocks()
+	var treeishes []string
+	defer mockGitArchive(t, &treeishes)()
+
+	tests := map[string]bool{ // query -> want gzip
+		"":                    false,
+		"?encoding=identity":  false,
+		"?encoding=gzip":      true,
+		"?compressionLevel=1": true,
+	}
+	for query, wantGzip := range tests {
+		req, _ := http.NewRequest("GET", "/git/github.com/gorilla/mux/tar/master"+query, nil)
+		// Accepting gzip alone must not make the archive compressed.
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%q: got status %d, want %d", query, resp.StatusCode, http.StatusOK)
+		}
+		if gotGzip := resp.Header.Get("Content-Encoding") == "gzip"; gotGzip != wantGzip {
+			t.Errorf("%q: got gzip %v, want %v", query, gotGzip, wantGzip)
+		}
+		body := io.Reader(resp.Body)
+		if wantGzip {
+			if body, err = gzip.NewReader(resp.Body); err != nil {
+				t.Fatalf("%q: %s", query, err)
+			}
+		}
+		if _, err := tar.NewReader(body).Next(); err != io.EOF {
+			t.Errorf("%q: got error %v reading the tarball, want EOF", query, err)
+		}
+	}
+
+	resp, err := c.Get("/git/github.com/gorilla/mux/tar/master?encoding=br")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestServeGitTar_asOf(t *testing.T) {
+	c := newInternalTest()
+
+	defer mockEnabledRepo(t)()
+	git.Mocks.ResolveRevision = func(spec string, opt *git.ResolveRevisionOptions) (api.CommitID, error) {
+		// asOf is relative to the default branch, not the commit in the URL.
+		if spec != "HEAD" {
+			t.Errorf("got spec %q, want HEAD", spec)
+		}
+		return "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", nil
+	}
+	git.Mocks.Commits = func(opt git.CommitsOptions) ([]*git.Commit, error) {
+		if opt.Range != "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb" || opt.N != 1 {
+			t.Errorf("got options %+v, want the last commit reachable from the resolved spec", opt)
+		}
+		// The repository's first commit is from 2018.
+		if opt.Before < "2018" {
+			return nil, nil
+		}
+		return []*git.Commit{{ID: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}}, nil
+	}
+	defer git.ResetMocks()
+	var treeishes []string
+	defer mockGitArchive(t, &treeishes)()
+
+	tests := []struct {
+		asOf       string
+		wantStatus int
+		wantCommit string
+	}{
+		{asOf: "yesterday", wantStatus: http.StatusBadRequest},
+		{asOf: "2017-01-01T00:00:00Z", wantStatus: http.StatusNotFound},
+		{asOf: "2019-01-01T00:00:00Z", wantStatus: http.StatusOK, wantCommit: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"},
+	}
+	for _, test := range tests {
+		treeishes = nil
+		req, _ := http.NewRequest("GET", "/git/github.com/gorilla/mux/tar/master?asOf="+url.QueryEscape(test.asOf), nil)
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != test.wantStatus {
+			t.Errorf("%s: got status %d, want %d", test.asOf, resp.StatusCode, test.wantStatus)
+		}
+		if test.wantStatus == http.StatusNotFound {
+			var body errorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Code != "no_commit_before" {
+				t.Errorf("%s: got error code %q, want no_commit_before", test.asOf, body.Code)
+			}
+		}
+		if test.wantCommit == "" {
+			continue
+		}
+		if got := resp.Header.Get("X-Resolved-Commit"); got != test.wantCommit {
+			t.Errorf("%s: got X-Resolved-Commit %q, want %q", test.asOf, got, test.wantCommit)
+		}
+		if want := []string{test.wantCommit}; !reflect.DeepEqual(treeishes, want) {
+			t.Errorf("%s: got archived treeishes %v, want %v", test.asOf, treeishes, want)
+		}
+	}
+}
+
+func TestArchiveFilename(t *testing.T) {
+	if got, want := archiveFilename("github.com/gorilla/mux", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "zip"), "github.com-gorilla-mux-aaaaaaaaaaaa.zip"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTarEntriesForPaths(t *testing.T) {
+	got := tarEntriesForPaths([]string{"README", "a/b/c.go", "a/d.go"})
+	want := map[string]bool{"README": true, "a/": true, "a/b/": true, "a/b/c.go": true, "a/d.go": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestEncodeDeletedPaths(t *testing.T) {
+	if got, want := encodeDeletedPaths([]string{"a/b.go", "c d,e"}), "a%2Fb.go,c+d%2Ce"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := encodeDeletedPaths(nil); got != "" {
+		t.Errorf("got %q, want empty", got)
+	}
+}
+
+// blockingReadCloser blocks reads until it is closed, like the output of a
+// long-running git archive command.
+type blockingReadCloser struct {
+	closed chan struct{}
+}
+
+func (b *blockingReadCloser) Read(p []byte) (int, error) {
+	<-b.closed
+	return 0, errors.New("read on closed reader")
+}
+
+func (b *blockingReadCloser) Close() error {
+	close(b.closed)
+	return nil
+}
+
+func TestCloseOnDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	src := &blockingReadCloser{closed: make(chan struct{})}
+	rc := closeOnDone(ctx, src)
+	defer rc.Close()
+
+	copyErr := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(ioutil.Discard, rc)
+		copyErr <- err
+	}()
+
+	// Simulate the client disconnecting.
+	cancel()
+
+	select {
+	case <-src.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("source was not closed after the context was canceled")
+	}
+	if err := <-copyErr; err != context.Canceled {
+		t.Errorf("got copy error %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,43 @@
+package httpapi
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// rateLimitState is the state of a limiter at the time it rejected a request.
+type rateLimitState struct {
+	Limit     int       // maximum number of requests the limiter allows (per window, or concurrently)
+	Remaining int       // number of requests the limiter would still allow
+	Reset     time.Time // when the limiter is expected to allow requests again
+}
+
+// rateLimitedError is implemented by errors that are returned when a request
+// is rejected by a limiter. handleError sends the limiter's state to the
+// client in the X-RateLimit-* headers (see setRateLimitHeaders), so that
+// clients can back off adaptively instead of retrying blindly.
+//
+// All throttled handlers should return such an error rather than setting the
+// headers themselves.
+type rateLimitedError interface {
+	error
+	RateLimit() rateLimitState
+}
+
+// setRateLimitHeaders sets the X-RateLimit-Limit, X-RateLimit-Remaining and
+// X-RateLimit-Reset (in Unix seconds) headers from s, as well as the
+// equivalent Retry-After (in seconds from now, at least 1).
+func setRateLimitHeaders(w http.ResponseWriter, s rateLimitState, now time.Time) {
+	h := w.Header()
+	h.Set("X-RateLimit-Limit", strconv.Itoa(s.Limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(s.Remaining))
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(int64(math.Ceil(float64(s.Reset.UnixNano())/float64(time.Second))), 10))
+
+	retryAfter := int(math.Ceil(s.Reset.Sub(now).Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	h.Set("Retry-After", strconv.Itoa(retryAfter))
+}
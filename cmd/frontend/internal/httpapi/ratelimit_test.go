@@ -0,0 +1,61 @@
+package httpapi
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSetRateLimitHeaders(t *testing.T) {
+	now := time.Unix(1000, 0)
+	tests := []struct {
+		state rateLimitState
+		want  map[string]string
+	}{
+		{
+			state: rateLimitState{Limit: 32, Remaining: 0, Reset: now.Add(4500 * time.Millisecond)},
+			want: map[string]string{
+				"X-RateLimit-Limit":     "32",
+				"X-RateLimit-Remaining": "0",
+				"X-RateLimit-Reset":     "1005",
+				"Retry-After":           "5",
+			},
+		},
+		{
+			// A reset in the past still asks clients to wait a little.
+			state: rateLimitState{Limit: 10, Remaining: 3, Reset: now.Add(-time.Second)},
+			want: map[string]string{
+				"X-RateLimit-Limit":     "10",
+				"X-RateLimit-Remaining": "3",
+				"X-RateLimit-Reset":     "999",
+				"Retry-After":           "1",
+			},
+		},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		setRateLimitHeaders(rec, test.state, now)
+		for k, want := range test.want {
+			if got := rec.Header().Get(k); got != want {
+				t.Errorf("%+v: got %s %q, want %q", test.state, k, got, want)
+			}
+		}
+	}
+}
+
+func TestHandleError_rateLimited(t *testing.T) {
+	rec := httptest.NewRecorder()
+	err := &archiveLimitError{Limit: 32, RetryAfter: 5 * time.Second, Reset: time.Now().Add(5 * time.Second)}
+	handleError(rec, httptest.NewRequest("GET", "/", nil), err.HTTPStatusCode(), err)
+	if rec.Code != 429 {
+		t.Errorf("got status %d, want 429", rec.Code)
+	}
+	for _, k := range []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After"} {
+		if rec.Header().Get(k) == "" {
+			t.Errorf("got no %s header", k)
+		}
+	}
+	if got, want := rec.Header().Get("X-RateLimit-Limit"), "32"; got != want {
+		t.Errorf("got X-RateLimit-Limit %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,59 @@
+package httpapi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+
+	log15 "gopkg.in/inconshreveable/log15.v2"
+)
+
+// panicResponse is the body of the response sent when a handler panics. ID
+// identifies the request in the logs.
+type panicResponse struct {
+	Error string `json:"error"`
+	ID    string `json:"id"`
+}
+
+// recoverPanic must be deferred by a handler. If the handler panics, it logs
+// the panic with its stack trace and responds with a JSON 500 that carries the
+// request ID, so that the client's error can be correlated with the log entry.
+//
+// The request ID is taken from the X-Request-Id request header if present, and
+// is otherwise generated. It is also sent in the X-Request-Id response header.
+func recoverPanic(w http.ResponseWriter, r *http.Request) {
+	rec := recover()
+	if rec == nil {
+		return
+	}
+	if rec == http.ErrAbortHandler {
+		// Used by handlers to abort the response on purpose.
+		panic(rec)
+	}
+
+	id := r.Header.Get("X-Request-Id")
+	if id == "" {
+		id = newRequestID()
+	}
+	log15.Error("panic in API handler", "id", id, "method", r.Method, "request_uri", r.URL.RequestURI(), "panic", rec, "stack", string(debug.Stack()))
+
+	// If the handler already started writing its response, the client will
+	// see a truncated response instead.
+	w.Header().Set("X-Request-Id", id)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("cache-control", "no-cache, max-age=0")
+	w.WriteHeader(http.StatusInternalServerError)
+	if err := json.NewEncoder(w).Encode(panicResponse{Error: "internal error", ID: id}); err != nil {
+		log15.Error("error encoding API panic response", "id", id, "err", err)
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
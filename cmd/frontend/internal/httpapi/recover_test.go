@@ -0,0 +1,56 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	log15 "gopkg.in/inconshreveable/log15.v2"
+)
+
+func TestHandler_panic(t *testing.T) {
+	var records []*log15.Record
+	orig := log15.Root().GetHandler()
+	log15.Root().SetHandler(log15.FuncHandler(func(r *log15.Record) error {
+		records = append(records, r)
+		return nil
+	}))
+	defer log15.Root().SetHandler(orig)
+
+	h := handler(func(w http.ResponseWriter, r *http.Request) error {
+		var m map[string]string
+		m["x"] = "y" // panics
+		return nil
+	})
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("X-Request-Id", "abc123")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	var body panicResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if want := (panicResponse{Error: "internal error", ID: "abc123"}); body != want {
+		t.Errorf("got body %+v, want %+v", body, want)
+	}
+
+	if len(records) != 1 {
+		t.Fatalf("got %d log records, want 1", len(records))
+	}
+	ctx := map[string]interface{}{}
+	for i := 0; i+1 < len(records[0].Ctx); i += 2 {
+		ctx[records[0].Ctx[i].(string)] = records[0].Ctx[i+1]
+	}
+	if ctx["id"] != "abc123" {
+		t.Errorf("got logged id %v, want %q", ctx["id"], "abc123")
+	}
+	if stack, _ := ctx["stack"].(string); !strings.Contains(stack, "TestHandler_panic") {
+		t.Errorf("logged stack does not include the panicking handler:\n%s", stack)
+	}
+}
@@ -0,0 +1,31 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/sourcegraph/sourcegraph/pkg/errcode"
+)
+
+// cleanRepoPath cleans p, a (possibly user-supplied) path relative to the root
+// of a repository. It returns a 400 Bad Request error if p refers to anything
+// outside of the repository, such as "../../etc/passwd". A leading slash is
+// ignored, and the root itself is returned as "".
+//
+// All endpoints that take file or tree paths should pass them through
+// cleanRepoPath instead of checking them themselves.
+func cleanRepoPath(p string) (string, error) {
+	if strings.ContainsRune(p, 0) {
+		return "", &errcode.HTTPErr{Status: http.StatusBadRequest, Err: fmt.Errorf("invalid path %q", p)}
+	}
+	cleaned := path.Clean(strings.TrimLeft(p, "/"))
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", &errcode.HTTPErr{Status: http.StatusBadRequest, Err: fmt.Errorf("path %q is outside of the repository", p)}
+	}
+	if cleaned == "." {
+		return "", nil
+	}
+	return cleaned, nil
+}
@@ -0,0 +1,54 @@
+package httpapi
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/pkg/errcode"
+)
+
+func TestCleanRepoPath(t *testing.T) {
+	tests := map[string]string{
+		"":           "",
+		".":          "",
+		"/":          "",
+		"README.md":  "README.md",
+		"/README.md": "README.md",
+		"a/b/../c":   "a/c",
+		"a//b/./c/":  "a/b/c",
+		"a/..":       "",
+		"a/../..b":   "..b",
+	}
+	for p, want := range tests {
+		got, err := cleanRepoPath(p)
+		if err != nil {
+			t.Errorf("%q: %s", p, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%q: got %q, want %q", p, got, want)
+		}
+	}
+}
+
+func TestCleanRepoPath_traversal(t *testing.T) {
+	for _, p := range []string{
+		"..",
+		"../",
+		"../../etc/passwd",
+		"/../../etc/passwd",
+		"a/../../etc/passwd",
+		"a/b/../../../etc/passwd",
+		"./../a",
+		"a\x00b",
+	} {
+		_, err := cleanRepoPath(p)
+		if err == nil {
+			t.Errorf("%q: got no error, want it rejected", p)
+			continue
+		}
+		if status := errcode.HTTP(err); status != http.StatusBadRequest {
+			t.Errorf("%q: got HTTP status %d, want %d", p, status, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/cmd/frontend/types"
+	"github.com/sourcegraph/sourcegraph/pkg/conf"
+	log15 "gopkg.in/inconshreveable/log15.v2"
+)
+
+// repoCreatedWebhookTimeout is the maximum time spent posting a single
+// repos.createdWebhookURL notification.
+const repoCreatedWebhookTimeout = 30 * time.Second
+
+// notifyRepoCreated asynchronously posts repo to the site's
+// repos.createdWebhookURL, if any. Failures are logged and otherwise
+// ignored.
+func notifyRepoCreated(repo *types.Repo) {
+	url := conf.Get().ReposCreatedWebhookURL
+	if url == "" {
+		return
+	}
+	go func() {
+		if err := postRepoCreatedWebhook(url, repo); err != nil {
+			log15.Warn("Failed to notify repos.createdWebhookURL of new repository.", "repo", repo.Name, "error", err)
+		}
+	}()
+}
+
+func postRepoCreatedWebhook(url string, repo *types.Repo) error {
+	payload, err := json.Marshal(repo)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	ctx, cancel := context.WithTimeout(context.Background(), repoCreatedWebhookTimeout)
+	defer cancel()
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with HTTP status %d", resp.StatusCode)
+	}
+	return nil
+}
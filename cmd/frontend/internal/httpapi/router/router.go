@@ -15,36 +15,114 @@ const (
 	RepoRefresh = "repo.refresh"
 	Telemetry   = "telemetry"
 
-	SavedQueriesListAll    = "internal.saved-queries.list-all"
-	SavedQueriesGetInfo    = "internal.saved-queries.get-info"
-	SavedQueriesSetInfo    = "internal.saved-queries.set-info"
-	SavedQueriesDeleteInfo = "internal.saved-queries.delete-info"
-	SettingsGetForSubject  = "internal.settings.get-for-subject"
-	OrgsListUsers          = "internal.orgs.list-users"
-	OrgsGetByName          = "internal.orgs.get-by-name"
-	UsersGetByUsername     = "internal.users.get-by-username"
-	UserEmailsGetEmail     = "internal.user-emails.get-email"
-	ExternalURL            = "internal.app-url"
-	GitServerAddrs         = "internal.git-server-addrs"
-	CanSendEmail           = "internal.can-send-email"
-	SendEmail              = "internal.send-email"
-	Extension              = "internal.extension"
-	GitResolveRevision     = "internal.git.resolve-revision"
-	GitTar                 = "internal.git.tar"
-	PhabricatorRepoCreate  = "internal.phabricator.repo.create"
-	ReposCreateIfNotExists = "internal.repos.create-if-not-exists"
-	ReposGetByName         = "internal.repos.get-by-name"
-	ReposInventoryUncached = "internal.repos.inventory-uncached"
-	ReposInventory         = "internal.repos.inventory"
-	ReposList              = "internal.repos.list"
-	ReposListEnabled       = "internal.repos.list-enabled"
-	ReposUpdateMetadata    = "internal.repos.update-metadata"
-	Configuration          = "internal.configuration"
-	SearchConfiguration    = "internal.search-configuration"
-	ExternalServiceConfigs = "internal.external-services.configs"
-	ExternalServicesList   = "internal.external-services.list"
+	SavedQueriesListAll         = "internal.saved-queries.list-all"
+	SavedQueriesGetInfo         = "internal.saved-queries.get-info"
+	SavedQueriesSetInfo         = "internal.saved-queries.set-info"
+	SavedQueriesDeleteInfo      = "internal.saved-queries.delete-info"
+	SavedQueriesDeleteInfoBatch = "internal.saved-queries.delete-info-batch"
+	SavedQueriesReconcile       = "internal.saved-queries.reconcile"
+	SavedQueriesHealth          = "internal.saved-queries.health"
+	SettingsGetForSubject       = "internal.settings.get-for-subject"
+	SettingsUpdate              = "internal.settings.update"
+	SettingsExistBatch          = "internal.settings.exist-batch"
+	OrgsListUsers               = "internal.orgs.list-users"
+	OrgsGetByName               = "internal.orgs.get-by-name"
+	OrgsIsAdmin                 = "internal.orgs.is-admin"
+	UsersGetByUsername          = "internal.users.get-by-username"
+	UsersSummary                = "internal.users.summary"
+	UserEmailsGetEmail          = "internal.user-emails.get-email"
+	ExternalURL                 = "internal.app-url"
+	GitServerAddrs              = "internal.git-server-addrs"
+	CanSendEmail                = "internal.can-send-email"
+	EmailVerificationRequired   = "internal.email-verification-required"
+	EmailConfig                 = "internal.email-config"
+	SendEmail                   = "internal.send-email"
+	SendEmailBatch              = "internal.send-email-batch"
+	Extension                   = "internal.extension"
+	ExtensionsWarm              = "internal.extensions.warm"
+	ExtensionsList              = "internal.extensions.list"
+	GitVersion                  = "internal.git.version"
+	GitserverDiskInfo           = "internal.gitserver.disk-info"
+	GitResolveRevision          = "internal.git.resolve-revision"
+	GitResolveRevisions         = "internal.git.resolve-revisions"
+	GitCommits                  = "internal.git.commits"
+	GitIsAncestor               = "internal.git.is-ancestor"
+	GitMergeBaseDiffStat        = "internal.git.merge-base-diffstat"
+	GitTagsContaining           = "internal.git.tags-containing"
+	GitBranchesContaining       = "internal.git.branches-containing"
+	GitHasSubmodules            = "internal.git.has-submodules"
+	GitSubmodules               = "internal.git.submodules"
+	GitRefs                     = "internal.git.refs"
+	GitObjectType               = "internal.git.object-type"
+	GitBlob                     = "internal.git.blob"
+	GitPathExists               = "internal.git.path-exists"
+	GitFileType                 = "internal.git.file-type"
+	GitFileSymbols              = "internal.git.file-symbols"
+	GitTreeRecursive            = "internal.git.tree-recursive"
+	GitLargestFiles             = "internal.git.largest-files"
+	GitLogStream                = "internal.git.log-stream"
+	GitCommitsBetween           = "internal.git.commits-between"
+	GitDiff                     = "internal.git.diff"
+	GitDiffTrees                = "internal.git.diff-trees"
+	GitTar                      = "internal.git.tar"
+	GitArchiveChecksum          = "internal.git.archive-checksum"
+	PhabricatorRepoCreate       = "internal.phabricator.repo.create"
+	ReposCreateIfNotExists      = "internal.repos.create-if-not-exists"
+	ReposGetByName              = "internal.repos.get-by-name"
+	ReposExists                 = "internal.repos.exists"
+	ReposStatus                 = "internal.repos.status"
+	ReposCancelClone            = "internal.repos.cancel-clone"
+	ReposDefaultBranches        = "internal.repos.default-branches"
+	ReposPermsStatus            = "internal.repos.perms-status"
+	ReposPermsStatusBatch       = "internal.repos.perms-status-batch"
+	ReposValidateName           = "internal.repos.validate-name"
+	ReposTouch                  = "internal.repos.touch"
+	ReposDeleteByFilter         = "internal.repos.delete-by-filter"
+	ReposGetMetadata            = "internal.repos.get-metadata"
+	ReposSetMetadata            = "internal.repos.set-metadata"
+	ReposGitserverShard         = "internal.repos.gitserver-shard"
+	ReposGitserverShards        = "internal.repos.gitserver-shards"
+	ReposInventoryUncached      = "internal.repos.inventory-uncached"
+	ReposInventory              = "internal.repos.inventory"
+	ReposInventoryByPath        = "internal.repos.inventory-by-path"
+	ReposInventoryWarm          = "internal.repos.inventory-warm"
+	ReposHasLanguage            = "internal.repos.has-language"
+	ReposLanguageStats          = "internal.repos.language-stats"
+	ReposList                   = "internal.repos.list"
+	ReposListEnabled            = "internal.repos.list-enabled"
+	ReposListByExtService       = "internal.repos.list-by-external-service"
+	ReposListForOrg             = "internal.repos.list-for-org"
+	ReposGetByExtRepoBatch      = "internal.repos.get-by-external-repos-batch"
+	ReposNeedingClone           = "internal.repos.needing-clone"
+	ReposCloneStatus            = "internal.repos.clone-status-summary"
+	ReposRecentlyUpdated        = "internal.repos.recently-updated"
+	ReposUpdateMetadata         = "internal.repos.update-metadata"
+	Configuration               = "internal.configuration"
+	SearchConfiguration         = "internal.search-configuration"
+	SearchLimits                = "internal.search.limits"
+	ExternalServiceConfigs      = "internal.external-services.configs"
+	ExternalServicesList        = "internal.external-services.list"
 )
 
+// streamingRoutes are the internal routes whose handlers stream their
+// response (instead of writing a single JSON value), so that it must not be
+// buffered.
+var streamingRoutes = map[string]bool{
+	GitTar:           true,
+	GitTreeRecursive: true,
+	GitLogStream:     true,
+	GitDiff:          true,
+	GitDiffTrees:     true,
+	GitBlob:          true,
+	ReposList:        true,
+}
+
+// IsStreaming reports whether the route with the given name streams its
+// response.
+func IsStreaming(name string) bool {
+	return streamingRoutes[name]
+}
+
 // New creates a new API router with route URL pattern definitions but
 // no handlers attached to the routes.
 func New(base *mux.Router) *mux.Router {
@@ -82,17 +160,52 @@ func NewInternal(base *mux.Router) *mux.Router {
 	base.Path("/saved-queries/get-info").Methods("POST").Name(SavedQueriesGetInfo)
 	base.Path("/saved-queries/set-info").Methods("POST").Name(SavedQueriesSetInfo)
 	base.Path("/saved-queries/delete-info").Methods("POST").Name(SavedQueriesDeleteInfo)
+	base.Path("/saved-queries/delete-info-batch").Methods("POST").Name(SavedQueriesDeleteInfoBatch)
+	base.Path("/saved-queries/reconcile").Methods("POST").Name(SavedQueriesReconcile)
+	base.Path("/saved-queries/health").Methods("POST").Name(SavedQueriesHealth)
 	base.Path("/settings/get-for-subject").Methods("POST").Name(SettingsGetForSubject)
+	base.Path("/settings/update").Methods("POST").Name(SettingsUpdate)
+	base.Path("/settings/exist-batch").Methods("POST").Name(SettingsExistBatch)
 	base.Path("/orgs/list-users").Methods("POST").Name(OrgsListUsers)
 	base.Path("/orgs/get-by-name").Methods("POST").Name(OrgsGetByName)
+	base.Path("/orgs/is-admin").Methods("POST").Name(OrgsIsAdmin)
 	base.Path("/users/get-by-username").Methods("POST").Name(UsersGetByUsername)
+	base.Path("/users/summary").Methods("POST").Name(UsersSummary)
 	base.Path("/user-emails/get-email").Methods("POST").Name(UserEmailsGetEmail)
 	base.Path("/app-url").Methods("POST").Name(ExternalURL)
 	base.Path("/git-server-addrs").Methods("POST").Name(GitServerAddrs)
 	base.Path("/can-send-email").Methods("POST").Name(CanSendEmail)
+	base.Path("/email-verification-required").Methods("POST").Name(EmailVerificationRequired)
+	base.Path("/email-config").Methods("POST").Name(EmailConfig)
 	base.Path("/send-email").Methods("POST").Name(SendEmail)
+	base.Path("/send-email-batch").Methods("POST").Name(SendEmailBatch)
 	base.Path("/extension").Methods("POST").Name(Extension)
+	base.Path("/extensions/warm").Methods("POST").Name(ExtensionsWarm)
+	base.Path("/extensions/list").Methods("POST").Name(ExtensionsList)
+	base.Path("/git/version").Methods("GET").Name(GitVersion)
+	base.Path("/gitserver/disk-info").Methods("GET").Name(GitserverDiskInfo)
 	base.Path("/git/{RepoName:.*}/resolve-revision/{Spec}").Methods("GET").Name(GitResolveRevision)
+	base.Path("/git/resolve-revisions").Methods("POST").Name(GitResolveRevisions)
+	base.Path("/git/commits").Methods("POST").Name(GitCommits)
+	base.Path("/git/is-ancestor").Methods("POST").Name(GitIsAncestor)
+	base.Path("/git/merge-base-diffstat").Methods("POST").Name(GitMergeBaseDiffStat)
+	base.Path("/git/tags-containing").Methods("POST").Name(GitTagsContaining)
+	base.Path("/git/branches-containing").Methods("POST").Name(GitBranchesContaining)
+	base.Path("/git/has-submodules").Methods("POST").Name(GitHasSubmodules)
+	base.Path("/git/submodules").Methods("POST").Name(GitSubmodules)
+	base.Path("/git/refs").Methods("POST").Name(GitRefs)
+	base.Path("/git/object-type").Methods("POST").Name(GitObjectType)
+	base.Path("/git/blob").Methods("POST").Name(GitBlob)
+	base.Path("/git/path-exists").Methods("POST").Name(GitPathExists)
+	base.Path("/git/file-type").Methods("POST").Name(GitFileType)
+	base.Path("/git/file-symbols").Methods("POST").Name(GitFileSymbols)
+	base.Path("/git/tree-recursive").Methods("POST").Name(GitTreeRecursive)
+	base.Path("/git/largest-files").Methods("POST").Name(GitLargestFiles)
+	base.Path("/git/log-stream").Methods("POST").Name(GitLogStream)
+	base.Path("/git/commits-between").Methods("POST").Name(GitCommitsBetween)
+	base.Path("/git/diff").Methods("POST").Name(GitDiff)
+	base.Path("/git/diff-trees").Methods("POST").Name(GitDiffTrees)
+	base.Path("/git/archive-checksum").Methods("POST").Name(GitArchiveChecksum)
 	base.Path("/git/{RepoName:.*}/tar/{Commit}").Methods("GET").Name(GitTar)
 	base.Path("/phabricator/repo-create").Methods("POST").Name(PhabricatorRepoCreate)
 	base.Path("/external-services/configs").Methods("POST").Name(ExternalServiceConfigs)
@@ -100,12 +213,36 @@ func NewInternal(base *mux.Router) *mux.Router {
 	base.Path("/repos/create-if-not-exists").Methods("POST").Name(ReposCreateIfNotExists)
 	base.Path("/repos/inventory-uncached").Methods("POST").Name(ReposInventoryUncached)
 	base.Path("/repos/inventory").Methods("POST").Name(ReposInventory)
+	base.Path("/repos/inventory-by-path").Methods("POST").Name(ReposInventoryByPath)
+	base.Path("/repos/inventory-warm").Methods("POST").Name(ReposInventoryWarm)
+	base.Path("/repos/exists").Methods("POST").Name(ReposExists)
+	base.Path("/repos/status").Methods("POST").Name(ReposStatus)
+	base.Path("/repos/cancel-clone").Methods("POST").Name(ReposCancelClone)
+	base.Path("/repos/default-branches").Methods("POST").Name(ReposDefaultBranches)
+	base.Path("/repos/perms-status").Methods("POST").Name(ReposPermsStatus)
+	base.Path("/repos/perms-status-batch").Methods("POST").Name(ReposPermsStatusBatch)
+	base.Path("/repos/validate-name").Methods("POST").Name(ReposValidateName)
+	base.Path("/repos/touch").Methods("POST").Name(ReposTouch)
+	base.Path("/repos/delete-by-filter").Methods("POST").Name(ReposDeleteByFilter)
+	base.Path("/repos/get-metadata").Methods("POST").Name(ReposGetMetadata)
+	base.Path("/repos/set-metadata").Methods("POST").Name(ReposSetMetadata)
+	base.Path("/repos/gitserver-shard").Methods("POST").Name(ReposGitserverShard)
+	base.Path("/repos/gitserver-shards").Methods("POST").Name(ReposGitserverShards)
+	base.Path("/repos/has-language").Methods("POST").Name(ReposHasLanguage)
+	base.Path("/repos/language-stats").Methods("POST").Name(ReposLanguageStats)
 	base.Path("/repos/list").Methods("POST").Name(ReposList)
 	base.Path("/repos/list-enabled").Methods("POST").Name(ReposListEnabled)
+	base.Path("/repos/list-by-external-service").Methods("POST").Name(ReposListByExtService)
+	base.Path("/repos/list-for-org").Methods("POST").Name(ReposListForOrg)
+	base.Path("/repos/get-by-external-repos-batch").Methods("POST").Name(ReposGetByExtRepoBatch)
+	base.Path("/repos/needing-clone").Methods("POST").Name(ReposNeedingClone)
+	base.Path("/repos/clone-status-summary").Methods("POST").Name(ReposCloneStatus)
+	base.Path("/repos/recently-updated").Methods("POST").Name(ReposRecentlyUpdated)
 	base.Path("/repos/update-metadata").Methods("POST").Name(ReposUpdateMetadata)
 	base.Path("/repos/{RepoName:.*}").Methods("POST").Name(ReposGetByName)
 	base.Path("/configuration").Methods("POST").Name(Configuration)
 	base.Path("/search/configuration").Methods("GET").Name(SearchConfiguration)
+	base.Path("/search/limits").Methods("POST").Name(SearchLimits)
 	addRegistryRoute(base)
 	addGraphQLRoute(base)
 	addTelemetryRoute(base)
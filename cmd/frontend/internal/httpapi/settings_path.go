@@ -0,0 +1,33 @@
+package httpapi
+
+import "strings"
+
+// lookupSettingsPath returns the value at the dot-separated path in the
+// decoded settings JSON v, and whether it exists.
+//
+// Settings keys commonly contain dots themselves (such as
+// "search.defaultLimit"), so at each level the longest prefix of the
+// remaining path that names a key is preferred. For example, the path
+// "search.scopes.0" is looked up as the key "search.scopes" followed by the
+// key "0" (if no "search.scopes.0" key exists). Path components that index
+// into arrays are not supported.
+func lookupSettingsPath(v interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return v, true
+	}
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	parts := strings.Split(path, ".")
+	for i := len(parts); i > 0; i-- {
+		child, ok := obj[strings.Join(parts[:i], ".")]
+		if !ok {
+			continue
+		}
+		if value, ok := lookupSettingsPath(child, strings.Join(parts[i:], ".")); ok {
+			return value, true
+		}
+	}
+	return nil, false
+}
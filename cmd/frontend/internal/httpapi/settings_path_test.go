@@ -0,0 +1,40 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestLookupSettingsPath(t *testing.T) {
+	var settings interface{}
+	if err := json.Unmarshal([]byte(`{
+		"search.defaultLimit": 50,
+		"search": {"contextLines": 3},
+		"motd": ["hello"],
+		"a.b": {"c": true},
+		"a": {"b.c": false}
+	}`), &settings); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path   string
+		want   interface{}
+		wantOK bool
+	}{
+		{path: "search.defaultLimit", want: 50.0, wantOK: true},
+		{path: "search.contextLines", want: 3.0, wantOK: true},
+		{path: "motd", want: []interface{}{"hello"}, wantOK: true},
+		{path: "a.b.c", want: true, wantOK: true}, // the longest matching key wins
+		{path: "search.missing"},
+		{path: "motd.0"},
+		{path: "search.defaultLimit.x"},
+	}
+	for _, test := range tests {
+		got, ok := lookupSettingsPath(settings, test.path)
+		if ok != test.wantOK || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got (%v, %v), want (%v, %v)", test.path, got, ok, test.want, test.wantOK)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	apirouter "github.com/sourcegraph/sourcegraph/cmd/frontend/internal/httpapi/router"
+	"github.com/sourcegraph/sourcegraph/pkg/env"
+)
+
+var internalHandlerTimeout, _ = time.ParseDuration(env.Get("SRC_INTERNAL_API_TIMEOUT", "5m", "maximum duration of a non-streaming internal API request"))
+
+var streamingHandlerTimeout, _ = time.ParseDuration(env.Get("SRC_INTERNAL_API_STREAM_TIMEOUT", "1h", "maximum duration of a streaming internal API request (such as an archive download)"))
+
+var largestFilesTimeout, _ = time.ParseDuration(env.Get("SRC_GIT_LARGEST_FILES_TIMEOUT", "1m", "maximum duration of a request for the largest files of a repository"))
+
+var archiveChecksumTimeout, _ = time.ParseDuration(env.Get("SRC_GIT_ARCHIVE_CHECKSUM_TIMEOUT", "30m", "maximum duration of a request for the checksum of a repository archive"))
+
+// internalRouteTimeouts overrides internalHandlerTimeout (or
+// streamingHandlerTimeout, for streaming routes) for individual routes. A
+// timeout of 0 disables the timeout.
+var internalRouteTimeouts = map[string]time.Duration{
+	apirouter.GitLargestFiles:    largestFilesTimeout,
+	apirouter.GitArchiveChecksum: archiveChecksumTimeout,
+}
+
+// routeTimeout returns the timeout of the route with the given name.
+func routeTimeout(name string) time.Duration {
+	if d, ok := internalRouteTimeouts[name]; ok {
+		return d
+	}
+	if apirouter.IsStreaming(name) {
+		return streamingHandlerTimeout
+	}
+	return internalHandlerTimeout
+}
+
+// withRouteTimeout is a mux middleware that enforces the timeout of the
+// request's route. Requests for non-streaming routes that take too long are
+// responded to with 503 Service Unavailable. Streaming routes can't be
+// buffered, so their timeout is only applied as a deadline on the request's
+// context, which cuts off the stream. In both cases the request's context is
+// canceled when the timeout is exceeded.
+func withRouteTimeout(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var name string
+		if route := mux.CurrentRoute(r); route != nil {
+			name = route.GetName()
+		}
+		timeout := routeTimeout(name)
+		switch {
+		case timeout <= 0:
+			next.ServeHTTP(w, r)
+		case apirouter.IsStreaming(name):
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		default:
+			http.TimeoutHandler(next, timeout, "request timed out").ServeHTTP(w, r)
+		}
+	})
+}
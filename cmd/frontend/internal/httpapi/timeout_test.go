@@ -0,0 +1,90 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	apirouter "github.com/sourcegraph/sourcegraph/cmd/frontend/internal/httpapi/router"
+)
+
+func TestWithRouteTimeout(t *testing.T) {
+	defer func(orig time.Duration) { internalHandlerTimeout = orig }(internalHandlerTimeout)
+	internalHandlerTimeout = 50 * time.Millisecond
+
+	m := mux.NewRouter()
+	m.Path("/slow-json").Name("slow-json").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+		w.Write([]byte("{}"))
+	})
+	m.Path("/tar").Name(apirouter.GitTar).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Stream for longer than the timeout.
+		for i := 0; i < 5; i++ {
+			w.Write([]byte("chunk"))
+			w.(http.Flusher).Flush()
+			time.Sleep(30 * time.Millisecond)
+		}
+	})
+	m.Use(withRouteTimeout)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/slow-json", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("slow JSON handler: got status %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	rec = httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/tar", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("archive stream: got status %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got, want := rec.Body.String(), strings.Repeat("chunk", 5); got != want {
+		t.Errorf("archive stream: got body %q, want %q", got, want)
+	}
+}
+
+func TestWithRouteTimeout_streamDeadline(t *testing.T) {
+	defer func(orig time.Duration) { streamingHandlerTimeout = orig }(streamingHandlerTimeout)
+	streamingHandlerTimeout = 50 * time.Millisecond
+
+	m := mux.NewRouter()
+	m.Path("/tar").Name(apirouter.GitTar).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("chunk"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-time.After(5 * time.Second):
+			w.Write([]byte("chunk"))
+		case <-r.Context().Done():
+		}
+	})
+	m.Use(withRouteTimeout)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/tar", nil))
+	if !rec.Flushed {
+		t.Error("archive stream was buffered")
+	}
+	if got, want := rec.Body.String(), "chunk"; got != want {
+		t.Errorf("got body %q, want %q", got, want)
+	}
+}
+
+func TestRouteTimeout(t *testing.T) {
+	tests := map[string]time.Duration{
+		apirouter.GitArchiveChecksum: archiveChecksumTimeout,
+		apirouter.GitLargestFiles:    largestFilesTimeout,
+		apirouter.GitTar:             streamingHandlerTimeout,
+		apirouter.GitRefs:            internalHandlerTimeout,
+	}
+	for name, want := range tests {
+		if got := routeTimeout(name); got != want {
+			t.Errorf("%s: got timeout %s, want %s", name, got, want)
+		}
+	}
+}
@@ -81,6 +81,45 @@ func GetByUserID(userID int32) (*types.UserUsageStatistics, error) {
 	return a, nil
 }
 
+var MockGetLastActiveTimes func(userIDs []int32) (map[int32]time.Time, error)
+
+// GetLastActiveTimes returns the times at which the given users were last
+// active, keyed by user ID. Users that were never active are omitted.
+func GetLastActiveTimes(userIDs []int32) (map[int32]time.Time, error) {
+	if MockGetLastActiveTimes != nil {
+		return MockGetLastActiveTimes(userIDs)
+	}
+
+	c := pool.Get()
+	defer c.Close()
+
+	// Pipeline the lookups so that this takes a single round trip.
+	for _, id := range userIDs {
+		if err := c.Send("HGET", keyPrefix+strconv.Itoa(int(id)), fLastActive); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+	lastActive := make(map[int32]time.Time, len(userIDs))
+	for _, id := range userIDs {
+		s, err := redis.String(c.Receive())
+		if err != nil && err != redis.ErrNil {
+			return nil, err
+		}
+		if s == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, err
+		}
+		lastActive[id] = t
+	}
+	return lastActive, nil
+}
+
 // SiteUsageStatisticsOptions contains options for the number of daily, weekly, and monthly periods in
 // which to calculate the number of unique users (i.e., how many days of Daily Active Users, or DAUs,
 // how many weeks of Weekly Active Users, or WAUs, and how many months of Monthly Active Users, or MAUs).
@@ -56,6 +56,26 @@ func TestUserUsageStatistics_LogPageView(t *testing.T) {
 	}
 }
 
+func TestGetLastActiveTimes(t *testing.T) {
+	setupForTest(t)
+
+	if err := LogActivity(true, 1, "test-cookie-id", "PAGEVIEW"); err != nil {
+		t.Fatal(err)
+	}
+
+	lastActive, err := GetLastActiveTimes([]int32{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lastActive) != 1 {
+		t.Fatalf("got %v, want only user 1", lastActive)
+	}
+	diff := lastActive[1].Unix() - time.Now().Unix()
+	if wantMaxDiff := 10; diff > int64(wantMaxDiff) || diff < -int64(wantMaxDiff) {
+		t.Errorf("got %d seconds apart, wanted less than %d seconds apart", diff, wantMaxDiff)
+	}
+}
+
 func TestUserUsageStatistics_LogSearchQuery(t *testing.T) {
 	setupForTest(t)
 
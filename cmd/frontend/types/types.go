@@ -33,6 +33,9 @@ type Repo struct {
 	CreatedAt time.Time
 	// UpdatedAt is when this repository's metadata was last updated on Sourcegraph.
 	UpdatedAt *time.Time
+	// DeletedAt is when this repository was deleted on Sourcegraph, or nil if it
+	// was not. Deleted repositories are only listed if explicitly requested.
+	DeletedAt *time.Time `json:",omitempty"`
 }
 
 // ExternalService is a connection to an external service.
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+
+	"github.com/sourcegraph/sourcegraph/pkg/gitserver/protocol"
+)
+
+// runningClone is a clone that holds the repository lock, either waiting for
+// the clone limiter or running git clone.
+type runningClone struct {
+	cancel context.CancelFunc
+	done   chan struct{} // closed when the clone has finished
+}
+
+// trackClone registers the clone of dir so that cancelClone can cancel it.
+// The clone must use the returned context, and call done once it has finished
+// and released the repository lock.
+func (s *Server) trackClone(ctx context.Context, dir string) (_ context.Context, done func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	c := &runningClone{cancel: cancel, done: make(chan struct{})}
+
+	s.runningClonesMu.Lock()
+	if s.runningClones == nil {
+		s.runningClones = make(map[string]*runningClone)
+	}
+	s.runningClones[dir] = c
+	s.runningClonesMu.Unlock()
+
+	return ctx, func() {
+		s.runningClonesMu.Lock()
+		if s.runningClones[dir] == c {
+			delete(s.runningClones, dir)
+		}
+		s.runningClonesMu.Unlock()
+		cancel()
+		close(c.done)
+	}
+}
+
+// cancelClone cancels the clone of dir, if any, and waits for it to finish.
+// It reports whether there was a clone to cancel.
+func (s *Server) cancelClone(ctx context.Context, dir string) (bool, error) {
+	s.runningClonesMu.Lock()
+	c := s.runningClones[dir]
+	s.runningClonesMu.Unlock()
+	if c == nil {
+		return false, nil
+	}
+
+	c.cancel()
+	select {
+	case <-c.done:
+		return true, nil
+	case <-ctx.Done():
+		return true, ctx.Err()
+	}
+}
+
+// handleCancelClone cancels the queued or in-progress clone of a repository.
+// Canceling a repository that is not being cloned is a no-op.
+func (s *Server) handleCancelClone(w http.ResponseWriter, r *http.Request) {
+	var req protocol.CancelCloneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dir := filepath.Join(s.ReposDir, string(protocol.NormalizeRepo(req.Repo)))
+
+	canceled, err := s.cancelClone(r.Context(), dir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, cloneInProgress := s.locker.Status(dir)
+	resp := protocol.CancelCloneResponse{
+		Canceled:        canceled,
+		CloneInProgress: cloneInProgress,
+		Cloned:          repoCloned(dir),
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
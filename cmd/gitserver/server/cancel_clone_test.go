@@ -0,0 +1,64 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/pkg/gitserver/protocol"
+)
+
+func TestServer_handleCancelClone(t *testing.T) {
+	s := &Server{ReposDir: "/testroot"}
+	h := s.Handler()
+
+	origRepoCloned := repoCloned
+	repoCloned = func(dir string) bool { return false }
+	defer func() { repoCloned = origRepoCloned }()
+
+	cancelClone := func(t *testing.T) (resp protocol.CancelCloneResponse) {
+		rr := httptest.NewRecorder()
+		body, err := json.Marshal(protocol.CancelCloneRequest{Repo: "a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.ServeHTTP(rr, httptest.NewRequest("POST", "/cancel-clone", bytes.NewReader(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("http non-200 status %d", rr.Code)
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	t.Run("not cloning", func(t *testing.T) {
+		if got, want := cancelClone(t), (protocol.CancelCloneResponse{}); got != want {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("cloning", func(t *testing.T) {
+		// Simulate a clone that holds the lock until it is canceled.
+		lock, ok := s.locker.TryAcquire("/testroot/a", "cloning")
+		if !ok {
+			t.Fatal("could not acquire lock")
+		}
+		ctx, done := s.trackClone(context.Background(), "/testroot/a")
+		go func() {
+			<-ctx.Done()
+			lock.Release()
+			done()
+		}()
+
+		if got, want := cancelClone(t), (protocol.CancelCloneResponse{Canceled: true}); got != want {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+		if _, locked := s.locker.Status("/testroot/a"); locked {
+			t.Error("clone still holds the lock after being canceled")
+		}
+	})
+}
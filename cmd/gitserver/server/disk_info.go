@@ -0,0 +1,30 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"syscall"
+
+	"github.com/sourcegraph/sourcegraph/pkg/gitserver/protocol"
+)
+
+// handleDiskInfo reports the free and total space of the file system
+// containing ReposDir, so that callers can avoid filling it up (for example by
+// throttling clones).
+func (s *Server) handleDiskInfo(w http.ResponseWriter, r *http.Request) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(s.ReposDir, &stat); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := protocol.DiskInfoResponse{
+		// Bavail (not Bfree) is what unprivileged processes, such as git
+		// clone, can actually use.
+		FreeBytes:  stat.Bavail * uint64(stat.Bsize),
+		TotalBytes: stat.Blocks * uint64(stat.Bsize),
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
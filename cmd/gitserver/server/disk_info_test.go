@@ -0,0 +1,41 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/pkg/gitserver/protocol"
+)
+
+func TestHandleDiskInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitserver-disk-info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &Server{ReposDir: dir}
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/disk-info", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d (body %q)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var resp protocol.DiskInfoResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.TotalBytes == 0 || resp.FreeBytes > resp.TotalBytes {
+		t.Errorf("got %+v, want 0 <= FreeBytes <= TotalBytes and TotalBytes > 0", resp)
+	}
+
+	s = &Server{ReposDir: dir + "/missing"}
+	rec = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/disk-info", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d for missing ReposDir, want %d", rec.Code, http.StatusInternalServerError)
+	}
+}
@@ -125,6 +125,9 @@ type Server struct {
 
 	locker *RepositoryLocker
 
+	runningClonesMu sync.Mutex               // protects runningClones
+	runningClones   map[string]*runningClone // clones that can be canceled, keyed by repo dir
+
 	// cloneLimiter and cloneableLimiter limits the number of concurrent
 	// clones and ls-remotes respectively. Use s.acquireCloneLimiter() and
 	// s.acquireClonableLimiter() instead of using these directly.
@@ -140,11 +143,21 @@ type locks struct {
 	mu   *sync.Mutex // prevents updates running in parallel
 }
 
+// stripConfigArgs returns args without the leading "-c key=value" config
+// overrides, so that args[0] is the git subcommand.
+func stripConfigArgs(args []string) []string {
+	for len(args) >= 2 && args[0] == "-c" {
+		args = args[2:]
+	}
+	return args
+}
+
 // shortGitCommandTimeout returns the timeout for git commands that should not
 // take a long time. Some commands such as "git archive" are allowed more time
 // than "git rev-parse", so this will return an appropriate timeout given the
 // command.
 func shortGitCommandTimeout(args []string) time.Duration {
+	args = stripConfigArgs(args)
 	if len(args) < 1 {
 		return time.Minute
 	}
@@ -169,6 +182,7 @@ func shortGitCommandTimeout(args []string) time.Duration {
 // slow. Some commands such as "git archive" are inherently slower than "git
 // rev-parse", so this will return an appropriate threshold given the command.
 func shortGitCommandSlow(args []string) time.Duration {
+	args = stripConfigArgs(args)
 	if len(args) < 1 {
 		return time.Second
 	}
@@ -226,9 +240,12 @@ func (s *Server) Handler() http.Handler {
 	mux.HandleFunc("/repo", s.handleDeprecatedRepoInfo) // TODO(slimsag): Remove this after 3.3 is released.
 	mux.HandleFunc("/repos", s.handleRepoInfo)
 	mux.HandleFunc("/delete", s.handleRepoDelete)
+	mux.HandleFunc("/cancel-clone", s.handleCancelClone)
 	mux.HandleFunc("/repo-update", s.handleRepoUpdate)
 	mux.HandleFunc("/getGitolitePhabricatorMetadata", s.handleGetGitolitePhabricatorMetadata)
 	mux.HandleFunc("/create-commit-from-patch", s.handleCreateCommitFromPatch)
+	mux.HandleFunc("/version", s.handleVersion)
+	mux.HandleFunc("/disk-info", s.handleDiskInfo)
 	mux.HandleFunc("/ping", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
@@ -473,8 +490,8 @@ func (s *Server) handleExec(w http.ResponseWriter, r *http.Request) {
 	{
 		repo := repotrackutil.GetTrackedRepo(req.Repo)
 		cmd := ""
-		if len(req.Args) > 0 {
-			cmd = req.Args[0]
+		if args := stripConfigArgs(req.Args); len(args) > 0 {
+			cmd = args[0]
 		}
 		args := strings.Join(req.Args, " ")
 
@@ -785,17 +802,23 @@ func (s *Server) cloneRepo(ctx context.Context, repo api.RepoName, url string, o
 
 	if opts != nil && opts.Block {
 		// We are blocking, so use the passed in context.
+		ctx, done := s.trackClone(ctx, dir)
+		defer done()
 		if err := doClone(ctx); err != nil {
 			return "", errors.Wrapf(err, "failed to clone %s", repo)
 		}
 		return "", nil
 	}
 
+	// Create a new context because the clone runs in a background goroutine.
+	// It is tracked before the goroutine starts, so that the clone can be
+	// canceled as soon as it holds the lock.
+	bgCtx, bgCancel := s.serverContext()
+	bgCtx, done := s.trackClone(bgCtx, dir)
 	go func() {
-		// Create a new context because this is in a background goroutine.
-		ctx, cancel := s.serverContext()
-		defer cancel()
-		if err := doClone(ctx); err != nil {
+		defer bgCancel()
+		defer done()
+		if err := doClone(bgCtx); err != nil {
 			log15.Error("failed to clone repo", "repo", repo, "error", err)
 		}
 	}()
@@ -263,6 +263,15 @@ func BenchmarkQuickRevParseHead_unpacked_refs(b *testing.B) {
 	b.StopTimer()
 }
 
+func TestShortGitCommandTimeout_configArgs(t *testing.T) {
+	if got := shortGitCommandTimeout([]string{"-c", "core.autocrlf=false", "archive", "HEAD"}); got != longGitCommandTimeout {
+		t.Errorf("got %s, want %s", got, longGitCommandTimeout)
+	}
+	if got, want := shortGitCommandSlow([]string{"-c", "core.eol=lf", "-c", "core.autocrlf=true", "archive"}), time.Minute; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
 func TestUrlRedactor(t *testing.T) {
 	testCases := []struct {
 		url      string
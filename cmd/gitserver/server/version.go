@@ -0,0 +1,40 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os/exec"
+
+	"github.com/sourcegraph/sourcegraph/pkg/gitserver/protocol"
+	"github.com/sourcegraph/sourcegraph/pkg/version"
+)
+
+// handleVersion reports the version of the git binary used by gitserver and
+// of gitserver itself, to help correlate git behavior with git versions.
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	gitVersion, err := gitVersion(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := protocol.VersionResponse{
+		GitVersion:       gitVersion,
+		GitserverVersion: version.Version(),
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// gitVersion returns the output of `git version`, such as
+// "git version 2.20.1".
+func gitVersion(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(ctx, "git", "version").Output()
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.TrimSpace(out)), nil
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/pkg/gitserver/protocol"
+	"github.com/sourcegraph/sourcegraph/pkg/version"
+)
+
+func TestHandleVersion(t *testing.T) {
+	version.Mock("1.2.3")
+	defer version.Mock("dev")
+
+	s := &Server{}
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/version", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d (body %q)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var resp protocol.VersionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(resp.GitVersion, "git version ") {
+		t.Errorf("got git version %q, want it to start with %q", resp.GitVersion, "git version ")
+	}
+	if resp.GitserverVersion != "1.2.3" {
+		t.Errorf("got gitserver version %q, want %q", resp.GitserverVersion, "1.2.3")
+	}
+}
@@ -204,6 +204,11 @@ func main() {
 		Store:       store,
 		Syncer:      syncer,
 		InternalAPI: frontendAPI,
+
+		GitserverClient: gitserver.DefaultClient,
+		AutoGitUpdatesDisabled: func() bool {
+			return conf.Get().DisableAutoGitUpdates
+		},
 	}
 
 	var handler http.Handler
@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/sourcegraph/sourcegraph/pkg/api"
 	"github.com/sourcegraph/sourcegraph/pkg/conf"
 	"github.com/sourcegraph/sourcegraph/pkg/conf/reposource"
@@ -76,37 +77,124 @@ func GetGitoliteRepository(ctx context.Context, args protocol.RepoLookupArgs) (r
 	return nil, false, nil // not found
 }
 
+// ErrPhabricatorMetadataSyncRunning is returned by SyncGitolitePhabricatorMetadata when
+// another Phabricator metadata sync is already in progress.
+var ErrPhabricatorMetadataSyncRunning = errors.New("a gitolite/phabricator metadata sync is already running")
+
+type gitoliteHostNotFoundError struct{ host string }
+
+func (e *gitoliteHostNotFoundError) Error() string {
+	return fmt.Sprintf("no Gitolite connection configured for host %q", e.host)
+}
+
+func (e *gitoliteHostNotFoundError) NotFound() bool { return true }
+
+type gitoliteNoPhabricatorError struct{ host string }
+
+func (e *gitoliteNoPhabricatorError) Error() string {
+	return fmt.Sprintf("Gitolite connection for host %q has no Phabricator configured", e.host)
+}
+
+func (e *gitoliteNoPhabricatorError) BadRequest() bool { return true }
+
+// acquirePhabTask marks the gitolite/phabricator task as running. It returns
+// false if it is already running.
+func acquirePhabTask() bool {
+	phabTaskMu.Lock()
+	defer phabTaskMu.Unlock()
+	if phabTaskRunning {
+		return false
+	}
+	phabTaskRunning = true
+	return true
+}
+
+func releasePhabTask() {
+	phabTaskMu.Lock()
+	phabTaskRunning = false
+	phabTaskMu.Unlock()
+}
+
 // tryUpdateGitolitePhabricatorMetadata attempts to update Phabricator metadata for a Gitolite-sourced repository, if it
 // is appropriate to do so.
 func tryUpdateGitolitePhabricatorMetadata(ctx context.Context, gconf *schema.GitoliteConnection, repoNames []api.RepoName) {
 	if gconf.Phabricator == nil {
 		return
 	}
-	phabTaskMu.Lock()
-	if phabTaskRunning {
+	if !acquirePhabTask() {
 		log15.Info("existing gitolite/phabricator repo task still running, skipping")
-		phabTaskMu.Unlock()
 		return
 	}
-	phabTaskRunning = true
-	phabTaskMu.Unlock()
+	defer releasePhabTask()
+	res := updateGitolitePhabricatorMetadata(ctx, gconf, repoNames)
+	for _, e := range res.Errors {
+		log15.Warn("could not update Phabricator metadata for Gitolite repository", "repo", e.Repo, "error", e.Error)
+	}
+	log15.Info("updated gitolite/phabricator metadata for repos", "repos", len(repoNames))
+}
+
+// SyncGitolitePhabricatorMetadata runs the Phabricator metadata command for every
+// repository on the Gitolite host and upserts the resulting Phabricator
+// mappings. It does not create or update the repositories themselves. Failures
+// for individual repositories are collected in the result rather than aborting
+// the sync.
+func SyncGitolitePhabricatorMetadata(ctx context.Context, host string) (*protocol.PhabricatorMetadataSyncResult, error) {
+	config, err := conf.GitoliteConfigs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var gconf *schema.GitoliteConnection
+	for _, c := range config {
+		if c.Host == host {
+			gconf = c
+			break
+		}
+	}
+	if gconf == nil {
+		return nil, &gitoliteHostNotFoundError{host: host}
+	}
+	if gconf.Phabricator == nil {
+		return nil, &gitoliteNoPhabricatorError{host: host}
+	}
+
+	if !acquirePhabTask() {
+		return nil, ErrPhabricatorMetadataSyncRunning
+	}
+	defer releasePhabTask()
+
+	allRepos, err := gitserver.DefaultClient.ListGitolite(ctx, gconf.Host)
+	if err != nil {
+		return nil, err
+	}
+	repos, err := filterBlacklist(gconf, allRepos)
+	if err != nil {
+		return nil, err
+	}
+	return updateGitolitePhabricatorMetadata(ctx, gconf, repoNames(gconf.Prefix, repos)), nil
+}
+
+// updateGitolitePhabricatorMetadata fetches the Phabricator metadata for each
+// repository and ensures a Phabricator mapping exists for those with a
+// callsign. Mappings are upserted one at a time since there is no batch API.
+// The caller must hold the gitolite/phabricator task.
+func updateGitolitePhabricatorMetadata(ctx context.Context, gconf *schema.GitoliteConnection, repoNames []api.RepoName) *protocol.PhabricatorMetadataSyncResult {
+	res := &protocol.PhabricatorMetadataSyncResult{Repos: len(repoNames)}
 	for _, repoName := range repoNames {
 		metadata, err := gitserver.DefaultClient.GetGitolitePhabricatorMetadata(ctx, gconf.Host, repoName)
 		if err != nil {
-			log15.Warn("could not fetch valid Phabricator metadata for Gitolite repository", "repo", repoName, "error", err)
+			res.Errors = append(res.Errors, protocol.PhabricatorMetadataSyncError{Repo: repoName, Error: err.Error()})
 			continue
 		}
 		if metadata.Callsign == "" {
 			continue
 		}
 		if err := api.InternalClient.PhabricatorRepoCreate(ctx, repoName, metadata.Callsign, gconf.Phabricator.Url); err != nil {
-			log15.Warn("could not ensure Gitolite Phabricator mapping", "repo", repoName, "error", err)
+			res.Errors = append(res.Errors, protocol.PhabricatorMetadataSyncError{Repo: repoName, Error: err.Error()})
+			continue
 		}
+		res.Mapped++
 	}
-	phabTaskMu.Lock()
-	phabTaskRunning = false
-	phabTaskMu.Unlock()
-	log15.Info("updated gitolite/phabricator metadata for repos", "repos", len(repoNames))
+	return res
 }
 
 // gitoliteUpdateRepos updates the repos associated with a specific
@@ -32,6 +32,14 @@ type Server struct {
 	InternalAPI interface {
 		ReposUpdateMetadata(ctx context.Context, repo api.RepoName, description string, fork, archived bool) error
 	}
+	// GitserverClient is used to check whether a repository is cloned. If
+	// nil, repositories are assumed not to be cloned.
+	GitserverClient interface {
+		IsRepoCloned(ctx context.Context, repo api.RepoName) (bool, error)
+	}
+	// AutoGitUpdatesDisabled reports whether the DisableAutoGitUpdates site
+	// setting is set. If nil, automatic git updates are enabled.
+	AutoGitUpdatesDisabled func() bool
 }
 
 // Handler returns the http.Handler that should be used to serve requests.
@@ -43,6 +51,7 @@ func (s *Server) Handler() http.Handler {
 	mux.HandleFunc("/enqueue-repo-update", s.handleEnqueueRepoUpdate)
 	mux.HandleFunc("/exclude-repo", s.handleExcludeRepo)
 	mux.HandleFunc("/sync-external-service", s.handleExternalServiceSync)
+	mux.HandleFunc("/sync-phabricator-metadata", s.handlePhabricatorMetadataSync)
 	return mux
 }
 
@@ -262,6 +271,24 @@ func (s *Server) handleEnqueueRepoUpdate(w http.ResponseWriter, r *http.Request)
 	}
 
 	repo := rs[0]
+
+	// With auto git updates disabled, we still clone repositories on demand,
+	// but refuse to update the ones that are already cloned.
+	if s.AutoGitUpdatesDisabled != nil && s.AutoGitUpdatesDisabled() && s.GitserverClient != nil {
+		cloned, err := s.GitserverClient.IsRepoCloned(r.Context(), req.Repo)
+		if err != nil {
+			respond(w, http.StatusInternalServerError, errors.Wrap(err, "gitserver.is-repo-cloned"))
+			return
+		}
+		if cloned {
+			respond(w, http.StatusConflict, &protocol.RepoUpdateError{
+				Error: fmt.Sprintf("automatic git updates are disabled, not updating cloned repo %q", req.Repo),
+				Code:  protocol.RepoUpdateErrorCodeAutoUpdatesDisabled,
+			})
+			return
+		}
+	}
+
 	if req.URL == "" {
 		if urls := repo.CloneURLs(); len(urls) > 0 {
 			req.URL = urls[0]
@@ -294,10 +321,13 @@ func (s *Server) handleExternalServiceSync(w http.ResponseWriter, r *http.Reques
 			continue
 		}
 
-		_, err := s.Syncer.Sync(r.Context(), kind)
+		diff, err := s.Syncer.Sync(r.Context(), kind)
 		switch {
 		case err == nil:
 			log15.Info("server.external-service-sync", "synced", req.ExternalService.Kind)
+			if req.ForceUpdate {
+				forceUpdate(diff.Repos())
+			}
 			_ = json.NewEncoder(w).Encode(&protocol.ExternalServiceSyncResult{
 				ExternalService: req.ExternalService,
 				Error:           err,
@@ -309,6 +339,65 @@ func (s *Server) handleExternalServiceSync(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+// scheduleUpdateOnce is repos.Scheduler.UpdateOnce. It is a variable so that
+// tests can mock it.
+var scheduleUpdateOnce = repos.Scheduler.UpdateOnce
+
+// forceUpdate enqueues a git fetch for each enabled repository in rs,
+// regardless of the disableAutoGitUpdates site config option.
+func forceUpdate(rs repos.Repos) {
+	n := 0
+	for _, r := range rs {
+		if r.IsDeleted() || !r.Enabled {
+			continue
+		}
+		var url string
+		if urls := r.CloneURLs(); len(urls) > 0 {
+			url = urls[0]
+		}
+		scheduleUpdateOnce(r.ID, api.RepoName(r.Name), url)
+		n++
+	}
+	log15.Info("server.external-service-sync", "force-updated", n)
+}
+
+var syncGitolitePhabricatorMetadata = repos.SyncGitolitePhabricatorMetadata
+
+// handlePhabricatorMetadataSync runs the Phabricator metadata command for all
+// repositories on a Gitolite host and upserts the resulting mappings,
+// independently of repository fetches.
+func (s *Server) handlePhabricatorMetadataSync(w http.ResponseWriter, r *http.Request) {
+	var req protocol.PhabricatorMetadataSyncRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respond(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Host == "" {
+		respond(w, http.StatusBadRequest, errors.New("host must be set"))
+		return
+	}
+
+	res, err := syncGitolitePhabricatorMetadata(r.Context(), req.Host)
+	switch {
+	case err == nil:
+	case errcode.IsNotFound(err):
+		respond(w, http.StatusNotFound, err)
+		return
+	case errcode.IsBadRequest(err):
+		respond(w, http.StatusBadRequest, err)
+		return
+	case err == repos.ErrPhabricatorMetadataSyncRunning:
+		respond(w, http.StatusConflict, err)
+		return
+	default:
+		respond(w, http.StatusInternalServerError, errors.Wrap(err, "sync-phabricator-metadata"))
+		return
+	}
+
+	log15.Info("server.sync-phabricator-metadata", "host", req.Host, "repos", res.Repos, "mapped", res.Mapped, "errors", len(res.Errors))
+	respond(w, http.StatusOK, res)
+}
+
 var mockRepoLookup func(protocol.RepoLookupArgs) (*protocol.RepoLookupResult, error)
 
 func (s *Server) repoLookup(ctx context.Context, args protocol.RepoLookupArgs) (result *protocol.RepoLookupResult, err error) {
@@ -18,6 +18,7 @@ import (
 	"github.com/opentracing/opentracing-go"
 	"github.com/sourcegraph/sourcegraph/cmd/repo-updater/repos"
 	"github.com/sourcegraph/sourcegraph/pkg/api"
+	"github.com/sourcegraph/sourcegraph/pkg/errcode"
 	"github.com/sourcegraph/sourcegraph/pkg/extsvc/bitbucketserver"
 	"github.com/sourcegraph/sourcegraph/pkg/extsvc/github"
 	"github.com/sourcegraph/sourcegraph/pkg/extsvc/gitlab"
@@ -581,6 +582,151 @@ func TestServer_EnqueueRepoUpdate(t *testing.T) {
 		})
 	}
 }
+
+type fakeGitserverClient map[api.RepoName]bool
+
+func (c fakeGitserverClient) IsRepoCloned(ctx context.Context, repo api.RepoName) (bool, error) {
+	return c[repo], nil
+}
+
+func TestServer_EnqueueRepoUpdate_autoUpdatesDisabled(t *testing.T) {
+	ctx := context.Background()
+
+	store := new(repos.FakeStore)
+	cloned := &repos.Repo{Name: "github.com/foo/cloned", ExternalRepo: api.ExternalRepoSpec{ID: "cloned", ServiceType: "github", ServiceID: "http://github.com"}}
+	notCloned := &repos.Repo{Name: "github.com/foo/not-cloned", ExternalRepo: api.ExternalRepoSpec{ID: "not-cloned", ServiceType: "github", ServiceID: "http://github.com"}}
+	must(store.UpsertRepos(ctx, cloned, notCloned))
+
+	srv := httptest.NewServer((&Server{
+		Store:                  store,
+		GitserverClient:        fakeGitserverClient{"github.com/foo/cloned": true},
+		AutoGitUpdatesDisabled: func() bool { return true },
+	}).Handler())
+	defer srv.Close()
+	cli := repoupdater.Client{URL: srv.URL}
+
+	_, err := cli.EnqueueRepoUpdate(ctx, gitserver.Repo{Name: "github.com/foo/cloned"})
+	if !repoupdater.IsAutoUpdatesDisabled(err) {
+		t.Errorf("cloned repo: got err %v, want *AutoUpdatesDisabledError", err)
+	}
+
+	res, err := cli.EnqueueRepoUpdate(ctx, gitserver.Repo{Name: "github.com/foo/not-cloned"})
+	if err != nil {
+		t.Fatalf("not cloned repo: unexpected error: %v", err)
+	}
+	if res.Name != "github.com/foo/not-cloned" {
+		t.Errorf("not cloned repo: got response for %q", res.Name)
+	}
+}
+
+func TestServer_SyncExternalService_forceUpdate(t *testing.T) {
+	ctx := context.Background()
+
+	svc := &repos.ExternalService{ID: 1, Kind: "GITHUB"}
+	cloned := &repos.Repo{
+		Name:         "github.com/foo/cloned",
+		Enabled:      true,
+		Metadata:     new(github.Repository),
+		ExternalRepo: api.ExternalRepoSpec{ID: "cloned", ServiceType: "github", ServiceID: "http://github.com"},
+		Sources: map[string]*repos.SourceInfo{
+			svc.URN(): {ID: svc.URN(), CloneURL: "https://github.com/foo/cloned"},
+		},
+	}
+	store := new(repos.FakeStore)
+	must(store.UpsertRepos(ctx, cloned.Clone()))
+
+	var updated []api.RepoName
+	orig := scheduleUpdateOnce
+	defer func() { scheduleUpdateOnce = orig }()
+	scheduleUpdateOnce = func(id uint32, name api.RepoName, url string) {
+		updated = append(updated, name)
+	}
+
+	clock := repos.NewFakeClock(time.Now(), time.Second)
+	srv := httptest.NewServer((&Server{
+		Kinds:                  []string{"GITHUB"},
+		Store:                  store,
+		Syncer:                 repos.NewSyncer(store, repos.NewFakeSourcer(nil, repos.NewFakeSource(svc, nil, cloned.Clone())), nil, clock.Now),
+		GitserverClient:        fakeGitserverClient{"github.com/foo/cloned": true},
+		AutoGitUpdatesDisabled: func() bool { return true },
+	}).Handler())
+	defer srv.Close()
+	cli := repoupdater.Client{URL: srv.URL}
+
+	for _, forceUpdate := range []bool{false, true} {
+		updated = nil
+		if _, err := cli.SyncExternalService(ctx, api.ExternalService{ID: svc.ID, Kind: svc.Kind}, forceUpdate); err != nil {
+			t.Fatalf("forceUpdate=%v: %v", forceUpdate, err)
+		}
+		var want []api.RepoName
+		if forceUpdate {
+			want = []api.RepoName{"github.com/foo/cloned"}
+		}
+		if !reflect.DeepEqual(updated, want) {
+			t.Errorf("forceUpdate=%v: got updates of %v, want %v", forceUpdate, updated, want)
+		}
+	}
+}
+
+func TestServer_PhabricatorMetadataSync(t *testing.T) {
+	orig := syncGitolitePhabricatorMetadata
+	defer func() { syncGitolitePhabricatorMetadata = orig }()
+
+	srv := httptest.NewServer((&Server{}).Handler())
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		name       string
+		host       string
+		err        error
+		wantStatus int
+	}{
+		{name: "ok", host: "git@gitolite.example.com", wantStatus: http.StatusOK},
+		{name: "no host", host: "", wantStatus: http.StatusBadRequest},
+		{name: "unknown host", host: "git@other", err: &errcode.Mock{Message: "not found", IsNotFound: true}, wantStatus: http.StatusNotFound},
+		{name: "running", host: "git@gitolite.example.com", err: repos.ErrPhabricatorMetadataSyncRunning, wantStatus: http.StatusConflict},
+		{name: "failure", host: "git@gitolite.example.com", err: errors.New("boom"), wantStatus: http.StatusInternalServerError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			want := &protocol.PhabricatorMetadataSyncResult{
+				Repos:  2,
+				Mapped: 1,
+				Errors: []protocol.PhabricatorMetadataSyncError{{Repo: "gitolite.example.com/b", Error: "no callsign"}},
+			}
+			syncGitolitePhabricatorMetadata = func(ctx context.Context, host string) (*protocol.PhabricatorMetadataSyncResult, error) {
+				if host != tc.host {
+					t.Errorf("got host %q, want %q", host, tc.host)
+				}
+				if tc.err != nil {
+					return nil, tc.err
+				}
+				return want, nil
+			}
+
+			body, _ := json.Marshal(protocol.PhabricatorMetadataSyncRequest{Host: tc.host})
+			resp, err := http.Post(srv.URL+"/sync-phabricator-metadata", "application/json", bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			var have protocol.PhabricatorMetadataSyncResult
+			if err := json.NewDecoder(resp.Body).Decode(&have); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(&have, want) {
+				t.Errorf("got %+v, want %+v", have, want)
+			}
+		})
+	}
+}
+
 func TestServer_RepoExternalServices(t *testing.T) {
 	service1 := &repos.ExternalService{
 		ID:          1,
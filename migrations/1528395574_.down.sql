@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP INDEX IF EXISTS repo_updated_at_id_idx;
+
+COMMIT;
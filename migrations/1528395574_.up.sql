@@ -0,0 +1,5 @@
+BEGIN;
+
+CREATE INDEX IF NOT EXISTS repo_updated_at_id_idx ON repo (updated_at, id) WHERE deleted_at IS NULL;
+
+COMMIT;
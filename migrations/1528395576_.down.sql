@@ -0,0 +1,6 @@
+BEGIN;
+
+CREATE INDEX IF NOT EXISTS repo_updated_at_id_idx ON repo (updated_at, id) WHERE deleted_at IS NULL;
+DROP INDEX IF EXISTS repo_updated_at_id_all_idx;
+
+COMMIT;
@@ -0,0 +1,12 @@
+BEGIN;
+
+-- Repositories created by Repos.Upsert used to have no updated_at, which
+-- excludes them from incremental syncs (see ReposListOptions.UpdatedAfter).
+UPDATE repo SET updated_at = created_at WHERE updated_at IS NULL;
+
+-- Incremental syncs also return deleted repositories, so that mirrors learn
+-- about deletions. Index them too.
+CREATE INDEX IF NOT EXISTS repo_updated_at_id_all_idx ON repo (updated_at, id);
+DROP INDEX IF EXISTS repo_updated_at_id_idx;
+
+COMMIT;
@@ -210,6 +210,12 @@
 // 1528395572_.up.sql (181B)
 // 1528395573_recent_searches.down.sql (55B)
 // 1528395573_recent_searches.up.sql (142B)
+// 1528395574_.down.sql (62B)
+// 1528395574_.up.sql (118B)
+// 1528395575_.down.sql (49B)
+// 1528395575_.up.sql (194B)
+// 1528395576_.down.sql (167B)
+// 1528395576_.up.sql (473B)
 
 package migrations
 
@@ -4478,6 +4484,126 @@ func _1528395573_recent_searchesUpSql() (*asset, error) {
 	return a, nil
 }
 
+var __1528395574_DownSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x73\x72\x75\xf7\xf4\xb3\xe6\xe2\x72\x09\xf2\x0f\x50\xf0\xf4\x73\x71\x8d\x50\xf0\x74\x53\x70\x8d\xf0\x0c\x0e\x09\x56\x28\x4a\x2d\xc8\x8f\x2f\x2d\x48\x49\x2c\x49\x4d\x89\x4f\x2c\x89\xcf\x4c\x01\xa2\x0a\xa0\x6a\x67\x7f\x5f\x5f\xcf\x10\x6b\x2e\x00\xef\x94\x04\x62\x3e\x00\x00\x00")
+
+func _1528395574_DownSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__1528395574_DownSql,
+		"1528395574_.down.sql",
+	)
+}
+
+func _1528395574_DownSql() (*asset, error) {
+	bytes, err := _1528395574_DownSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "1528395574_.down.sql", size: 0, mode: os.FileMode(0), modTime: time.Unix(0, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0x3f, 0x8e, 0x8d, 0x5a, 0xe5, 0x34, 0xf8, 0x71, 0x90, 0x94, 0xdf, 0x84, 0xe5, 0xae, 0xc2, 0xcb, 0x49, 0xc2, 0x23, 0x44, 0xe4, 0x68, 0x1e, 0xf6, 0x5f, 0x58, 0x7b, 0x8f, 0x5f, 0x12, 0x47, 0xf5}}
+	return a, nil
+}
+
+var __1528395574_UpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x73\x72\x75\xf7\xf4\xb3\xe6\xe2\x72\x0e\x72\x75\x0c\x71\x55\xf0\xf4\x73\x71\x8d\x50\xf0\x74\x53\xf0\xf3\x0f\x51\x70\x8d\xf0\x0c\x0e\x09\x56\x28\x4a\x2d\xc8\x8f\x2f\x2d\x48\x49\x2c\x49\x4d\x89\x4f\x2c\x89\xcf\x4c\x01\xa2\x0a\x05\x7f\x3f\xb0\x8c\x82\x06\x42\x4a\x47\x21\x33\x45\x53\x21\xdc\xc3\x35\xc8\x55\x21\x25\x35\x27\x15\x22\xaa\xe0\x19\xac\xe0\x17\xea\xe3\x03\xb2\xc5\xdf\xd7\xd7\x33\xc4\x9a\x0b\x00\x94\xe8\x9d\x1b\x76\x00\x00\x00")
+
+func _1528395574_UpSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__1528395574_UpSql,
+		"1528395574_.up.sql",
+	)
+}
+
+func _1528395574_UpSql() (*asset, error) {
+	bytes, err := _1528395574_UpSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "1528395574_.up.sql", size: 0, mode: os.FileMode(0), modTime: time.Unix(0, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0x13, 0x5a, 0x75, 0x5a, 0x2f, 0x3a, 0xe4, 0x32, 0xa9, 0x90, 0x8b, 0xf2, 0xd6, 0x27, 0x79, 0x5a, 0x27, 0x97, 0x04, 0x66, 0x29, 0x31, 0xda, 0x7b, 0xd9, 0xa4, 0xc2, 0xbf, 0x16, 0x41, 0x5b, 0x9d}}
+	return a, nil
+}
+
+var __1528395575_DownSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x73\x72\x75\xf7\xf4\xb3\xe6\xe2\x72\x09\xf2\x0f\x50\x08\x71\x74\xf2\x71\x55\xf0\x74\x53\x70\x8d\xf0\x0c\x0e\x09\x56\x28\x4a\x2d\xc8\x8f\xcf\x2e\x2b\x28\x06\x2a\x70\xf6\xf7\xf5\xf5\x0c\xb1\xe6\x02\x00\x4c\x11\x6d\xb5\x31\x00\x00\x00")
+
+func _1528395575_DownSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__1528395575_DownSql,
+		"1528395575_.down.sql",
+	)
+}
+
+func _1528395575_DownSql() (*asset, error) {
+	bytes, err := _1528395575_DownSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "1528395575_.down.sql", size: 0, mode: os.FileMode(0), modTime: time.Unix(0, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0xa0, 0xbf, 0x41, 0x50, 0x3e, 0x4d, 0x7f, 0x67, 0xf7, 0xa7, 0x1f, 0x8a, 0x55, 0x86, 0x2e, 0xd8, 0xe2, 0x65, 0x18, 0xdf, 0x44, 0x13, 0x8a, 0xa1, 0x95, 0x51, 0x9e, 0xff, 0x60, 0xe4, 0x53, 0x58}}
+	return a, nil
+}
+
+var __1528395575_UpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x65\x8e\xc1\x0e\x82\x30\x18\x83\xcf\xec\x29\x7a\x84\x84\x37\xe0\x34\xc6\x8f\x59\x1c\xc3\x6c\x33\x91\x93\x31\x61\x21\x04\xa3\x04\x91\xe8\xdb\x3b\xd1\x78\xf1\xd8\xa6\x5f\xdb\x9c\x36\x52\x67\x8c\x09\x43\xdc\x11\x1c\xcf\x15\x41\x96\xd0\xb5\x03\x1d\xa4\x75\x16\x93\x1f\xaf\xc7\x61\x19\x6f\x88\x59\xb4\x8a\xbe\x45\x7f\x99\x7d\xe7\xa7\x35\xa7\xf7\x4a\xc1\x50\x49\x86\xb4\xa0\x0f\x10\xf7\x6d\x82\x5a\xa3\x20\x45\xa1\x57\x70\x2b\x78\x41\x29\x8b\x06\xff\xc4\xec\x1f\xf3\x8f\x0c\xde\x72\x3a\xdf\xfd\x9f\xbb\x33\xb2\xe2\xa6\xc1\x96\x1a\xc4\xdf\xdd\x14\x81\x4f\x58\xf2\x7e\x5c\x57\x95\x74\x19\x7b\x01\x13\xe5\x1c\xc2\xc2\x00\x00\x00")
+
+func _1528395575_UpSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__1528395575_UpSql,
+		"1528395575_.up.sql",
+	)
+}
+
+func _1528395575_UpSql() (*asset, error) {
+	bytes, err := _1528395575_UpSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "1528395575_.up.sql", size: 0, mode: os.FileMode(0), modTime: time.Unix(0, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0x74, 0x58, 0xe6, 0xfc, 0x02, 0x74, 0x10, 0x16, 0x90, 0xc9, 0x9d, 0x3c, 0x6b, 0x26, 0x10, 0x2f, 0x6d, 0xca, 0xda, 0xb2, 0xf6, 0x2d, 0xe7, 0xe3, 0x24, 0x95, 0xb1, 0xc2, 0xcd, 0xc3, 0xd9, 0x96}}
+	return a, nil
+}
+
+var __1528395576_DownSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x73\x72\x75\xf7\xf4\xb3\xe6\xe2\x72\x0e\x72\x75\x0c\x71\x55\xf0\xf4\x73\x71\x8d\x50\xf0\x74\x53\xf0\xf3\x0f\x51\x70\x8d\xf0\x0c\x0e\x09\x56\x28\x4a\x2d\xc8\x8f\x2f\x2d\x48\x49\x2c\x49\x4d\x89\x4f\x2c\x89\xcf\x4c\x01\xa2\x0a\x05\x7f\x3f\xb0\x8c\x82\x06\x42\x4a\x47\x21\x33\x45\x53\x21\xdc\xc3\x35\xc8\x55\x21\x25\x35\x27\x15\x22\xaa\xe0\x19\xac\xe0\x17\xea\xe3\x63\xcd\xe5\x12\xe4\x1f\x80\xb0\x02\xb7\xf1\x89\x39\x39\x20\x2b\x40\xce\xf2\xf7\xf5\xf5\x0c\xb1\xe6\x02\x00\xd0\xa2\x55\xe5\xa7\x00\x00\x00")
+
+func _1528395576_DownSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__1528395576_DownSql,
+		"1528395576_.down.sql",
+	)
+}
+
+func _1528395576_DownSql() (*asset, error) {
+	bytes, err := _1528395576_DownSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "1528395576_.down.sql", size: 0, mode: os.FileMode(0), modTime: time.Unix(0, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0x7d, 0x92, 0xa4, 0x0a, 0xc3, 0x18, 0x69, 0x2c, 0x89, 0x5a, 0xd0, 0xcf, 0x5a, 0x5a, 0xcf, 0x78, 0x8d, 0x9d, 0xd3, 0x0c, 0x29, 0x77, 0xb8, 0x46, 0x31, 0x6e, 0x28, 0x5e, 0xb4, 0x64, 0xfe, 0x7e}}
+	return a, nil
+}
+
+var __1528395576_UpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x75\x90\x41\x6e\x83\x30\x10\x45\xf7\x9c\x62\x96\x89\x94\xe4\x02\xa8\x8b\x34\x71\x5b\x4b\x04\x22\x20\x6a\x76\xc8\x81\x89\xb0\x64\x6c\x64\x0f\x2d\xb9\x7d\x6d\x50\x15\xa4\xaa\x1b\x8f\x3c\x33\x7e\xff\x7f\xbf\xb2\x77\x9e\xc6\x51\xb4\xdd\x42\x8e\xbd\x71\x92\x8c\x95\xe8\xa0\xb6\x28\x08\x1b\xb8\x3d\xe6\xfe\xee\xd2\x3b\xb4\x04\x83\xf3\x4d\x32\xd0\x8a\x2f\x04\x6d\x60\xe8\x9b\xb0\x57\x09\xda\xc0\x77\x2b\xeb\x36\x90\x70\xac\xd5\xd0\x78\x0a\xb5\xd8\xc1\xdd\x9a\x0e\xa4\xf6\xc4\x0e\x35\x09\x05\xee\xa1\x6b\x07\x2b\x87\x38\xb3\x13\xe9\x28\xeb\x49\x1a\x1d\x64\x26\xde\xfe\x4e\x68\xd7\xbb\xe8\x72\x3e\xee\x4b\x06\xd6\xaf\x41\xc1\xca\x85\x1c\xbc\xfc\x7a\x0c\x97\xcf\x0f\x96\xb3\xe5\x94\x17\x90\x5e\x92\x64\x4e\xc6\xff\x88\x0b\xe5\x8c\xa7\xd2\x60\x35\x34\xa8\x30\x44\xb5\x8b\xfc\x1b\xf0\x73\x6a\x3d\xa8\x93\xd6\x1a\xeb\x40\xa1\xb0\x3a\xc0\xc4\xcd\x0c\x34\x3f\x9a\x1c\x7b\x7a\x83\xe3\x1c\x95\x8c\xd9\x45\x87\x9c\x05\xcf\x3c\x3d\xb2\x2b\xf0\x37\x48\xb3\x12\xd8\x95\x17\x65\x31\x49\x54\x4f\x97\x95\xf4\xa7\x52\xbe\x8c\x90\xa5\x73\xca\xd5\xf2\x47\x65\xb3\x8e\xa3\x63\x9e\x9d\x9f\xb4\xff\x49\x9e\xe2\xe3\x1e\xb2\xd3\x89\x97\x71\xf4\x03\x76\x2a\x5a\xa1\xd9\x01\x00\x00")
+
+func _1528395576_UpSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__1528395576_UpSql,
+		"1528395576_.up.sql",
+	)
+}
+
+func _1528395576_UpSql() (*asset, error) {
+	bytes, err := _1528395576_UpSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "1528395576_.up.sql", size: 0, mode: os.FileMode(0), modTime: time.Unix(0, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0x3d, 0xd8, 0xf7, 0xf2, 0x1a, 0x1c, 0x46, 0x28, 0x5d, 0x9b, 0x1b, 0x13, 0x84, 0x3a, 0x47, 0xb7, 0x46, 0x67, 0xc1, 0xcd, 0x4c, 0xbb, 0x33, 0x43, 0xff, 0x78, 0x52, 0x85, 0x65, 0xf6, 0xb2, 0xab}}
+	return a, nil
+}
+
 // Asset loads and returns the asset for the given name.
 // It returns an error if the asset could not be found or
 // could not be loaded.
@@ -4988,6 +5114,18 @@ var _bindata = map[string]func() (*asset, error){
 	"1528395573_recent_searches.down.sql": _1528395573_recent_searchesDownSql,
 
 	"1528395573_recent_searches.up.sql": _1528395573_recent_searchesUpSql,
+
+	"1528395574_.down.sql": _1528395574_DownSql,
+
+	"1528395574_.up.sql": _1528395574_UpSql,
+
+	"1528395575_.down.sql": _1528395575_DownSql,
+
+	"1528395575_.up.sql": _1528395575_UpSql,
+
+	"1528395576_.down.sql": _1528395576_DownSql,
+
+	"1528395576_.up.sql": _1528395576_UpSql,
 }
 
 // AssetDir returns the file names below a certain
@@ -5241,6 +5379,12 @@ var _bintree = &bintree{nil, map[string]*bintree{
 	"1528395572_.up.sql":                                          {_1528395572_UpSql, map[string]*bintree{}},
 	"1528395573_recent_searches.down.sql":                         {_1528395573_recent_searchesDownSql, map[string]*bintree{}},
 	"1528395573_recent_searches.up.sql":                           {_1528395573_recent_searchesUpSql, map[string]*bintree{}},
+	"1528395574_.down.sql":                                        {_1528395574_DownSql, map[string]*bintree{}},
+	"1528395574_.up.sql":                                          {_1528395574_UpSql, map[string]*bintree{}},
+	"1528395575_.down.sql":                                        {_1528395575_DownSql, map[string]*bintree{}},
+	"1528395575_.up.sql":                                          {_1528395575_UpSql, map[string]*bintree{}},
+	"1528395576_.down.sql":                                        {_1528395576_DownSql, map[string]*bintree{}},
+	"1528395576_.up.sql":                                          {_1528395576_UpSql, map[string]*bintree{}},
 }}
 
 // RestoreAsset restores an asset under the given directory.
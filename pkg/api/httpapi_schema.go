@@ -1,5 +1,17 @@
 package api
 
+import (
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/pkg/txemail/txtypes"
+)
+
+// InternalAPIVersion is the version of the shapes of the internal API's JSON
+// responses. It is sent in the X-API-Version header of every JSON response of
+// the internal API. Bump it whenever a response changes incompatibly, so that
+// clients built against another version fail instead of mis-parsing it.
+const InternalAPIVersion = "1"
+
 // RepoCreateOrUpdateRequest is a request to create or update a repository.
 //
 // The request handler determines if the request refers to an existing repository (and should therefore update
@@ -43,6 +55,785 @@ type ReposUpdateMetadataRequest struct {
 	Archived    bool   `json:"Archived"`
 }
 
+// GitResolveRevisionsRequest is a request to resolve the same
+// revision in each of a list of repositories or, if Specs is set,
+// each of a list of revisions in a single repository (Repo).
+type GitResolveRevisionsRequest struct {
+	Spec  string     `json:"spec"`
+	Repos []RepoName `json:"repos"`
+
+	Repo  RepoName `json:"repo,omitempty"`
+	Specs []string `json:"specs,omitempty"`
+}
+
+// GitResolveRevisionsResult is the result of resolving a revision in
+// a single repository. Exactly one of CommitID and Error is set. Spec
+// is only set in response to a request with Specs.
+type GitResolveRevisionsResult struct {
+	Repo     RepoName `json:"repo"`
+	Spec     string   `json:"spec,omitempty"`
+	CommitID CommitID `json:"commitID,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// GitCommitsRequest is a request for the metadata of several commits in a
+// repository.
+type GitCommitsRequest struct {
+	Repo    RepoName   `json:"repo"`
+	Commits []CommitID `json:"commits"`
+}
+
+// GitCommitsResult is the metadata of a single commit requested in a
+// GitCommitsRequest. If the commit could not be read, only CommitID and Error
+// are set.
+type GitCommitsResult struct {
+	CommitID CommitID   `json:"commitID"`
+	Author   string     `json:"author,omitempty"`
+	Date     time.Time  `json:"date,omitempty"`
+	Subject  string     `json:"subject,omitempty"`
+	Parents  []CommitID `json:"parents,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// GitIsAncestorRequest is a request to check whether Commit is reachable from
+// Ref in Repo.
+type GitIsAncestorRequest struct {
+	Repo   RepoName `json:"repo"`
+	Commit string   `json:"commit"`
+	Ref    string   `json:"ref"`
+}
+
+type GitIsAncestorResponse struct {
+	IsAncestor bool `json:"isAncestor"`
+}
+
+// GitMergeBaseDiffStatRequest is a request for the diffstat of the changes on
+// Branch since its merge base with BaseBranch in Repo. Both may be any
+// revision specifiers.
+type GitMergeBaseDiffStatRequest struct {
+	Repo       RepoName `json:"repo"`
+	Branch     string   `json:"branch"`
+	BaseBranch string   `json:"baseBranch"`
+}
+
+type GitMergeBaseDiffStatResponse struct {
+	MergeBase    CommitID `json:"mergeBase"`
+	FilesChanged int      `json:"filesChanged"`
+	Additions    int      `json:"additions"`
+	Deletions    int      `json:"deletions"`
+}
+
+// GitTagsContainingRequest is a request for the tags in Repo whose history
+// includes Commit (which may be any revision specifier).
+type GitTagsContainingRequest struct {
+	Repo   RepoName `json:"repo"`
+	Commit string   `json:"commit"`
+}
+
+type GitTagsContainingResponse struct {
+	Tags []string `json:"tags"`
+}
+
+// GitBranchesContainingRequest is a request for the branches in Repo whose
+// history includes Commit (which may be any revision specifier).
+type GitBranchesContainingRequest struct {
+	Repo   RepoName `json:"repo"`
+	Commit string   `json:"commit"`
+}
+
+type GitBranchesContainingResponse struct {
+	Branches []string `json:"branches"`
+}
+
+// GitHasSubmodulesRequest is a request to check whether Repo declares any
+// submodules at Commit (which may be any revision specifier).
+type GitHasSubmodulesRequest struct {
+	Repo   RepoName `json:"repo"`
+	Commit string   `json:"commit"`
+}
+
+type GitHasSubmodulesResponse struct {
+	HasSubmodules bool     `json:"hasSubmodules"`
+	Paths         []string `json:"paths"` // paths of the submodules, sorted
+}
+
+// GitSubmodulesRequest is a request for the submodules declared in Repo at
+// Commit (which may be any revision specifier).
+type GitSubmodulesRequest struct {
+	Repo   RepoName `json:"repo"`
+	Commit string   `json:"commit"`
+}
+
+// GitSubmodule is a submodule declared in a repository's .gitmodules file.
+type GitSubmodule struct {
+	Path         string   `json:"path"`
+	URL          string   `json:"url"`
+	ResolvedRepo RepoName `json:"resolvedRepo"` // empty if the URL does not refer to a known repository
+}
+
+// GitPathExistsRequest is a request to check whether Path exists in Repo at
+// Commit (which may be any revision specifier).
+type GitPathExistsRequest struct {
+	Repo   RepoName `json:"repo"`
+	Commit string   `json:"commit"`
+	Path   string   `json:"path"`
+}
+
+type GitPathExistsResponse struct {
+	Exists bool `json:"exists"`
+	IsDir  bool `json:"isDir"`
+}
+
+// GitFileTypeRequest is a request to detect whether the file at Path in Repo
+// at Commit (which may be any revision specifier) is binary.
+type GitFileTypeRequest struct {
+	Repo   RepoName `json:"repo"`
+	Commit string   `json:"commit"`
+	Path   string   `json:"path"`
+}
+
+type GitFileTypeResponse struct {
+	IsBinary bool   `json:"isBinary"`
+	MIMEType string `json:"mimeType"`
+	Size     int64  `json:"size"`
+}
+
+// GitFileSymbolsRequest is a request for the top-level symbols of the file at
+// Path in Repo at Commit (which may be any revision specifier).
+type GitFileSymbolsRequest struct {
+	Repo   RepoName `json:"repo"`
+	Commit string   `json:"commit"`
+	Path   string   `json:"path"`
+}
+
+// GitFileSymbol is a top-level symbol (such as a function or class) defined
+// in a file.
+type GitFileSymbol struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"` // the ctags kind, such as "function"
+	Line int    `json:"line"` // 1-based
+}
+
+// GitTreeRecursiveRequest is a request for all tree entries under Path
+// (recursively) in Repo at Commit (which may be any revision specifier). An
+// empty Path means the repository root.
+type GitTreeRecursiveRequest struct {
+	Repo   RepoName `json:"repo"`
+	Commit string   `json:"commit"`
+	Path   string   `json:"path"`
+}
+
+// GitTreeEntry is an entry of a git tree.
+type GitTreeEntry struct {
+	Path string `json:"path"` // full path from the repository root
+	Mode string `json:"mode"` // octal git file mode, such as "100644"
+	Type string `json:"type"` // "blob", "tree" or "commit" (for submodules)
+	Size int64  `json:"size"` // size of blobs in bytes; -1 for other types
+	SHA  string `json:"sha"`
+}
+
+// GitLargestFilesRequest is a request for the TopN largest files in Repo at
+// Commit (which may be any revision specifier). If TopN is 0, the 10 largest
+// files are returned.
+type GitLargestFilesRequest struct {
+	Repo   RepoName `json:"repo"`
+	Commit string   `json:"commit"`
+	TopN   int      `json:"topN,omitempty"`
+}
+
+// GitLargestFile is a file returned in response to a GitLargestFilesRequest.
+type GitLargestFile struct {
+	Path string `json:"path"` // full path from the repository root
+	Size int64  `json:"size"` // in bytes
+	SHA  string `json:"sha"`  // blob ID
+}
+
+// GitVersionResponse describes the versions of git and gitserver running on
+// each gitserver shard. GitVersion and GitserverVersion are only set if all
+// shards that could be reached agree on them.
+type GitVersionResponse struct {
+	GitVersion       string             `json:"gitVersion,omitempty"`
+	GitserverVersion string             `json:"gitserverVersion,omitempty"`
+	Shards           []GitserverVersion `json:"shards"`
+}
+
+// GitserverVersion describes the versions of git and gitserver running on a
+// single gitserver shard. If the shard could not be reached, only Addr and
+// Error are set.
+type GitserverVersion struct {
+	Addr             string `json:"addr"`
+	GitVersion       string `json:"gitVersion,omitempty"` // such as "git version 2.20.1"
+	GitserverVersion string `json:"gitserverVersion,omitempty"`
+	Error            string `json:"error,omitempty"`
+}
+
+// GitserverDiskInfoResponse describes the disk space of each gitserver shard.
+// FreeBytes, TotalBytes and PercentUsed are totals over the shards that could
+// be reached.
+type GitserverDiskInfoResponse struct {
+	FreeBytes   uint64              `json:"freeBytes"`
+	TotalBytes  uint64              `json:"totalBytes"`
+	PercentUsed float64             `json:"percentUsed"`
+	Shards      []GitserverDiskInfo `json:"shards"`
+}
+
+// GitserverDiskInfo describes the disk space of a single gitserver shard. If
+// the shard could not be reached, only Addr and Error are set.
+type GitserverDiskInfo struct {
+	Addr        string  `json:"addr"`
+	FreeBytes   uint64  `json:"freeBytes"`
+	TotalBytes  uint64  `json:"totalBytes"`
+	PercentUsed float64 `json:"percentUsed"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// GitRefsRequest is a request to list the refs of a repository.
+type GitRefsRequest struct {
+	Repo RepoName `json:"repo"`
+
+	// Types, if non-empty, restricts the list to refs of these types ("branch",
+	// "tag" or "other").
+	Types []string `json:"types,omitempty"`
+
+	// Limit, if positive, is the maximum number of refs returned, starting at
+	// Offset.
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+type GitRefsResponse struct {
+	Refs       []GitRef `json:"refs"`
+	TotalCount int      `json:"totalCount"` // number of matching refs, ignoring Limit and Offset
+}
+
+type GitRef struct {
+	Name     string   `json:"name"` // full name, such as "refs/heads/master"
+	CommitID CommitID `json:"commitID"`
+	Type     string   `json:"type"` // "branch", "tag" or "other"
+}
+
+type GitObjectTypeRequest struct {
+	Repo RepoName `json:"repo"`
+	SHA  string   `json:"sha"` // full or abbreviated
+}
+
+type GitObjectTypeResponse struct {
+	Type string `json:"type"` // "commit", "tree", "blob" or "tag"
+}
+
+// GitBlobRequest is a request for the contents of the blob with the given SHA
+// in Repo.
+type GitBlobRequest struct {
+	Repo RepoName `json:"repo"`
+	SHA  string   `json:"sha"` // full or abbreviated
+}
+
+// GitLogStreamRequest is a request to stream all commits reachable from Ref
+// (HEAD if empty).
+type GitLogStreamRequest struct {
+	Repo RepoName `json:"repo"`
+	Ref  string   `json:"ref"`
+}
+
+// GitDiffRequest is a request for the unified diff of the changes from Base
+// to Head (both may be any revision specifiers) in Repo. If Base is empty,
+// Head is diffed against its first parent. If Path is set, only the changes
+// to that file or directory are included.
+type GitDiffRequest struct {
+	Repo RepoName `json:"repo"`
+	Base string   `json:"base,omitempty"`
+	Head string   `json:"head"`
+	Path string   `json:"path,omitempty"`
+}
+
+// GitDiffTreesRequest is a request for the unified diff between two
+// tree-ishes in Repo (such as branches, tags, commit IDs or tree IDs), which
+// need not be related. If Path is set, only the changes to that file or
+// directory are included.
+type GitDiffTreesRequest struct {
+	Repo  RepoName `json:"repo"`
+	TreeA string   `json:"treeA"`
+	TreeB string   `json:"treeB"`
+	Path  string   `json:"path,omitempty"`
+}
+
+// GitLogEntry is a commit streamed in response to a GitLogStreamRequest.
+type GitLogEntry struct {
+	CommitID    CommitID   `json:"commitID"`
+	Parents     []CommitID `json:"parents"`
+	AuthorName  string     `json:"authorName"`
+	AuthorEmail string     `json:"authorEmail"`
+	AuthorDate  time.Time  `json:"authorDate"`
+	Subject     string     `json:"subject"` // first line of the commit message
+}
+
+// GitCommitsBetweenRequest is a request for a page of the commits in
+// Base..Head in Repo (both may be any revision specifiers), i.e. the commits
+// reachable from Head but not from Base. If Base is not an ancestor of Head,
+// these are the commits on Head since the two diverged. Cursor is the
+// NextCursor of the previous page, or empty for the first page. If Limit is 0,
+// pages have 100 commits.
+type GitCommitsBetweenRequest struct {
+	Repo   RepoName `json:"repo"`
+	Base   string   `json:"base"`
+	Head   string   `json:"head"`
+	Limit  int      `json:"limit,omitempty"`
+	Cursor CommitID `json:"cursor,omitempty"`
+}
+
+// GitCommitsBetweenResponse is a page of commits, newest first, in response
+// to a GitCommitsBetweenRequest. Base and Head are the resolved commit IDs,
+// which should be passed in the requests for the later pages. NextCursor is
+// empty on the last page.
+type GitCommitsBetweenResponse struct {
+	Base       CommitID      `json:"base"`
+	Head       CommitID      `json:"head"`
+	Commits    []GitLogEntry `json:"commits"`
+	NextCursor CommitID      `json:"nextCursor,omitempty"`
+}
+
+// GitArchiveChecksumRequest is a request for the checksum of the archive of
+// Repo at Commit (which may be any revision specifier).
+type GitArchiveChecksumRequest struct {
+	Repo   RepoName `json:"repo"`
+	Commit string   `json:"commit"`
+	Format string   `json:"format"` // "tar" (the default) or "zip"
+}
+
+type GitArchiveChecksumResponse struct {
+	CommitID CommitID `json:"commitID"` // the commit that Commit resolved to
+	SHA256   string   `json:"sha256"`   // hex-encoded
+	Size     int64    `json:"size"`     // in bytes
+}
+
+// ReposHasLanguageRequest is a request to check whether a repository contains
+// code in a language at a commit.
+type ReposHasLanguageRequest struct {
+	Repo     RepoName `json:"repo"`
+	CommitID CommitID `json:"commitID"`
+	Language string   `json:"language"`
+}
+
+type ReposInventoryRequest struct {
+	Repo     RepoName `json:"repo"`
+	CommitID CommitID `json:"commitID"`
+}
+
+// ReposInventoryByPathRequest is a request for the inventory of the subtree at
+// Path (a directory) in Repo at CommitID. An empty Path refers to the whole
+// repository.
+type ReposInventoryByPathRequest struct {
+	Repo     RepoName `json:"repo"`
+	CommitID CommitID `json:"commitID"`
+	Path     string   `json:"path"`
+}
+
+// ReposInventoryUncachedRequest is a request to compute the inventory of Repo
+// at CommitID without using the cache. If listing the files takes longer than
+// TimeoutSeconds or finds more than MaxFiles files, the inventory of the files
+// listed so far is returned and marked as truncated. If a limit is 0, the
+// server's default is used.
+type ReposInventoryUncachedRequest struct {
+	Repo           RepoName `json:"repo"`
+	CommitID       CommitID `json:"commitID"`
+	TimeoutSeconds int      `json:"timeoutSeconds,omitempty"`
+	MaxFiles       int      `json:"maxFiles,omitempty"`
+}
+
+// ReposInventoryWarmRequest identifies a repository commit whose inventory
+// should be computed and cached.
+type ReposInventoryWarmRequest struct {
+	Repo     RepoName `json:"repo"`
+	CommitID CommitID `json:"commitID"`
+}
+
+// ReposInventoryWarmResult is the outcome of warming the inventory cache for
+// a ReposInventoryWarmRequest.
+type ReposInventoryWarmResult struct {
+	Repo     RepoName `json:"repo"`
+	CommitID CommitID `json:"commitID"`
+	Cached   bool     `json:"cached,omitempty"` // whether the inventory was already cached (and so skipped)
+	Error    string   `json:"error,omitempty"`
+}
+
+// ReposListByExternalServiceRequest is a request to list the repositories
+// residing on any of the given external service instances.
+type ReposListByExternalServiceRequest struct {
+	ServiceIDs []string `json:"serviceIDs"` // see ExternalRepoSpec.ServiceID
+
+	// Limit, if positive, is the maximum number of repositories returned,
+	// starting at Offset.
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+type ReposListByExternalServiceResponse struct {
+	Repos      []*Repo `json:"repos"`
+	TotalCount int     `json:"totalCount"` // number of matching repositories, ignoring Limit and Offset
+}
+
+// ReposListForOrgRequest is a request to list the repositories associated
+// with an organization.
+type ReposListForOrgRequest struct {
+	OrgID int32 `json:"orgID"`
+
+	// Limit, if positive, is the maximum number of repositories returned,
+	// starting at Offset.
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+type ReposListForOrgResponse struct {
+	Repos      []*Repo `json:"repos"`
+	TotalCount int     `json:"totalCount"` // number of matching repositories, ignoring Limit and Offset
+}
+
+// ReposRecentlyUpdatedRequest is a request for the enabled repositories whose
+// metadata was most recently updated. Limit defaults to 10 and is capped at
+// 1000.
+type ReposRecentlyUpdatedRequest struct {
+	Limit int `json:"limit"`
+}
+
+type RecentlyUpdatedRepo struct {
+	Name      RepoName  `json:"name"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// ReposNeedingCloneRequest is a request to check which enabled repositories
+// are not cloned on gitserver. Limit and Offset page through the enabled
+// repositories (all of them if Limit is not positive).
+type ReposNeedingCloneRequest struct {
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+type ReposNeedingCloneResponse struct {
+	Repos      []RepoName               `json:"repos"`      // repositories in the page that are not cloned
+	Errors     []ReposNeedingCloneError `json:"errors"`     // repositories in the page that could not be checked
+	TotalCount int                      `json:"totalCount"` // number of enabled repositories, ignoring Limit and Offset
+}
+
+// ReposCloneStatusSummary is the number of enabled repositories in each clone
+// state on gitserver.
+type ReposCloneStatusSummary struct {
+	NotCloned int `json:"notCloned"`
+	Cloning   int `json:"cloning"`
+	Cloned    int `json:"cloned"`
+	Errored   int `json:"errored"` // repositories whose status could not be determined
+}
+
+type ReposNeedingCloneError struct {
+	Repo  RepoName `json:"repo"`
+	Error string   `json:"error"`
+}
+
+type ReposExistsRequest struct {
+	Repo RepoName `json:"repo"`
+}
+
+type ReposExistsResponse struct {
+	Exists bool `json:"exists"`
+}
+
+// ReposStatusRequest is a request for the status of Repo.
+type ReposStatusRequest struct {
+	Repo RepoName `json:"repo"`
+}
+
+// ReposStatusResponse describes whether a repository exists, is enabled and
+// is cloned. Fields after Exists are only set if the repository exists.
+type ReposStatusResponse struct {
+	Exists        bool      `json:"exists"`
+	Enabled       bool      `json:"enabled"`
+	Cloned        bool      `json:"cloned"`
+	Cloning       bool      `json:"cloning"`
+	DefaultBranch *string   `json:"defaultBranch"` // nil if not cloned, empty or HEAD is detached
+	HeadCommit    *CommitID `json:"headCommit"`    // nil if not cloned or empty
+}
+
+// ReposDefaultBranchesRequest is a request for the default branches of Repos.
+type ReposDefaultBranchesRequest struct {
+	Repos []RepoName `json:"repos"`
+}
+
+// DefaultBranchStatus describes the outcome of resolving the default branch
+// of a repository in a ReposDefaultBranchesRequest.
+type DefaultBranchStatus string
+
+const (
+	DefaultBranchStatusOK        DefaultBranchStatus = "ok"
+	DefaultBranchStatusCloning   DefaultBranchStatus = "cloning"
+	DefaultBranchStatusNotCloned DefaultBranchStatus = "not-cloned"
+	DefaultBranchStatusEmpty     DefaultBranchStatus = "empty" // cloned, but has no commits
+	DefaultBranchStatusError     DefaultBranchStatus = "error" // see Error
+)
+
+// RepoDefaultBranch is the default branch of a repository and the commit it
+// points to, as returned in response to a ReposDefaultBranchesRequest. They
+// are only set if Status is DefaultBranchStatusOK, and DefaultBranch is empty
+// if HEAD is detached.
+type RepoDefaultBranch struct {
+	Repo          RepoName            `json:"repo"`
+	Status        DefaultBranchStatus `json:"status"`
+	DefaultBranch string              `json:"defaultBranch,omitempty"`
+	CommitID      CommitID            `json:"commitID,omitempty"`
+	Error         string              `json:"error,omitempty"`
+}
+
+// ReposPermsStatusRequest is a request for the permissions status of Repo.
+type ReposPermsStatusRequest struct {
+	Repo RepoName `json:"repo"`
+}
+
+// ReposPermsStatusBatchRequest is a request for the permissions status of
+// each of Repos.
+type ReposPermsStatusBatchRequest struct {
+	Repos []RepoName `json:"repos"`
+}
+
+// RepoPermsStatus describes where the permissions of a repository come from.
+// Authz providers fetch permissions from the code host on demand and cache
+// them per user, so there is no record of when a repository's permissions
+// were last synced or of how many users can read it.
+type RepoPermsStatus struct {
+	Repo RepoName `json:"repo"`
+
+	// Tracked is whether the repository's permissions are enforced by an authz
+	// provider, identified by ServiceType and ServiceID.
+	Tracked     bool   `json:"tracked"`
+	ServiceType string `json:"serviceType,omitempty"`
+	ServiceID   string `json:"serviceID,omitempty"`
+
+	// Unrestricted is whether all users can read the repository. It is never
+	// set for tracked repositories.
+	Unrestricted bool `json:"unrestricted"`
+
+	Reason string `json:"reason"`          // human-readable explanation of the above
+	Error  string `json:"error,omitempty"` // the repository could not be looked up
+}
+
+// ReposCancelCloneRequest is a request to cancel the queued or in-progress
+// clone of Repo.
+type ReposCancelCloneRequest struct {
+	Repo RepoName `json:"repo"`
+}
+
+// ReposCancelCloneResponse describes the clone state of a repository after a
+// ReposCancelCloneRequest. Canceled is false if the repository was not being
+// cloned, in which case nothing was done.
+type ReposCancelCloneResponse struct {
+	Canceled bool `json:"canceled"`
+	Cloning  bool `json:"cloning"`
+	Cloned   bool `json:"cloned"`
+}
+
+// ReposValidateNameRequest is a request to check whether Repo is a valid name
+// for a new repository.
+type ReposValidateNameRequest struct {
+	Repo RepoName `json:"repo"`
+}
+
+type ReposValidateNameResponse struct {
+	Valid  bool   `json:"valid"`
+	Reason string `json:"reason,omitempty"` // why the name is invalid (if !Valid)
+}
+
+type ReposTouchRequest struct {
+	RepoID RepoID `json:"repoID"`
+}
+
+type ReposTouchResponse struct {
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// ReposDeleteByFilterRequest is a request to delete all repositories matching
+// a filter. At least one of ExternalServiceID and NameGlob must be set; if
+// both are, repositories must match both.
+//
+// Unless DryRun is set, ConfirmationToken must be the token returned by a dry
+// run with the same filter, which guards against accidental mass deletion.
+type ReposDeleteByFilterRequest struct {
+	ExternalServiceID string `json:"externalServiceID"` // see ExternalRepoSpec.ServiceID
+	NameGlob          string `json:"nameGlob"`          // such as "github.example.com/*"
+	DryRun            bool   `json:"dryRun"`
+	ConfirmationToken string `json:"confirmationToken"`
+}
+
+type ReposDeleteByFilterResponse struct {
+	Count             int    `json:"count"`                       // number of matching (or deleted) repositories
+	ConfirmationToken string `json:"confirmationToken,omitempty"` // only set for dry runs
+}
+
+// ReposGetMetadataRequest is a request for the key-value metadata of a
+// repository. If Key is empty, all of the repository's metadata is returned.
+type ReposGetMetadataRequest struct {
+	RepoID RepoID `json:"repoID"`
+	Key    string `json:"key"`
+}
+
+// ReposSetMetadataRequest is a request to set a key-value metadata pair of a
+// repository. An empty Value deletes the key.
+type ReposSetMetadataRequest struct {
+	RepoID RepoID `json:"repoID"`
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+}
+
+type ReposGitserverShardRequest struct {
+	Repo RepoName `json:"repo"`
+}
+
+type ReposGitserverShardResponse struct {
+	ShardAddr string `json:"shardAddr"` // address of the gitserver storing the repo
+}
+
+type ReposHasLanguageResponse struct {
+	Present bool  `json:"present"`
+	Bytes   int64 `json:"bytes"` // total size of files in the language
+}
+
+type EmailVerificationRequiredResponse struct {
+	Required bool `json:"required"`
+}
+
+// EmailConfig describes the site's email configuration as relevant to
+// clients.
+type EmailConfig struct {
+	CanSend              bool `json:"canSend"`              // whether the site can send emails
+	VerificationRequired bool `json:"verificationRequired"` // whether users must verify their email address
+}
+
+// SendEmailBatchRequest is a request to send the same message to each of
+// Recipients individually. The To field of Message is ignored.
+type SendEmailBatchRequest struct {
+	Message    txtypes.Message `json:"message"`
+	Recipients []string        `json:"recipients"`
+}
+
+// SendEmailBatchResult is the result of sending the message of a
+// SendEmailBatchRequest to a single recipient.
+type SendEmailBatchResult struct {
+	Recipient string `json:"recipient"`
+	Sent      bool   `json:"sent"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ExtensionsWarmRequest is a request to fetch and cache the manifests of the
+// given extensions.
+type ExtensionsWarmRequest struct {
+	ExtensionIDs []string `json:"extensionIDs"`
+}
+
+// ExtensionsWarmResult is the outcome of warming the cache for a single
+// extension of an ExtensionsWarmRequest.
+type ExtensionsWarmResult struct {
+	ExtensionID string `json:"extensionID"`
+	Error       string `json:"error,omitempty"`
+}
+
+// ExtensionResponse is the manifest of an extension in the local or remote
+// registry. Manifest is nil if the extension has no published releases.
+type ExtensionResponse struct {
+	ExtensionID string  `json:"extensionID"`
+	IsLocal     bool    `json:"isLocal"` // whether the extension is in the local registry
+	Manifest    *string `json:"manifest"`
+}
+
+// ExtensionsListItem describes an extension in the local or remote registry
+// and the state of its manifest.
+type ExtensionsListItem struct {
+	ExtensionID string `json:"extensionID"`
+	IsLocal     bool   `json:"isLocal"`     // whether the extension is in the local registry
+	HasManifest bool   `json:"hasManifest"` // whether the extension has a manifest that parses
+	Version     string `json:"version,omitempty"`
+}
+
+// SearchLimits are the limits that apply to the searches of a settings
+// subject, after applying its settings cascade.
+type SearchLimits struct {
+	MaxResults        int `json:"maxResults"`        // results returned by a query without count:
+	TimeoutSeconds    int `json:"timeoutSeconds"`    // timeout of a query without timeout: or count:
+	MaxTimeoutSeconds int `json:"maxTimeoutSeconds"` // maximum timeout of any query
+	ContextLines      int `json:"contextLines"`      // lines of context around each match (search.contextLines)
+}
+
+type ReposLanguageStatsRequest struct {
+	EnabledOnly bool `json:"enabledOnly"` // only count enabled repositories
+}
+
+// SavedQueriesReconcileRequest is a request to delete the stored information
+// of saved queries that no longer exist in any settings.
+type SavedQueriesReconcileRequest struct {
+	// DryRun, if true, reports the orphaned queries without deleting them.
+	DryRun bool `json:"dryRun"`
+}
+
+// SavedQueriesReconcileResult is the result of a SavedQueriesReconcileRequest.
+type SavedQueriesReconcileResult struct {
+	// Removed are the queries whose information was (or, for a dry run, would
+	// be) deleted.
+	Removed []string `json:"removed"`
+	Count   int      `json:"count"`
+}
+
+// SavedQueriesHealthRequest is a request for the execution health of saved
+// queries. If Limit is 0, all queries from Offset on are returned. Thresholds
+// that are 0 take their default values (1 minute for SlowThresholdSeconds, 6
+// hours for StaleAfterSeconds).
+type SavedQueriesHealthRequest struct {
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+
+	// SlowThresholdSeconds is the execution duration above which a query is
+	// reported as slow.
+	SlowThresholdSeconds int `json:"slowThresholdSeconds"`
+
+	// StaleAfterSeconds is how long after its last execution a query is
+	// reported as stale.
+	StaleAfterSeconds int `json:"staleAfterSeconds"`
+}
+
+// SavedQueriesHealthResponse is the response to a SavedQueriesHealthRequest.
+// TotalCount is the number of saved queries regardless of pagination.
+type SavedQueriesHealthResponse struct {
+	Queries    []SavedQueryHealth `json:"queries"`
+	TotalCount int                `json:"totalCount"`
+}
+
+// SavedQueryHealth describes when a saved query was last executed by the
+// query runner and how long it took. LastExecuted and LatestResult are nil if
+// the query was never executed, in which case it is stale.
+type SavedQueryHealth struct {
+	Spec         SavedQueryIDSpec `json:"spec"`
+	Query        string           `json:"query"`
+	LastExecuted *time.Time       `json:"lastExecuted"`
+	LatestResult *time.Time       `json:"latestResult"`
+	ExecDuration time.Duration    `json:"execDuration"`
+	Slow         bool             `json:"slow"`
+	Stale        bool             `json:"stale"`
+}
+
+// SettingsUpdateRequest is a request to create new settings for a subject if
+// its latest settings have not changed since the caller last read them.
+type SettingsUpdateRequest struct {
+	Subject SettingsSubject `json:"subject"`
+
+	// LastKnownVersion is the ID of the subject's settings that the new
+	// contents are based on, or nil if the subject had no settings.
+	LastKnownVersion *int32 `json:"lastKnownVersion"`
+
+	AuthorUserID *int32 `json:"authorUserID"`
+	Contents     string `json:"contents"`
+}
+
+// SettingsUpdateResponse is the response to a SettingsUpdateRequest. Version
+// is the ID of the newly created settings or, if the request conflicted, of
+// the subject's current settings.
+type SettingsUpdateResponse struct {
+	Version int32 `json:"version"`
+}
+
 type PhabricatorRepoCreateRequest struct {
 	RepoName `json:"repo"`
 	Callsign string `json:"callsign"`
@@ -59,3 +850,24 @@ type ExternalServicesListRequest struct {
 	Kind  string   `json:"kind"`
 	Kinds []string `json:"kinds"`
 }
+
+// OrgsIsAdminRequest is a request to check whether a user is a member and an
+// admin of an org.
+type OrgsIsAdminRequest struct {
+	OrgID  int32 `json:"orgID"`
+	UserID int32 `json:"userID"`
+}
+
+type OrgsIsAdminResponse struct {
+	IsMember bool `json:"isMember"`
+	IsAdmin  bool `json:"isAdmin"`
+}
+
+// UserSummary is a user's username, primary email address and last active
+// time, as returned by the users/summary endpoint.
+type UserSummary struct {
+	UserID       int32      `json:"userID"`
+	Username     string     `json:"username"`
+	PrimaryEmail string     `json:"primaryEmail"`           // empty if the user has no email addresses
+	LastActiveAt *time.Time `json:"lastActiveAt,omitempty"` // nil if the user was never active
+}
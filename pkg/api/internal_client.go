@@ -5,8 +5,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/sourcegraph/sourcegraph/pkg/conf/conftypes"
@@ -136,13 +138,29 @@ type SavedQueryInfo struct {
 }
 
 // SavedQueriesGetInfo gets the info from the DB for the given saved query. nil
-// is returned if there is no existing info for the saved query.
+// is returned if there is no existing info for the saved query (the endpoint
+// responds with 404 Not Found in that case).
 func (c *internalClient) SavedQueriesGetInfo(ctx context.Context, query string) (*SavedQueryInfo, error) {
-	var result *SavedQueryInfo
-	err := c.postInternal(ctx, "saved-queries/get-info", query, &result)
+	data, err := json.Marshal(query)
 	if err != nil {
 		return nil, err
 	}
+	resp, err := ctxhttp.Post(ctx, nil, c.URL+"/.internal/saved-queries/get-info", "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err := checkAPIResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var result *SavedQueryInfo
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
 	return result, nil
 }
 
@@ -155,6 +173,41 @@ func (c *internalClient) SavedQueriesDeleteInfo(ctx context.Context, query strin
 	return c.postInternal(ctx, "saved-queries/delete-info", query, nil)
 }
 
+// SavedQueriesDeleteInfoBatch deletes the info in the DB for all of the given
+// queries and returns the number of deleted entries. Queries without info in
+// the DB are ignored.
+func (c *internalClient) SavedQueriesDeleteInfoBatch(ctx context.Context, queries []string) (int, error) {
+	var deleted int
+	err := c.postInternal(ctx, "saved-queries/delete-info-batch", queries, &deleted)
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// SavedQueriesReconcile deletes the stored information of saved queries that
+// are no longer present in any settings. If dryRun is true, nothing is
+// deleted.
+func (c *internalClient) SavedQueriesReconcile(ctx context.Context, dryRun bool) (*SavedQueriesReconcileResult, error) {
+	var result SavedQueriesReconcileResult
+	err := c.postInternal(ctx, "saved-queries/reconcile", &SavedQueriesReconcileRequest{DryRun: dryRun}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SavedQueriesHealth reports when each saved query was last executed and how
+// long it took, flagging slow and stale queries.
+func (c *internalClient) SavedQueriesHealth(ctx context.Context, req *SavedQueriesHealthRequest) (*SavedQueriesHealthResponse, error) {
+	var result SavedQueriesHealthResponse
+	err := c.postInternal(ctx, "saved-queries/health", req, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
 func (c *internalClient) SettingsGetForSubject(ctx context.Context, subject SettingsSubject) (parsed *schema.Settings, settings *Settings, err error) {
 	err = c.postInternal(ctx, "settings/get-for-subject", subject, &settings)
 	if err == nil {
@@ -163,6 +216,91 @@ func (c *internalClient) SettingsGetForSubject(ctx context.Context, subject Sett
 	return parsed, settings, err
 }
 
+// SettingsGetPathForSubject returns the value at path (such as
+// "search.defaultLimit") in the subject's latest settings. nil is returned if
+// the settings have no value at path.
+func (c *internalClient) SettingsGetPathForSubject(ctx context.Context, subject SettingsSubject, path string) (json.RawMessage, error) {
+	data, err := json.Marshal(subject)
+	if err != nil {
+		return nil, err
+	}
+	u := c.URL + "/.internal/settings/get-for-subject?" + url.Values{"path": {path}}.Encode()
+	resp, err := ctxhttp.Post(ctx, nil, u, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err := checkAPIResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var value json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// SettingsConflictError is returned by SettingsUpdate when the subject's
+// settings were changed since the caller's last known version.
+type SettingsConflictError struct {
+	CurrentVersion int32
+}
+
+func (e *SettingsConflictError) Error() string {
+	return fmt.Sprintf("settings were modified concurrently (current version %d)", e.CurrentVersion)
+}
+
+// SettingsUpdate creates new settings for req.Subject if its latest settings
+// are still req.LastKnownVersion, and returns the new version. If they are not,
+// a *SettingsConflictError is returned.
+func (c *internalClient) SettingsUpdate(ctx context.Context, req SettingsUpdateRequest) (version int32, err error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := ctxhttp.Post(ctx, nil, c.URL+"/.internal/settings/update", "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		if err := checkAPIResponse(resp); err != nil {
+			return 0, err
+		}
+	}
+
+	var result SettingsUpdateResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, err
+	}
+	if resp.StatusCode == http.StatusConflict {
+		return 0, &SettingsConflictError{CurrentVersion: result.Version}
+	}
+	return result.Version, nil
+}
+
+// SettingsExistBatch reports which of subjects have any settings. The result
+// is keyed by the subjects' String representations.
+func (c *internalClient) SettingsExistBatch(ctx context.Context, subjects []SettingsSubject) (map[string]bool, error) {
+	var exist map[string]bool
+	err := c.postInternal(ctx, "settings/exist-batch", subjects, &exist)
+	return exist, err
+}
+
+// SearchLimits returns the search limits that apply to subject, after
+// applying its settings cascade.
+func (c *internalClient) SearchLimits(ctx context.Context, subject SettingsSubject) (*SearchLimits, error) {
+	var limits SearchLimits
+	if err := c.postInternal(ctx, "search/limits", subject, &limits); err != nil {
+		return nil, err
+	}
+	return &limits, nil
+}
+
 var MockOrgsListUsers func(orgID int32) (users []int32, err error)
 
 func (c *internalClient) OrgsListUsers(ctx context.Context, orgID int32) (users []int32, err error) {
@@ -184,6 +322,16 @@ func (c *internalClient) OrgsGetByName(ctx context.Context, orgName string) (org
 	return orgID, nil
 }
 
+// OrgsIsAdmin reports whether the user is a member and an admin of the org.
+// Non-members are reported as neither.
+func (c *internalClient) OrgsIsAdmin(ctx context.Context, orgID, userID int32) (*OrgsIsAdminResponse, error) {
+	var resp OrgsIsAdminResponse
+	if err := c.postInternal(ctx, "orgs/is-admin", &OrgsIsAdminRequest{OrgID: orgID, UserID: userID}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 func (c *internalClient) UsersGetByUsername(ctx context.Context, username string) (user *int32, err error) {
 	err = c.postInternal(ctx, "users/get-by-username", username, &user)
 	if err != nil {
@@ -192,6 +340,16 @@ func (c *internalClient) UsersGetByUsername(ctx context.Context, username string
 	return user, nil
 }
 
+// UsersSummary returns the username, primary email and last active time of
+// each of the given users. Users that don't exist are omitted.
+func (c *internalClient) UsersSummary(ctx context.Context, userIDs []int32) ([]UserSummary, error) {
+	var resp []UserSummary
+	if err := c.postInternal(ctx, "users/summary", userIDs, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
 func (c *internalClient) UserEmailsGetEmail(ctx context.Context, userID int32) (email *string, err error) {
 	err = c.postInternal(ctx, "user-emails/get-email", userID, &email)
 	if err != nil {
@@ -223,6 +381,23 @@ func (c *internalClient) GitServerAddrs(ctx context.Context) ([]string, error) {
 	return gitServerAddrs, nil
 }
 
+// EmailVerificationRequired reports whether the site requires users to verify
+// their email address.
+func (c *internalClient) EmailVerificationRequired(ctx context.Context) (bool, error) {
+	var resp EmailVerificationRequiredResponse
+	err := c.postInternal(ctx, "email-verification-required", nil, &resp)
+	return resp.Required, err
+}
+
+// EmailConfig returns the site's email configuration.
+func (c *internalClient) EmailConfig(ctx context.Context) (*EmailConfig, error) {
+	var config EmailConfig
+	if err := c.postInternal(ctx, "email-config", nil, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
 // TODO(slimsag): needs cleanup as part of upcoming configuration refactor.
 func (c *internalClient) CanSendEmail(ctx context.Context) (canSendEmail bool, err error) {
 	err = c.postInternal(ctx, "can-send-email", nil, &canSendEmail)
@@ -237,6 +412,53 @@ func (c *internalClient) SendEmail(ctx context.Context, message txtypes.Message)
 	return c.postInternal(ctx, "send-email", &message, nil)
 }
 
+// SendEmailBatch sends message to each of the recipients individually and
+// reports the outcome for each of them. The To field of message is ignored.
+func (c *internalClient) SendEmailBatch(ctx context.Context, message txtypes.Message, recipients []string) ([]SendEmailBatchResult, error) {
+	var results []SendEmailBatchResult
+	err := c.postInternal(ctx, "send-email-batch", &SendEmailBatchRequest{Message: message, Recipients: recipients}, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// ExtensionsWarm fetches and caches the manifests of the given extensions and
+// reports the outcome for each of them.
+func (c *internalClient) ExtensionsWarm(ctx context.Context, extensionIDs []string) ([]ExtensionsWarmResult, error) {
+	var results []ExtensionsWarmResult
+	err := c.postInternal(ctx, "extensions/warm", &ExtensionsWarmRequest{ExtensionIDs: extensionIDs}, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Extension returns the manifest of the extension with the given ID. If
+// refresh is true, the manifest of a remote extension is fetched again
+// instead of being served from the cache, and the cache is updated.
+func (c *internalClient) Extension(ctx context.Context, extensionID string, refresh bool) (*ExtensionResponse, error) {
+	route := "extension"
+	if refresh {
+		route += "?refresh=true"
+	}
+	var resp ExtensionResponse
+	if err := c.postInternal(ctx, route, extensionID, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ExtensionsList lists the extensions in the local and remote registries
+// along with the state of their manifests.
+func (c *internalClient) ExtensionsList(ctx context.Context) ([]ExtensionsListItem, error) {
+	var items []ExtensionsListItem
+	if err := c.postInternal(ctx, "extensions/list", nil, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 func (c *internalClient) ReposCreateIfNotExists(ctx context.Context, op RepoCreateOrUpdateRequest) (*Repo, error) {
 	var repo Repo
 	err := c.postInternal(ctx, "repos/create-if-not-exists", op, &repo)
@@ -253,6 +475,474 @@ func (c *internalClient) ReposListEnabled(ctx context.Context) ([]RepoName, erro
 	return names, err
 }
 
+// GitResolveRevisions resolves spec in each of repos. A repository in
+// which spec cannot be resolved has its Error field set in the results.
+func (c *internalClient) GitResolveRevisions(ctx context.Context, spec string, repos []RepoName) ([]GitResolveRevisionsResult, error) {
+	var results []GitResolveRevisionsResult
+	err := c.postInternal(ctx, "git/resolve-revisions", &GitResolveRevisionsRequest{Spec: spec, Repos: repos}, &results)
+	return results, err
+}
+
+// GitResolveSpecs resolves each of specs in repo, with results in the same
+// order. A spec that cannot be resolved has its Error field set in the
+// results.
+func (c *internalClient) GitResolveSpecs(ctx context.Context, repo RepoName, specs []string) ([]GitResolveRevisionsResult, error) {
+	var results []GitResolveRevisionsResult
+	err := c.postInternal(ctx, "git/resolve-revisions", &GitResolveRevisionsRequest{Repo: repo, Specs: specs}, &results)
+	return results, err
+}
+
+// GitVersion returns the versions of git and gitserver running on each
+// gitserver shard.
+func (c *internalClient) GitVersion(ctx context.Context) (*GitVersionResponse, error) {
+	resp, err := ctxhttp.Get(ctx, nil, c.URL+"/.internal/git/version")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkAPIResponse(resp); err != nil {
+		return nil, err
+	}
+	var v GitVersionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// GitserverDiskInfo returns the free and total disk space of each gitserver
+// shard.
+func (c *internalClient) GitserverDiskInfo(ctx context.Context) (*GitserverDiskInfoResponse, error) {
+	resp, err := ctxhttp.Get(ctx, nil, c.URL+"/.internal/gitserver/disk-info")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkAPIResponse(resp); err != nil {
+		return nil, err
+	}
+	var info GitserverDiskInfoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GitCommits returns the metadata of the given commits in repo, in the same
+// order. A commit that cannot be read has its Error field set in the results.
+func (c *internalClient) GitCommits(ctx context.Context, repo RepoName, commits []CommitID) ([]GitCommitsResult, error) {
+	var results []GitCommitsResult
+	err := c.postInternal(ctx, "git/commits", &GitCommitsRequest{Repo: repo, Commits: commits}, &results)
+	return results, err
+}
+
+// GitIsAncestor reports whether commit is reachable from ref in repo.
+func (c *internalClient) GitIsAncestor(ctx context.Context, repo RepoName, commit, ref string) (bool, error) {
+	var resp GitIsAncestorResponse
+	err := c.postInternal(ctx, "git/is-ancestor", &GitIsAncestorRequest{Repo: repo, Commit: commit, Ref: ref}, &resp)
+	return resp.IsAncestor, err
+}
+
+// GitTagsContaining returns the names of the tags in repo whose history
+// includes commit.
+func (c *internalClient) GitTagsContaining(ctx context.Context, repo RepoName, commit string) ([]string, error) {
+	var resp GitTagsContainingResponse
+	err := c.postInternal(ctx, "git/tags-containing", &GitTagsContainingRequest{Repo: repo, Commit: commit}, &resp)
+	return resp.Tags, err
+}
+
+// GitBranchesContaining returns the names of the branches in repo whose
+// history includes commit.
+func (c *internalClient) GitBranchesContaining(ctx context.Context, repo RepoName, commit string) ([]string, error) {
+	var resp GitBranchesContainingResponse
+	err := c.postInternal(ctx, "git/branches-containing", &GitBranchesContainingRequest{Repo: repo, Commit: commit}, &resp)
+	return resp.Branches, err
+}
+
+// GitPathExists reports whether path exists in repo at commit, and whether it
+// is a directory.
+func (c *internalClient) GitPathExists(ctx context.Context, repo RepoName, commit, path string) (*GitPathExistsResponse, error) {
+	var resp GitPathExistsResponse
+	if err := c.postInternal(ctx, "git/path-exists", &GitPathExistsRequest{Repo: repo, Commit: commit, Path: path}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GitFileType reports whether the file at path in repo at commit is binary,
+// along with its MIME type and size, without fetching its full contents.
+func (c *internalClient) GitFileType(ctx context.Context, repo RepoName, commit, path string) (*GitFileTypeResponse, error) {
+	var resp GitFileTypeResponse
+	if err := c.postInternal(ctx, "git/file-type", &GitFileTypeRequest{Repo: repo, Commit: commit, Path: path}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GitMergeBaseDiffStat returns the diffstat of the changes on branch since its
+// merge base with baseBranch.
+func (c *internalClient) GitMergeBaseDiffStat(ctx context.Context, repo RepoName, branch, baseBranch string) (*GitMergeBaseDiffStatResponse, error) {
+	var resp GitMergeBaseDiffStatResponse
+	if err := c.postInternal(ctx, "git/merge-base-diffstat", &GitMergeBaseDiffStatRequest{Repo: repo, Branch: branch, BaseBranch: baseBranch}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GitHasSubmodules reports whether repo declares any submodules at commit, and
+// returns their paths.
+func (c *internalClient) GitHasSubmodules(ctx context.Context, repo RepoName, commit string) (*GitHasSubmodulesResponse, error) {
+	var resp GitHasSubmodulesResponse
+	if err := c.postInternal(ctx, "git/has-submodules", &GitHasSubmodulesRequest{Repo: repo, Commit: commit}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GitSubmodules returns the submodules declared in repo at commit, with each
+// submodule's URL resolved to the name of a known repository where possible.
+func (c *internalClient) GitSubmodules(ctx context.Context, repo RepoName, commit string) ([]GitSubmodule, error) {
+	var resp []GitSubmodule
+	if err := c.postInternal(ctx, "git/submodules", &GitSubmodulesRequest{Repo: repo, Commit: commit}, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// ReposExists reports whether a repository with the given name exists. Unlike
+// ReposGetByName, it never causes the repository to be looked up on its code
+// host.
+func (c *internalClient) ReposExists(ctx context.Context, repo RepoName) (bool, error) {
+	var resp ReposExistsResponse
+	err := c.postInternal(ctx, "repos/exists", &ReposExistsRequest{Repo: repo}, &resp)
+	return resp.Exists, err
+}
+
+// ReposStatus returns whether repo exists, is enabled and is cloned, and its
+// default branch. Like ReposExists, it never causes the repository to be
+// looked up on its code host.
+func (c *internalClient) ReposStatus(ctx context.Context, repo RepoName) (*ReposStatusResponse, error) {
+	var resp ReposStatusResponse
+	if err := c.postInternal(ctx, "repos/status", &ReposStatusRequest{Repo: repo}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ReposDefaultBranches returns the default branch and its commit for each of
+// repos, in the same order. Repositories that cannot be resolved (e.g.
+// because they are not cloned yet) are reported in their entry's Status
+// rather than as an error.
+func (c *internalClient) ReposDefaultBranches(ctx context.Context, repos []RepoName) ([]RepoDefaultBranch, error) {
+	var resp []RepoDefaultBranch
+	err := c.postInternal(ctx, "repos/default-branches", &ReposDefaultBranchesRequest{Repos: repos}, &resp)
+	return resp, err
+}
+
+// ReposPermsStatus returns where the permissions of repo come from, i.e.
+// which authz provider (if any) enforces them.
+func (c *internalClient) ReposPermsStatus(ctx context.Context, repo RepoName) (*RepoPermsStatus, error) {
+	var resp RepoPermsStatus
+	if err := c.postInternal(ctx, "repos/perms-status", &ReposPermsStatusRequest{Repo: repo}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ReposPermsStatusBatch is like ReposPermsStatus for each of repos, in the
+// same order. Repositories that do not exist are reported in their entry's
+// Error rather than as an error.
+func (c *internalClient) ReposPermsStatusBatch(ctx context.Context, repos []RepoName) ([]RepoPermsStatus, error) {
+	var resp []RepoPermsStatus
+	err := c.postInternal(ctx, "repos/perms-status-batch", &ReposPermsStatusBatchRequest{Repos: repos}, &resp)
+	return resp, err
+}
+
+// ReposCancelClone cancels the queued or in-progress clone of repo and
+// returns its resulting clone state. It is a no-op if repo is not being
+// cloned.
+func (c *internalClient) ReposCancelClone(ctx context.Context, repo RepoName) (*ReposCancelCloneResponse, error) {
+	var resp ReposCancelCloneResponse
+	if err := c.postInternal(ctx, "repos/cancel-clone", &ReposCancelCloneRequest{Repo: repo}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ReposValidateName checks whether repo is a valid name for a new repository,
+// without looking it up. If it is not, the returned reason describes why.
+func (c *internalClient) ReposValidateName(ctx context.Context, repo RepoName) (valid bool, reason string, err error) {
+	var resp ReposValidateNameResponse
+	err = c.postInternal(ctx, "repos/validate-name", &ReposValidateNameRequest{Repo: repo}, &resp)
+	return resp.Valid, resp.Reason, err
+}
+
+// ReposTouch bumps the updated_at time of the repository and returns the new
+// time.
+func (c *internalClient) ReposTouch(ctx context.Context, repo RepoID) (time.Time, error) {
+	var resp ReposTouchResponse
+	err := c.postInternal(ctx, "repos/touch", &ReposTouchRequest{RepoID: repo}, &resp)
+	return resp.UpdatedAt, err
+}
+
+// ReposDeleteByFilter deletes all repositories matching the filter of req, or
+// only counts them if req.DryRun is set. See ReposDeleteByFilterRequest.
+func (c *internalClient) ReposDeleteByFilter(ctx context.Context, req ReposDeleteByFilterRequest) (*ReposDeleteByFilterResponse, error) {
+	var resp ReposDeleteByFilterResponse
+	if err := c.postInternal(ctx, "repos/delete-by-filter", &req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ReposGetMetadata returns the key-value metadata of the repository. If key
+// is non-empty, only the value for that key (if any) is returned.
+func (c *internalClient) ReposGetMetadata(ctx context.Context, repo RepoID, key string) (map[string]string, error) {
+	var kvps map[string]string
+	err := c.postInternal(ctx, "repos/get-metadata", &ReposGetMetadataRequest{RepoID: repo, Key: key}, &kvps)
+	return kvps, err
+}
+
+// ReposSetMetadata sets the value of key in the metadata of the repository.
+// An empty value deletes the key.
+func (c *internalClient) ReposSetMetadata(ctx context.Context, repo RepoID, key, value string) error {
+	return c.postInternal(ctx, "repos/set-metadata", &ReposSetMetadataRequest{RepoID: repo, Key: key, Value: value}, nil)
+}
+
+// ReposGitserverShard returns the address of the gitserver that stores repo.
+func (c *internalClient) ReposGitserverShard(ctx context.Context, repo RepoName) (string, error) {
+	var resp ReposGitserverShardResponse
+	err := c.postInternal(ctx, "repos/gitserver-shard", &ReposGitserverShardRequest{Repo: repo}, &resp)
+	return resp.ShardAddr, err
+}
+
+// ReposGitserverShards returns the addresses of the gitservers that store
+// each of repos.
+func (c *internalClient) ReposGitserverShards(ctx context.Context, repos []RepoName) (map[RepoName]string, error) {
+	var shards map[RepoName]string
+	err := c.postInternal(ctx, "repos/gitserver-shards", repos, &shards)
+	return shards, err
+}
+
+// GitFileSymbols returns the top-level symbols of the file at path in repo at
+// the given revision. Files in unsupported languages have no symbols.
+func (c *internalClient) GitFileSymbols(ctx context.Context, repo RepoName, commit, path string) ([]GitFileSymbol, error) {
+	var symbols []GitFileSymbol
+	err := c.postInternal(ctx, "git/file-symbols", &GitFileSymbolsRequest{Repo: repo, Commit: commit, Path: path}, &symbols)
+	return symbols, err
+}
+
+// GitTreeRecursive calls fn for each entry under path (recursively) in repo at
+// the given revision. An empty path means the repository root. The entries are
+// streamed, so fn is called before the whole tree has been received.
+func (c *internalClient) GitTreeRecursive(ctx context.Context, repo RepoName, commit, path string, fn func(GitTreeEntry) error) error {
+	resp, err := c.postInternalStream(ctx, "git/tree-recursive", &GitTreeRecursiveRequest{Repo: repo, Commit: commit, Path: path})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var entry GitTreeEntry
+		if err := dec.Decode(&entry); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+}
+
+// GitLargestFiles returns the topN largest files in repo at the given
+// revision, largest first. If topN is 0, the 10 largest files are returned.
+func (c *internalClient) GitLargestFiles(ctx context.Context, repo RepoName, commit string, topN int) ([]GitLargestFile, error) {
+	var files []GitLargestFile
+	err := c.postInternal(ctx, "git/largest-files", &GitLargestFilesRequest{Repo: repo, Commit: commit, TopN: topN}, &files)
+	return files, err
+}
+
+// GitCommitsBetween returns a page of the commits in base..head in repo,
+// newest first. To get the next page, pass the resolved Base, Head and the
+// NextCursor of the response; NextCursor is empty on the last page.
+func (c *internalClient) GitCommitsBetween(ctx context.Context, req *GitCommitsBetweenRequest) (*GitCommitsBetweenResponse, error) {
+	var resp GitCommitsBetweenResponse
+	if err := c.postInternal(ctx, "git/commits-between", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GitLogStream calls fn for each commit reachable from ref (HEAD if empty) in
+// repo, newest first. The commits are streamed, so fn is called before the
+// whole history has been received.
+func (c *internalClient) GitLogStream(ctx context.Context, repo RepoName, ref string, fn func(GitLogEntry) error) error {
+	resp, err := c.postInternalStream(ctx, "git/log-stream", &GitLogStreamRequest{Repo: repo, Ref: ref})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var entry GitLogEntry
+		if err := dec.Decode(&entry); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+}
+
+// GitDiff returns the unified diff of the changes from base to head in repo,
+// optionally limited to path. If base is empty, head is diffed against its
+// first parent. The diff is streamed; the caller must close the returned
+// reader.
+func (c *internalClient) GitDiff(ctx context.Context, repo RepoName, base, head, path string) (io.ReadCloser, error) {
+	resp, err := c.postInternalStream(ctx, "git/diff", &GitDiffRequest{Repo: repo, Base: base, Head: head, Path: path})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// GitDiffTrees returns the unified diff between the tree-ishes treeA and treeB
+// in repo, optionally limited to path. The diff is streamed; the caller must
+// close the returned reader.
+func (c *internalClient) GitDiffTrees(ctx context.Context, repo RepoName, treeA, treeB, path string) (io.ReadCloser, error) {
+	resp, err := c.postInternalStream(ctx, "git/diff-trees", &GitDiffTreesRequest{Repo: repo, TreeA: treeA, TreeB: treeB, Path: path})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// ReposHasLanguage reports whether repo contains files in language at commitID.
+func (c *internalClient) ReposHasLanguage(ctx context.Context, repo RepoName, commitID CommitID, language string) (*ReposHasLanguageResponse, error) {
+	var resp ReposHasLanguageResponse
+	err := c.postInternal(ctx, "repos/has-language", &ReposHasLanguageRequest{Repo: repo, CommitID: commitID, Language: language}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ReposInventoryWarm computes and caches the inventories of the given
+// repository commits, skipping those that are already cached.
+func (c *internalClient) ReposInventoryWarm(ctx context.Context, reqs []ReposInventoryWarmRequest) ([]ReposInventoryWarmResult, error) {
+	var results []ReposInventoryWarmResult
+	err := c.postInternal(ctx, "repos/inventory-warm", reqs, &results)
+	return results, err
+}
+
+// ReposGetByExternalReposBatch resolves specs to repository IDs. The result
+// is keyed by the specs' String representations and omits specs that match no
+// repository.
+func (c *internalClient) ReposGetByExternalReposBatch(ctx context.Context, specs []ExternalRepoSpec) (map[string]RepoID, error) {
+	var ids map[string]RepoID
+	err := c.postInternal(ctx, "repos/get-by-external-repos-batch", specs, &ids)
+	return ids, err
+}
+
+// ReposListByExternalService lists the repositories residing on any of the
+// given external service instances.
+func (c *internalClient) ReposListByExternalService(ctx context.Context, req ReposListByExternalServiceRequest) (*ReposListByExternalServiceResponse, error) {
+	var resp ReposListByExternalServiceResponse
+	if err := c.postInternal(ctx, "repos/list-by-external-service", &req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ReposListForOrg lists the repositories associated with an organization.
+// Sites that do not associate repositories with organizations respond with
+// a "not_supported" error.
+func (c *internalClient) ReposListForOrg(ctx context.Context, req ReposListForOrgRequest) (*ReposListForOrgResponse, error) {
+	var resp ReposListForOrgResponse
+	if err := c.postInternal(ctx, "repos/list-for-org", &req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GitArchiveChecksum returns the checksum and size of the archive of a
+// repository at a commit.
+func (c *internalClient) GitArchiveChecksum(ctx context.Context, req GitArchiveChecksumRequest) (*GitArchiveChecksumResponse, error) {
+	var resp GitArchiveChecksumResponse
+	if err := c.postInternal(ctx, "git/archive-checksum", &req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ReposRecentlyUpdated returns up to limit enabled repositories whose
+// metadata was most recently updated, most recent first.
+func (c *internalClient) ReposRecentlyUpdated(ctx context.Context, limit int) ([]RecentlyUpdatedRepo, error) {
+	var repos []RecentlyUpdatedRepo
+	err := c.postInternal(ctx, "repos/recently-updated", &ReposRecentlyUpdatedRequest{Limit: limit}, &repos)
+	return repos, err
+}
+
+// ReposNeedingClone returns the enabled repositories in a page of them that
+// are not cloned on gitserver.
+func (c *internalClient) ReposNeedingClone(ctx context.Context, req ReposNeedingCloneRequest) (*ReposNeedingCloneResponse, error) {
+	var resp ReposNeedingCloneResponse
+	if err := c.postInternal(ctx, "repos/needing-clone", &req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ReposCloneStatusSummary returns the number of enabled repositories in each
+// clone state. The summary may be up to a minute old.
+func (c *internalClient) ReposCloneStatusSummary(ctx context.Context) (*ReposCloneStatusSummary, error) {
+	var resp ReposCloneStatusSummary
+	if err := c.postInternal(ctx, "repos/clone-status-summary", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GitRefs lists the refs of a repository.
+func (c *internalClient) GitRefs(ctx context.Context, req GitRefsRequest) (*GitRefsResponse, error) {
+	var resp GitRefsResponse
+	if err := c.postInternal(ctx, "git/refs", &req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GitObjectType returns the type ("commit", "tree", "blob" or "tag") of the
+// object with the given SHA in the repository.
+func (c *internalClient) GitObjectType(ctx context.Context, repo RepoName, sha string) (string, error) {
+	var resp GitObjectTypeResponse
+	err := c.postInternal(ctx, "git/object-type", &GitObjectTypeRequest{Repo: repo, SHA: sha}, &resp)
+	return resp.Type, err
+}
+
+// GitBlob returns the contents of the blob with the given SHA in the
+// repository. The contents are streamed; the caller must close the returned
+// reader.
+func (c *internalClient) GitBlob(ctx context.Context, repo RepoName, sha string) (io.ReadCloser, error) {
+	resp, err := c.postInternalStream(ctx, "git/blob", &GitBlobRequest{Repo: repo, SHA: sha})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// ReposLanguageStats returns the number of repositories per primary language.
+func (c *internalClient) ReposLanguageStats(ctx context.Context, enabledOnly bool) (map[string]int, error) {
+	var stats map[string]int
+	err := c.postInternal(ctx, "repos/language-stats", &ReposLanguageStatsRequest{EnabledOnly: enabledOnly}, &stats)
+	return stats, err
+}
+
 // MockInternalClientConfiguration mocks (*internalClient).Configuration.
 var MockInternalClientConfiguration func() (conftypes.RawUnified, error)
 
@@ -342,11 +1032,43 @@ func (c *internalClient) post(ctx context.Context, route string, reqBody, respBo
 	}
 
 	if respBody != nil {
+		if err := checkAPIVersion(resp); err != nil {
+			return err
+		}
 		return json.NewDecoder(resp.Body).Decode(respBody)
 	}
 	return nil
 }
 
+// postInternalStream is like postInternal, but returns the response instead of
+// decoding its body. The caller must close the response body.
+func (c *internalClient) postInternalStream(ctx context.Context, route string, reqBody interface{}) (*http.Response, error) {
+	data, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ctxhttp.Post(ctx, nil, c.URL+"/.internal/"+route, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAPIResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// checkAPIVersion returns an error if resp is a JSON response of a different
+// version of the internal API than the one this client was built against.
+// Responses without a version (e.g., from a frontend that predates
+// versioning) are accepted.
+func checkAPIVersion(resp *http.Response) error {
+	if v := resp.Header.Get("X-API-Version"); v != "" && v != InternalAPIVersion {
+		return fmt.Errorf("internal API response version %s is incompatible with client version %s (%s)", v, InternalAPIVersion, resp.Request.URL)
+	}
+	return nil
+}
+
 func checkAPIResponse(resp *http.Response) error {
 	if 200 > resp.StatusCode || resp.StatusCode > 299 {
 		buf := new(bytes.Buffer)
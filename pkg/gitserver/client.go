@@ -126,6 +126,12 @@ type Client struct {
 	UserAgent string
 }
 
+// AddrForRepo returns the address of the gitserver that the given repo is
+// (or would be) stored on.
+func (c *Client) AddrForRepo(ctx context.Context, repo api.RepoName) string {
+	return c.addrForRepo(ctx, repo)
+}
+
 // addrForRepo returns the gitserver address to use for the given repo name.
 func (c *Client) addrForRepo(ctx context.Context, repo api.RepoName) string {
 	repo = protocol.NormalizeRepo(repo) // in case the caller didn't already normalize it
@@ -370,6 +376,43 @@ func (c *Client) ping(ctx context.Context, addr string) error {
 	return nil
 }
 
+// Version returns the versions of git and gitserver running on the gitserver
+// at addr.
+func (c *Client) Version(ctx context.Context, addr string) (*protocol.VersionResponse, error) {
+	resp, err := ctxhttp.Get(ctx, c.HTTPClient, "http://"+addr+"/version")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 200))
+		return nil, fmt.Errorf("version: bad HTTP response status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	var v protocol.VersionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// DiskInfo returns the free and total disk space of the gitserver at addr.
+func (c *Client) DiskInfo(ctx context.Context, addr string) (*protocol.DiskInfoResponse, error) {
+	resp, err := ctxhttp.Get(ctx, c.HTTPClient, "http://"+addr+"/disk-info")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 200))
+		return nil, fmt.Errorf("disk-info: bad HTTP response status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	var info protocol.DiskInfoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
 // ListGitolite lists Gitolite repositories.
 func (c *Client) ListGitolite(ctx context.Context, gitoliteHost string) (list []*gitolite.Repo, err error) {
 	// The gitserver calls the shared Gitolite server in response to this request, so
@@ -646,6 +689,30 @@ func (c *Client) Remove(ctx context.Context, repo api.RepoName) error {
 	return nil
 }
 
+// CancelClone cancels the queued or in-progress clone of repo, and returns
+// the resulting state of repo. If repo is not being cloned, nothing is
+// canceled.
+func (c *Client) CancelClone(ctx context.Context, repo api.RepoName) (*protocol.CancelCloneResponse, error) {
+	req := &protocol.CancelCloneRequest{
+		Repo: repo,
+	}
+	resp, err := c.httpPost(ctx, repo, "cancel-clone", req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// best-effort inclusion of body in error message
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 200))
+		return nil, &url.Error{URL: resp.Request.URL.String(), Op: "CancelClone", Err: fmt.Errorf("CancelClone: http status %d: %s", resp.StatusCode, string(body))}
+	}
+	var res protocol.CancelCloneResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
 // httpPost performs a POST request to a gitserver, sharding based on the given
 // repo name (the repo name is otherwise not used).
 func (c *Client) httpPost(ctx context.Context, repo api.RepoName, method string, payload interface{}) (resp *http.Response, err error) {
@@ -129,6 +129,20 @@ type RepoDeleteRequest struct {
 	Repo api.RepoName
 }
 
+// CancelCloneRequest is a request to cancel the queued or in-progress clone
+// of a repository on gitserver.
+type CancelCloneRequest struct {
+	// Repo is the repository whose clone to cancel.
+	Repo api.RepoName
+}
+
+// CancelCloneResponse is the state of a repository after a CancelCloneRequest.
+type CancelCloneResponse struct {
+	Canceled        bool // whether a clone was canceled (false if there was nothing to cancel)
+	CloneInProgress bool // whether the repository is (still or again) being cloned
+	Cloned          bool // whether the repository is cloned
+}
+
 // RepoInfo is the information requests about a single repository
 // via a RepoInfoRequest.
 type RepoInfo struct {
@@ -181,3 +195,16 @@ type CreatePatchFromPatchResponse struct {
 	// Rev is the tag that the staging object can be found at
 	Rev string
 }
+
+// DiskInfoResponse is the response of a gitserver's /disk-info endpoint. It
+// describes the file system containing the gitserver's repositories.
+type DiskInfoResponse struct {
+	FreeBytes  uint64 // space available to gitserver
+	TotalBytes uint64
+}
+
+// VersionResponse is the response of a gitserver's /version endpoint.
+type VersionResponse struct {
+	GitVersion       string // output of `git version`, such as "git version 2.20.1"
+	GitserverVersion string // the Sourcegraph version of the gitserver binary
+}
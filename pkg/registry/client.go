@@ -83,6 +83,17 @@ func (e *notFoundError) Error() string {
 	return fmt.Sprintf("extension not found with %s %q", e.field, e.value)
 }
 
+type key int
+
+const noCacheKey key = iota
+
+// WithNoCache returns a copy of ctx that causes requests to the remote registry made with it to
+// bypass the HTTP cache of HTTPClient (if any). The fresh response still replaces the cached one,
+// so later requests made without it see the refreshed data.
+func WithNoCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey, true)
+}
+
 func httpGet(ctx context.Context, op, urlStr string, result interface{}) (err error) {
 	defer func() { err = errors.Wrap(err, remoteRegistryErrorMessage) }()
 
@@ -92,6 +103,9 @@ func httpGet(ctx context.Context, op, urlStr string, result interface{}) (err er
 	}
 	req.Header.Set("Accept", AcceptHeader)
 	req.Header.Set("User-Agent", "Sourcegraph registry client v"+APIVersion)
+	if noCache, _ := ctx.Value(noCacheKey).(bool); noCache {
+		req.Header.Set("Cache-Control", "no-cache")
+	}
 
 	resp, err := ctxhttp.Do(ctx, HTTPClient, req)
 	if err != nil {
@@ -32,6 +32,29 @@ var (
 	ErrTemporarilyUnavailable = errors.New("repository temporarily unavailable")
 )
 
+// AutoUpdatesDisabledError is returned by EnqueueRepoUpdate when the update
+// of an already cloned repository was rejected because the
+// DisableAutoGitUpdates site setting is set.
+type AutoUpdatesDisabledError struct {
+	Repo api.RepoName
+}
+
+func (e *AutoUpdatesDisabledError) Error() string {
+	return fmt.Sprintf("automatic git updates are disabled, not updating cloned repo %q", e.Repo)
+}
+
+func (e *AutoUpdatesDisabledError) HTTPStatusCode() int { return http.StatusConflict }
+
+func (e *AutoUpdatesDisabledError) ErrorCode() string {
+	return protocol.RepoUpdateErrorCodeAutoUpdatesDisabled
+}
+
+// IsAutoUpdatesDisabled reports whether err is an *AutoUpdatesDisabledError.
+func IsAutoUpdatesDisabled(err error) bool {
+	_, ok := err.(*AutoUpdatesDisabledError)
+	return ok
+}
+
 // DefaultClient is the default Client. Unless overwritten, it is connected to the server specified by the
 // REPO_UPDATER_URL environment variable.
 var DefaultClient = &Client{
@@ -164,6 +187,12 @@ func (c *Client) EnqueueRepoUpdate(ctx context.Context, repo gitserver.Repo) (*p
 	}
 
 	var res protocol.RepoUpdateResponse
+	if resp.StatusCode == http.StatusConflict {
+		var e protocol.RepoUpdateError
+		if json.Unmarshal(bs, &e) == nil && e.Code == protocol.RepoUpdateErrorCodeAutoUpdatesDisabled {
+			return nil, &AutoUpdatesDisabledError{Repo: repo.Name}
+		}
+	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
 		return nil, errors.New(string(bs))
 	} else if err = json.Unmarshal(bs, &res); err != nil {
@@ -173,9 +202,11 @@ func (c *Client) EnqueueRepoUpdate(ctx context.Context, repo gitserver.Repo) (*p
 	return &res, nil
 }
 
-// SyncExternalService requests the given external service to be synced.
-func (c *Client) SyncExternalService(ctx context.Context, svc api.ExternalService) (*protocol.ExternalServiceSyncResult, error) {
-	req := &protocol.ExternalServiceSyncRequest{ExternalService: svc}
+// SyncExternalService requests the given external service to be synced. If
+// forceUpdate is true, a git fetch is also enqueued for each of its enabled
+// repositories, even if automatic git updates are disabled.
+func (c *Client) SyncExternalService(ctx context.Context, svc api.ExternalService, forceUpdate bool) (*protocol.ExternalServiceSyncResult, error) {
+	req := &protocol.ExternalServiceSyncRequest{ExternalService: svc, ForceUpdate: forceUpdate}
 	resp, err := c.httpPost(ctx, "sync-external-service", req)
 	if err != nil {
 		return nil, err
@@ -203,6 +234,31 @@ func (c *Client) SyncExternalService(ctx context.Context, svc api.ExternalServic
 	return &result, nil
 }
 
+// SyncPhabricatorMetadata requests that the Phabricator mappings of all
+// repositories on the given Gitolite host be refreshed from their metadata.
+func (c *Client) SyncPhabricatorMetadata(ctx context.Context, host string) (*protocol.PhabricatorMetadataSyncResult, error) {
+	req := protocol.PhabricatorMetadataSyncRequest{Host: host}
+	resp, err := c.httpPost(ctx, "sync-phabricator-metadata", &req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	bs, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read response body")
+	}
+
+	var res protocol.PhabricatorMetadataSyncResult
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return nil, errors.New(string(bs))
+	} else if err = json.Unmarshal(bs, &res); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
 // RepoExternalServices requests the external services associated with a
 // repository with the given id.
 func (c *Client) RepoExternalServices(ctx context.Context, id uint32) ([]api.ExternalService, error) {
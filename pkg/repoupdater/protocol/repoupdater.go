@@ -162,6 +162,18 @@ type RepoUpdateResponse struct {
 	URL string `json:"url"`
 }
 
+// RepoUpdateErrorCodeAutoUpdatesDisabled is the code of the error returned
+// (with HTTP status 409 Conflict) for a RepoUpdateRequest of an already
+// cloned repository while the DisableAutoGitUpdates site setting is set.
+const RepoUpdateErrorCodeAutoUpdatesDisabled = "auto_updates_disabled"
+
+// RepoUpdateError is the body of an error response to a RepoUpdateRequest
+// that has a machine-readable code.
+type RepoUpdateError struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
 // ExternalServiceSyncRequest is a request to sync a specific external service eagerly.
 //
 // The FrontendAPI is one of the issuers of this request. It does so when creating or
@@ -169,6 +181,11 @@ type RepoUpdateResponse struct {
 // run to see their repos being synced.
 type ExternalServiceSyncRequest struct {
 	ExternalService api.ExternalService
+
+	// ForceUpdate, if true, enqueues a git fetch for every enabled repository of
+	// the synced external service, including already cloned ones. It applies
+	// even if the disableAutoGitUpdates site config option is set.
+	ForceUpdate bool `json:",omitempty"`
 }
 
 // ExternalServiceSyncResult is a result type of an external service's sync request.
@@ -176,3 +193,25 @@ type ExternalServiceSyncResult struct {
 	ExternalService api.ExternalService
 	Error           error
 }
+
+// PhabricatorMetadataSyncRequest is a request to run the Phabricator metadata
+// command for all repositories on a Gitolite host and upsert the resulting
+// Phabricator mappings.
+type PhabricatorMetadataSyncRequest struct {
+	// Host is the Gitolite host, as configured in the Gitolite connection.
+	Host string
+}
+
+// PhabricatorMetadataSyncResult is the result of a PhabricatorMetadataSyncRequest.
+type PhabricatorMetadataSyncResult struct {
+	Repos  int                            // number of repositories considered
+	Mapped int                            // number of Phabricator mappings upserted
+	Errors []PhabricatorMetadataSyncError `json:",omitempty"`
+}
+
+// PhabricatorMetadataSyncError describes a failure to sync the Phabricator
+// metadata of a single repository.
+type PhabricatorMetadataSyncError struct {
+	Repo  api.RepoName
+	Error string
+}
@@ -2,6 +2,7 @@ package git
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"strings"
 
@@ -18,6 +19,40 @@ type ArchiveOptions struct {
 	Treeish string   // the tree or commit to produce an archive for
 	Format  string   // format of the resulting archive (usually "tar" or "zip")
 	Paths   []string // if nonempty, only include these paths
+
+	// Config is a list of "key=value" git config overrides for the archive
+	// command (as with git -c key=value). Only the keys and values accepted
+	// by CheckArchiveConfig are allowed.
+	Config []string
+}
+
+// archiveConfigValues is the allowlist of git config keys (lowercased) that
+// may be overridden for git archive, and the values they may be set to. Only
+// settings that merely affect line ending conversion are allowed; most other
+// config keys can make git run arbitrary commands.
+var archiveConfigValues = map[string][]string{
+	"core.autocrlf": {"true", "false", "input"},
+	"core.eol":      {"lf", "crlf", "native"},
+}
+
+// CheckArchiveConfig returns an error if kv is not a "key=value" git config
+// override that is allowed in ArchiveOptions.Config.
+func CheckArchiveConfig(kv string) error {
+	i := strings.Index(kv, "=")
+	if i == -1 {
+		return fmt.Errorf("invalid git config override %q (must be key=value)", kv)
+	}
+	key, value := strings.ToLower(kv[:i]), kv[i+1:]
+	allowed, ok := archiveConfigValues[key]
+	if !ok {
+		return fmt.Errorf("git config key %q may not be overridden", kv[:i])
+	}
+	for _, v := range allowed {
+		if value == v {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid value %q for git config key %q (must be one of %s)", value, kv[:i], strings.Join(allowed, ", "))
 }
 
 // archiveReader wraps the StdoutReader yielded by gitserver's
@@ -61,8 +96,15 @@ func Archive(ctx context.Context, repo gitserver.Repo, opt ArchiveOptions) (_ io
 	if err := checkSpecArgSafety(string(opt.Treeish)); err != nil {
 		return nil, err
 	}
+	var configArgs []string
+	for _, kv := range opt.Config {
+		if err := CheckArchiveConfig(kv); err != nil {
+			return nil, badRequestError{err.Error()}
+		}
+		configArgs = append(configArgs, "-c", kv)
+	}
 
-	cmd := gitserver.DefaultClient.Command("git",
+	cmd := gitserver.DefaultClient.Command("git", append(configArgs,
 		"archive",
 
 		// Suppresses fatal error when the repo contains paths matching **/.git/** and instead
@@ -73,7 +115,7 @@ func Archive(ctx context.Context, repo gitserver.Repo, opt ArchiveOptions) (_ io
 		"--worktree-attributes",
 
 		"--format="+opt.Format,
-	)
+	)...)
 	if opt.Format == "zip" {
 		// Compression level of 0 (no compression) seems to perform the
 		// best overall on fast network links, but this has not been tuned
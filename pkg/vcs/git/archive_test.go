@@ -149,3 +149,22 @@ filemode=true
 	}
 	return nil
 }
+
+func TestCheckArchiveConfig(t *testing.T) {
+	for kv, wantOK := range map[string]bool{
+		"core.autocrlf=false": true,
+		"core.autocrlf=input": true,
+		"core.autoCRLF=true":  true,
+		"core.eol=lf":         true,
+		"core.eol=crlf":       true,
+		"core.autocrlf":       false,
+		"core.autocrlf=maybe": false,
+		"core.eol=":           false,
+		"core.fsmonitor=true": false,
+		"core.sshCommand=sh":  false,
+	} {
+		if err := git.CheckArchiveConfig(kv); (err == nil) != wantOK {
+			t.Errorf("%q: got error %v, want ok %v", kv, err, wantOK)
+		}
+	}
+}
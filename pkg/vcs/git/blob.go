@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
 
 	opentracing "github.com/opentracing/opentracing-go"
@@ -31,6 +34,96 @@ func ReadFile(ctx context.Context, repo gitserver.Repo, commit api.CommitID, nam
 	return b, nil
 }
 
+// ReadBlob returns a reader of the contents of the blob with the given
+// (possibly abbreviated) SHA. The contents are streamed from gitserver; the
+// caller must close the reader. If there is no such object, a
+// *RevisionNotFoundError is returned. If the object is not a blob, a bad
+// request error is returned.
+func ReadBlob(ctx context.Context, repo gitserver.Repo, sha string) (io.ReadCloser, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Git: ReadBlob")
+	span.SetTag("sha", sha)
+	defer span.Finish()
+
+	// Check the object first, because errors from git cat-file would only
+	// surface after the response has started streaming.
+	objectType, err := GetObjectType(ctx, repo, sha)
+	if err != nil {
+		return nil, err
+	}
+	if objectType != ObjectTypeBlob {
+		return nil, badRequestError{fmt.Sprintf("object %s is a %s, not a blob", sha, objectType)}
+	}
+
+	cmd := gitserver.DefaultClient.Command("git", "cat-file", "blob", sha)
+	cmd.Repo = repo
+	return gitserver.StdoutReader(ctx, cmd)
+}
+
+// FileType describes the contents of a file, as returned by DetectFileType.
+type FileType struct {
+	IsBinary bool   // whether git considers the file binary
+	MIMEType string // sniffed from the file's contents
+	Size     int64  // in bytes
+}
+
+// fileTypeSniffLen is the number of leading bytes of a file that
+// DetectFileType inspects. It matches the length git itself inspects when
+// deciding whether a file is binary.
+const fileTypeSniffLen = 8000
+
+// DetectFileType reports whether the named file at commit is binary, using
+// the same heuristic as git (a NUL byte in the first 8000 bytes), along with
+// its sniffed MIME type and size. Only the beginning of the file is read. As
+// with Stat, symbolic links are followed. If the path is a directory or a
+// submodule, a bad request error is returned.
+func DetectFileType(ctx context.Context, repo gitserver.Repo, commit api.CommitID, name string) (*FileType, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Git: DetectFileType")
+	span.SetTag("Name", name)
+	defer span.Finish()
+
+	if err := checkSpecArgSafety(string(commit)); err != nil {
+		return nil, err
+	}
+	ensureAbsCommit(commit)
+
+	name = util.Rel(name)
+	fi, err := Lstat(ctx, repo, commit, name)
+	if err != nil {
+		return nil, err
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		target, err := readFileBytes(ctx, repo, commit, name)
+		if err != nil {
+			return nil, err
+		}
+		name = util.Rel(string(target))
+		if fi, err = Lstat(ctx, repo, commit, name); err != nil {
+			return nil, err
+		}
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, badRequestError{fmt.Sprintf("%s is not a file", name)}
+	}
+
+	cmd := gitserver.DefaultClient.Command("git", "cat-file", "blob", string(commit)+":"+name)
+	cmd.Repo = repo
+	rc, err := gitserver.StdoutReader(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	head, err := ioutil.ReadAll(io.LimitReader(rc, fileTypeSniffLen))
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileType{
+		IsBinary: bytes.IndexByte(head, 0) != -1,
+		MIMEType: http.DetectContentType(head),
+		Size:     fi.Size(),
+	}, nil
+}
+
 func readFileBytes(ctx context.Context, repo gitserver.Repo, commit api.CommitID, name string) ([]byte, error) {
 	ensureAbsCommit(commit)
 
@@ -0,0 +1,83 @@
+package git_test
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/pkg/errcode"
+	"github.com/sourcegraph/sourcegraph/pkg/vcs/git"
+)
+
+func TestReadBlob(t *testing.T) {
+	t.Parallel()
+
+	repo := makeGitRepository(t,
+		"echo x > f",
+		"git add f",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit -m foo --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+	)
+
+	for _, sha := range []string{"587be6b4c3f93f93c489c0111bba5596147a26cb", "587be6b"} {
+		rc, err := git.ReadBlob(ctx, repo, sha)
+		if err != nil {
+			t.Fatalf("%s: %s", sha, err)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("%s: %s", sha, err)
+		}
+		if want := "x\n"; string(data) != want {
+			t.Errorf("%s: got %q, want %q", sha, data, want)
+		}
+	}
+
+	if _, err := git.ReadBlob(ctx, repo, "0000000000000000000000000000000000000000"); !git.IsRevisionNotFound(err) {
+		t.Errorf("unknown SHA: got err %v, want a revision not found error", err)
+	}
+	if _, err := git.ReadBlob(ctx, repo, "a1dffc7a64c0b2d395484bf452e9aeb1da3a18f2"); !errcode.IsBadRequest(err) {
+		t.Errorf("tree SHA: got err %v, want a bad request error", err)
+	}
+}
+
+func TestDetectFileType(t *testing.T) {
+	t.Parallel()
+
+	repo := makeGitRepository(t,
+		"mkdir d",
+		"echo hello > d/text",
+		"printf 'GIF89a\\000\\001' > image.gif",
+		"ln -s d/text link",
+		"git add d image.gif link",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit -m foo --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+	)
+	commitID, err := git.ResolveRevision(ctx, repo, nil, "master", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]*git.FileType{
+		"d/text":    {IsBinary: false, MIMEType: "text/plain; charset=utf-8", Size: 6},
+		"image.gif": {IsBinary: true, MIMEType: "image/gif", Size: 8},
+		"link":      {IsBinary: false, MIMEType: "text/plain; charset=utf-8", Size: 6},
+	}
+	for path, want := range tests {
+		ft, err := git.DetectFileType(ctx, repo, commitID, path)
+		if err != nil {
+			t.Errorf("%s: %s", path, err)
+			continue
+		}
+		if !reflect.DeepEqual(ft, want) {
+			t.Errorf("%s: got %+v, want %+v", path, ft, want)
+		}
+	}
+
+	if _, err := git.DetectFileType(ctx, repo, commitID, "missing"); !os.IsNotExist(err) {
+		t.Errorf("missing file: got err %v, want not exist", err)
+	}
+	if _, err := git.DetectFileType(ctx, repo, commitID, "d"); !errcode.IsBadRequest(err) {
+		t.Errorf("directory: got err %v, want a bad request error", err)
+	}
+}
@@ -41,6 +41,7 @@ type CommitsOptions struct {
 
 	Author string // include only commits whose author matches this
 	After  string // include only commits after this date
+	Before string // include only commits before this date
 
 	Path string // only commits modifying the given path are selected (optional)
 
@@ -91,8 +92,60 @@ func GetCommit(ctx context.Context, repo gitserver.Repo, remoteURLFunc func() (s
 	return getCommit(ctx, repo, remoteURLFunc, id)
 }
 
+// GetCommits returns the commits with the given IDs, keyed by ID. The IDs must
+// be absolute commit IDs. IDs of commits that do not exist in the repository
+// are not present in the result. All commits are read with a single git
+// invocation.
+func GetCommits(ctx context.Context, repo gitserver.Repo, ids []api.CommitID) (map[api.CommitID]*Commit, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Git: GetCommits")
+	span.SetTag("Commits", len(ids))
+	defer span.Finish()
+
+	commits := make(map[api.CommitID]*Commit, len(ids))
+	if Mocks.GetCommit != nil {
+		for _, id := range ids {
+			if commit, err := Mocks.GetCommit(id); err == nil {
+				commits[id] = commit
+			}
+		}
+		return commits, nil
+	}
+
+	if len(ids) == 0 {
+		return commits, nil
+	}
+
+	args := []string{"log", logFormatWithoutRefs, "--no-walk", "--ignore-missing"}
+	for _, id := range ids {
+		if !IsAbsoluteRevision(string(id)) {
+			return nil, fmt.Errorf("non-absolute commit ID: %q", id)
+		}
+		args = append(args, string(id))
+	}
+
+	cmd := gitserver.DefaultClient.Command("git", args...)
+	cmd.Repo = repo
+	data, stderr, err := cmd.DividedOutput(ctx)
+	if err != nil {
+		return nil, errors.WithMessage(err, fmt.Sprintf("git command %v failed (stderr: %q)", cmd.Args, stderr))
+	}
+	for len(data) > 0 {
+		var commit *Commit
+		commit, _, data, err = parseCommitFromLog(data)
+		if err != nil {
+			return nil, err
+		}
+		commits[commit.ID] = commit
+	}
+	return commits, nil
+}
+
 // Commits returns all commits matching the options.
 func Commits(ctx context.Context, repo gitserver.Repo, opt CommitsOptions) ([]*Commit, error) {
+	if Mocks.Commits != nil {
+		return Mocks.Commits(opt)
+	}
+
 	span, ctx := opentracing.StartSpanFromContext(ctx, "Git: Commits")
 	span.SetTag("Opt", opt)
 	defer span.Finish()
@@ -184,6 +237,10 @@ func commitLogArgs(initialArgs []string, opt CommitsOptions) (args []string, err
 		args = append(args, "--after="+opt.After)
 	}
 
+	if opt.Before != "" {
+		args = append(args, "--before="+opt.Before)
+	}
+
 	if opt.MessageQuery != "" {
 		args = append(args, "--fixed-strings", "--regexp-ignore-case", "--grep="+opt.MessageQuery)
 	}
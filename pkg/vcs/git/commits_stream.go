@@ -0,0 +1,95 @@
+package git
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/sourcegraph/sourcegraph/pkg/api"
+	"github.com/sourcegraph/sourcegraph/pkg/gitserver"
+)
+
+// ForEachCommit calls fn for each commit reachable from commit, newest first
+// (in git log order). Unlike Commits, it streams the output of git log, so
+// memory usage does not grow with the number of commits.
+func ForEachCommit(ctx context.Context, repo gitserver.Repo, commit api.CommitID, fn func(*Commit) error) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Git: ForEachCommit")
+	span.SetTag("Commit", commit)
+	defer span.Finish()
+
+	if err := checkSpecArgSafety(string(commit)); err != nil {
+		return err
+	}
+	ensureAbsCommit(commit)
+
+	return forEachCommit(ctx, repo, fn, string(commit))
+}
+
+// ForEachCommitInRange calls fn for each commit in base..head, i.e. each
+// commit reachable from head but not from base, newest first (in git log
+// order). As with git log, if base is not an ancestor of head, the result is
+// the commits on head since the two diverged; commits that are only on base
+// are never included.
+func ForEachCommitInRange(ctx context.Context, repo gitserver.Repo, base, head api.CommitID, fn func(*Commit) error) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Git: ForEachCommitInRange")
+	span.SetTag("Base", base)
+	span.SetTag("Head", head)
+	defer span.Finish()
+
+	for _, commit := range []api.CommitID{base, head} {
+		if err := checkSpecArgSafety(string(commit)); err != nil {
+			return err
+		}
+		ensureAbsCommit(commit)
+	}
+
+	return forEachCommit(ctx, repo, fn, string(base)+".."+string(head))
+}
+
+// forEachCommit calls fn for each commit listed by git log for the given
+// revisions.
+func forEachCommit(ctx context.Context, repo gitserver.Repo, fn func(*Commit) error, revs ...string) error {
+	cmd := gitserver.DefaultClient.Command("git", append([]string{"log", logFormatWithoutRefs}, revs...)...)
+	cmd.Repo = repo
+	rc, err := gitserver.StdoutReader(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return scanCommitLog(rc, fn)
+}
+
+// scanCommitLog calls fn for each commit in r, which is git log output in
+// the logFormatWithoutRefs format.
+func scanCommitLog(r io.Reader, fn func(*Commit) error) error {
+	// Each commit is partsPerCommit NUL-terminated fields. Commit messages
+	// can be long, so allow large fields.
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	sc.Split(scanNULTerminated)
+	parts := make([]string, 0, partsPerCommit)
+	for sc.Scan() {
+		parts = append(parts, sc.Text())
+		if len(parts) < partsPerCommit {
+			continue
+		}
+		c, _, _, err := parseCommitFromLog([]byte(strings.Join(parts, "\x00")))
+		if err != nil {
+			return err
+		}
+		if err := fn(c); err != nil {
+			return err
+		}
+		parts = parts[:0]
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	if len(parts) > 0 {
+		return fmt.Errorf("truncated commit log entry: %q", parts)
+	}
+	return nil
+}
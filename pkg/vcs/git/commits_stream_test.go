@@ -0,0 +1,47 @@
+package git
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/sourcegraph/pkg/api"
+)
+
+func TestScanCommitLog(t *testing.T) {
+	out := "d9548bf3631982c183b67f162e42c5f3e2bb2403\x00\x00b\x00b@b.com\x001136300645\x00b\x00b@b.com\x001136300645\x00bar\n\nbody line\n\x00e86b31b62399cfc86199e8b6e21a35e76d0e8b5e\x00" +
+		"\ne86b31b62399cfc86199e8b6e21a35e76d0e8b5e\x00\x00a\x00a@a.com\x001136214245\x00a\x00a@a.com\x001136214245\x00foo\n\x00\x00"
+
+	var commits []*Commit
+	err := scanCommitLog(strings.NewReader(out), func(c *Commit) error {
+		commits = append(commits, c)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*Commit{
+		{
+			ID:        "d9548bf3631982c183b67f162e42c5f3e2bb2403",
+			Author:    Signature{Name: "b", Email: "b@b.com", Date: time.Unix(1136300645, 0).UTC()},
+			Committer: &Signature{Name: "b", Email: "b@b.com", Date: time.Unix(1136300645, 0).UTC()},
+			Message:   "bar\n\nbody line",
+			Parents:   []api.CommitID{"e86b31b62399cfc86199e8b6e21a35e76d0e8b5e"},
+		},
+		{
+			ID:        "e86b31b62399cfc86199e8b6e21a35e76d0e8b5e",
+			Author:    Signature{Name: "a", Email: "a@a.com", Date: time.Unix(1136214245, 0).UTC()},
+			Committer: &Signature{Name: "a", Email: "a@a.com", Date: time.Unix(1136214245, 0).UTC()},
+			Message:   "foo",
+		},
+	}
+	if !reflect.DeepEqual(commits, want) {
+		t.Errorf("got %+v, want %+v", commits, want)
+	}
+
+	if err := scanCommitLog(strings.NewReader(out[:50]), func(*Commit) error { return nil }); err == nil {
+		t.Error("got nil error for truncated log")
+	}
+}
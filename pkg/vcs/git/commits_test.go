@@ -1,6 +1,7 @@
 package git_test
 
 import (
+	"reflect"
 	"testing"
 	"time"
 
@@ -298,3 +299,49 @@ func TestRepository_Commits_options_path(t *testing.T) {
 		}
 	}
 }
+
+func TestForEachCommitInRange(t *testing.T) {
+	t.Parallel()
+
+	// master and feature have diverged: c is only on master, d and e are only
+	// on feature.
+	repo := makeGitRepository(t,
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit --allow-empty -m a --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:06Z git commit --allow-empty -m b --author='a <a@a.com>' --date 2006-01-02T15:04:06Z",
+		"git branch feature",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:07Z git commit --allow-empty -m c --author='a <a@a.com>' --date 2006-01-02T15:04:07Z",
+		"git checkout -q feature",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:08Z git commit --allow-empty -m d --author='a <a@a.com>' --date 2006-01-02T15:04:08Z",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:09Z git commit --allow-empty -m e --author='a <a@a.com>' --date 2006-01-02T15:04:09Z",
+	)
+	resolve := func(spec string) api.CommitID {
+		t.Helper()
+		commitID, err := git.ResolveRevision(ctx, repo, nil, spec, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return commitID
+	}
+	subjects := func(base, head api.CommitID) []string {
+		t.Helper()
+		var subjects []string
+		err := git.ForEachCommitInRange(ctx, repo, base, head, func(c *git.Commit) error {
+			subjects = append(subjects, c.Message)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return subjects
+	}
+
+	if got, want := subjects(resolve("master"), resolve("feature")), []string{"e", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("master..feature: got %v, want %v", got, want)
+	}
+	if got, want := subjects(resolve("feature~2"), resolve("feature")), []string{"e", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("feature~2..feature: got %v, want %v", got, want)
+	}
+	if got := subjects(resolve("feature"), resolve("feature")); len(got) != 0 {
+		t.Errorf("feature..feature: got %v, want no commits", got)
+	}
+}
@@ -0,0 +1,212 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/sourcegraph/pkg/api"
+	"github.com/sourcegraph/sourcegraph/pkg/gitserver"
+	"github.com/sourcegraph/sourcegraph/pkg/vcs"
+)
+
+// ChangedPaths returns the paths of the files that differ between commits
+// base and head. Files that were added or modified in head (including files
+// whose type changed) are returned in changed, and files that exist in base
+// but not in head are returned in deleted. Renames are reported as a deletion
+// of the old path and an addition of the new path.
+func ChangedPaths(ctx context.Context, repo gitserver.Repo, base, head api.CommitID) (changed, deleted []string, err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Git: ChangedPaths")
+	span.SetTag("Base", base)
+	span.SetTag("Head", head)
+	defer span.Finish()
+
+	if err := checkSpecArgSafety(string(base)); err != nil {
+		return nil, nil, err
+	}
+	if err := checkSpecArgSafety(string(head)); err != nil {
+		return nil, nil, err
+	}
+
+	cmd := gitserver.DefaultClient.Command("git", "diff", "--name-status", "--no-renames", "-z", string(base), string(head), "--")
+	cmd.Repo = repo
+	out, err := cmd.CombinedOutput(ctx)
+	if err != nil {
+		return nil, nil, errors.WithMessage(err, fmt.Sprintf("git command %v failed (output: %q)", cmd.Args, out))
+	}
+
+	// With -z, each entry is a status letter and a path, both terminated by
+	// a NUL byte.
+	fields := bytes.Split(bytes.TrimSuffix(out, []byte{0}), []byte{0})
+	if len(fields) == 1 && len(fields[0]) == 0 {
+		return nil, nil, nil
+	}
+	if len(fields)%2 != 0 {
+		return nil, nil, fmt.Errorf("unexpected output from git diff --name-status: %q", out)
+	}
+	for i := 0; i < len(fields); i += 2 {
+		status, path := fields[i], string(fields[i+1])
+		if len(status) > 0 && status[0] == 'D' {
+			deleted = append(deleted, path)
+		} else {
+			changed = append(changed, path)
+		}
+	}
+	return changed, deleted, nil
+}
+
+// DiffStat summarizes the differences between two commits.
+type DiffStat struct {
+	FilesChanged int // number of files added, modified or deleted
+	Additions    int // number of lines added
+	Deletions    int // number of lines deleted
+}
+
+// GetDiffStat returns the DiffStat of the changes from commit base to commit
+// head. Binary files count as changed files, but not towards the line counts.
+func GetDiffStat(ctx context.Context, repo gitserver.Repo, base, head api.CommitID) (*DiffStat, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Git: GetDiffStat")
+	span.SetTag("Base", base)
+	span.SetTag("Head", head)
+	defer span.Finish()
+
+	if err := checkSpecArgSafety(string(base)); err != nil {
+		return nil, err
+	}
+	if err := checkSpecArgSafety(string(head)); err != nil {
+		return nil, err
+	}
+
+	cmd := gitserver.DefaultClient.Command("git", "diff", "--numstat", "--no-renames", "-z", string(base), string(head), "--")
+	cmd.Repo = repo
+	out, err := cmd.CombinedOutput(ctx)
+	if err != nil {
+		return nil, errors.WithMessage(err, fmt.Sprintf("git command %v failed (output: %q)", cmd.Args, out))
+	}
+
+	// With -z, each entry is "added<TAB>deleted<TAB>path" terminated by a
+	// NUL byte. The counts are "-" for binary files.
+	var stat DiffStat
+	for _, line := range bytes.Split(out, []byte{0}) {
+		if len(line) == 0 {
+			continue
+		}
+		fields := bytes.SplitN(line, []byte{'\t'}, 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("unexpected output from git diff --numstat: %q", out)
+		}
+		stat.FilesChanged++
+		for i, n := range []*int{&stat.Additions, &stat.Deletions} {
+			if string(fields[i]) == "-" {
+				continue
+			}
+			v, err := strconv.Atoi(string(fields[i]))
+			if err != nil {
+				return nil, fmt.Errorf("unexpected output from git diff --numstat: %q", out)
+			}
+			*n += v
+		}
+	}
+	return &stat, nil
+}
+
+// emptyTreeID is the ID of the empty tree object (`git hash-object -t tree
+// /dev/null`). It is used as the base when diffing a root commit.
+const emptyTreeID = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// RawDiff returns a reader of the unified diff of the changes from commit base
+// to commit head, optionally limited to path (a file or directory). If base is
+// empty, head is diffed against its first parent (or against the empty tree if
+// it is a root commit). The diff is streamed from gitserver; the caller must
+// close the reader.
+func RawDiff(ctx context.Context, repo gitserver.Repo, base, head api.CommitID, path string) (io.ReadCloser, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Git: RawDiff")
+	span.SetTag("Base", base)
+	span.SetTag("Head", head)
+	span.SetTag("Path", path)
+	defer span.Finish()
+
+	if err := checkSpecArgSafety(string(base)); err != nil {
+		return nil, err
+	}
+	if err := checkSpecArgSafety(string(head)); err != nil {
+		return nil, err
+	}
+
+	if base == "" {
+		commit, err := getCommit(ctx, repo, nil, head)
+		if err != nil {
+			return nil, err
+		}
+		if len(commit.Parents) > 0 {
+			base = commit.Parents[0]
+		} else {
+			base = emptyTreeID
+		}
+	}
+
+	return streamDiff(ctx, repo, string(base), string(head), path)
+}
+
+// ResolveTree returns the ID of the tree that treeish (such as a branch, a
+// tag, a commit ID or a tree ID) refers to. If treeish does not refer to a
+// tree or to an object that can be peeled to one, a *RevisionNotFoundError is
+// returned.
+func ResolveTree(ctx context.Context, repo gitserver.Repo, treeish string) (string, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Git: ResolveTree")
+	span.SetTag("Treeish", treeish)
+	defer span.Finish()
+
+	if err := checkSpecArgSafety(treeish); err != nil {
+		return "", err
+	}
+
+	cmd := gitserver.DefaultClient.Command("git", "rev-parse", "--verify", "--quiet", treeish+"^{tree}")
+	cmd.Repo = repo
+	stdout, stderr, err := cmd.DividedOutput(ctx)
+	if err != nil {
+		if vcs.IsRepoNotExist(err) {
+			return "", err
+		}
+		// With --quiet, exit status 1 means that treeish does not resolve
+		// to a tree.
+		if cmd.ExitStatus == 1 {
+			return "", &RevisionNotFoundError{Repo: repo.Name, Spec: treeish}
+		}
+		return "", errors.WithMessage(err, fmt.Sprintf("git command %v failed (stderr: %q)", cmd.Args, stderr))
+	}
+	return string(bytes.TrimSpace(stdout)), nil
+}
+
+// RawTreeDiff is like RawDiff, but returns the diff between two trees (as
+// returned by ResolveTree), which need not belong to related commits.
+func RawTreeDiff(ctx context.Context, repo gitserver.Repo, treeA, treeB, path string) (io.ReadCloser, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Git: RawTreeDiff")
+	span.SetTag("TreeA", treeA)
+	span.SetTag("TreeB", treeB)
+	span.SetTag("Path", path)
+	defer span.Finish()
+
+	if err := checkSpecArgSafety(treeA); err != nil {
+		return nil, err
+	}
+	if err := checkSpecArgSafety(treeB); err != nil {
+		return nil, err
+	}
+	return streamDiff(ctx, repo, treeA, treeB, path)
+}
+
+// streamDiff streams the output of git diff between a and b, optionally
+// limited to path.
+func streamDiff(ctx context.Context, repo gitserver.Repo, a, b, path string) (io.ReadCloser, error) {
+	cmd := gitserver.DefaultClient.Command("git", "diff", "--no-color", "--no-ext-diff", a, b, "--")
+	if path != "" {
+		cmd.Args = append(cmd.Args, path)
+	}
+	cmd.Repo = repo
+	return gitserver.StdoutReader(ctx, cmd)
+}
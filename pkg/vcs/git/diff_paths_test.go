@@ -0,0 +1,245 @@
+package git_test
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/sourcegraph/sourcegraph/pkg/api"
+	"github.com/sourcegraph/sourcegraph/pkg/vcs/git"
+)
+
+func TestChangedPaths(t *testing.T) {
+	t.Parallel()
+
+	repo := makeGitRepository(t,
+		"echo a > a",
+		"echo b > b",
+		"echo c > c",
+		"git add a b c",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit -m commit1 --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+		"git tag base",
+		"echo a2 > a",
+		"git rm -q b",
+		"git mv c 'd e'",
+		"mkdir f",
+		"echo g > f/g",
+		"git add a f/g",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit -m commit2 --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+	)
+	base, err := git.ResolveRevision(ctx, repo, nil, "base", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := git.ResolveRevision(ctx, repo, nil, "master", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed, deleted, err := git.ChangedPaths(ctx, repo, base, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "d e", "f/g"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("got changed %q, want %q", changed, want)
+	}
+	if want := []string{"b", "c"}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("got deleted %q, want %q", deleted, want)
+	}
+
+	changed, deleted, err = git.ChangedPaths(ctx, repo, head, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 0 || len(deleted) != 0 {
+		t.Errorf("got changed %q and deleted %q, want none", changed, deleted)
+	}
+}
+
+func TestGetDiffStat(t *testing.T) {
+	t.Parallel()
+
+	repo := makeGitRepository(t,
+		"printf 'a\\nb\\nc\\n' > a",
+		"echo b > b",
+		"git add a b",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit -m commit1 --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+		"git tag base",
+		"printf 'a\\nc\\nd\\ne\\n' > a",
+		"git rm -q b",
+		"printf '\\000\\001' > bin",
+		"git add a bin",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit -m commit2 --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+	)
+	base, err := git.ResolveRevision(ctx, repo, nil, "base", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := git.ResolveRevision(ctx, repo, nil, "master", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stat, err := git.GetDiffStat(ctx, repo, base, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (git.DiffStat{FilesChanged: 3, Additions: 2, Deletions: 2}); *stat != want {
+		t.Errorf("got %+v, want %+v", *stat, want)
+	}
+
+	stat, err = git.GetDiffStat(ctx, repo, head, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (git.DiffStat{}); *stat != want {
+		t.Errorf("got %+v, want %+v", *stat, want)
+	}
+}
+
+func TestRawDiff(t *testing.T) {
+	t.Parallel()
+
+	repo := makeGitRepository(t,
+		"echo a > a",
+		"git add a",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit -m commit1 --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+		"git tag base",
+		"echo a2 > a",
+		"mkdir d",
+		"echo b > d/b",
+		"git add a d/b",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit -m commit2 --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+	)
+	base, err := git.ResolveRevision(ctx, repo, nil, "base", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := git.ResolveRevision(ctx, repo, nil, "master", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rawDiff := func(base, head api.CommitID, path string) string {
+		t.Helper()
+		rc, err := git.RawDiff(ctx, repo, base, head, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+		out, err := ioutil.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+
+	const diffA = `diff --git a/a b/a
+index 7898192..c1827f0 100644
+--- a/a
++++ b/a
+@@ -1 +1 @@
+-a
++a2
+`
+	const diffB = `diff --git a/d/b b/d/b
+new file mode 100644
+index 0000000..6178079
+--- /dev/null
++++ b/d/b
+@@ -0,0 +1 @@
++b
+`
+	tests := map[string]struct {
+		base, head api.CommitID
+		path       string
+		want       string
+	}{
+		"range":          {base: base, head: head, want: diffA + diffB},
+		"parent":         {head: head, want: diffA + diffB},
+		"path":           {base: base, head: head, path: "d", want: diffB},
+		"root commit":    {head: base, want: "diff --git a/a b/a\nnew file mode 100644\nindex 0000000..7898192\n--- /dev/null\n+++ b/a\n@@ -0,0 +1 @@\n+a\n"},
+		"no changes":     {base: head, head: head},
+		"unmatched path": {base: base, head: head, path: "nonexistent"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := rawDiff(test.base, test.head, test.path); got != test.want {
+				t.Errorf("got diff %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRawTreeDiff(t *testing.T) {
+	t.Parallel()
+
+	// The two branches have no common history.
+	repo := makeGitRepository(t,
+		"mkdir d",
+		"echo a > d/a",
+		"echo b > b",
+		"git add d/a b",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit -m commit1 --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+		"git checkout --orphan other",
+		"git rm -q -f b",
+		"echo a2 > d/a",
+		"git add d/a",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit -m commit2 --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+	)
+	treeA, err := git.ResolveTree(ctx, repo, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	treeB, err := git.ResolveTree(ctx, repo, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rawTreeDiff := func(path string) string {
+		t.Helper()
+		rc, err := git.RawTreeDiff(ctx, repo, treeA, treeB, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+		out, err := ioutil.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+
+	const diffA = `diff --git a/d/a b/d/a
+index 7898192..c1827f0 100644
+--- a/d/a
++++ b/d/a
+@@ -1 +1 @@
+-a
++a2
+`
+	if got, want := rawTreeDiff("d"), diffA; got != want {
+		t.Errorf("got diff %q, want %q", got, want)
+	}
+	const diffB = `diff --git a/b b/b
+deleted file mode 100644
+index 6178079..0000000
+--- a/b
++++ /dev/null
+@@ -1 +0,0 @@
+-b
+`
+	if got, want := rawTreeDiff(""), diffB+diffA; got != want {
+		t.Errorf("got diff %q, want %q", got, want)
+	}
+
+	// A tree ID is a tree-ish, but a blob is not.
+	if tree, err := git.ResolveTree(ctx, repo, treeA); err != nil || tree != treeA {
+		t.Errorf("got tree %q (error %v), want %q", tree, err, treeA)
+	}
+	for _, treeish := range []string{"nonexistent", "master:b"} {
+		if _, err := git.ResolveTree(ctx, repo, treeish); !git.IsRevisionNotFound(err) {
+			t.Errorf("%s: got error %v, want revision not found", treeish, err)
+		}
+	}
+}
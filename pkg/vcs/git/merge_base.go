@@ -11,7 +11,12 @@ import (
 	"github.com/sourcegraph/sourcegraph/pkg/gitserver"
 )
 
-// MergeBase returns the merge base commit for the specified commits.
+// ErrNoMergeBase is returned by MergeBase when the commits have no common
+// ancestor.
+var ErrNoMergeBase = errors.New("commits have no common ancestor")
+
+// MergeBase returns the merge base commit for the specified commits. If they
+// have no common ancestor, it returns ErrNoMergeBase.
 func MergeBase(ctx context.Context, repo gitserver.Repo, a, b api.CommitID) (api.CommitID, error) {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "Git: MergeBase")
 	span.SetTag("A", a)
@@ -22,7 +27,32 @@ func MergeBase(ctx context.Context, repo gitserver.Repo, a, b api.CommitID) (api
 	cmd.Repo = repo
 	out, err := cmd.CombinedOutput(ctx)
 	if err != nil {
+		// Exit status 1 with no output means there is no merge base.
+		if cmd.ExitStatus == 1 && len(out) == 0 {
+			return "", ErrNoMergeBase
+		}
 		return "", errors.WithMessage(err, fmt.Sprintf("git command %v failed (output: %q)", cmd.Args, out))
 	}
 	return api.CommitID(bytes.TrimSpace(out)), nil
 }
+
+// IsAncestor returns whether commit a is an ancestor of (i.e., reachable from)
+// commit b. A commit is considered an ancestor of itself.
+func IsAncestor(ctx context.Context, repo gitserver.Repo, a, b api.CommitID) (bool, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Git: IsAncestor")
+	span.SetTag("A", a)
+	span.SetTag("B", b)
+	defer span.Finish()
+
+	cmd := gitserver.DefaultClient.Command("git", "merge-base", "--is-ancestor", "--", string(a), string(b))
+	cmd.Repo = repo
+	out, err := cmd.CombinedOutput(ctx)
+	if err != nil {
+		// Exit status 1 with no output means a is not an ancestor of b.
+		if cmd.ExitStatus == 1 && len(out) == 0 {
+			return false, nil
+		}
+		return false, errors.WithMessage(err, fmt.Sprintf("git command %v failed (output: %q)", cmd.Args, out))
+	}
+	return true, nil
+}
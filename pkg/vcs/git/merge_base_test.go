@@ -71,3 +71,28 @@ func TestMerger_MergeBase(t *testing.T) {
 		}
 	}
 }
+
+func TestMerger_MergeBase_none(t *testing.T) {
+	t.Parallel()
+
+	repo := makeGitRepository(t,
+		"echo line1 > f",
+		"git add f",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit -m foo --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+		"git checkout -q --orphan b2",
+		"echo line2 > g",
+		"git add g",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit -m bar --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+	)
+	a, err := git.ResolveRevision(ctx, repo, nil, "master", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := git.ResolveRevision(ctx, repo, nil, "b2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := git.MergeBase(ctx, repo, a, b); err != git.ErrNoMergeBase {
+		t.Errorf("got error %v, want ErrNoMergeBase", err)
+	}
+}
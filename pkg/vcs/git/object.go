@@ -9,6 +9,7 @@ import (
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/sourcegraph/sourcegraph/pkg/gitserver"
+	"github.com/sourcegraph/sourcegraph/pkg/vcs"
 )
 
 // OID is a Git OID (40-char hex-encoded).
@@ -62,3 +63,32 @@ func GetObject(ctx context.Context, repo gitserver.Repo, objectName string) (oid
 	objectType = ObjectType(string(bytes.TrimSpace(out)))
 	return oid, objectType, nil
 }
+
+// GetObjectType returns the type of the object with the given (possibly
+// abbreviated) SHA. If there is no such object, a *RevisionNotFoundError is
+// returned.
+func GetObjectType(ctx context.Context, repo gitserver.Repo, sha string) (ObjectType, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Git: GetObjectType")
+	span.SetTag("sha", sha)
+	defer span.Finish()
+
+	if err := checkSpecArgSafety(sha); err != nil {
+		return "", err
+	}
+
+	cmd := gitserver.DefaultClient.Command("git", "cat-file", "-t", "--", sha)
+	cmd.Repo = repo
+	stdout, stderr, err := cmd.DividedOutput(ctx)
+	if err != nil {
+		if vcs.IsRepoNotExist(err) {
+			return "", err
+		}
+		// The message depends on whether the SHA is abbreviated (and on the
+		// git version).
+		if bytes.Contains(stderr, []byte("Not a valid object name")) || bytes.Contains(stderr, []byte("could not get object info")) {
+			return "", &RevisionNotFoundError{Repo: repo.Name, Spec: sha}
+		}
+		return "", errors.WithMessage(err, fmt.Sprintf("git command %v failed (stderr: %q)", cmd.Args, stderr))
+	}
+	return ObjectType(bytes.TrimSpace(stdout)), nil
+}
@@ -44,3 +44,33 @@ func TestGetObject(t *testing.T) {
 		})
 	}
 }
+
+func TestGetObjectType(t *testing.T) {
+	t.Parallel()
+
+	repo := makeGitRepository(t,
+		"echo x > f",
+		"git add f",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit -m foo --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+	)
+	tests := map[string]git.ObjectType{
+		"e86b31b62399cfc86199e8b6e21a35e76d0e8b5e": git.ObjectTypeCommit,
+		"a1dffc7a64c0b2d395484bf452e9aeb1da3a18f2": git.ObjectTypeTree,
+		"587be6b4c3f93f93c489c0111bba5596147a26cb": git.ObjectTypeBlob,
+		"e86b31b": git.ObjectTypeCommit, // abbreviated
+	}
+	for sha, want := range tests {
+		objectType, err := git.GetObjectType(ctx, repo, sha)
+		if err != nil {
+			t.Errorf("%s: %s", sha, err)
+			continue
+		}
+		if objectType != want {
+			t.Errorf("%s: got object type %q, want %q", sha, objectType, want)
+		}
+	}
+
+	if _, err := git.GetObjectType(ctx, repo, "0000000000000000000000000000000000000000"); !git.IsRevisionNotFound(err) {
+		t.Errorf("got err %v, want a revision not found error", err)
+	}
+}
@@ -247,6 +247,158 @@ func ListTags(ctx context.Context, repo gitserver.Repo) ([]*Tag, error) {
 	return tags, nil
 }
 
+// ListTagsContaining returns the names of the tags whose history includes
+// commit, sorted by name.
+func ListTagsContaining(ctx context.Context, repo gitserver.Repo, commit api.CommitID) ([]string, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Git: ListTagsContaining")
+	span.SetTag("Commit", commit)
+	defer span.Finish()
+
+	if err := checkSpecArgSafety(string(commit)); err != nil {
+		return nil, err
+	}
+
+	cmd := gitserver.DefaultClient.Command("git", "tag", "--list", "--contains", string(commit))
+	cmd.Repo = repo
+	out, err := cmd.CombinedOutput(ctx)
+	if err != nil {
+		if vcs.IsRepoNotExist(err) {
+			return nil, err
+		}
+		return nil, errors.WithMessage(err, fmt.Sprintf("git command %v failed (output: %q)", cmd.Args, out))
+	}
+
+	out = bytes.TrimSuffix(out, []byte("\n"))
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return strings.Split(string(out), "\n"), nil
+}
+
+// ListBranchesContaining returns the names of the branches whose history
+// includes commit, sorted by name. Unlike ListBranches with ContainsCommit,
+// it returns no branches (instead of all of them) for a commit that is on no
+// branch.
+func ListBranchesContaining(ctx context.Context, repo gitserver.Repo, commit api.CommitID) ([]string, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Git: ListBranchesContaining")
+	span.SetTag("Commit", commit)
+	defer span.Finish()
+
+	if err := checkSpecArgSafety(string(commit)); err != nil {
+		return nil, err
+	}
+
+	cmd := gitserver.DefaultClient.Command("git", "for-each-ref", "--format=%(refname)", "--contains", string(commit), "refs/heads/")
+	cmd.Repo = repo
+	out, err := cmd.CombinedOutput(ctx)
+	if err != nil {
+		if vcs.IsRepoNotExist(err) {
+			return nil, err
+		}
+		return nil, errors.WithMessage(err, fmt.Sprintf("git command %v failed (output: %q)", cmd.Args, out))
+	}
+
+	out = bytes.TrimSuffix(out, []byte("\n"))
+	if len(out) == 0 {
+		return nil, nil
+	}
+	lines := strings.Split(string(out), "\n")
+	branches := make([]string, len(lines))
+	for i, line := range lines {
+		branches[i] = strings.TrimPrefix(line, "refs/heads/")
+	}
+	return branches, nil
+}
+
+// A Ref is a git reference, such as a branch or a tag.
+type Ref struct {
+	Name     string       // full name, such as "refs/heads/master"
+	CommitID api.CommitID // the commit the ref points to (annotated tags are peeled)
+	Type     RefType
+}
+
+// RefType is the kind of a Ref.
+type RefType string
+
+const (
+	RefTypeBranch RefType = "branch"
+	RefTypeTag    RefType = "tag"
+	RefTypeOther  RefType = "other"
+)
+
+// refTypePrefixes maps each RefType (except RefTypeOther) to the prefix of
+// the names of refs of that type.
+var refTypePrefixes = map[RefType]string{
+	RefTypeBranch: "refs/heads/",
+	RefTypeTag:    "refs/tags/",
+}
+
+// ListRefs returns the refs of the repository, sorted by name. If types is
+// non-empty, only refs of those types are returned.
+func ListRefs(ctx context.Context, repo gitserver.Repo, types ...RefType) ([]*Ref, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Git: ListRefs")
+	defer span.Finish()
+
+	// Let git filter by prefix unless refs of other types (which can be
+	// anywhere) are requested, in which case we filter below.
+	var patterns []string
+	for _, t := range types {
+		prefix, ok := refTypePrefixes[t]
+		if !ok {
+			patterns = nil
+			break
+		}
+		patterns = append(patterns, prefix)
+	}
+	args := append([]string{"for-each-ref", "--sort", "refname", "--format", "%(if)%(*objectname)%(then)%(*objectname)%(else)%(objectname)%(end)%00%(refname)"}, patterns...)
+	cmd := gitserver.DefaultClient.Command("git", args...)
+	cmd.Repo = repo
+	out, err := cmd.CombinedOutput(ctx)
+	if err != nil {
+		if vcs.IsRepoNotExist(err) {
+			return nil, err
+		}
+		return nil, errors.WithMessage(err, fmt.Sprintf("git command %v failed (output: %q)", cmd.Args, out))
+	}
+
+	out = bytes.TrimSuffix(out, []byte("\n")) // remove trailing newline
+	if len(out) == 0 {
+		return nil, nil // no refs
+	}
+	lines := bytes.Split(out, []byte("\n"))
+	refs := make([]*Ref, 0, len(lines))
+	for _, line := range lines {
+		parts := bytes.SplitN(line, []byte("\x00"), 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid git for-each-ref output line: %q", line)
+		}
+		ref := &Ref{Name: string(parts[1]), CommitID: api.CommitID(parts[0]), Type: refType(string(parts[1]))}
+		if len(types) > 0 && !containsRefType(types, ref.Type) {
+			continue
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+func refType(name string) RefType {
+	for t, prefix := range refTypePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return t
+		}
+	}
+	return RefTypeOther
+}
+
+func containsRefType(types []RefType, t RefType) bool {
+	for _, t2 := range types {
+		if t2 == t {
+			return true
+		}
+	}
+	return false
+}
+
 type byteSlices [][]byte
 
 func (p byteSlices) Len() int           { return len(p) }
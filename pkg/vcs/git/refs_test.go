@@ -44,6 +44,48 @@ func TestRepository_ListBranches(t *testing.T) {
 	}
 }
 
+func TestRepository_ListRefs(t *testing.T) {
+	t.Parallel()
+
+	repo := makeGitRepository(t,
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit --allow-empty -m foo --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+		"git branch b0",
+		"git tag t0",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git tag -a t1 -m t1",
+		"git update-ref refs/pull/1/head HEAD",
+	)
+	const commit = "ea167fe3d76b1e5fd3ed8ca44cbd2fe3897684f8"
+	branches := []*git.Ref{
+		{Name: "refs/heads/b0", CommitID: commit, Type: git.RefTypeBranch},
+		{Name: "refs/heads/master", CommitID: commit, Type: git.RefTypeBranch},
+	}
+	other := []*git.Ref{{Name: "refs/pull/1/head", CommitID: commit, Type: git.RefTypeOther}}
+	tags := []*git.Ref{
+		{Name: "refs/tags/t0", CommitID: commit, Type: git.RefTypeTag},
+		{Name: "refs/tags/t1", CommitID: commit, Type: git.RefTypeTag}, // annotated tags are peeled
+	}
+
+	tests := map[string]struct {
+		types []git.RefType
+		want  []*git.Ref
+	}{
+		"all":      {want: append(append(append([]*git.Ref(nil), branches...), other...), tags...)},
+		"branches": {types: []git.RefType{git.RefTypeBranch}, want: branches},
+		"tags":     {types: []git.RefType{git.RefTypeTag}, want: tags},
+		"other":    {types: []git.RefType{git.RefTypeOther}, want: other},
+	}
+	for label, test := range tests {
+		refs, err := git.ListRefs(ctx, repo, test.types...)
+		if err != nil {
+			t.Errorf("%s: ListRefs: %s", label, err)
+			continue
+		}
+		if !reflect.DeepEqual(refs, test.want) {
+			t.Errorf("%s: got refs == %v, want %v", label, asJSON(refs), asJSON(test.want))
+		}
+	}
+}
+
 func TestRepository_Branches_MergedInto(t *testing.T) {
 	t.Parallel()
 
@@ -242,6 +284,72 @@ func TestRepository_Branches_IncludeCommit(t *testing.T) {
 	}
 }
 
+func TestRepository_ListBranchesContaining(t *testing.T) {
+	t.Parallel()
+
+	gitCommands := []string{
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit --allow-empty -m base --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit --allow-empty -m master --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+		"git checkout HEAD^ -b branch2",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit --allow-empty -m branch2 --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+		"git checkout --orphan orphan",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit --allow-empty -m orphan --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+		"git tag orphaned", // keeps the commit, but on no branch
+		"git checkout master",
+		"git branch -D orphan",
+	}
+	repo := makeGitRepository(t, gitCommands...)
+
+	for _, test := range []struct {
+		commit       api.CommitID
+		wantBranches []string
+	}{
+		{commit: "2816a72df28f699722156e545d038a5203b959de", wantBranches: []string{"branch2", "master"}},
+		{commit: "1224d334dfe08f4693968ea618ad63ae86ec16ca", wantBranches: []string{"master"}},
+		{commit: "a98236b3ed97430c58e85418b146e1319a9876f0", wantBranches: nil},
+	} {
+		branches, err := git.ListBranchesContaining(ctx, repo, test.commit)
+		if err != nil {
+			t.Errorf("%s: ListBranchesContaining: %s", test.commit, err)
+			continue
+		}
+		if !reflect.DeepEqual(branches, test.wantBranches) {
+			t.Errorf("%s: got branches == %v, want %v", test.commit, branches, test.wantBranches)
+		}
+	}
+}
+
+func TestRepository_ListTagsContaining(t *testing.T) {
+	t.Parallel()
+
+	gitCommands := []string{
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit --allow-empty -m base --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+		"git tag v1",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit --allow-empty -m master --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+		"git tag v2",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit --allow-empty -m untagged --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+	}
+	repo := makeGitRepository(t, gitCommands...)
+
+	for _, test := range []struct {
+		commit   api.CommitID
+		wantTags []string
+	}{
+		{commit: "2816a72df28f699722156e545d038a5203b959de", wantTags: []string{"v1", "v2"}},
+		{commit: "1224d334dfe08f4693968ea618ad63ae86ec16ca", wantTags: []string{"v2"}},
+		{commit: "47446b7e4b3c8b54c9db8480d79f26cc690f0f58", wantTags: nil},
+	} {
+		tags, err := git.ListTagsContaining(ctx, repo, test.commit)
+		if err != nil {
+			t.Errorf("%s: ListTagsContaining: %s", test.commit, err)
+			continue
+		}
+		if !reflect.DeepEqual(tags, test.wantTags) {
+			t.Errorf("%s: got tags == %v, want %v", test.commit, tags, test.wantTags)
+		}
+	}
+}
+
 func TestRepository_ListTags(t *testing.T) {
 	t.Parallel()
 
@@ -7,6 +7,7 @@ import (
 	"os"
 	stdlibpath "path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -293,3 +294,48 @@ func lsTreeUncached(ctx context.Context, repo gitserver.Repo, commit api.CommitI
 
 	return fis, nil
 }
+
+// ListSubmodules returns the submodules declared in the .gitmodules file at
+// commit, sorted by path. Only the Path and URL fields of each Submodule are
+// set. If there is no .gitmodules file, it returns no submodules.
+func ListSubmodules(ctx context.Context, repo gitserver.Repo, commit api.CommitID) ([]Submodule, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Git: ListSubmodules")
+	span.SetTag("Commit", commit)
+	defer span.Finish()
+
+	data, err := ReadFile(ctx, repo, commit, ".gitmodules")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var cfg config.Config
+	if err := config.NewDecoder(bytes.NewReader(data)).Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("error parsing .gitmodules: %s", err)
+	}
+	var submodules []Submodule
+	for _, s := range cfg.Section("submodule").Subsections {
+		if path := s.Option("path"); path != "" {
+			submodules = append(submodules, Submodule{Path: path, URL: s.Option("url")})
+		}
+	}
+	sort.Slice(submodules, func(i, j int) bool { return submodules[i].Path < submodules[j].Path })
+	return submodules, nil
+}
+
+// ListSubmodulePaths returns the paths of the submodules declared in the
+// .gitmodules file at commit, sorted. If there is no .gitmodules file, it
+// returns no paths.
+func ListSubmodulePaths(ctx context.Context, repo gitserver.Repo, commit api.CommitID) ([]string, error) {
+	submodules, err := ListSubmodules(ctx, repo, commit)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, s := range submodules {
+		paths = append(paths, s.Path)
+	}
+	return paths, nil
+}
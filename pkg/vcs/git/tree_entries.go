@@ -0,0 +1,174 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/sourcegraph/sourcegraph/pkg/api"
+	"github.com/sourcegraph/sourcegraph/pkg/gitserver"
+	"github.com/sourcegraph/sourcegraph/pkg/vcs/util"
+)
+
+// TreeEntry is an entry of a git tree, as reported by git ls-tree.
+type TreeEntry struct {
+	Path string // full path from the repository root
+	Mode string // octal git file mode, such as "100644"
+	Type string // "blob", "tree" or "commit" (for submodules)
+	Size int64  // size of blobs in bytes; -1 for other types
+	SHA  string // object ID
+}
+
+// ForEachTreeEntry calls fn for each entry under path (recursively, including
+// subtrees) in the tree of commit. An empty path means the repository root.
+// Unlike ReadDir, it streams the output of git ls-tree, so memory usage does
+// not grow with the size of the tree.
+func ForEachTreeEntry(ctx context.Context, repo gitserver.Repo, commit api.CommitID, path string, fn func(TreeEntry) error) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Git: ForEachTreeEntry")
+	span.SetTag("Commit", commit)
+	span.SetTag("Path", path)
+	defer span.Finish()
+
+	if err := checkSpecArgSafety(string(commit)); err != nil {
+		return err
+	}
+	ensureAbsCommit(commit)
+
+	args := []string{"ls-tree", "--long", "--full-name", "-z", "-r", "-t", string(commit)}
+	if path != "" {
+		// Trailing slash is necessary to ls-tree under the dir.
+		path = filepath.Clean(util.Rel(path)) + "/"
+		if err := checkSpecArgSafety(path); err != nil {
+			return err
+		}
+		args = append(args, "--", filepath.ToSlash(path))
+	}
+	cmd := gitserver.DefaultClient.Command("git", args...)
+	cmd.Repo = repo
+	rc, err := gitserver.StdoutReader(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	sc := bufio.NewScanner(rc)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	sc.Split(scanNULTerminated)
+	for sc.Scan() {
+		entry, err := parseTreeEntry(sc.Text())
+		if err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// LargestFiles returns the n largest blobs in the tree of commit, largest
+// first. Blobs of equal size are ordered by path. Like ForEachTreeEntry, it
+// streams the tree, so memory usage only grows with n.
+func LargestFiles(ctx context.Context, repo gitserver.Repo, commit api.CommitID, n int) ([]TreeEntry, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Git: LargestFiles")
+	span.SetTag("Commit", commit)
+	span.SetTag("N", n)
+	defer span.Finish()
+
+	var h largestBlobs
+	err := ForEachTreeEntry(ctx, repo, commit, "", func(e TreeEntry) error {
+		h.add(e, n)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return h.sorted(), nil
+}
+
+// largestBlobs is a min-heap of the largest blobs seen so far.
+type largestBlobs []TreeEntry
+
+// add adds e to h if it is a blob and among the n largest blobs seen so far.
+func (h *largestBlobs) add(e TreeEntry, n int) {
+	if e.Type != "blob" || n <= 0 {
+		return
+	}
+	if h.Len() < n {
+		heap.Push(h, e)
+		return
+	}
+	if smallerBlob((*h)[0], e) {
+		(*h)[0] = e
+		heap.Fix(h, 0)
+	}
+}
+
+// sorted returns the blobs in h, largest first.
+func (h largestBlobs) sorted() []TreeEntry {
+	entries := append([]TreeEntry(nil), h...)
+	sort.Slice(entries, func(i, j int) bool { return smallerBlob(entries[j], entries[i]) })
+	return entries
+}
+
+func (h largestBlobs) Len() int            { return len(h) }
+func (h largestBlobs) Less(i, j int) bool  { return smallerBlob(h[i], h[j]) }
+func (h largestBlobs) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *largestBlobs) Push(x interface{}) { *h = append(*h, x.(TreeEntry)) }
+func (h *largestBlobs) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// smallerBlob orders blobs by size. Among blobs of equal size, the one with
+// the greater path is smaller, so that the ones with lesser paths are kept.
+func smallerBlob(a, b TreeEntry) bool {
+	if a.Size != b.Size {
+		return a.Size < b.Size
+	}
+	return a.Path > b.Path
+}
+
+// parseTreeEntry parses a line of `git ls-tree --long -z` output.
+func parseTreeEntry(line string) (TreeEntry, error) {
+	tabPos := strings.IndexByte(line, '\t')
+	if tabPos == -1 {
+		return TreeEntry{}, fmt.Errorf("invalid `git ls-tree` output: %q", line)
+	}
+	info := strings.Fields(line[:tabPos])
+	if len(info) != 4 {
+		return TreeEntry{}, fmt.Errorf("invalid `git ls-tree` output: %q", line)
+	}
+	entry := TreeEntry{Path: line[tabPos+1:], Mode: info[0], Type: info[1], SHA: info[2], Size: -1}
+	if !IsAbsoluteRevision(entry.SHA) {
+		return TreeEntry{}, fmt.Errorf("invalid `git ls-tree` oid output: %q", entry.SHA)
+	}
+	if info[3] != "-" {
+		size, err := strconv.ParseInt(info[3], 10, 64)
+		if err != nil || size < 0 {
+			return TreeEntry{}, fmt.Errorf("invalid `git ls-tree` size output: %q", info[3])
+		}
+		entry.Size = size
+	}
+	return entry, nil
+}
+
+// scanNULTerminated is a bufio.SplitFunc for NUL-terminated records.
+func scanNULTerminated(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,76 @@
+package git
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTreeEntries(t *testing.T) {
+	out := "100644 blob e69de29bb2d1d6434b8b29ae775ad8c2e48c5391       0\ta b.txt\x00" +
+		"040000 tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904       -\tdir\x00" +
+		"160000 commit 2e8a3c6d5e2a0b9f1c6e1d3f7b1a0c9d8e7f6a5b       -\tdir/sub\x00"
+
+	sc := bufio.NewScanner(strings.NewReader(out))
+	sc.Split(scanNULTerminated)
+	var entries []TreeEntry
+	for sc.Scan() {
+		entry, err := parseTreeEntry(sc.Text())
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []TreeEntry{
+		{Path: "a b.txt", Mode: "100644", Type: "blob", Size: 0, SHA: "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"},
+		{Path: "dir", Mode: "040000", Type: "tree", Size: -1, SHA: "4b825dc642cb6eb9a060e54bf8d69288fbee4904"},
+		{Path: "dir/sub", Mode: "160000", Type: "commit", Size: -1, SHA: "2e8a3c6d5e2a0b9f1c6e1d3f7b1a0c9d8e7f6a5b"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("got %+v, want %+v", entries, want)
+	}
+
+	if _, err := parseTreeEntry("garbage"); err == nil {
+		t.Error("got nil error for invalid line")
+	}
+}
+
+func TestLargestBlobs(t *testing.T) {
+	entries := []TreeEntry{
+		{Path: "a", Type: "blob", Size: 10},
+		{Path: "dir", Type: "tree", Size: -1},
+		{Path: "b", Type: "blob", Size: 30},
+		{Path: "dir/c", Type: "blob", Size: 20},
+		{Path: "sub", Type: "commit", Size: -1},
+		{Path: "dir/d", Type: "blob", Size: 30},
+		{Path: "e", Type: "blob", Size: 0},
+	}
+	paths := func(n int) []string {
+		var h largestBlobs
+		for _, e := range entries {
+			h.add(e, n)
+		}
+		var paths []string
+		for _, e := range h.sorted() {
+			paths = append(paths, e.Path)
+		}
+		return paths
+	}
+
+	tests := map[int][]string{
+		0:  nil,
+		1:  {"b"},
+		3:  {"b", "dir/d", "dir/c"},
+		10: {"b", "dir/d", "dir/c", "a", "e"},
+	}
+	for n, want := range tests {
+		if got := paths(n); !reflect.DeepEqual(got, want) {
+			t.Errorf("n=%d: got %v, want %v", n, got, want)
+		}
+	}
+}
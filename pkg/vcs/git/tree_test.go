@@ -450,5 +450,44 @@ func TestRepository_FileSystem_gitSubmodules(t *testing.T) {
 			t.Errorf("%s: fs.Open(submod): %s", label, err)
 			continue
 		}
+
+		paths, err := git.ListSubmodulePaths(ctx, test.repo, commitID)
+		if err != nil {
+			t.Errorf("%s: ListSubmodulePaths: %s", label, err)
+			continue
+		}
+		if want := []string{"submod"}; !reflect.DeepEqual(paths, want) {
+			t.Errorf("%s: ListSubmodulePaths: got %q, want %q", label, paths, want)
+		}
+
+		submodules, err := git.ListSubmodules(ctx, test.repo, commitID)
+		if err != nil {
+			t.Errorf("%s: ListSubmodules: %s", label, err)
+			continue
+		}
+		if want := []git.Submodule{{Path: "submod", URL: filepath.ToSlash(submodDir)}}; !reflect.DeepEqual(submodules, want) {
+			t.Errorf("%s: ListSubmodules: got %+v, want %+v", label, submodules, want)
+		}
+	}
+}
+
+func TestListSubmodulePaths_none(t *testing.T) {
+	t.Parallel()
+
+	repo := makeGitRepository(t,
+		"touch f",
+		"git add f",
+		"GIT_COMMITTER_NAME=a GIT_COMMITTER_EMAIL=a@a.com GIT_COMMITTER_DATE=2006-01-02T15:04:05Z git commit -m commit1 --author='a <a@a.com>' --date 2006-01-02T15:04:05Z",
+	)
+	commitID, err := git.ResolveRevision(ctx, repo, nil, "master", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths, err := git.ListSubmodulePaths(ctx, repo, commitID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 0 {
+		t.Errorf("got %q, want no paths", paths)
 	}
 }
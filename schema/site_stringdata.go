@@ -68,6 +68,15 @@ const SiteSchemaJSON = `{
       "type": "boolean",
       "group": "External services"
     },
+    "git.accessAllowlist": {
+      "description": "A list of glob patterns (such as \"github.com/myorg/*\") of the repositories that may be archived, cloned or resolved through the frontend's internal git endpoints. Patterns are case-insensitive and * also matches /. If empty or unset, all repositories are allowed.",
+      "type": "array",
+      "items": {
+        "type": "string"
+      },
+      "group": "Security",
+      "examples": [["github.com/myorg/*", "gitlab.example.com/team/project"]]
+    },
     "git.cloneURLToRepositoryName": {
       "description": "JSON array of configuration that maps from Git clone URL to repository name. Sourcegraph automatically resolves remote clone URLs to their proper code host. However, there may be non-remote clone URLs (e.g., in submodule declarations) that Sourcegraph cannot automatically map to a code host. In this case, use this field to specify the mapping. The mappings are tried in the order they are specified and take precedence over automatic mappings.",
       "type": "array",
@@ -114,6 +123,12 @@ const SiteSchemaJSON = `{
       "default": 1,
       "group": "External services"
     },
+    "repos.createdWebhookURL": {
+      "description": "A URL to which a JSON description of each newly added repository is POSTed (on a best-effort basis). It is not called for repositories that already existed.",
+      "type": "string",
+      "format": "uri",
+      "group": "External services"
+    },
     "maxReposToSearch": {
       "description": "The maximum number of repositories to search across. The user is prompted to narrow their query if exceeded. Any value less than or equal to zero means unlimited.",
       "type": "integer",